@@ -2,12 +2,16 @@
 	2024 Kasyanov Nikolay Alexeyevich (Unbewohnte)
 */
 
+// Identifies this tab, so that it can ignore pushed changes it made itself
+const clientID = Date.now().toString(36) + Math.random().toString(36).slice(2);
+
 async function post(url, json) {
     return fetch(url, {
         method: "POST",
         credentials: "include",
         headers: {
             "Content-Type": "application/json",
+            "X-Client-ID": clientID,
         },
         body: JSON.stringify(json)
     })
@@ -18,7 +22,25 @@ async function postEmailVerification(email, code) {
 }
 
 async function postNewTodo(newTodo) {
-    return post("/api/todo/create", newTodo)
+    return sendOrQueue(() => post("/api/todo/create", newTodo), {
+        "type": "create",
+        "todo": {
+            "groupId": newTodo.groupId,
+            "text": newTodo.text,
+            "dueUnix": newTodo.dueUnix || 0,
+            "dueHasTime": newTodo.dueHasTime || false,
+            "dueDate": newTodo.dueDate,
+            "dueTime": newTodo.dueTime,
+        },
+    });
+}
+
+async function quickAddTodo(input, groupId) {
+    return post("/api/todo/quickadd", {"input": String(input), "groupId": Number(groupId)});
+}
+
+async function previewQuickAddTodo(input, groupId) {
+    return post("/api/todo/quickadd/preview", {"input": String(input), "groupId": Number(groupId)});
 }
 
 async function postNewGroup(newGroup) {
@@ -33,10 +55,17 @@ async function doLogin(userInformation) {
     return post("/api/user/login", userInformation)
 }
 
+async function postPasswordReset(token, password) {
+    return post("/api/user/resetpassword", {"token": token, "password": password});
+}
+
 async function get(url) {
     return fetch(url, {
         method: "GET",
         credentials: "include",
+        headers: {
+            "X-Client-ID": clientID,
+        },
     })
 }
 
@@ -62,12 +91,13 @@ async function del(url) {
         credentials: "include",
         headers: {
             "Content-Type": "application/json",
+            "X-Client-ID": clientID,
         },
     })
 }
 
 async function deleteTodo(id) {
-    return del("/api/todo/delete/"+id);
+    return sendOrQueue(() => del("/api/todo/delete/"+id), {"type": "delete", "todoId": Number(id)});
 }
 
 async function deleteAccount() {
@@ -83,11 +113,16 @@ async function update(url, json) {
 }
 
 async function updateTodo(id, updatedTodo) {
-    return update("/api/todo/update/"+id, updatedTodo);
+    return sendOrQueue(() => update("/api/todo/update/"+id, updatedTodo), {"type": "update", "todoId": Number(id), "todo": updatedTodo});
+}
+
+async function getTodosInRange(from, to) {
+    let query = new URLSearchParams({"from": from, "to": to});
+    return get("/api/todo/range?"+query.toString());
 }
 
 async function markAsDone(id) {
-    return update("/api/todo/markdone/"+id);
+    return sendOrQueue(() => update("/api/todo/markdone/"+id), {"type": "update", "todoId": Number(id), "todo": {"isDone": true}});
 }
 
 async function updateGroup(id, updatedGroup) {
@@ -98,6 +133,215 @@ async function updateUser(updatedUser) {
     return update("/api/user/update", updatedUser);
 }
 
+async function moveTodo(id, columnId) {
+    return post("/api/todo/move/"+id, {"columnId": Number(columnId)});
+}
+
+async function setGroupBoardView(id, boardView) {
+    return post("/api/group/board/"+id, {"boardView": boardView});
+}
+
+async function getBoard(groupId) {
+    return get("/api/board/get/"+groupId);
+}
+
+async function createBoardColumn(groupId, column) {
+    return post("/api/board/column/create/"+groupId, column);
+}
+
+async function updateBoardColumn(id, column) {
+    return post("/api/board/column/update/"+id, column);
+}
+
+async function deleteBoardColumn(id) {
+    return post("/api/board/column/delete/"+id);
+}
+
+async function restoreTodo(id) {
+    return post("/api/todo/restore/"+id);
+}
+
+async function restoreGroup(id) {
+    return post("/api/group/restore/"+id);
+}
+
+async function archiveTodo(id) {
+    return post("/api/todo/archive/"+id);
+}
+
+async function snoozeTodo(id, until, startUnix = 0) {
+    return post("/api/todo/snooze/"+id, {"until": String(until), "startUnix": Number(startUnix)});
+}
+
+async function uploadTodoImage(id, file) {
+    let data = new FormData();
+    data.append("image", file);
+    return fetch("/api/todo/image/"+id, {
+        method: "POST",
+        credentials: "include",
+        headers: {
+            "X-Client-ID": clientID,
+        },
+        body: data,
+    });
+}
+
+async function deleteTodoImage(id) {
+    return post("/api/todo/image/delete/"+id);
+}
+
+async function getTodoSketch(id) {
+    return get("/api/todo/sketch/"+id);
+}
+
+async function saveTodoSketch(id, sketch) {
+    return post("/api/todo/sketch/"+id, sketch);
+}
+
+async function getTodoComments(id) {
+    return get("/api/todo/comments/"+id);
+}
+
+async function commentTodo(id, body) {
+    return post("/api/todo/comment/"+id, {"body": String(body)});
+}
+
+async function updateTodoComment(id, body) {
+    return post("/api/comment/update/"+id, {"body": String(body)});
+}
+
+async function deleteTodoComment(id) {
+    return post("/api/comment/delete/"+id);
+}
+
+async function getTodoTimeline(id) {
+    return get("/api/todo/timeline/"+id);
+}
+
+async function unarchiveTodo(id) {
+    return post("/api/todo/unarchive/"+id);
+}
+
+async function archiveGroupCompleted(id) {
+    return post("/api/group/archive/"+id);
+}
+
+async function searchArchive(text, from, to) {
+    let query = new URLSearchParams({"q": text, "from": from, "to": to});
+    return get("/api/archive/search?"+query.toString());
+}
+
+async function getStats(days, weeks) {
+    let query = new URLSearchParams({"days": days, "weeks": weeks});
+    return get("/api/stats?"+query.toString());
+}
+
+async function getTrash() {
+    return get("/api/trash/get");
+}
+
+async function emptyTrash() {
+    return post("/api/trash/empty");
+}
+
 async function userSetNotify(value) {
     return post("/api/user/notify", {"notify": Boolean(value)});
-}
\ No newline at end of file
+}
+
+async function userSetAutoArchive(days) {
+    return post("/api/user/autoarchive", {"days": Number(days)});
+}
+
+async function userSetTimezone(timezone) {
+    return post("/api/user/timezone", {"timezone": String(timezone)});
+}
+
+async function userSetDigest(frequency) {
+    return post("/api/user/digest", {"digestFrequency": Number(frequency)});
+}
+
+async function userGetAuditEvents() {
+    return get("/api/user/audit");
+}
+
+async function retryOutboxEmail(id) {
+    return post("/api/admin/outbox/retry/"+id);
+}
+
+async function deleteOutboxEmail(id) {
+    return del("/api/admin/outbox/delete/"+id);
+}
+
+async function adminGetUsers() {
+    return get("/api/admin/users/get");
+}
+
+async function adminGetAuditEvents(limit, offset) {
+    return get("/api/admin/audit/get?limit="+Number(limit)+"&offset="+Number(offset));
+}
+
+async function adminVerifyUser(email) {
+    return post("/api/admin/user/verify", {"email": String(email)});
+}
+
+async function adminToggleUserDisabled(email) {
+    return post("/api/admin/user/disable", {"email": String(email)});
+}
+
+async function adminDeleteUser(email) {
+    return post("/api/admin/user/delete", {"email": String(email)});
+}
+
+async function adminResetUserPassword(email) {
+    return post("/api/admin/user/resetpassword", {"email": String(email)});
+}
+
+async function adminResendVerification(email) {
+    return post("/api/admin/user/resendverification", {"email": String(email)});
+}
+
+async function adminBackup() {
+    return post("/api/admin/backup/create", {});
+}
+
+async function adminToggleUserRole(email) {
+    return post("/api/admin/user/role", {"email": String(email)});
+}
+
+/*
+Listens for changes of user's data made in other tabs or by other sessions.
+onChange receives {action, targetType, targetId, data}; onReset is called when
+some changes could not be delivered and everything should be reloaded.
+EventSource reconnects by itself and resumes after the last received event
+*/
+function subscribeToChanges(onChange, onReset) {
+    const source = new EventSource("/api/events");
+    source.addEventListener("change", (event) => {
+        const change = JSON.parse(event.data);
+        if (change.clientId === clientID) {
+            return;
+        }
+        onChange(change);
+    });
+    source.addEventListener("reset", () => {
+        onReset();
+    });
+    return source;
+}
+
+let pendingReload = null;
+
+// Reloads the page once no dialog is open, so that nothing the user is typing is lost
+function reloadWhenIdle() {
+    if (pendingReload !== null) {
+        return;
+    }
+
+    pendingReload = setTimeout(function tryReload() {
+        if (document.querySelector(".modal.show") !== null) {
+            pendingReload = setTimeout(tryReload, 1000);
+            return;
+        }
+        window.location.reload();
+    }, 300);
+}
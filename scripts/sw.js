@@ -0,0 +1,91 @@
+/*
+	2025 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+*/
+
+// Bump to drop caches of previous versions
+const cacheName = "dela-v4";
+
+// Needed by every page, so are cached right away
+const appShell = [
+    "/scripts/api.js",
+    "/scripts/auth.js",
+    "/scripts/sync.js",
+    "/static/bootstrap/css/bootstrap.min.css",
+    "/static/bootstrap/js/bootstrap.bundle.min.js",
+    "/static/fonts/Roboto-Regular.ttf",
+    "/static/images/favicon.ico",
+    "/static/images/android-chrome-192x192.png",
+    "/static/manifest.webmanifest",
+];
+
+self.addEventListener("install", (event) => {
+    event.waitUntil(
+        caches.open(cacheName)
+            .then((cache) => cache.addAll(appShell))
+            .then(() => self.skipWaiting())
+    );
+});
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((names) => Promise.all(
+                names.filter((name) => name !== cacheName).map((name) => caches.delete(name))
+            ))
+            .then(() => self.clients.claim())
+    );
+});
+
+// Pages: fresh when online, the last seen version when offline
+async function networkFirst(request) {
+    const cache = await caches.open(cacheName);
+    try {
+        const response = await fetch(request);
+        if (response.ok && !response.redirected) {
+            cache.put(request, response.clone());
+        }
+        return response;
+    } catch (error) {
+        const cached = await cache.match(request, {"ignoreSearch": true});
+        if (cached) {
+            return cached;
+        }
+        // Not visited yet, show the main page instead
+        const main = await cache.match("/");
+        return main || Response.error();
+    }
+}
+
+// Scripts and static files: cached right away, refreshed in the background
+async function staleWhileRevalidate(request) {
+    const cache = await caches.open(cacheName);
+    const cached = await cache.match(request);
+    const fresh = fetch(request)
+        .then((response) => {
+            if (response.ok) {
+                cache.put(request, response.clone());
+            }
+            return response;
+        })
+        .catch(() => cached);
+
+    return cached || fresh;
+}
+
+self.addEventListener("fetch", (event) => {
+    const url = new URL(event.request.url);
+    if (event.request.method !== "GET" || url.origin !== self.location.origin) {
+        return;
+    }
+
+    // API responses are never cached, TODOs are kept by sync.js instead
+    if (url.pathname.startsWith("/api/")) {
+        return;
+    }
+
+    if (event.request.mode === "navigate") {
+        event.respondWith(networkFirst(event.request));
+    } else if (url.pathname.startsWith("/static/") || url.pathname.startsWith("/scripts/")) {
+        event.respondWith(staleWhileRevalidate(event.request));
+    }
+});
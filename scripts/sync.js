@@ -0,0 +1,263 @@
+/*
+	2025 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+*/
+
+/*
+Offline storage of user's TODOs and groups. They are mirrored into IndexedDB by pulling
+changes since the last cursor. Changes made without a connection are applied to the mirror and
+queued as mutations with unique IDs, then pushed in order once the server is reachable.
+The server never applies a mutation with the same ID twice, so pushing again is safe
+*/
+
+const offlineDBName = "dela";
+const offlineDBVersion = 2;
+const maxPushedMutations = 500;
+
+function idbRequest(request) {
+    return new Promise((resolve, reject) => {
+        request.onsuccess = () => resolve(request.result);
+        request.onerror = () => reject(request.error);
+    });
+}
+
+let offlineDB = null;
+
+function openOfflineDB() {
+    if (offlineDB !== null) {
+        return offlineDB;
+    }
+
+    const request = indexedDB.open(offlineDBName, offlineDBVersion);
+    request.onupgradeneeded = (event) => {
+        const database = request.result;
+        if (event.oldVersion < 1) {
+            database.createObjectStore("todos", {"keyPath": "id"});
+            database.createObjectStore("queue", {"keyPath": "seq", "autoIncrement": true});
+            database.createObjectStore("meta");
+        }
+        if (event.oldVersion < 2) {
+            database.createObjectStore("groups", {"keyPath": "id"});
+        }
+    };
+    offlineDB = idbRequest(request);
+    return offlineDB;
+}
+
+async function offlineStore(name, mode = "readonly") {
+    const database = await openOfflineDB();
+    return database.transaction(name, mode).objectStore(name);
+}
+
+function newMutationID() {
+    if (window.crypto && crypto.randomUUID) {
+        return crypto.randomUUID();
+    }
+    return Date.now().toString(36) + "-" + Math.random().toString(36).slice(2);
+}
+
+// All mirrored TODOs, including the ones created offline with negative IDs
+async function offlineTodos() {
+    return idbRequest((await offlineStore("todos")).getAll());
+}
+
+// Mutations waiting to be pushed, oldest first
+async function queuedMutations() {
+    return idbRequest((await offlineStore("queue")).getAll());
+}
+
+// Applies the mutation to the mirror and queues it to be pushed
+async function queueMutation(mutation) {
+    const todos = await offlineStore("todos", "readwrite");
+    const now = Math.floor(Date.now() / 1000);
+
+    if (mutation.type === "create") {
+        // Will be replaced with the real one after the push
+        const localID = -Date.now();
+        await idbRequest(todos.put(Object.assign({}, mutation.todo, {"id": localID, "timeCreatedUnix": now})));
+        mutation = {"type": "create", "localId": localID, "todo": mutation.todo};
+    } else {
+        const todo = await idbRequest(todos.get(mutation.todoId));
+        if (todo !== undefined) {
+            if (mutation.type === "delete") {
+                todo.deletedAtUnix = now;
+            } else {
+                Object.assign(todo, mutation.todo);
+            }
+            await idbRequest(todos.put(todo));
+        }
+
+        if (mutation.todoId < 0) {
+            // Not created on the server yet, change the queued creation instead
+            const queue = await offlineStore("queue", "readwrite");
+            for (const queued of await idbRequest(queue.getAll())) {
+                if (queued.localId !== mutation.todoId) {
+                    continue;
+                }
+                if (mutation.type === "delete") {
+                    await idbRequest(queue.delete(queued.seq));
+                    await idbRequest((await offlineStore("todos", "readwrite")).delete(mutation.todoId));
+                } else {
+                    Object.assign(queued.todo, mutation.todo);
+                    await idbRequest(queue.put(queued));
+                }
+                return;
+            }
+        }
+    }
+
+    mutation.id = newMutationID();
+    await idbRequest((await offlineStore("queue", "readwrite")).add(mutation));
+}
+
+// Pushes queued mutations. Returns how many were pushed
+async function pushMutations() {
+    // The server accepts a limited number at once, the rest go with the next sync
+    const queued = (await queuedMutations()).slice(0, maxPushedMutations);
+    if (queued.length === 0) {
+        return 0;
+    }
+
+    const response = await post("/api/todo/sync", {"mutations": queued.map((mutation) => ({
+        "id": mutation.id,
+        "type": mutation.type,
+        "todoId": mutation.todoId || 0,
+        "todo": mutation.todo || null,
+    }))});
+    if (!response.ok) {
+        return 0;
+    }
+
+    // Mutations are done with whatever happened to them: conflicts and rejections are final
+    const results = (await response.json()).results;
+    for (let i = 0; i < results.length; i++) {
+        await idbRequest((await offlineStore("queue", "readwrite")).delete(queued[i].seq));
+        if (queued[i].localId) {
+            // The real one comes with the next pull
+            await idbRequest((await offlineStore("todos", "readwrite")).delete(queued[i].localId));
+        }
+    }
+
+    return results.length;
+}
+
+// All mirrored groups
+async function offlineGroups() {
+    return idbRequest((await offlineStore("groups")).getAll());
+}
+
+// Brings the mirror up to date with the server
+async function pullChanges() {
+    let cursor = await idbRequest((await offlineStore("meta")).get("cursor")) || 0;
+
+    while (true) {
+        const response = await get("/api/sync?since=" + cursor);
+        if (!response.ok) {
+            return;
+        }
+        const changes = await response.json();
+
+        const database = await openOfflineDB();
+        const transaction = database.transaction(["todos", "groups", "meta"], "readwrite");
+        const todos = transaction.objectStore("todos");
+        const groups = transaction.objectStore("groups");
+        if (changes.reset) {
+            // The server does not know the cursor, everything comes again
+            todos.clear();
+            groups.clear();
+        }
+        for (const todo of changes.todos) {
+            todos.put(todo);
+        }
+        for (const group of changes.groups) {
+            groups.put(group);
+        }
+        for (const id of changes.deletedTodos) {
+            todos.delete(id);
+        }
+        for (const id of changes.deletedGroups) {
+            groups.delete(id);
+        }
+        transaction.objectStore("meta").put(changes.cursor, "cursor");
+        await new Promise((resolve, reject) => {
+            transaction.oncomplete = resolve;
+            transaction.onerror = () => reject(transaction.error);
+        });
+
+        cursor = changes.cursor;
+        if (!changes.more) {
+            return;
+        }
+    }
+}
+
+let syncInProgress = null;
+
+// Pushes queued changes and pulls the ones made elsewhere. Returns how many changes were pushed
+function syncTodos() {
+    if (syncInProgress === null) {
+        syncInProgress = (async () => {
+            try {
+                const pushed = await pushMutations();
+                await pullChanges();
+                return pushed;
+            } catch (error) {
+                // Still offline
+                return 0;
+            } finally {
+                syncInProgress = null;
+            }
+        })();
+    }
+
+    return syncInProgress;
+}
+
+// Sends the request, or queues the mutation if the server can't be reached
+async function sendOrQueue(request, mutation) {
+    let queued = [];
+    try {
+        queued = await queuedMutations();
+    } catch (error) {
+        // No IndexedDB, ie: in private mode. Can only work online
+        return request();
+    }
+
+    if (queued.length > 0) {
+        // Must not overtake changes made earlier
+        await queueMutation(mutation);
+        syncTodos();
+        return new Response(null, {"status": 202});
+    }
+
+    try {
+        return await request();
+    } catch (error) {
+        await queueMutation(mutation);
+        return new Response(null, {"status": 202});
+    }
+}
+
+// Drops everything stored for offline use. Must be called on log out
+async function forgetOfflineData() {
+    if (offlineDB !== null) {
+        (await offlineDB).close();
+        offlineDB = null;
+    }
+    indexedDB.deleteDatabase(offlineDBName);
+
+    if ("caches" in window) {
+        for (const name of await caches.keys()) {
+            await caches.delete(name);
+        }
+    }
+}
+
+if ("serviceWorker" in navigator) {
+    navigator.serviceWorker.register("/sw.js");
+}
+
+window.addEventListener("online", async () => {
+    if (await syncTodos() > 0) {
+        reloadWhenIdle();
+    }
+});
@@ -0,0 +1,328 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package client talks to a dela server over its versioned HTTP API
+package client
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/misc"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Path of the versioned API on the server
+const APIPath string = "/api/v1"
+
+// How long a single request may take by default
+const DefaultTimeout time.Duration = time.Second * 30
+
+// Error returned by the server
+type Error struct {
+	// HTTP status of the response
+	Status int
+	// Machine-readable code, ie: "not_found". Empty if the server did not send one
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server responded with %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Code, e.Status, e.Message)
+}
+
+// Client of a single user
+type Client struct {
+	// Address of the server, ie: https://dela.example.com
+	BaseURL string
+	Email   string
+	// SHA-256 of the password in hex. Pages hash passwords before sending them, so the server only knows this
+	Password string
+	HTTP     *http.Client
+}
+
+// Creates a new client for the user with given email and password
+func New(baseURL string, email string, password string) *Client {
+	return &Client{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Email:    email,
+		Password: misc.HashPassword(password),
+		HTTP:     &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// Creates a new client from the value of the auth cookie: email and hashed password separated by a colon
+func NewFromToken(baseURL string, token string) (*Client, error) {
+	email, password, ok := strings.Cut(token, ":")
+	if !ok || email == "" || password == "" {
+		return nil, fmt.Errorf("token must be in the form of email:password-hash")
+	}
+
+	api := New(baseURL, email, "")
+	api.Password = password
+	return api, nil
+}
+
+// Sends the request with JSON body if in is not nil and decodes JSON response into out if it is not nil
+func (c *Client) do(method string, route string, query url.Values, in interface{}, out interface{}) error {
+	requestURL := c.BaseURL + APIPath + route
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		inBytes, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(inBytes)
+	}
+
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Email, c.Password)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errorFromResponse(resp.StatusCode, respBytes)
+	}
+
+	if out == nil || len(respBytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBytes, out)
+}
+
+// Decodes an API error, falling back to the plain text of the body
+func errorFromResponse(status int, body []byte) *Error {
+	var apiError struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err := json.Unmarshal(body, &apiError)
+	if err == nil && apiError.Error.Code != "" {
+		return &Error{
+			Status:  status,
+			Code:    apiError.Error.Code,
+			Message: apiError.Error.Message,
+		}
+	}
+
+	return &Error{
+		Status:  status,
+		Message: strings.TrimSpace(string(body)),
+	}
+}
+
+func idPath(collection string, id uint64, action string) string {
+	route := fmt.Sprintf("/%s/%d", collection, id)
+	if action != "" {
+		route += "/" + action
+	}
+	return route
+}
+
+// Returns the user the client acts as
+func (c *Client) User() (*db.User, error) {
+	var user db.User
+	err := c.do(http.MethodGet, "/user", nil, nil, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Which TODOs are listed
+type TodosFilter struct {
+	// Include archived TODOs
+	Archived bool
+	// Include TODOs that are snoozed and not started yet
+	Deferred bool
+}
+
+// Returns TODOs of the user that are not in the trash
+func (c *Client) Todos(filter TodosFilter) ([]*db.Todo, error) {
+	query := url.Values{}
+	if filter.Archived {
+		query.Set("archived", "true")
+	}
+	if filter.Deferred {
+		query.Set("deferred", "true")
+	}
+
+	var todos []*db.Todo
+	err := c.do(http.MethodGet, "/todos", query, nil, &todos)
+	if err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// Returns a single TODO
+func (c *Client) Todo(id uint64) (*db.Todo, error) {
+	var todo db.Todo
+	err := c.do(http.MethodGet, idPath("todos", id, ""), nil, nil, &todo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &todo, nil
+}
+
+// Creates a new TODO in todo.GroupID and returns it as it was saved
+func (c *Client) CreateTodo(todo db.Todo) (*db.Todo, error) {
+	var created db.Todo
+	err := c.do(http.MethodPost, "/todos", nil, &todo, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// Creates a new TODO from a line of text with due date, priority and recurrence written in it
+func (c *Client) QuickAdd(input string, groupID uint64) (*db.Todo, error) {
+	request := struct {
+		Input   string `json:"input"`
+		GroupID uint64 `json:"groupId"`
+	}{
+		Input:   input,
+		GroupID: groupID,
+	}
+
+	var created db.Todo
+	err := c.do(http.MethodPost, "/todos/quickadd", nil, &request, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// Changes of a TODO. Only the set fields are changed
+type TodoUpdate struct {
+	GroupID       *uint64 `json:"groupId,omitempty"`
+	Text          *string `json:"text,omitempty"`
+	DueUnix       *uint64 `json:"dueUnix,omitempty"`
+	DueHasTime    *bool   `json:"dueHasTime,omitempty"`
+	Priority      *uint64 `json:"priority,omitempty"`
+	IsDone        *bool   `json:"isDone,omitempty"`
+	RecurUnit     *string `json:"recurUnit,omitempty"`
+	RecurInterval *uint64 `json:"recurInterval,omitempty"`
+}
+
+// Changes the set fields of a TODO
+func (c *Client) UpdateTodo(id uint64, update TodoUpdate) error {
+	return c.do(http.MethodPatch, idPath("todos", id, ""), nil, &update, nil)
+}
+
+// Puts a TODO into another group
+func (c *Client) MoveTodo(id uint64, groupID uint64) error {
+	return c.UpdateTodo(id, TodoUpdate{GroupID: &groupID})
+}
+
+// Marks a TODO as done. The next occurrence of recurring TODOs is created by the server
+func (c *Client) MarkTodoDone(id uint64) error {
+	return c.do(http.MethodPost, idPath("todos", id, "done"), nil, nil, nil)
+}
+
+// Moves a TODO to the trash
+func (c *Client) DeleteTodo(id uint64) error {
+	return c.do(http.MethodDelete, idPath("todos", id, ""), nil, nil, nil)
+}
+
+// Brings a TODO back from the trash
+func (c *Client) RestoreTodo(id uint64) error {
+	return c.do(http.MethodPost, idPath("todos", id, "restore"), nil, nil, nil)
+}
+
+// Returns groups of the user that are not in the trash
+func (c *Client) Groups() ([]*db.TodoGroup, error) {
+	var groups []*db.TodoGroup
+	err := c.do(http.MethodGet, "/groups", nil, nil, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// Returns a single group
+func (c *Client) Group(id uint64) (*db.TodoGroup, error) {
+	var group db.TodoGroup
+	err := c.do(http.MethodGet, idPath("groups", id, ""), nil, nil, &group)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// Creates a new group and returns it as it was saved
+func (c *Client) CreateGroup(name string) (*db.TodoGroup, error) {
+	var created db.TodoGroup
+	err := c.do(http.MethodPost, "/groups", nil, &db.TodoGroup{Name: name}, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// Changes the name of a group
+func (c *Client) RenameGroup(id uint64, name string) error {
+	return c.do(http.MethodPatch, idPath("groups", id, ""), nil, map[string]string{"name": name}, nil)
+}
+
+// Moves a group with all of its TODOs to the trash
+func (c *Client) DeleteGroup(id uint64) error {
+	return c.do(http.MethodDelete, idPath("groups", id, ""), nil, nil, nil)
+}
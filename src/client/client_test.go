@@ -0,0 +1,122 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"Unbewohnte/dela/db"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var lastMethod, lastPath, lastBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		email, password, ok := req.BasicAuth()
+		if !ok || email != "a@b.c" || password != "password123" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"unauthorized","message":"Invalid user auth data"}}`))
+			return
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		lastMethod, lastPath, lastBody = req.Method, req.URL.Path, string(body)
+
+		switch req.URL.Path {
+		case "/api/v1/todos":
+			if req.Method == http.MethodPost {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":7,"groupId":1,"text":"Buy milk"}`))
+				return
+			}
+			w.Write([]byte(`[{"id":7,"groupId":1,"text":"Buy milk"}]`))
+		case "/api/v1/todos/404":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"not_found","message":"No such TODO"}}`))
+		case "/api/v1/todos/500":
+			http.Error(w, "Something broke", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	api, err := NewFromToken(server.URL+"/", "a@b.c:password123")
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	created, err := api.CreateTodo(db.Todo{GroupID: 1, Text: "Buy milk"})
+	if err != nil {
+		t.Fatalf("failed to create TODO: %s", err)
+	}
+	if created.ID != 7 || lastMethod != http.MethodPost || lastPath != "/api/v1/todos" {
+		t.Fatalf("unexpected creation: %+v via %s %s", created, lastMethod, lastPath)
+	}
+
+	todos, err := api.Todos(TodosFilter{})
+	if err != nil || len(todos) != 1 || todos[0].Text != "Buy milk" {
+		t.Fatalf("unexpected TODOs %+v: %v", todos, err)
+	}
+
+	// Only the group is sent when moving
+	err = api.MoveTodo(7, 2)
+	if err != nil {
+		t.Fatalf("failed to move TODO: %s", err)
+	}
+	var sent map[string]interface{}
+	json.Unmarshal([]byte(lastBody), &sent)
+	if lastMethod != http.MethodPatch || lastPath != "/api/v1/todos/7" || len(sent) != 1 || sent["groupId"] != float64(2) {
+		t.Fatalf("unexpected move: %s %s %s", lastMethod, lastPath, lastBody)
+	}
+
+	err = api.MarkTodoDone(7)
+	if err != nil || lastPath != "/api/v1/todos/7/done" {
+		t.Fatalf("failed to mark TODO as done via %s: %v", lastPath, err)
+	}
+
+	// Errors keep their codes
+	var apiErr *Error
+	_, err = api.Todo(404)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code != "not_found" {
+		t.Fatalf("expected not_found error, got %v", err)
+	}
+	_, err = api.Todo(500)
+	if !errors.As(err, &apiErr) || apiErr.Code != "" || apiErr.Message != "Something broke" {
+		t.Fatalf("expected plain-text error, got %v", err)
+	}
+
+	api.Password = "wrong"
+	_, err = api.Groups()
+	if !errors.As(err, &apiErr) || apiErr.Code != "unauthorized" {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+
+	// Passwords are sent the way pages send them
+	if New(server.URL, "a@b.c", "password123").Password != "ef92b778bafe771e89245b89ecbc08a44a4e166c06659911881f383d4473e94f" {
+		t.Fatal("password was not hashed")
+	}
+	if _, err := NewFromToken(server.URL, "no-password"); err == nil {
+		t.Fatal("token without password was accepted")
+	}
+}
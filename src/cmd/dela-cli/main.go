@@ -0,0 +1,427 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Command line client of dela
+package main
+
+import (
+	"Unbewohnte/dela/client"
+	"Unbewohnte/dela/db"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Environment variables settings are taken from when not given as flags
+const (
+	EnvServer string = "DELA_SERVER"
+	EnvToken  string = "DELA_TOKEN"
+)
+
+const DefaultServer string = "http://localhost:8080"
+
+const usage string = `Usage: dela-cli [-server URL] [-token EMAIL:PASSWORD-HASH] [-json] COMMAND [ARGS]
+
+Commands:
+  ls [-group GROUP] [-pending] [-archived]       List TODOs
+  add [-group GROUP] [-due DATE] [-priority N] [-quick] TEXT
+                                                 Create a new TODO
+  done ID...                                     Mark TODOs as done
+  mv ID GROUP                                    Move a TODO into another group
+  rm ID...                                       Move TODOs to the trash
+  groups                                         List groups
+  groups add NAME                                Create a new group
+  groups rm GROUP                                Move a group to the trash
+
+GROUP is either an ID or a name. DATE is YYYY-MM-DD or "YYYY-MM-DD HH:MM" in local time.
+The token is the value of the auth cookie: email and SHA-256 of the password in hex.
+Server address and token are also taken from ` + EnvServer + ` and ` + EnvToken + `
+`
+
+var outputJSON bool
+
+// Creates flags of a command. Output format can be set anywhere in the command line
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.BoolVar(&outputJSON, "json", outputJSON, "Output JSON instead of a table")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	return flags
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "dela-cli: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func printJSON(value interface{}) {
+	valueBytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fail("failed to marshal JSON: %s", err)
+	}
+	fmt.Println(string(valueBytes))
+}
+
+// Finds the group by ID or name
+func resolveGroup(api *client.Client, group string) (*db.TodoGroup, error) {
+	groups, err := api.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	return findGroup(groups, group)
+}
+
+func findGroup(groups []*db.TodoGroup, group string) (*db.TodoGroup, error) {
+	id, err := strconv.ParseUint(group, 10, 64)
+	for _, candidate := range groups {
+		if (err == nil && candidate.ID == id) || strings.EqualFold(candidate.Name, group) {
+			return candidate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no group %q", group)
+}
+
+// The group TODOs go to when none is given: the one every user has
+func defaultGroup(api *client.Client) (*db.TodoGroup, error) {
+	groups, err := api.Groups()
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("there are no groups")
+	}
+
+	for _, group := range groups {
+		if !group.Removable {
+			return group, nil
+		}
+	}
+	return groups[0], nil
+}
+
+func parseIDs(args []string) []uint64 {
+	if len(args) == 0 {
+		fail("no TODO IDs given")
+	}
+
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			fail("bad TODO ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Returns due time and whether it has the time of the day. Dates alone are stored as UTC midnight
+func parseDue(due string) (uint64, bool, error) {
+	date, err := time.Parse(time.DateOnly, due)
+	if err == nil {
+		return uint64(date.Unix()), false, nil
+	}
+
+	dateTime, err := time.ParseInLocation("2006-01-02 15:04", due, time.Local)
+	if err != nil {
+		return 0, false, fmt.Errorf("due date must be YYYY-MM-DD or \"YYYY-MM-DD HH:MM\"")
+	}
+	return uint64(dateTime.Unix()), true, nil
+}
+
+func formatDue(todo *db.Todo) string {
+	if todo.DueUnix == 0 {
+		return "-"
+	}
+	if todo.DueHasTime {
+		return time.Unix(int64(todo.DueUnix), 0).Local().Format("2006-01-02 15:04")
+	}
+	return time.Unix(int64(todo.DueUnix), 0).UTC().Format(time.DateOnly)
+}
+
+func formatPriority(priority uint64) string {
+	switch priority {
+	case db.PriorityLow:
+		return "low"
+	case db.PriorityMedium:
+		return "medium"
+	case db.PriorityHigh:
+		return "high"
+	default:
+		return "-"
+	}
+}
+
+func printTodos(todos []*db.Todo, groups []*db.TodoGroup) {
+	if outputJSON {
+		printJSON(todos)
+		return
+	}
+
+	groupNames := make(map[uint64]string)
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tDONE\tPRIORITY\tDUE\tGROUP\tTEXT")
+	for _, todo := range todos {
+		done := " "
+		if todo.IsDone {
+			done = "x"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			todo.ID, done, formatPriority(todo.Priority), formatDue(todo), groupNames[todo.GroupID], todo.Text,
+		)
+	}
+	table.Flush()
+}
+
+func printGroups(groups []*db.TodoGroup) {
+	if outputJSON {
+		printJSON(groups)
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tCREATED")
+	for _, group := range groups {
+		fmt.Fprintf(table, "%d\t%s\t%s\n",
+			group.ID, group.Name, time.Unix(int64(group.TimeCreatedUnix), 0).Local().Format(time.DateOnly),
+		)
+	}
+	table.Flush()
+}
+
+func commandLs(api *client.Client, args []string) {
+	flags := commandFlags("ls")
+	group := flags.String("group", "", "Only list TODOs of this group")
+	pending := flags.Bool("pending", false, "Only list TODOs that are not done")
+	archived := flags.Bool("archived", false, "List archived TODOs as well")
+	flags.Parse(args)
+
+	todos, err := api.Todos(client.TodosFilter{Archived: *archived})
+	if err != nil {
+		fail("failed to get TODOs: %s", err)
+	}
+	groups, err := api.Groups()
+	if err != nil {
+		fail("failed to get groups: %s", err)
+	}
+
+	var groupID uint64
+	if *group != "" {
+		found, err := findGroup(groups, *group)
+		if err != nil {
+			fail("%s", err)
+		}
+		groupID = found.ID
+	}
+
+	listed := []*db.Todo{}
+	for _, todo := range todos {
+		if groupID != 0 && todo.GroupID != groupID {
+			continue
+		}
+		if *pending && todo.IsDone {
+			continue
+		}
+		listed = append(listed, todo)
+	}
+
+	printTodos(listed, groups)
+}
+
+func commandAdd(api *client.Client, args []string) {
+	flags := commandFlags("add")
+	group := flags.String("group", "", "Group to put the TODO into")
+	due := flags.String("due", "", "Due date")
+	priority := flags.Uint64("priority", db.PriorityNone, "Priority from 0 (none) to 3 (high)")
+	quick := flags.Bool("quick", false, "Read due date, priority and recurrence from the text, ie: \"Call mom tomorrow !high\"")
+	flags.Parse(args)
+
+	text := strings.Join(flags.Args(), " ")
+	if text == "" {
+		fail("no TODO text given")
+	}
+
+	var targetGroup *db.TodoGroup
+	var err error
+	if *group != "" {
+		targetGroup, err = resolveGroup(api, *group)
+	} else {
+		targetGroup, err = defaultGroup(api)
+	}
+	if err != nil {
+		fail("%s", err)
+	}
+
+	var created *db.Todo
+	if *quick {
+		created, err = api.QuickAdd(text, targetGroup.ID)
+	} else {
+		newTodo := db.Todo{
+			GroupID:  targetGroup.ID,
+			Text:     text,
+			Priority: *priority,
+		}
+		if *due != "" {
+			newTodo.DueUnix, newTodo.DueHasTime, err = parseDue(*due)
+			if err != nil {
+				fail("%s", err)
+			}
+		}
+		created, err = api.CreateTodo(newTodo)
+	}
+	if err != nil {
+		fail("failed to create TODO: %s", err)
+	}
+
+	printTodos([]*db.Todo{created}, []*db.TodoGroup{targetGroup})
+}
+
+func commandDone(api *client.Client, args []string) {
+	flags := commandFlags("done")
+	flags.Parse(args)
+
+	for _, id := range parseIDs(flags.Args()) {
+		err := api.MarkTodoDone(id)
+		if err != nil {
+			fail("failed to mark TODO %d as done: %s", id, err)
+		}
+	}
+}
+
+func commandMv(api *client.Client, args []string) {
+	flags := commandFlags("mv")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fail("expected a TODO ID and a group")
+	}
+	id := parseIDs(flags.Args()[:1])[0]
+
+	group, err := resolveGroup(api, flags.Arg(1))
+	if err != nil {
+		fail("%s", err)
+	}
+
+	err = api.MoveTodo(id, group.ID)
+	if err != nil {
+		fail("failed to move TODO %d: %s", id, err)
+	}
+}
+
+func commandRm(api *client.Client, args []string) {
+	flags := commandFlags("rm")
+	flags.Parse(args)
+
+	for _, id := range parseIDs(flags.Args()) {
+		err := api.DeleteTodo(id)
+		if err != nil {
+			fail("failed to delete TODO %d: %s", id, err)
+		}
+	}
+}
+
+func commandGroups(api *client.Client, args []string) {
+	flags := commandFlags("groups")
+	flags.Parse(args)
+
+	switch flags.Arg(0) {
+	case "":
+		groups, err := api.Groups()
+		if err != nil {
+			fail("failed to get groups: %s", err)
+		}
+		printGroups(groups)
+
+	case "add":
+		name := strings.Join(flags.Args()[1:], " ")
+		if name == "" {
+			fail("no group name given")
+		}
+
+		created, err := api.CreateGroup(name)
+		if err != nil {
+			fail("failed to create group: %s", err)
+		}
+		printGroups([]*db.TodoGroup{created})
+
+	case "rm":
+		if flags.NArg() != 2 {
+			fail("expected a single group")
+		}
+
+		group, err := resolveGroup(api, flags.Arg(1))
+		if err != nil {
+			fail("%s", err)
+		}
+		err = api.DeleteGroup(group.ID)
+		if err != nil {
+			fail("failed to delete group %d: %s", group.ID, err)
+		}
+
+	default:
+		fail("unknown groups command %q", flags.Arg(0))
+	}
+}
+
+func main() {
+	flags := commandFlags("dela-cli")
+	server := flags.String("server", os.Getenv(EnvServer), "Address of the server")
+	token := flags.String("token", os.Getenv(EnvToken), "Credentials in the form of email:password-hash")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *server == "" {
+		*server = DefaultServer
+	}
+
+	api, err := client.NewFromToken(*server, *token)
+	if err != nil {
+		fail("%s. Set it with -token or %s", err, EnvToken)
+	}
+
+	commands := map[string]func(*client.Client, []string){
+		"ls":     commandLs,
+		"add":    commandAdd,
+		"done":   commandDone,
+		"mv":     commandMv,
+		"rm":     commandRm,
+		"groups": commandGroups,
+	}
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dela-cli: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+	command(api, flags.Args()[1:])
+}
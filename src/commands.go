@@ -0,0 +1,667 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"Unbewohnte/dela/conf"
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"Unbewohnte/dela/misc"
+	"Unbewohnte/dela/server"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Who changes made from the shell are recorded as in the audit log
+const ShellActor string = "shell"
+
+// A subcommand operating directly on the configured database or configuration
+type command struct {
+	Group string
+	Name  string
+	Args  string
+	Help  string
+	Run   func(args []string) error
+}
+
+var commands = []command{
+	{"user", "list", "[-json]", "List registered users", commandUserList},
+	{"user", "create", "[-password PASSWORD] [-admin] [-unverified] EMAIL", "Register a new user. A random password is generated if none is given", commandUserCreate},
+	{"user", "delete", "EMAIL", "Delete a user with all of their data", commandUserDelete},
+	{"user", "verify", "EMAIL", "Confirm email of a user", commandUserVerify},
+	{"user", "reset-password", "[-password PASSWORD] EMAIL", "Set a new password. A random one is generated if none is given", commandUserResetPassword},
+	{"db", "backup", "[PATH]", "Write a consistent copy of the database, safe while the server is running. Goes into the backup directory by default", commandDBBackup},
+	{"db", "restore", "BACKUP", "Replace the database with a backup. The server must be stopped", commandDBRestore},
+	{"db", "vacuum", "", "Give space taken by deleted data back to the system", commandDBVacuum},
+	{"db", "check", "", "Look for corruption and broken references", commandDBCheck},
+	{"db", "migrate", "", "Bring tables of an older version up to date", commandDBMigrate},
+	{"config", "init", "[-force]", "Write the default configuration file", commandConfigInit},
+	{"config", "validate", "", "Look for mistakes in the configuration file", commandConfigValidate},
+	{"config", "print", "[-secrets]", "Print the configuration in use. Passwords are hidden unless asked", commandConfigPrint},
+}
+
+// Tells that the command was called the wrong way
+var errUsage = errors.New("wrong usage")
+
+func printUsage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: dela [-conf PATH] [-version] [COMMAND]\n\nStarts the server unless a command is given.\n\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(output, "\nCommands:\n")
+
+	table := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(table, "  %s %s %s\t%s\n", cmd.Group, cmd.Name, cmd.Args, cmd.Help)
+	}
+	table.Flush()
+}
+
+// Runs the command and returns the exit code
+func runCommand(args []string) int {
+	if len(args) >= 2 {
+		for _, cmd := range commands {
+			if cmd.Group != args[0] || cmd.Name != args[1] {
+				continue
+			}
+
+			err := cmd.Run(args[2:])
+			if errors.Is(err, errUsage) {
+				fmt.Fprintf(os.Stderr, "Usage: dela %s %s %s\n", cmd.Group, cmd.Name, cmd.Args)
+				return 2
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "dela: %s\n", err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "dela: unknown command \"%s\"\n\n", strings.Join(args, " "))
+	printUsage()
+	return 2
+}
+
+/*
+Parses flags wherever they are among the arguments and returns the rest of them.
+Fails with errUsage if there are fewer than minPositional or more than maxPositional of them
+*/
+func parseCommandArgs(flags *flag.FlagSet, args []string, minPositional int, maxPositional int) ([]string, error) {
+	flags.SetOutput(os.Stderr)
+
+	var positional []string
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, errUsage
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < minPositional || len(positional) > maxPositional {
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// Opens the configuration file, resolving paths the way the server does
+func loadConf() (conf.Conf, error) {
+	config, err := conf.FromFile(*confPath)
+	if err != nil {
+		return config, fmt.Errorf("failed to open configuration file %s: %s", *confPath, err)
+	}
+	if config.BaseContentDir == "." {
+		config.BaseContentDir = WDir
+	}
+
+	return config, nil
+}
+
+// Opens the database the server uses. It is not created if it does not exist
+func openDB() (*db.DB, error) {
+	config, err := loadConf()
+	if err != nil {
+		return nil, err
+	}
+
+	dbPath := filepath.Join(config.BaseContentDir, config.ProdDBName)
+	dbase, err := db.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %s", dbPath, err)
+	}
+
+	return dbase, nil
+}
+
+// Opens the database and fails if there is no such user in it
+func openDBForUser(email string) (*db.DB, *db.User, error) {
+	dbase, err := openDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := dbase.GetUser(strings.ToLower(email))
+	if err != nil {
+		dbase.Close()
+		return nil, nil, fmt.Errorf("no user %s", email)
+	}
+
+	return dbase, user, nil
+}
+
+// Returns the given password or generates a new one if it is empty
+func passwordOrRandom(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	return misc.GenerateRandomPassword(server.ResetPasswordLength)
+}
+
+// Appends a change made from the shell to the audit log
+func auditShellChange(dbase *db.DB, email string, action string) {
+	err := dbase.CreateAuditEvent(db.AuditEvent{
+		ActorEmail: ShellActor,
+		OwnerEmail: email,
+		Action:     action,
+		TargetType: server.AuditTargetUser,
+		TargetID:   email,
+		TimeUnix:   uint64(time.Now().Unix()),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dela: failed to record %s of %s in the audit log: %s\n", action, email, err)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func commandUserList(args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Output JSON instead of a table")
+	_, err := parseCommandArgs(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	users, err := dbase.GetUsersOverview()
+	if err != nil {
+		return fmt.Errorf("failed to get users: %s", err)
+	}
+
+	if *asJSON {
+		usersBytes, err := json.MarshalIndent(users, "", " ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(usersBytes))
+		return nil
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "EMAIL\tROLE\tVERIFIED\tDISABLED\tTODOS\tSTORAGE\tCREATED\tLAST LOGIN")
+	for _, user := range users {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			user.Email, user.Role, yesNo(user.ConfirmedEmail), yesNo(user.Disabled),
+			user.TodoCount, user.Storage, user.TimeCreated, user.LastLogin,
+		)
+	}
+	return table.Flush()
+}
+
+func commandUserCreate(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	password := flags.String("password", "", "Password of the user")
+	admin := flags.Bool("admin", false, "Grant administrator rights")
+	unverified := flags.Bool("unverified", false, "Leave the email unconfirmed")
+	positional, err := parseCommandArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := passwordOrRandom(*password)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %s", err)
+	}
+
+	user := db.User{
+		Email:           strings.ToLower(strings.TrimSpace(positional[0])),
+		Password:        newPassword,
+		TimeCreatedUnix: uint64(time.Now().Unix()),
+	}
+	if valid, reason := server.IsUserValid(user); !valid {
+		return errors.New(reason)
+	}
+	user.Password = misc.HashPassword(newPassword)
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	if _, err := dbase.GetUser(user.Email); err == nil {
+		return fmt.Errorf("user %s already exists", user.Email)
+	}
+
+	err = dbase.CreateUser(user)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %s", err)
+	}
+	auditShellChange(dbase, user.Email, "admin.user.create")
+
+	// Every user has a non-removable group to start with
+	_, err = dbase.CreateTodoGroup(db.NewTodoGroup("Notes", user.TimeCreatedUnix, user.Email, false))
+	if err != nil {
+		return fmt.Errorf("failed to create default group: %s", err)
+	}
+
+	if !*unverified {
+		err = dbase.UserSetEmailConfirmed(user.Email)
+		if err != nil {
+			return fmt.Errorf("failed to confirm email: %s", err)
+		}
+	}
+	if *admin {
+		err = dbase.UserSetRole(user.Email, db.RoleAdmin)
+		if err != nil {
+			return fmt.Errorf("failed to grant administrator rights: %s", err)
+		}
+	}
+
+	fmt.Printf("Created %s\n", user.Email)
+	if *password == "" {
+		fmt.Printf("Password: %s\n", newPassword)
+	}
+	return nil
+}
+
+func commandUserDelete(args []string) error {
+	positional, err := parseCommandArgs(flag.NewFlagSet("user delete", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	dbase, user, err := openDBForUser(positional[0])
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	err = dbase.DeleteUserClean(user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %s", user.Email, err)
+	}
+	auditShellChange(dbase, user.Email, "admin.user.delete")
+
+	fmt.Printf("Deleted %s\n", user.Email)
+	return nil
+}
+
+func commandUserVerify(args []string) error {
+	positional, err := parseCommandArgs(flag.NewFlagSet("user verify", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	dbase, user, err := openDBForUser(positional[0])
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	if user.ConfirmedEmail {
+		fmt.Printf("%s is already verified\n", user.Email)
+		return nil
+	}
+
+	err = dbase.UserSetEmailConfirmed(user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to confirm email of %s: %s", user.Email, err)
+	}
+	auditShellChange(dbase, user.Email, "admin.user.verify")
+
+	fmt.Printf("Verified %s\n", user.Email)
+	return nil
+}
+
+func commandUserResetPassword(args []string) error {
+	flags := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	password := flags.String("password", "", "New password")
+	positional, err := parseCommandArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := passwordOrRandom(*password)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %s", err)
+	}
+	if valid, reason := server.IsUserValid(db.User{Email: positional[0], Password: newPassword}); !valid {
+		return errors.New(reason)
+	}
+
+	dbase, user, err := openDBForUser(positional[0])
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	err = dbase.UserSetPassword(user.Email, misc.HashPassword(newPassword))
+	if err != nil {
+		return fmt.Errorf("failed to set password of %s: %s", user.Email, err)
+	}
+	auditShellChange(dbase, user.Email, "admin.user.resetpassword")
+
+	fmt.Printf("Changed password of %s\n", user.Email)
+	if *password == "" {
+		fmt.Printf("Password: %s\n", newPassword)
+	}
+	return nil
+}
+
+func commandDBBackup(args []string) error {
+	positional, err := parseCommandArgs(flag.NewFlagSet("db backup", flag.ContinueOnError), args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConf()
+	if err != nil {
+		return err
+	}
+
+	var backupPath string
+	if len(positional) == 1 {
+		backupPath = positional[0]
+	} else {
+		if config.Backup.Directory == "" {
+			return errors.New("backup directory is not configured, give a path to back up into")
+		}
+		err = os.MkdirAll(server.BackupDir(config), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create backup directory: %s", err)
+		}
+		backupPath = filepath.Join(server.BackupDir(config), server.BackupFileName(config, time.Now()))
+	}
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	if strings.HasSuffix(backupPath, db.CompressedBackupExt) {
+		err = dbase.BackupCompressedTo(backupPath)
+	} else {
+		err = dbase.BackupTo(backupPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to back up into %s: %s", backupPath, err)
+	}
+
+	fmt.Println(backupPath)
+	return nil
+}
+
+func commandDBRestore(args []string) error {
+	positional, err := parseCommandArgs(flag.NewFlagSet("db restore", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConf()
+	if err != nil {
+		return err
+	}
+	dbPath := filepath.Join(config.BaseContentDir, config.ProdDBName)
+
+	// Names of backups in the backup directory are enough
+	backupPath := positional[0]
+	if _, err := os.Stat(backupPath); err != nil {
+		backupPath = filepath.Join(server.BackupDir(config), positional[0])
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("no backup %s", positional[0])
+	}
+
+	err = db.Restore(backupPath, dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %s", backupPath, err)
+	}
+
+	fmt.Printf("Restored %s from %s\n", dbPath, backupPath)
+	return nil
+}
+
+// Returns size of the file in human readable form
+func fileSize(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "?"
+	}
+
+	size := info.Size()
+	if size < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
+
+func commandDBVacuum(args []string) error {
+	_, err := parseCommandArgs(flag.NewFlagSet("db vacuum", flag.ContinueOnError), args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConf()
+	if err != nil {
+		return err
+	}
+	dbPath := filepath.Join(config.BaseContentDir, config.ProdDBName)
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	sizeBefore := fileSize(dbPath)
+	err = dbase.Vacuum()
+	if err != nil {
+		return fmt.Errorf("failed to vacuum: %s", err)
+	}
+
+	fmt.Printf("%s -> %s\n", sizeBefore, fileSize(dbPath))
+	return nil
+}
+
+func commandDBCheck(args []string) error {
+	_, err := parseCommandArgs(flag.NewFlagSet("db check", flag.ContinueOnError), args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	problems, err := dbase.Check()
+	if err != nil {
+		return fmt.Errorf("failed to check: %s", err)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func commandDBMigrate(args []string) error {
+	_, err := parseCommandArgs(flag.NewFlagSet("db migrate", flag.ContinueOnError), args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	dbase, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer dbase.Close()
+
+	added, err := dbase.Migrate()
+	if err != nil {
+		return fmt.Errorf("failed to migrate: %s", err)
+	}
+	if len(added) == 0 {
+		fmt.Println("Already up to date")
+		return nil
+	}
+
+	for _, name := range added {
+		fmt.Printf("Added %s\n", name)
+	}
+	return nil
+}
+
+func commandConfigInit(args []string) error {
+	flags := flag.NewFlagSet("config init", flag.ContinueOnError)
+	force := flags.Bool("force", false, "Overwrite an existing file")
+	_, err := parseCommandArgs(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*confPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", *confPath)
+	}
+
+	_, err = conf.Create(*confPath, conf.Default())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %s", *confPath, err)
+	}
+
+	fmt.Printf("Created %s\n", *confPath)
+	return nil
+}
+
+func commandConfigValidate(args []string) error {
+	_, err := parseCommandArgs(flag.NewFlagSet("config validate", flag.ContinueOnError), args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	confBytes, err := os.ReadFile(*confPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %s", *confPath, err)
+	}
+
+	// Misspelled keys are silently ignored by the server
+	decoder := json.NewDecoder(bytes.NewReader(confBytes))
+	decoder.DisallowUnknownFields()
+	var strict conf.Conf
+	err = decoder.Decode(&strict)
+	if err != nil {
+		return fmt.Errorf("%s: %s", *confPath, err)
+	}
+
+	config, err := loadConf()
+	if err != nil {
+		return err
+	}
+
+	problems := config.Validate()
+	if config.Verification.VerifyEmails {
+		_, err = email.NewTransport(config.Verification.Emailer)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("emailer: %s", err))
+		}
+	}
+	for _, dirName := range []string{server.PagesDirName, server.ScriptsDirName, server.StaticDirName, server.TranslationsDirName} {
+		dirPath := filepath.Join(config.BaseContentDir, dirName)
+		if _, err := os.Stat(dirPath); err != nil {
+			problems = append(problems, fmt.Errorf("no %s directory in %s", dirName, config.BaseContentDir))
+		}
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("found %d problems in %s", len(problems), *confPath)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func commandConfigPrint(args []string) error {
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	secrets := flags.Bool("secrets", false, "Show passwords")
+	_, err := parseCommandArgs(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConf()
+	if err != nil {
+		return err
+	}
+	if !*secrets && config.Verification.Emailer.Password != "" {
+		config.Verification.Emailer.Password = "********"
+	}
+
+	confBytes, err := json.MarshalIndent(config, "", " ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(confBytes))
+	return nil
+}
@@ -20,14 +20,18 @@ package conf
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"strings"
 )
 
 type ServerConf struct {
 	Port         uint16 `json:"port"`
 	CertFilePath string `json:"cert_file_path"`
 	KeyFilePath  string `json:"key_file_path"`
+	PublicURL    string `json:"public_url"`
 }
 
 type EmailerConf struct {
@@ -35,6 +39,17 @@ type EmailerConf struct {
 	Host     string `json:"host"`
 	HostPort uint16 `json:"host_port"`
 	Password string `json:"password"`
+	// smtp, sendmail, file or log
+	Transport string `json:"transport"`
+	// opportunistic, starttls, implicit or none
+	TLSMode            string `json:"tls_mode"`
+	CACertFilePath     string `json:"ca_cert_file_path"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// Do not authenticate. Useful for local relays
+	NoAuth       bool   `json:"no_auth"`
+	SendmailPath string `json:"sendmail_path"`
+	// Where file transport puts messages
+	Directory string `json:"directory"`
 }
 
 type EmailVerificationConf struct {
@@ -42,11 +57,32 @@ type EmailVerificationConf struct {
 	Emailer      EmailerConf `json:"emailer"`
 }
 
+type BackupConf struct {
+	// How often the database is backed up. 0 disables scheduled backups
+	IntervalHours uint `json:"interval_hours"`
+	// Where backups are written. Relative paths are relative to base_content_dir
+	Directory string `json:"directory"`
+	// How many latest backups are kept. 0 keeps all of them
+	Keep uint `json:"keep"`
+	// Compress backups with gzip
+	Compress bool `json:"compress"`
+}
+
 type Conf struct {
 	Server         ServerConf            `json:"server"`
 	Verification   EmailVerificationConf `json:"verification"`
 	BaseContentDir string                `json:"base_content_dir"`
 	ProdDBName     string                `json:"production_db_name"`
+	Admins         []string              `json:"admins"`
+	// How long audit events are kept. 0 keeps them forever
+	AuditRetentionDays uint `json:"audit_retention_days"`
+	// How long deleted TODOs and groups stay in the trash. 0 keeps them forever
+	TrashRetentionDays uint `json:"trash_retention_days"`
+	// Uploaded photos are downscaled so that their longest side is at most this many pixels
+	ImageMaxDimension uint `json:"image_max_dimension"`
+	// JPEG quality photos are re-encoded with, from 1 to 100
+	ImageQuality uint       `json:"image_quality"`
+	Backup       BackupConf `json:"backup"`
 }
 
 // Creates a default server configuration
@@ -56,19 +92,41 @@ func Default() Conf {
 			Port:         8080,
 			CertFilePath: "",
 			KeyFilePath:  "",
+			PublicURL:    "",
 		},
 		Verification: EmailVerificationConf{
 			VerifyEmails: true,
 			Emailer: EmailerConf{
-				User:     "you@example.com",
-				Host:     "smtp.example.com",
-				HostPort: 587,
-				Password: "hostpassword",
+				User:               "you@example.com",
+				Host:               "smtp.example.com",
+				HostPort:           587,
+				Password:           "hostpassword",
+				Transport:          "smtp",
+				TLSMode:            "opportunistic",
+				CACertFilePath:     "",
+				InsecureSkipVerify: false,
+				NoAuth:             false,
+				SendmailPath:       "/usr/sbin/sendmail",
+				Directory:          "",
 			},
 		},
 
 		BaseContentDir: ".",
 		ProdDBName:     "dela.db",
+		Admins:         []string{},
+
+		AuditRetentionDays: 365,
+		TrashRetentionDays: 30,
+
+		ImageMaxDimension: 1600,
+		ImageQuality:      85,
+
+		Backup: BackupConf{
+			IntervalHours: 24,
+			Directory:     "backups",
+			Keep:          7,
+			Compress:      true,
+		},
 	}
 }
 
@@ -114,3 +172,62 @@ func Create(path string, conf Conf) (Conf, error) {
 
 	return conf, nil
 }
+
+// Looks for mistakes in the configuration. Returns found problems, none if it is fine
+func (c Conf) Validate() []error {
+	var problems []error
+
+	if c.Server.Port == 0 {
+		problems = append(problems, fmt.Errorf("server.port must be set"))
+	}
+	if (c.Server.CertFilePath == "") != (c.Server.KeyFilePath == "") {
+		problems = append(problems, fmt.Errorf("server.cert_file_path and server.key_file_path must be set together"))
+	}
+	for _, path := range []string{c.Server.CertFilePath, c.Server.KeyFilePath} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, fmt.Errorf("can't access %s: %s", path, err))
+		}
+	}
+	if c.Server.PublicURL != "" {
+		publicURL, err := url.Parse(c.Server.PublicURL)
+		if err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+			problems = append(problems, fmt.Errorf("server.public_url must be an http or https URL"))
+		}
+	}
+
+	if c.Verification.VerifyEmails && c.Verification.Emailer.User == "" {
+		problems = append(problems, fmt.Errorf("verification.emailer.user must be set to send verification emails"))
+	}
+	emailer := c.Verification.Emailer
+	isSMTP := emailer.Transport == "" || strings.EqualFold(emailer.Transport, "smtp")
+	if isSMTP && strings.EqualFold(emailer.TLSMode, "none") && !emailer.NoAuth {
+		// The password would be sent in plain text
+		problems = append(problems, fmt.Errorf("verification.emailer.tls_mode none can only be used with no_auth"))
+	}
+
+	if info, err := os.Stat(c.BaseContentDir); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Errorf("base_content_dir %s is not a directory", c.BaseContentDir))
+	}
+	if c.ProdDBName == "" {
+		problems = append(problems, fmt.Errorf("production_db_name must be set"))
+	}
+	for _, admin := range c.Admins {
+		if strings.TrimSpace(admin) == "" {
+			problems = append(problems, fmt.Errorf("admins must not contain empty emails"))
+			break
+		}
+	}
+
+	if c.ImageQuality > 100 {
+		problems = append(problems, fmt.Errorf("image_quality must be from 1 to 100"))
+	}
+
+	if c.Backup.IntervalHours > 0 && c.Backup.Directory == "" {
+		problems = append(problems, fmt.Errorf("backup.directory must be set to make scheduled backups"))
+	}
+
+	return problems
+}
@@ -0,0 +1,158 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// A single change made to an account or its data
+type AuditEvent struct {
+	ID uint64 `json:"id"`
+	// Who made the change
+	ActorEmail string `json:"actorEmail"`
+	// Whose data was changed
+	OwnerEmail string `json:"ownerEmail"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetID   string `json:"targetId"`
+	// JSON snapshots of the target before and after the change. Empty if there was nothing
+	Before   string `json:"before"`
+	After    string `json:"after"`
+	ClientIP string `json:"clientIp"`
+	TimeUnix uint64 `json:"timeUnix"`
+	Time     string `json:"time"`
+}
+
+func scanAuditEvent(rows *sql.Rows) (*AuditEvent, error) {
+	var event AuditEvent
+	err := rows.Scan(
+		&event.ID,
+		&event.ActorEmail,
+		&event.OwnerEmail,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.Before,
+		&event.After,
+		&event.ClientIP,
+		&event.TimeUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Time = time.Unix(int64(event.TimeUnix), 0).Format(time.DateTime)
+
+	return &event, nil
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]*AuditEvent, error) {
+	var events []*AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Appends a new event to the audit log
+func (db *DB) CreateAuditEvent(event AuditEvent) error {
+	_, err := db.Exec(
+		"INSERT INTO audit_events(actor_email, owner_email, action, target_type, target_id, before, after, client_ip, time_unix) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.ActorEmail,
+		event.OwnerEmail,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Before,
+		event.After,
+		event.ClientIP,
+		event.TimeUnix,
+	)
+
+	return err
+}
+
+// Retrieves up to limit latest events concerning user's account and data
+func (db *DB) GetUserAuditEvents(email string, limit uint64) ([]*AuditEvent, error) {
+	rows, err := db.Query(
+		"SELECT * FROM audit_events WHERE owner_email=? ORDER BY time_unix DESC, id DESC LIMIT ?",
+		email,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+// Retrieves all events concerning given target, oldest first
+func (db *DB) GetTargetAuditEvents(targetType string, targetID string) ([]*AuditEvent, error) {
+	rows, err := db.Query(
+		"SELECT * FROM audit_events WHERE target_type=? AND target_id=? ORDER BY time_unix, id",
+		targetType,
+		targetID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+// Retrieves latest events of all users, newest first
+func (db *DB) GetAuditEvents(limit uint64, offset uint64) ([]*AuditEvent, error) {
+	rows, err := db.Query(
+		"SELECT * FROM audit_events ORDER BY time_unix DESC, id DESC LIMIT ? OFFSET ?",
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAuditEvents(rows)
+}
+
+/*
+Deletes events older than given time. Events of TODOs which still exist are kept, since they make
+up TODO's history. todoTargetType is the target type of such events. Returns how many were deleted
+*/
+func (db *DB) DeleteAuditEventsOlderThan(olderThanUnix uint64, todoTargetType string) (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM audit_events WHERE time_unix<? AND NOT (target_type=? AND target_id IN (SELECT CAST(id AS TEXT) FROM todos))",
+		olderThanUnix,
+		todoTargetType,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,149 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Backups with names ending with it are gzip compressed
+const CompressedBackupExt string = ".gz"
+
+// Does the same as BackupTo, but compresses the copy with gzip
+func (db *DB) BackupCompressedTo(path string) error {
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	uncompressedPath := path + ".tmp"
+	os.Remove(uncompressedPath)
+	err = db.BackupTo(uncompressedPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(uncompressedPath)
+
+	err = compressFile(uncompressedPath, path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+func compressFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	compressor := gzip.NewWriter(dst)
+	_, err = io.Copy(compressor, src)
+	if err != nil {
+		return err
+	}
+	err = compressor.Close()
+	if err != nil {
+		return err
+	}
+
+	return dst.Sync()
+}
+
+// Copies the backup to dstPath, decompressing it if needed
+func unpackBackup(backupPath string, dstPath string) error {
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var reader io.Reader = src
+	if strings.HasSuffix(backupPath, CompressedBackupExt) {
+		decompressor, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, reader)
+	if err != nil {
+		return err
+	}
+
+	return dst.Sync()
+}
+
+/*
+Replaces the database at path with the backup, decompressing it if its name ends with .gz.
+The backup is checked first and nothing is replaced if it has problems.
+Nothing must be using the database while it is restored
+*/
+func Restore(backupPath string, path string) error {
+	restoredPath := path + ".restore"
+	os.Remove(restoredPath)
+	err := unpackBackup(backupPath, restoredPath)
+	if err != nil {
+		os.Remove(restoredPath)
+		return err
+	}
+
+	restored, err := Open(restoredPath)
+	if err != nil {
+		os.Remove(restoredPath)
+		return err
+	}
+	problems, err := restored.Check()
+	restored.Close()
+	if err == nil && len(problems) > 0 {
+		err = fmt.Errorf("backup is damaged: %s", strings.Join(problems, "; "))
+	}
+	if err != nil {
+		os.Remove(restoredPath)
+		return err
+	}
+
+	// Leftovers of the replaced database would be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(path + suffix)
+	}
+
+	return os.Rename(restoredPath, path)
+}
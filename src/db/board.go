@@ -0,0 +1,152 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+)
+
+// A status column of a group shown as a board
+type BoardColumn struct {
+	ID       uint64 `json:"id"`
+	GroupID  uint64 `json:"groupId"`
+	Name     string `json:"name"`
+	Position uint64 `json:"position"`
+	// TODOs moved into this column are marked as done
+	IsDone bool `json:"isDone"`
+}
+
+func scanBoardColumn(rows *sql.Rows) (*BoardColumn, error) {
+	var column BoardColumn
+	err := rows.Scan(
+		&column.ID,
+		&column.GroupID,
+		&column.Name,
+		&column.Position,
+		&column.IsDone,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &column, nil
+}
+
+// Creates a new column after all existing columns of the group and returns its ID
+func (db *DB) CreateBoardColumn(column BoardColumn) (uint64, error) {
+	result, err := db.Exec(
+		"INSERT INTO board_columns(group_id, name, position, is_done) VALUES(?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM board_columns WHERE group_id=?), ?)",
+		column.GroupID,
+		column.Name,
+		column.GroupID,
+		column.IsDone,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return uint64(id), err
+}
+
+// Retrieves a board column with given ID
+func (db *DB) GetBoardColumn(id uint64) (*BoardColumn, error) {
+	rows, err := db.Query("SELECT * FROM board_columns WHERE id=?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rows.Next()
+	column, err := scanBoardColumn(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return column, nil
+}
+
+// Retrieves all columns of the group in the order they are shown
+func (db *DB) GetGroupBoardColumns(groupID uint64) ([]*BoardColumn, error) {
+	rows, err := db.Query("SELECT * FROM board_columns WHERE group_id=? ORDER BY position, id", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []*BoardColumn
+	for rows.Next() {
+		column, err := scanBoardColumn(rows)
+		if err != nil {
+			return columns, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// Updates column's name, position and done flag
+func (db *DB) UpdateBoardColumn(columnID uint64, updatedColumn BoardColumn) error {
+	_, err := db.Exec(
+		"UPDATE board_columns SET name=?, position=?, is_done=? WHERE id=?",
+		updatedColumn.Name,
+		updatedColumn.Position,
+		updatedColumn.IsDone,
+		columnID,
+	)
+
+	return err
+}
+
+// Deletes the column. Its TODOs are left without a column
+func (db *DB) DeleteBoardColumn(columnID uint64) error {
+	_, err := db.Exec("UPDATE todos SET column_id=0 WHERE column_id=?", columnID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM board_columns WHERE id=?", columnID)
+	return err
+}
+
+// Turns board view of the group on or off
+func (db *DB) TodoGroupSetBoardView(groupID uint64, boardView bool) error {
+	_, err := db.Exec("UPDATE todo_groups SET board_view=? WHERE id=?", boardView, groupID)
+	return err
+}
+
+// Puts TODO into the column, setting its completion state at the same time
+func (db *DB) TodoSetColumn(todoID uint64, columnID uint64, isDone bool, completionTimeUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE todos SET column_id=?, is_done=?, completion_time_unix=? WHERE id=?",
+		columnID,
+		isDone,
+		completionTimeUnix,
+		todoID,
+	)
+
+	return err
+}
+
+// Deletes columns whose groups no longer exist
+func (db *DB) deleteOrphanBoardColumns() error {
+	_, err := db.Exec("DELETE FROM board_columns WHERE group_id NOT IN (SELECT id FROM todo_groups)")
+	return err
+}
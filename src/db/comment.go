@@ -0,0 +1,140 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// A comment left on a TODO
+type TodoComment struct {
+	ID          uint64 `json:"id"`
+	TodoID      uint64 `json:"todoId"`
+	AuthorEmail string `json:"authorEmail"`
+	// Markdown source as written by the author
+	Body        string `json:"body"`
+	CreatedUnix uint64 `json:"createdUnix"`
+	// 0 if the comment was never edited
+	UpdatedUnix uint64 `json:"updatedUnix"`
+	Created     string `json:"created"`
+	Updated     string `json:"updated"`
+}
+
+func scanTodoComment(rows *sql.Rows) (*TodoComment, error) {
+	var comment TodoComment
+	err := rows.Scan(
+		&comment.ID,
+		&comment.TodoID,
+		&comment.AuthorEmail,
+		&comment.Body,
+		&comment.CreatedUnix,
+		&comment.UpdatedUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Localize(time.Local, time.DateOnly)
+
+	return &comment, nil
+}
+
+// Converts comment's timestamps to given location
+func (comment *TodoComment) Localize(location *time.Location, dateLayout string) {
+	comment.Created = unixToLocalTimeStr(comment.CreatedUnix, location, dateLayout+" 15:04")
+	if comment.UpdatedUnix != 0 {
+		comment.Updated = unixToLocalTimeStr(comment.UpdatedUnix, location, dateLayout+" 15:04")
+	}
+}
+
+// Creates a new comment and returns its ID
+func (db *DB) CreateTodoComment(comment TodoComment) (uint64, error) {
+	result, err := db.Exec(
+		"INSERT INTO todo_comments(todo_id, author_email, body, created_unix) VALUES(?, ?, ?, ?)",
+		comment.TodoID,
+		comment.AuthorEmail,
+		comment.Body,
+		comment.CreatedUnix,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return uint64(id), err
+}
+
+// Retrieves a comment with given ID
+func (db *DB) GetTodoComment(id uint64) (*TodoComment, error) {
+	rows, err := db.Query("SELECT * FROM todo_comments WHERE id=?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rows.Next()
+	comment, err := scanTodoComment(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Retrieves all comments of the TODO, oldest first
+func (db *DB) GetTodoComments(todoID uint64) ([]*TodoComment, error) {
+	rows, err := db.Query(
+		"SELECT * FROM todo_comments WHERE todo_id=? ORDER BY created_unix, id",
+		todoID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*TodoComment
+	for rows.Next() {
+		comment, err := scanTodoComment(rows)
+		if err != nil {
+			return comments, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// Replaces comment's body and remembers when it was edited
+func (db *DB) UpdateTodoComment(commentID uint64, body string, updatedUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE todo_comments SET body=?, updated_unix=? WHERE id=?",
+		body,
+		updatedUnix,
+		commentID,
+	)
+
+	return err
+}
+
+// Deletes a comment with given ID
+func (db *DB) DeleteTodoComment(commentID uint64) error {
+	_, err := db.Exec("DELETE FROM todo_comments WHERE id=?", commentID)
+	return err
+}
@@ -20,6 +20,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 
 	_ "modernc.org/sqlite"
@@ -37,7 +38,15 @@ func setUpTables(db *DB) error {
 		password TEXT NOT NULL,
 		time_created_unix INTEGER,
 		confirmed_email INTEGER,
-		notify_on_todos INTEGER)`,
+		notify_on_todos INTEGER,
+		digest_frequency INTEGER NOT NULL DEFAULT 0,
+		last_digest_unix INTEGER NOT NULL DEFAULT 0,
+		language TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT 'user',
+		disabled INTEGER NOT NULL DEFAULT 0,
+		last_login_unix INTEGER NOT NULL DEFAULT 0,
+		auto_archive_days INTEGER NOT NULL DEFAULT 0,
+		timezone TEXT NOT NULL DEFAULT '')`,
 	)
 	if err != nil {
 		return err
@@ -55,6 +64,18 @@ func setUpTables(db *DB) error {
 		return err
 	}
 
+	// One-time password reset links. Only hashes of tokens are kept
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS password_resets(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		email TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		issued_unix INTEGER NOT NULL,
+		life_seconds INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
 	// Todo groups
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS todo_groups(
 		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
@@ -62,6 +83,10 @@ func setUpTables(db *DB) error {
 		time_created_unix INTEGER,
 		owner_email TEXT NOT NULL,
 		removable INTEGER,
+		deleted_at_unix INTEGER NOT NULL DEFAULT 0,
+		board_view INTEGER NOT NULL DEFAULT 0,
+		revision INTEGER NOT NULL DEFAULT 0,
+		updated_unix INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY(owner_email) REFERENCES users(email))`,
 	)
 	if err != nil {
@@ -80,6 +105,16 @@ func setUpTables(db *DB) error {
 		completion_time_unix INTEGER,
 		image BLOB,
 		file BLOB,
+		deleted_at_unix INTEGER NOT NULL DEFAULT 0,
+		archived_at_unix INTEGER NOT NULL DEFAULT 0,
+		column_id INTEGER NOT NULL DEFAULT 0,
+		due_has_time INTEGER NOT NULL DEFAULT 0,
+		start_unix INTEGER NOT NULL DEFAULT 0,
+		priority INTEGER NOT NULL DEFAULT 0,
+		recur_unit TEXT NOT NULL DEFAULT '',
+		recur_interval INTEGER NOT NULL DEFAULT 0,
+		revision INTEGER NOT NULL DEFAULT 0,
+		updated_unix INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY(group_id) REFERENCES todo_groups(id),
 		FOREIGN KEY(owner_email) REFERENCES users(email))`,
 	)
@@ -87,6 +122,290 @@ func setUpTables(db *DB) error {
 		return err
 	}
 
+	// Status columns of groups shown as a board
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS board_columns(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		group_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		is_done INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(group_id) REFERENCES todo_groups(id))`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Outgoing emails
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS outbox(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		sender TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		subject TEXT,
+		message BLOB,
+		status TEXT NOT NULL,
+		attempts INTEGER,
+		next_attempt_unix INTEGER,
+		last_error TEXT,
+		created_unix INTEGER,
+		sent_unix INTEGER)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Discussion attached to TODOs
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS todo_comments(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		todo_id INTEGER NOT NULL,
+		author_email TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_unix INTEGER NOT NULL,
+		updated_unix INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(todo_id) REFERENCES todos(id),
+		FOREIGN KEY(author_email) REFERENCES users(email))`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Downscaled TODO images. Regenerated whenever the image changes
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS todo_thumbnails(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		todo_id INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		etag TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		data BLOB NOT NULL,
+		FOREIGN KEY(todo_id) REFERENCES todos(id))`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Vector documents of hand-drawn TODO images, kept to be edited later
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS todo_sketches(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		todo_id INTEGER NOT NULL UNIQUE,
+		document TEXT NOT NULL,
+		updated_unix INTEGER NOT NULL,
+		FOREIGN KEY(todo_id) REFERENCES todos(id))`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The latest revision given to a changed TODO or group. Has a single row
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sync_state(
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		revision INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT OR IGNORE INTO sync_state(id, revision) VALUES(1, 0)")
+	if err != nil {
+		return err
+	}
+
+	// Permanently deleted TODOs, so that syncing clients can drop them too
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS todo_tombstones(
+		todo_id INTEGER PRIMARY KEY,
+		owner_email TEXT NOT NULL,
+		revision INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Permanently deleted groups
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS group_tombstones(
+		group_id INTEGER PRIMARY KEY,
+		owner_email TEXT NOT NULL,
+		revision INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Results of applied offline changes, so that resent ones are not applied twice
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sync_mutations(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		owner_email TEXT NOT NULL,
+		mutation_id TEXT NOT NULL,
+		result TEXT NOT NULL,
+		created_unix INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Account and data changes. Never updated, only appended to and purged after retention period
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS audit_events(
+		id INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+		actor_email TEXT NOT NULL,
+		owner_email TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		before TEXT NOT NULL DEFAULT '',
+		after TEXT NOT NULL DEFAULT '',
+		client_ip TEXT NOT NULL DEFAULT '',
+		time_unix INTEGER NOT NULL)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS audit_events_owner ON audit_events(owner_email, time_unix)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS audit_events_target ON audit_events(target_type, target_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS todo_comments_todo ON todo_comments(todo_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS todo_thumbnails_todo ON todo_thumbnails(todo_id, size)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS sync_mutations_owner ON sync_mutations(owner_email, mutation_id)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS todo_tombstones_owner ON todo_tombstones(owner_email, revision)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS group_tombstones_owner ON group_tombstones(owner_email, revision)")
+	if err != nil {
+		return err
+	}
+
+	// Statistics are computed over all TODOs of a user
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS todos_owner ON todos(owner_email)")
+	if err != nil {
+		return err
+	}
+
+	err = migrateTables(db)
+	if err != nil {
+		return err
+	}
+
+	return setUpRevisions(db)
+}
+
+// Adds a column to the table if it is not there yet. Returns true if it was added
+func addColumnIfNotExists(db *DB, table string, column string, definition string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool = false
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      int
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			rows.Close()
+			return false, err
+		}
+
+		if name == column {
+			exists = true
+			break
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return false, nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+/*
+Brings tables created by older versions up to date.
+Columns are always appended to the end of the table, so the order
+of columns added here must match the order in setUpTables
+*/
+func migrateTables(db *DB) error {
+	migrations := []struct {
+		Table      string
+		Column     string
+		Definition string
+	}{
+		{"users", "digest_frequency", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "last_digest_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "language", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"users", "disabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "last_login_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"todo_groups", "deleted_at_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "deleted_at_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "auto_archive_days", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "archived_at_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"todo_groups", "board_view", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "column_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "timezone", "TEXT NOT NULL DEFAULT ''"},
+		{"todos", "due_has_time", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "start_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "recur_unit", "TEXT NOT NULL DEFAULT ''"},
+		{"todos", "recur_interval", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "revision", "INTEGER NOT NULL DEFAULT 0"},
+		{"todo_groups", "revision", "INTEGER NOT NULL DEFAULT 0"},
+		{"todo_groups", "updated_unix", "INTEGER NOT NULL DEFAULT 0"},
+		{"todos", "updated_unix", "INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	// Existing rows are filled in once, right after the column is added
+	backfills := map[string]func(db *DB) error{
+		"todos.revision":           backfillRevisions("todos"),
+		"todo_groups.revision":     backfillRevisions("todo_groups"),
+		"todo_groups.updated_unix": backfillUpdateTimes("todo_groups"),
+		"todos.updated_unix":       backfillUpdateTimes("todos"),
+	}
+
+	for _, migration := range migrations {
+		added, err := addColumnIfNotExists(db, migration.Table, migration.Column, migration.Definition)
+		if err != nil {
+			return err
+		}
+
+		backfill, ok := backfills[migration.Table+"."+migration.Column]
+		if added && ok {
+			err = backfill(db)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -19,9 +19,11 @@
 package db
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestApi(t *testing.T) {
@@ -58,7 +60,7 @@ func TestApi(t *testing.T) {
 		OwnerEmail:      user.Email,
 	}
 
-	err = db.CreateTodoGroup(group)
+	_, err = db.CreateTodoGroup(group)
 	if err != nil {
 		t.Fatalf("failed to create todo group: %s", err)
 	}
@@ -84,7 +86,7 @@ func TestApi(t *testing.T) {
 		DueUnix:         0,
 		OwnerEmail:      user.Email,
 	}
-	err = db.CreateTodo(todo)
+	_, err = db.CreateTodo(todo)
 	if err != nil {
 		t.Fatalf("couldn't create a new TODO: %s", err)
 	}
@@ -95,3 +97,1100 @@ func TestApi(t *testing.T) {
 		t.Fatalf("couldn't cleanly delete user with all TODOs: %s", err)
 	}
 }
+
+func TestAuditEvents(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_audit_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		err = db.CreateAuditEvent(AuditEvent{
+			ActorEmail: "admin@mail.ru",
+			OwnerEmail: "user1@mail.ru",
+			Action:     "todo.delete",
+			TargetType: "todo",
+			TargetID:   "100",
+			Before:     `{"text":"Do the dishes"}`,
+			TimeUnix:   i * 100,
+		})
+		if err != nil {
+			t.Fatalf("failed to create audit event: %s", err)
+		}
+	}
+
+	events, err := db.GetUserAuditEvents("user1@mail.ru", 2)
+	if err != nil {
+		t.Fatalf("failed to get user audit events: %s", err)
+	}
+	if len(events) != 2 || events[0].TimeUnix != 300 {
+		t.Fatalf("expected 2 latest events first, got %+v", events)
+	}
+
+	// History of a TODO which still exists
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: "user1@mail.ru", Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	todoID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "kept", OwnerEmail: "user1@mail.ru"})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	err = db.CreateAuditEvent(AuditEvent{
+		ActorEmail: "user1@mail.ru",
+		OwnerEmail: "user1@mail.ru",
+		Action:     "todo.create",
+		TargetType: "todo",
+		TargetID:   fmt.Sprint(todoID),
+		TimeUnix:   50,
+	})
+	if err != nil {
+		t.Fatalf("failed to create audit event: %s", err)
+	}
+
+	deleted, err := db.DeleteAuditEventsOlderThan(250, "todo")
+	if err != nil {
+		t.Fatalf("failed to delete old audit events: %s", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 events to be deleted, got %d", deleted)
+	}
+
+	events, err = db.GetAuditEvents(10, 0)
+	if err != nil {
+		t.Fatalf("failed to get audit events: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events to be left, got %d", len(events))
+	}
+
+	history, err := db.GetTargetAuditEvents("todo", fmt.Sprint(todoID))
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected history of an existing TODO to be kept, got %+v: %v", history, err)
+	}
+
+	// Gone with the TODO
+	err = db.DeleteTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to delete TODO: %s", err)
+	}
+	deleted, err = db.DeleteAuditEventsOlderThan(250, "todo")
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected history of a deleted TODO to be deleted, got %d: %v", deleted, err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_trash_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	earlierTodoID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "deleted earlier", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	_, err = db.CreateTodo(Todo{GroupID: groupID, Text: "deleted with group", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	err = db.SoftDeleteTodo(earlierTodoID, 100)
+	if err != nil {
+		t.Fatalf("failed to move TODO to the trash: %s", err)
+	}
+	err = db.SoftDeleteTodoGroup(groupID, 200)
+	if err != nil {
+		t.Fatalf("failed to move group to the trash: %s", err)
+	}
+
+	todos, err := db.GetAllUserTodos(email)
+	if err != nil {
+		t.Fatalf("failed to get user TODOs: %s", err)
+	}
+	if len(todos) != 0 {
+		t.Fatalf("deleted TODOs are still listed: %+v", todos)
+	}
+
+	err = db.RestoreTodoGroup(groupID)
+	if err != nil {
+		t.Fatalf("failed to restore group: %s", err)
+	}
+
+	todos, err = db.GetGroupTodos(groupID)
+	if err != nil {
+		t.Fatalf("failed to get group TODOs: %s", err)
+	}
+	if len(todos) != 1 || todos[0].Text != "deleted with group" {
+		t.Fatalf("expected only the TODO deleted with the group to be restored, got %+v", todos)
+	}
+
+	purged, err := db.PurgeDeleted(150)
+	if err != nil {
+		t.Fatalf("failed to purge the trash: %s", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected 1 TODO to be purged, got %d", purged)
+	}
+
+	// Restoring a TODO brings back its group with everything deleted along with it
+	otherTodoID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "deleted with group again", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	err = db.SoftDeleteTodoGroup(groupID, 300)
+	if err != nil {
+		t.Fatalf("failed to move group to the trash: %s", err)
+	}
+	err = db.RestoreTodo(otherTodoID)
+	if err != nil {
+		t.Fatalf("failed to restore TODO: %s", err)
+	}
+
+	group, err := db.GetTodoGroup(groupID)
+	if err != nil || group.DeletedAtUnix != 0 {
+		t.Fatalf("expected the group to be restored with its TODO, got %+v: %v", group, err)
+	}
+	todos, err = db.GetGroupTodos(groupID)
+	if err != nil {
+		t.Fatalf("failed to get group TODOs: %s", err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("expected both TODOs deleted with the group to be restored, got %+v", todos)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_archive_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	err = db.CreateUser(User{Email: email, Password: "password", AutoArchiveDays: 7})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	day := uint64(60 * 60 * 24)
+	for _, todo := range []Todo{
+		{GroupID: groupID, Text: "done long ago", OwnerEmail: email, IsDone: true, CompletionTimeUnix: day},
+		{GroupID: groupID, Text: "done recently", OwnerEmail: email, IsDone: true, CompletionTimeUnix: day * 9},
+		{GroupID: groupID, Text: "not done", OwnerEmail: email},
+	} {
+		_, err = db.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	archived, err := db.AutoArchiveTodos(day * 10)
+	if err != nil {
+		t.Fatalf("failed to auto archive TODOs: %s", err)
+	}
+	if archived != 1 {
+		t.Fatalf("expected 1 TODO to be auto archived, got %d", archived)
+	}
+
+	archived, err = db.ArchiveCompletedGroupTodos(groupID, day*10)
+	if err != nil {
+		t.Fatalf("failed to archive completed group TODOs: %s", err)
+	}
+	if archived != 1 {
+		t.Fatalf("expected 1 more TODO to be archived, got %d", archived)
+	}
+
+	todos, err := db.GetAllUserTodos(email)
+	if err != nil {
+		t.Fatalf("failed to get user TODOs: %s", err)
+	}
+	if len(todos) != 1 || todos[0].Text != "not done" {
+		t.Fatalf("archived TODOs are still listed: %+v", todos)
+	}
+
+	found, err := db.SearchArchivedUserTodos(email, "long", 0, 0)
+	if err != nil {
+		t.Fatalf("failed to search the archive: %s", err)
+	}
+	if len(found) != 1 || found[0].Text != "done long ago" {
+		t.Fatalf("expected to find only one archived TODO, got %+v", found)
+	}
+
+	found, err = db.SearchArchivedUserTodos(email, "", day*5, 0)
+	if err != nil {
+		t.Fatalf("failed to search the archive: %s", err)
+	}
+	if len(found) != 1 || found[0].Text != "done recently" {
+		t.Fatalf("expected to find only TODO completed recently, got %+v", found)
+	}
+}
+
+func TestStats(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_stats_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	day := uint64(60 * 60 * 24)
+	for _, todo := range []Todo{
+		{GroupID: groupID, Text: "done in time", OwnerEmail: email, TimeCreatedUnix: day, DueUnix: day * 3, IsDone: true, CompletionTimeUnix: day * 2},
+		{GroupID: groupID, Text: "done late", OwnerEmail: email, TimeCreatedUnix: day, DueUnix: day * 2, IsDone: true, CompletionTimeUnix: day * 4},
+		{GroupID: groupID, Text: "not done", OwnerEmail: email, TimeCreatedUnix: day * 2, DueUnix: day * 3},
+	} {
+		_, err = db.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	totals, err := db.GetUserTodoTotals(email, day*5, time.UTC)
+	if err != nil {
+		t.Fatalf("failed to get TODO totals: %s", err)
+	}
+	if totals.Created != 3 || totals.Completed != 2 || totals.WithDue != 3 || totals.Overdue != 2 {
+		t.Fatalf("unexpected totals: %+v", totals)
+	}
+
+	// TODOs without time are overdue only after their day has passed
+	sameDayEmail := "user2@mail.ru"
+	for _, todo := range []Todo{
+		{GroupID: groupID, Text: "done on the due day", OwnerEmail: sameDayEmail, TimeCreatedUnix: day, DueUnix: day * 4, IsDone: true, CompletionTimeUnix: day*4 + 60*60*20},
+		{GroupID: groupID, Text: "due today", OwnerEmail: sameDayEmail, TimeCreatedUnix: day, DueUnix: day * 5},
+		{GroupID: groupID, Text: "due yesterday", OwnerEmail: sameDayEmail, TimeCreatedUnix: day, DueUnix: day * 4},
+	} {
+		_, err = db.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+	totals, err = db.GetUserTodoTotals(sameDayEmail, day*5+60*60*12, time.UTC)
+	if err != nil {
+		t.Fatalf("failed to get TODO totals: %s", err)
+	}
+	if totals.Overdue != 1 {
+		t.Fatalf("expected only the TODO due yesterday to be overdue, got %+v", totals)
+	}
+
+	activity, err := db.GetUserTodoActivity(email, 0, time.UTC, false)
+	if err != nil {
+		t.Fatalf("failed to get TODO activity: %s", err)
+	}
+	if len(activity) != 3 || activity[0].Period != "1970-01-02" || activity[0].Created != 2 || activity[1].Completed != 1 {
+		t.Fatalf("unexpected activity: %+v", activity)
+	}
+
+	// Days get the offset they have in the zone, the one clocks were turned back on included
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %s", err)
+	}
+	zonedEmail := "user3@mail.ru"
+	lateEvening := uint64(time.Date(2025, 11, 2, 23, 30, 0, 0, newYork).Unix())
+	summerEvening := uint64(time.Date(2025, 10, 1, 23, 30, 0, 0, newYork).Unix())
+	for _, todo := range []Todo{
+		{GroupID: groupID, Text: "late evening", OwnerEmail: zonedEmail, TimeCreatedUnix: lateEvening, IsDone: true, CompletionTimeUnix: lateEvening},
+		{GroupID: groupID, Text: "summer evening", OwnerEmail: zonedEmail, TimeCreatedUnix: summerEvening, IsDone: true, CompletionTimeUnix: summerEvening},
+	} {
+		_, err = db.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	activity, err = db.GetUserTodoActivity(zonedEmail, 0, newYork, false)
+	if err != nil || len(activity) != 2 || activity[0].Period != "2025-10-01" || activity[1].Period != "2025-11-02" {
+		t.Fatalf("expected activity on 2025-10-01 and 2025-11-02, got %+v: %v", activity, err)
+	}
+	activity, err = db.GetUserTodoActivity(zonedEmail, 0, newYork, true)
+	if err != nil || len(activity) != 2 || activity[0].Period != "2025-09-29" || activity[1].Period != "2025-10-27" {
+		t.Fatalf("expected activity in weeks of 2025-09-29 and 2025-10-27, got %+v: %v", activity, err)
+	}
+	completionDays, err := db.GetUserCompletionDays(zonedEmail, newYork)
+	if err != nil || len(completionDays) != 2 || completionDays[0] != "2025-10-01" || completionDays[1] != "2025-11-02" {
+		t.Fatalf("expected completions on 2025-10-01 and 2025-11-02, got %v: %v", completionDays, err)
+	}
+
+	groupStats, err := db.GetUserGroupCompletionStats(email)
+	if err != nil {
+		t.Fatalf("failed to get group completion stats: %s", err)
+	}
+	if len(groupStats) != 1 || groupStats[0].Completed != 2 || groupStats[0].AverageSeconds != float64(day*2) {
+		t.Fatalf("unexpected group completion stats: %+v", groupStats)
+	}
+}
+
+func TestBoardColumns(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_board_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	var columnIDs []uint64
+	for _, column := range []BoardColumn{
+		{GroupID: groupID, Name: "Backlog"},
+		{GroupID: groupID, Name: "Done", IsDone: true},
+	} {
+		id, err := db.CreateBoardColumn(column)
+		if err != nil {
+			t.Fatalf("failed to create board column: %s", err)
+		}
+		columnIDs = append(columnIDs, id)
+	}
+
+	columns, err := db.GetGroupBoardColumns(groupID)
+	if err != nil {
+		t.Fatalf("failed to get board columns: %s", err)
+	}
+	if len(columns) != 2 || columns[0].Name != "Backlog" || columns[1].Position <= columns[0].Position {
+		t.Fatalf("columns are not in the order of creation: %+v", columns)
+	}
+
+	todoID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "todo", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	err = db.TodoSetColumn(todoID, columnIDs[1], true, 100)
+	if err != nil {
+		t.Fatalf("failed to move TODO into column: %s", err)
+	}
+
+	err = db.DeleteBoardColumn(columnIDs[1])
+	if err != nil {
+		t.Fatalf("failed to delete board column: %s", err)
+	}
+
+	todo, err := db.GetTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to get TODO: %s", err)
+	}
+	if todo.ColumnID != 0 || !todo.IsDone {
+		t.Fatalf("TODO of deleted column was not left without a column: %+v", todo)
+	}
+
+	err = db.DeleteTodoGroupClean(groupID)
+	if err != nil {
+		t.Fatalf("failed to delete group: %s", err)
+	}
+
+	columns, err = db.GetGroupBoardColumns(groupID)
+	if err != nil {
+		t.Fatalf("failed to get board columns: %s", err)
+	}
+	if len(columns) != 0 {
+		t.Fatalf("columns of deleted group still exist: %+v", columns)
+	}
+}
+
+func TestDueTimes(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_due_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	// 2025-03-10 as a date without time and 2025-03-10 23:30 UTC
+	dateOnly := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	withTime := time.Date(2025, 3, 10, 23, 30, 0, 0, time.UTC)
+	for _, todo := range []Todo{
+		{GroupID: groupID, Text: "date only", OwnerEmail: email, DueUnix: uint64(dateOnly.Unix())},
+		{GroupID: groupID, Text: "with time", OwnerEmail: email, DueUnix: uint64(withTime.Unix()), DueHasTime: true},
+	} {
+		_, err = db.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	// A day in UTC+3 starts 3 hours earlier than in UTC
+	zone := time.FixedZone("UTC+3", 3*60*60)
+	dayStart := time.Date(2025, 3, 10, 0, 0, 0, 0, zone)
+	todos, err := db.GetUserTodosScheduledBetween(email, uint64(dayStart.Unix()), uint64(dayStart.AddDate(0, 0, 1).Unix()), zone)
+	if err != nil {
+		t.Fatalf("failed to get scheduled TODOs: %s", err)
+	}
+	if len(todos) != 1 || todos[0].Text != "date only" {
+		t.Fatalf("expected only TODO without time to be due on 2025-03-10 in UTC+3, got %+v", todos)
+	}
+
+	todos, err = db.GetUserTodosScheduledBetween(email, uint64(dayStart.AddDate(0, 0, 1).Unix()), uint64(dayStart.AddDate(0, 0, 2).Unix()), zone)
+	if err != nil {
+		t.Fatalf("failed to get scheduled TODOs: %s", err)
+	}
+	if len(todos) != 1 || todos[0].Text != "with time" {
+		t.Fatalf("expected TODO with time to be due on 2025-03-11 in UTC+3, got %+v", todos)
+	}
+
+	todos[0].Localize(zone, "02.01.2006")
+	if todos[0].Due != "11.03.2025 02:30" {
+		t.Fatalf("unexpected localized due date: %s", todos[0].Due)
+	}
+
+	dateOnlyTodo := Todo{DueUnix: uint64(dateOnly.Unix())}
+	dateOnlyTodo.Localize(time.FixedZone("UTC-5", -5*60*60), time.DateOnly)
+	if dateOnlyTodo.Due != "2025-03-10" {
+		t.Fatalf("date without time must stay the same in any zone, got %s", dateOnlyTodo.Due)
+	}
+
+	// Every date gets the offset of its own day, the week ends after clocks are turned back
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %s", err)
+	}
+	for _, date := range []time.Time{
+		time.Date(2025, 10, 27, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 11, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 11, 3, 0, 0, 0, 0, time.UTC),
+	} {
+		_, err = db.CreateTodo(Todo{GroupID: groupID, Text: date.Format(time.DateOnly), OwnerEmail: email, DueUnix: uint64(date.Unix())})
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+	weekStart := time.Date(2025, 10, 27, 0, 0, 0, 0, newYork)
+	todos, err = db.GetUserTodosScheduledBetween(email, uint64(weekStart.Unix()), uint64(weekStart.AddDate(0, 0, 7).Unix()), newYork)
+	if err != nil {
+		t.Fatalf("failed to get scheduled TODOs: %s", err)
+	}
+	if len(todos) != 2 || todos[0].Text != "2025-10-27" || todos[1].Text != "2025-11-02" {
+		t.Fatalf("expected TODOs due on 2025-10-27 and 2025-11-02 in New York, got %+v", todos)
+	}
+}
+
+func TestTodoStart(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_start_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	now := uint64(time.Now().Unix())
+	dueSoon := now + 60*60
+	visibleID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "visible", OwnerEmail: email, DueUnix: dueSoon, DueHasTime: true})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	snoozedID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "snoozed", OwnerEmail: email, DueUnix: dueSoon, DueHasTime: true, StartUnix: now + 60*60*24})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	due, err := db.GetUserTodosDue(email, 60*60*2, time.UTC)
+	if err != nil {
+		t.Fatalf("failed to get due TODOs: %s", err)
+	}
+	if len(due) != 1 || due[0].ID != visibleID {
+		t.Fatalf("snoozed TODOs must not be reminded of, got %+v", due)
+	}
+
+	started, err := db.GetUserTodosStartedBetween(email, now, now+60*60*24)
+	if err != nil {
+		t.Fatalf("failed to get started TODOs: %s", err)
+	}
+	if len(started) != 1 || started[0].ID != snoozedID || !started[0].IsDeferred(now) {
+		t.Fatalf("expected snoozed TODO to start within a day, got %+v", started)
+	}
+
+	err = db.TodoSetStart(snoozedID, 0)
+	if err != nil {
+		t.Fatalf("failed to unsnooze TODO: %s", err)
+	}
+
+	todo, err := db.GetTodo(snoozedID)
+	if err != nil {
+		t.Fatalf("failed to get TODO: %s", err)
+	}
+	if todo.IsDeferred(now) {
+		t.Fatalf("unsnoozed TODO must be visible")
+	}
+}
+
+func TestTodoClearPriorityAndRecurrence(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_clear_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	todoID, err := db.CreateTodo(Todo{
+		GroupID: groupID, Text: "weekly", OwnerEmail: email, DueUnix: uint64(time.Now().Unix()),
+		Priority: PriorityHigh, RecurUnit: RecurWeek, RecurInterval: 1,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	todo, err := db.GetTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to get TODO: %s", err)
+	}
+	todo.Priority = PriorityNone
+	todo.RecurUnit = RecurNone
+	err = db.UpdateTodoSoft(todoID, *todo)
+	if err != nil {
+		t.Fatalf("failed to update TODO: %s", err)
+	}
+
+	todo, err = db.GetTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to get TODO: %s", err)
+	}
+	if todo.Priority != PriorityNone || todo.RecurUnit != RecurNone || todo.RecurInterval != 0 || todo.IsRecurring() {
+		t.Fatalf("expected priority and recurrence to be cleared, got %+v", todo)
+	}
+	if todo.Text != "weekly" || todo.GroupID != groupID {
+		t.Fatalf("other fields must stay, got %+v", todo)
+	}
+}
+
+func TestTodoComments(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_comments_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	todoID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "discussed", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	for i, body := range []string{"first", "second"} {
+		_, err = db.CreateTodoComment(TodoComment{TodoID: todoID, AuthorEmail: email, Body: body, CreatedUnix: uint64(i + 1)})
+		if err != nil {
+			t.Fatalf("failed to create comment: %s", err)
+		}
+	}
+
+	comments, err := db.GetTodoComments(todoID)
+	if err != nil {
+		t.Fatalf("failed to get comments: %s", err)
+	}
+	if len(comments) != 2 || comments[0].Body != "first" || comments[1].Body != "second" {
+		t.Fatalf("expected two comments oldest first, got %+v", comments)
+	}
+
+	err = db.UpdateTodoComment(comments[0].ID, "edited", 10)
+	if err != nil {
+		t.Fatalf("failed to update comment: %s", err)
+	}
+
+	comment, err := db.GetTodoComment(comments[0].ID)
+	if err != nil {
+		t.Fatalf("failed to get comment: %s", err)
+	}
+	if comment.Body != "edited" || comment.UpdatedUnix != 10 {
+		t.Fatalf("comment was not updated: %+v", comment)
+	}
+
+	err = db.DeleteTodoComment(comments[1].ID)
+	if err != nil {
+		t.Fatalf("failed to delete comment: %s", err)
+	}
+
+	// Comments go away together with their TODO
+	err = db.DeleteTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to delete TODO: %s", err)
+	}
+
+	_, err = db.GetTodoComment(comments[0].ID)
+	if err == nil {
+		t.Fatalf("comment of deleted TODO must be deleted as well")
+	}
+}
+
+func TestTodoRevisions(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_revisions_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	firstID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "first", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	secondID, err := db.CreateTodo(Todo{GroupID: groupID, Text: "second", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	cursor, err := db.GetSyncRevision()
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+
+	changed, err := db.GetUserTodosChangedSince(email, 0, cursor, 100)
+	if err != nil {
+		t.Fatalf("failed to get changed TODOs: %s", err)
+	}
+	if len(changed) != 2 || changed[0].ID != firstID || changed[1].Revision <= changed[0].Revision {
+		t.Fatalf("expected both TODOs in order of creation, got %+v", changed)
+	}
+	if changed[0].UpdatedUnix == 0 {
+		t.Fatalf("created TODO must have an update time")
+	}
+
+	limited, err := db.GetUserTodosChangedSince(email, 0, cursor, 1)
+	if err != nil || len(limited) != 1 || limited[0].ID != firstID {
+		t.Fatalf("expected only the earliest change, got %+v (%v)", limited, err)
+	}
+
+	// Only the changed one is reported after the cursor
+	err = db.UpdateTodoSoft(firstID, Todo{Text: "first edited"})
+	if err != nil {
+		t.Fatalf("failed to update TODO: %s", err)
+	}
+	err = db.DeleteTodo(secondID)
+	if err != nil {
+		t.Fatalf("failed to delete TODO: %s", err)
+	}
+
+	newCursor, err := db.GetSyncRevision()
+	if err != nil {
+		t.Fatalf("failed to get revision: %s", err)
+	}
+
+	changed, err = db.GetUserTodosChangedSince(email, cursor, newCursor, 100)
+	if err != nil {
+		t.Fatalf("failed to get changed TODOs: %s", err)
+	}
+	if len(changed) != 1 || changed[0].Text != "first edited" {
+		t.Fatalf("expected only the edited TODO, got %+v", changed)
+	}
+
+	deleted, err := db.GetUserTodoTombstonesSince(email, cursor, newCursor, 100)
+	if err != nil {
+		t.Fatalf("failed to get tombstones: %s", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != secondID {
+		t.Fatalf("expected a tombstone of TODO %d, got %v", secondID, deleted)
+	}
+
+	changed, err = db.GetUserTodosChangedSince("other@mail.ru", 0, newCursor, 100)
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("other user must not see these TODOs, got %d (%v)", len(changed), err)
+	}
+
+	// Groups share the revisions
+	err = db.UpdateTodoGroup(groupID, TodoGroup{Name: "renamed", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to update group: %s", err)
+	}
+
+	groups, err := db.GetUserTodoGroupsChangedSince(email, newCursor, newCursor+10, 100)
+	if err != nil || len(groups) != 1 || groups[0].Name != "renamed" || groups[0].Revision != newCursor+1 {
+		t.Fatalf("expected the renamed group right after the cursor, got %+v (%v)", groups, err)
+	}
+
+	err = db.DeleteTodoGroup(groupID)
+	if err != nil {
+		t.Fatalf("failed to delete group: %s", err)
+	}
+
+	groupTombstones, err := db.GetUserGroupTombstonesSince(email, newCursor, newCursor+10, 100)
+	if err != nil || len(groupTombstones) != 1 || groupTombstones[0].ID != groupID {
+		t.Fatalf("expected a tombstone of group %d, got %v (%v)", groupID, groupTombstones, err)
+	}
+}
+
+func TestRevisionBackfill(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_backfill_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	groupID, err := db.CreateTodoGroup(TodoGroup{Name: "group1", OwnerEmail: email, Removable: true, TimeCreatedUnix: 100})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		_, err = db.CreateTodo(Todo{GroupID: groupID, Text: fmt.Sprint(i), OwnerEmail: email, TimeCreatedUnix: i * 100})
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	// As it was before revisions
+	for _, revisioned := range revisionedTables {
+		for _, statement := range []string{
+			"DROP TRIGGER %s_revision_insert",
+			"DROP TRIGGER %s_revision_update",
+			"DROP TRIGGER %s_tombstone",
+			"DROP INDEX %s_revision",
+			"ALTER TABLE %s DROP COLUMN updated_unix",
+			"ALTER TABLE %s DROP COLUMN revision",
+		} {
+			_, err = db.Exec(fmt.Sprintf(statement, revisioned.Table))
+			if err != nil {
+				t.Fatalf("failed to downgrade %s: %s", revisioned.Table, err)
+			}
+		}
+	}
+	_, err = db.Exec("UPDATE sync_state SET revision=0")
+	if err != nil {
+		t.Fatalf("failed to reset revision: %s", err)
+	}
+	db.Close()
+
+	db, err = FromFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer db.Close()
+
+	cursor, err := db.GetSyncRevision()
+	if err != nil || cursor != 4 {
+		t.Fatalf("expected revision 4 after the backfill, got %d: %v", cursor, err)
+	}
+	todos, err := db.GetUserTodosChangedSince(email, 0, cursor, 100)
+	if err != nil || len(todos) != 3 {
+		t.Fatalf("expected 3 changed TODOs, got %+v: %v", todos, err)
+	}
+	for i, todo := range todos {
+		if todo.Revision != uint64(i+1) || todo.UpdatedUnix != todo.TimeCreatedUnix {
+			t.Errorf("expected TODO %s to get revision %d and update time %d, got %d and %d",
+				todo.Text, i+1, todo.TimeCreatedUnix, todo.Revision, todo.UpdatedUnix)
+		}
+	}
+	groups, err := db.GetUserTodoGroupsChangedSince(email, 0, cursor, 100)
+	if err != nil || len(groups) != 1 || groups[0].Revision != 4 || groups[0].UpdatedUnix != 100 {
+		t.Fatalf("expected the group to get revision 4, got %+v: %v", groups, err)
+	}
+
+	// Done once, opening again changes nothing
+	db.Close()
+	db, err = FromFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	if again, _ := db.GetSyncRevision(); again != cursor {
+		t.Fatalf("expected revision to stay %d, got %d", cursor, again)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_maintenance_test.db")
+	backupPath := filepath.Join(os.TempDir(), "dela_maintenance_test_backup.db")
+	os.Remove(backupPath)
+	defer os.Remove(dbPath)
+	defer os.Remove(backupPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	err = db.CreateUser(User{Email: email, Password: "ruohguoeruoger"})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	if _, err := Open(filepath.Join(os.TempDir(), "dela_no_such.db")); err == nil {
+		t.Fatal("opened a database that does not exist")
+	}
+
+	// Tables and columns of older versions are added
+	_, err = db.Exec("ALTER TABLE users DROP COLUMN timezone")
+	if err != nil {
+		t.Fatalf("failed to drop column: %s", err)
+	}
+	_, err = db.Exec("DROP TABLE group_tombstones")
+	if err != nil {
+		t.Fatalf("failed to drop table: %s", err)
+	}
+	added, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if len(added) != 2 || added[0] != "group_tombstones" || added[1] != "users.timezone" {
+		t.Fatalf("expected group_tombstones and users.timezone to be added, got %v", added)
+	}
+	added, err = db.Migrate()
+	if err != nil || len(added) != 0 {
+		t.Fatalf("second migration added %v: %v", added, err)
+	}
+	if _, err := db.GetUser(email); err != nil {
+		t.Fatalf("failed to get user after migration: %s", err)
+	}
+
+	problems, err := db.Check()
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("fresh database has problems %v: %v", problems, err)
+	}
+	err = db.Vacuum()
+	if err != nil {
+		t.Fatalf("failed to vacuum: %s", err)
+	}
+
+	err = db.BackupTo(backupPath)
+	if err != nil {
+		t.Fatalf("failed to back up: %s", err)
+	}
+	if err := db.BackupTo(backupPath); err == nil {
+		t.Fatal("backup overwrote an existing file")
+	}
+
+	backup, err := Open(backupPath)
+	if err != nil {
+		t.Fatalf("failed to open backup: %s", err)
+	}
+	defer backup.Close()
+	if _, err := backup.GetUser(email); err != nil {
+		t.Fatalf("user is missing in backup: %s", err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_restore_test.db")
+	backupPath := filepath.Join(os.TempDir(), "dela_restore_test_backup.db")
+	compressedPath := backupPath + CompressedBackupExt
+	damagedPath := filepath.Join(os.TempDir(), "dela_restore_test_damaged.db")
+	for _, path := range []string{dbPath, backupPath, compressedPath, damagedPath} {
+		os.Remove(path)
+		defer os.Remove(path)
+	}
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	email := "user1@mail.ru"
+	err = db.CreateUser(User{Email: email, Password: "ruohguoeruoger"})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+
+	err = db.BackupTo(backupPath)
+	if err != nil {
+		t.Fatalf("failed to back up: %s", err)
+	}
+	err = db.BackupCompressedTo(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to back up compressed: %s", err)
+	}
+	if err := db.BackupCompressedTo(compressedPath); err == nil {
+		t.Fatal("compressed backup overwrote an existing file")
+	}
+	if _, err := os.Stat(compressedPath + ".tmp"); err == nil {
+		t.Fatal("uncompressed copy was left behind")
+	}
+
+	// Changes made after the backup are lost on restore
+	err = db.DeleteUserClean(email)
+	if err != nil {
+		t.Fatalf("failed to delete user: %s", err)
+	}
+	db.Close()
+
+	err = os.WriteFile(damagedPath, []byte("definitely not a database"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write damaged backup: %s", err)
+	}
+	if err := Restore(damagedPath, dbPath); err == nil {
+		t.Fatal("restored a damaged backup")
+	}
+
+	for _, path := range []string{compressedPath, backupPath} {
+		err = Restore(path, dbPath)
+		if err != nil {
+			t.Fatalf("failed to restore %s: %s", path, err)
+		}
+
+		db, err = FromFile(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open restored database: %s", err)
+		}
+		if _, err := db.GetUser(email); err != nil {
+			t.Fatalf("user is missing after restoring %s: %s", path, err)
+		}
+		db.Close()
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_outbox_test.db")
+	defer os.Remove(dbPath)
+
+	db, err := Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer db.Close()
+
+	recipient := "user1@mail.ru"
+	var now uint64 = 1000
+	for _, nextAttempt := range []uint64{now + 60, now - 10, now, now - 20} {
+		err = db.CreateOutboxEmail(OutboxEmail{
+			Recipient:       recipient,
+			Subject:         "subject",
+			Message:         []byte("message"),
+			Status:          OutboxPending,
+			NextAttemptUnix: nextAttempt,
+			CreatedUnix:     now - 100,
+		})
+		if err != nil {
+			t.Fatalf("failed to create outbox email: %s", err)
+		}
+	}
+
+	// Only emails whose time has come are taken, the most overdue first
+	due, err := db.GetDueOutboxEmails(now, 2)
+	if err != nil {
+		t.Fatalf("failed to get due emails: %s", err)
+	}
+	if len(due) != 2 || due[0].ID != 4 || due[1].ID != 2 {
+		t.Fatalf("expected emails 4 and 2 to be due, got %+v", due)
+	}
+	if string(due[0].Message) != "message" || due[0].Attempts != 0 {
+		t.Fatalf("unexpected due email %+v", due[0])
+	}
+
+	// A failed email is rescheduled and is not due until then
+	err = db.OutboxEmailSetFailed(4, OutboxPending, now+300, "connection refused")
+	if err != nil {
+		t.Fatalf("failed to record failed attempt: %s", err)
+	}
+	err = db.OutboxEmailSetFailed(2, OutboxDead, 0, "mailbox does not exist")
+	if err != nil {
+		t.Fatalf("failed to record failed attempt: %s", err)
+	}
+	due, err = db.GetDueOutboxEmails(now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != 3 {
+		t.Fatalf("expected only email 3 to be due, got %+v: %v", due, err)
+	}
+	failed, err := db.GetOutboxEmail(4)
+	if err != nil || failed.Attempts != 1 || failed.LastError != "connection refused" || failed.NextAttemptUnix != now+300 {
+		t.Fatalf("expected the failed attempt to be recorded, got %+v: %v", failed, err)
+	}
+	due, err = db.GetDueOutboxEmails(now+300, 10)
+	if err != nil || len(due) != 3 || due[0].ID != 3 || due[1].ID != 1 || due[2].ID != 4 {
+		t.Fatalf("expected emails 3, 1 and 4 to be due later, got %+v: %v", due, err)
+	}
+
+	// Postponing does not count as an attempt
+	err = db.OutboxEmailPostpone(3, now+600)
+	if err != nil {
+		t.Fatalf("failed to postpone email: %s", err)
+	}
+	postponed, err := db.GetOutboxEmail(3)
+	if err != nil || postponed.Attempts != 0 || postponed.NextAttemptUnix != now+600 {
+		t.Fatalf("expected the email to be postponed without an attempt, got %+v: %v", postponed, err)
+	}
+
+	// Dead emails can be requeued by hand, starting over
+	err = db.OutboxEmailRequeue(2, now)
+	if err != nil {
+		t.Fatalf("failed to requeue email: %s", err)
+	}
+	requeued, err := db.GetOutboxEmail(2)
+	if err != nil || requeued.Status != OutboxPending || requeued.Attempts != 0 || requeued.NextAttemptUnix != now {
+		t.Fatalf("expected the email to be pending again, got %+v: %v", requeued, err)
+	}
+
+	err = db.OutboxEmailSetSent(2, now)
+	if err != nil {
+		t.Fatalf("failed to mark email as sent: %s", err)
+	}
+	sentCount, err := db.CountOutboxEmailsSentTo(recipient, now-60)
+	if err != nil || sentCount != 1 {
+		t.Fatalf("expected 1 email to be sent recently, got %d: %v", sentCount, err)
+	}
+	due, err = db.GetDueOutboxEmails(now, 10)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("expected no emails to be due, got %+v: %v", due, err)
+	}
+
+	err = db.DeleteSentOutboxEmails(now + 1)
+	if err != nil {
+		t.Fatalf("failed to delete sent emails: %s", err)
+	}
+	if _, err := db.GetOutboxEmail(2); err == nil {
+		t.Fatal("sent email was not deleted")
+	}
+}
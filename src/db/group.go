@@ -29,7 +29,16 @@ type TodoGroup struct {
 	TimeCreatedUnix uint64 `json:"timeCreatedUnix"`
 	OwnerEmail      string `json:"ownerEmail"`
 	Removable       bool   `json:"removable"`
-	TimeCreated     string
+	// 0 if not in the trash
+	DeletedAtUnix uint64 `json:"deletedAtUnix"`
+	// Whether the group is shown as a board of status columns instead of a list
+	BoardView bool `json:"boardView"`
+	// Set by the database whenever the group changes. Shares the sequence with TODO revisions
+	Revision uint64 `json:"revision"`
+	// When the group was changed the last time
+	UpdatedUnix uint64 `json:"updatedUnix"`
+	TimeCreated string
+	DeletedAt   string
 }
 
 func NewTodoGroup(name string, timeCreatedUnix uint64, ownerEmail string, removable bool) TodoGroup {
@@ -41,17 +50,22 @@ func NewTodoGroup(name string, timeCreatedUnix uint64, ownerEmail string, remova
 	}
 }
 
-// Creates a new TODO group in the database
-func (db *DB) CreateTodoGroup(group TodoGroup) error {
-	_, err := db.Exec(
-		"INSERT INTO todo_groups(name, time_created_unix, owner_email, removable) VALUES(?, ?, ?, ?)",
+// Creates a new TODO group in the database and returns its ID
+func (db *DB) CreateTodoGroup(group TodoGroup) (uint64, error) {
+	result, err := db.Exec(
+		"INSERT INTO todo_groups(name, time_created_unix, owner_email, removable, board_view) VALUES(?, ?, ?, ?, ?)",
 		group.Name,
 		group.TimeCreatedUnix,
 		group.OwnerEmail,
 		group.Removable,
+		group.BoardView,
 	)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	id, err := result.LastInsertId()
+	return uint64(id), err
 }
 
 func scanTodoGroup(rows *sql.Rows) (*TodoGroup, error) {
@@ -62,6 +76,10 @@ func scanTodoGroup(rows *sql.Rows) (*TodoGroup, error) {
 		&newTodoGroup.TimeCreatedUnix,
 		&newTodoGroup.OwnerEmail,
 		&newTodoGroup.Removable,
+		&newTodoGroup.DeletedAtUnix,
+		&newTodoGroup.BoardView,
+		&newTodoGroup.Revision,
+		&newTodoGroup.UpdatedUnix,
 	)
 	if err != nil {
 		return nil, err
@@ -69,6 +87,7 @@ func scanTodoGroup(rows *sql.Rows) (*TodoGroup, error) {
 
 	// Convert to Basic time string
 	newTodoGroup.TimeCreated = unixToTimeStr(newTodoGroup.TimeCreatedUnix)
+	newTodoGroup.DeletedAt = unixToTimeStr(newTodoGroup.DeletedAtUnix)
 
 	return &newTodoGroup, nil
 }
@@ -115,7 +134,7 @@ func (db *DB) GetTodoGroups() ([]*TodoGroup, error) {
 }
 
 func (db *DB) GetGroupTodos(groupId uint64) ([]*Todo, error) {
-	rows, err := db.Query("SELECT * FROM todos WHERE group_id=?", groupId)
+	rows, err := db.Query("SELECT * FROM todos WHERE group_id=? AND deleted_at_unix=0 AND archived_at_unix=0", groupId)
 	if err != nil {
 		return nil, err
 	}
@@ -157,10 +176,192 @@ func (db *DB) DeleteTodoGroupClean(groupId uint64) error {
 		"DELETE FROM todo_groups WHERE id=?",
 		groupId,
 	)
+	if err != nil {
+		return err
+	}
+
+	err = db.deleteOrphanTodoData()
+	if err != nil {
+		return err
+	}
+
+	return db.deleteOrphanBoardColumns()
+}
+
+// Moves the group and all of its TODOs to the trash
+func (db *DB) SoftDeleteTodoGroup(groupId uint64, deletedAtUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE todos SET deleted_at_unix=? WHERE group_id=? AND deleted_at_unix=0",
+		deletedAtUnix,
+		groupId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE todo_groups SET deleted_at_unix=? WHERE id=?",
+		deletedAtUnix,
+		groupId,
+	)
+
+	return err
+}
+
+/*
+Takes the group out of the trash together with TODOs that were deleted along with it.
+TODOs deleted separately before the group stay in the trash
+*/
+func (db *DB) RestoreTodoGroup(groupId uint64) error {
+	group, err := db.GetTodoGroup(groupId)
+	if err != nil {
+		return err
+	}
+
+	if group.DeletedAtUnix == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = restoreTodoGroup(tx, groupId, group.DeletedAtUnix)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Takes the group deleted at given time out of the trash together with TODOs that were deleted along with it
+func restoreTodoGroup(tx *sql.Tx, groupId uint64, deletedAtUnix uint64) error {
+	_, err := tx.Exec(
+		"UPDATE todos SET deleted_at_unix=0 WHERE group_id=? AND deleted_at_unix=?",
+		groupId,
+		deletedAtUnix,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE todo_groups SET deleted_at_unix=0 WHERE id=?", groupId)
 
 	return err
 }
 
+// Retrieves user's TODO groups that are in the trash, most recently deleted first
+func (db *DB) GetDeletedUserTodoGroups(email string) ([]*TodoGroup, error) {
+	rows, err := db.Query(
+		"SELECT * FROM todo_groups WHERE owner_email=? AND deleted_at_unix>0 ORDER BY deleted_at_unix DESC",
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*TodoGroup
+	for rows.Next() {
+		group, err := scanTodoGroup(rows)
+		if err != nil {
+			return groups, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// Retrieves user's TODOs that are in the trash, most recently deleted first
+func (db *DB) GetDeletedUserTodos(email string) ([]*Todo, error) {
+	rows, err := db.Query(
+		"SELECT * FROM todos WHERE owner_email=? AND deleted_at_unix>0 ORDER BY deleted_at_unix DESC",
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return todos, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
+
+// Permanently deletes user's TODOs and groups that are in the trash
+func (db *DB) EmptyUserTrash(email string) error {
+	_, err := db.Exec(
+		"DELETE FROM todos WHERE owner_email=? AND (deleted_at_unix>0 OR group_id IN (SELECT id FROM todo_groups WHERE deleted_at_unix>0))",
+		email,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM todo_groups WHERE owner_email=? AND deleted_at_unix>0", email)
+	if err != nil {
+		return err
+	}
+
+	err = db.deleteOrphanTodoData()
+	if err != nil {
+		return err
+	}
+
+	return db.deleteOrphanBoardColumns()
+}
+
+// Permanently deletes TODOs and groups that were put into the trash before given time
+func (db *DB) PurgeDeleted(olderThanUnix uint64) (int64, error) {
+	todosResult, err := db.Exec(
+		"DELETE FROM todos WHERE (deleted_at_unix>0 AND deleted_at_unix<?) OR group_id IN (SELECT id FROM todo_groups WHERE deleted_at_unix>0 AND deleted_at_unix<?)",
+		olderThanUnix,
+		olderThanUnix,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	groupsResult, err := db.Exec(
+		"DELETE FROM todo_groups WHERE deleted_at_unix>0 AND deleted_at_unix<?",
+		olderThanUnix,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.deleteOrphanBoardColumns()
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.deleteOrphanTodoData()
+	if err != nil {
+		return 0, err
+	}
+
+	deletedTodos, err := todosResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	deletedGroups, err := groupsResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return deletedTodos + deletedGroups, nil
+}
+
 // Updates TODO group's name
 func (db *DB) UpdateTodoGroup(groupID uint64, updatedGroup TodoGroup) error {
 	_, err := db.Exec(
@@ -172,6 +373,16 @@ func (db *DB) UpdateTodoGroup(groupID uint64, updatedGroup TodoGroup) error {
 	return err
 }
 
+// Returns true if the group is in the trash. TODOs must not be added to such groups
+func (db *DB) IsTodoGroupInTrash(groupId uint64) bool {
+	group, err := db.GetTodoGroup(groupId)
+	if err != nil {
+		return false
+	}
+
+	return group.DeletedAtUnix != 0
+}
+
 func (db *DB) DoesUserOwnGroup(groupId uint64, email string) bool {
 	group, err := db.GetTodoGroup(groupId)
 	if err != nil {
@@ -0,0 +1,145 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+// A downscaled copy of TODO's image
+type TodoThumbnail struct {
+	TodoID uint64
+	// Longest side in pixels
+	Size uint64
+	// ETag of the image the thumbnail was made of
+	ETag        string
+	ContentType string
+	Data        []byte
+}
+
+// Retrieves only the image of the TODO
+func (db *DB) GetTodoImage(todoID uint64) ([]byte, error) {
+	var image []byte
+	err := db.QueryRow("SELECT image FROM todos WHERE id=?", todoID).Scan(&image)
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// Replaces TODO's image. nil removes it
+func (db *DB) UpdateTodoImage(todoID uint64, image []byte) error {
+	_, err := db.Exec("UPDATE todos SET image=? WHERE id=?", image, todoID)
+	if err != nil {
+		return err
+	}
+
+	return db.deleteTodoImageDerivatives(todoID)
+}
+
+// Deletes thumbnails and the sketch of TODO's image after it was replaced
+func (db *DB) deleteTodoImageDerivatives(todoID uint64) error {
+	_, err := db.Exec("DELETE FROM todo_thumbnails WHERE todo_id=?", todoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM todo_sketches WHERE todo_id=?", todoID)
+	return err
+}
+
+// Retrieves the vector document TODO's image was drawn from
+func (db *DB) GetTodoSketch(todoID uint64) (string, error) {
+	var document string
+	err := db.QueryRow("SELECT document FROM todo_sketches WHERE todo_id=?", todoID).Scan(&document)
+	if err != nil {
+		return "", err
+	}
+
+	return document, nil
+}
+
+// Sets TODO's image to the rendered sketch and keeps the sketch's vector document for editing
+func (db *DB) SetTodoSketch(todoID uint64, document string, rendered []byte, updatedUnix uint64) error {
+	err := db.UpdateTodoImage(todoID, rendered)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO todo_sketches(todo_id, document, updated_unix) VALUES(?, ?, ?)",
+		todoID,
+		document,
+		updatedUnix,
+	)
+
+	return err
+}
+
+// Retrieves IDs of TODOs whose images are still stored as data URLs
+func (db *DB) GetTodosWithDataURLImages() ([]uint64, error) {
+	rows, err := db.Query("SELECT id FROM todos WHERE substr(image, 1, 5)=CAST('data:' AS BLOB)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		err = rows.Scan(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Retrieves a thumbnail of given size made of the image with given ETag
+func (db *DB) GetTodoThumbnail(todoID uint64, size uint64, etag string) (*TodoThumbnail, error) {
+	thumbnail := TodoThumbnail{
+		TodoID: todoID,
+		Size:   size,
+		ETag:   etag,
+	}
+	err := db.QueryRow(
+		"SELECT content_type, data FROM todo_thumbnails WHERE todo_id=? AND size=? AND etag=?",
+		todoID,
+		size,
+		etag,
+	).Scan(&thumbnail.ContentType, &thumbnail.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &thumbnail, nil
+}
+
+// Saves the thumbnail, replacing previous one of the same size
+func (db *DB) SaveTodoThumbnail(thumbnail TodoThumbnail) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO todo_thumbnails(todo_id, size, etag, content_type, data) VALUES(?, ?, ?, ?, ?)",
+		thumbnail.TodoID,
+		thumbnail.Size,
+		thumbnail.ETag,
+		thumbnail.ContentType,
+		thumbnail.Data,
+	)
+
+	return err
+}
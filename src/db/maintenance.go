@@ -0,0 +1,189 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Opens an existing database as is, without creating or migrating tables
+func Open(path string) (*DB, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening does not touch the file yet
+	err = driver.Ping()
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+
+	return &DB{driver}, nil
+}
+
+// Returns names of all tables and their columns as "table" and "table.column"
+func (db *DB) schema() (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	schema := make(map[string]bool)
+	for _, table := range tables {
+		schema[table] = true
+
+		columns, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+		if err != nil {
+			return nil, err
+		}
+		for columns.Next() {
+			var column string
+			err = columns.Scan(&column)
+			if err != nil {
+				columns.Close()
+				return nil, err
+			}
+			schema[table+"."+column] = true
+		}
+		columns.Close()
+	}
+
+	return schema, nil
+}
+
+/*
+Creates missing tables, columns, indexes and triggers.
+Returns added tables and columns as "table" and "table.column"
+*/
+func (db *DB) Migrate() ([]string, error) {
+	before, err := db.schema()
+	if err != nil {
+		return nil, err
+	}
+
+	err = setUpTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := db.schema()
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for name := range after {
+		if before[name] {
+			continue
+		}
+
+		// Columns of new tables are not worth mentioning
+		table, _, isColumn := strings.Cut(name, ".")
+		if isColumn && !before[table] {
+			continue
+		}
+		added = append(added, name)
+	}
+	sort.Strings(added)
+
+	return added, nil
+}
+
+// Looks for corruption and references to missing rows. Returns found problems, none if the database is fine
+func (db *DB) Check() ([]string, error) {
+	var problems []string
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var result string
+		err = rows.Scan(&result)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			table  string
+			rowID  sql.NullInt64
+			parent string
+			fkID   int64
+		)
+		err = rows.Scan(&table, &rowID, &parent, &fkID)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, fmt.Sprintf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent))
+	}
+
+	return problems, nil
+}
+
+// Rebuilds the database file, giving space taken by deleted data back to the system
+func (db *DB) Vacuum() error {
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
+// Writes a consistent copy of the database into a new file. Safe to do while the database is in use
+func (db *DB) BackupTo(path string) error {
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	_, err = db.Exec("VACUUM INTO ?", path)
+	return err
+}
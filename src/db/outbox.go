@@ -0,0 +1,218 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+)
+
+const (
+	// Waiting to be sent (again)
+	OutboxPending string = "pending"
+	// Successfully handed over to the mail server
+	OutboxSent string = "sent"
+	// Gave up sending after too many failed attempts
+	OutboxDead string = "dead"
+)
+
+// An email waiting in the outbox. Every recipient gets their own entry
+type OutboxEmail struct {
+	ID              uint64 `json:"id"`
+	Sender          string `json:"sender"`
+	Recipient       string `json:"recipient"`
+	Subject         string `json:"subject"`
+	Message         []byte `json:"-"`
+	Status          string `json:"status"`
+	Attempts        uint64 `json:"attempts"`
+	NextAttemptUnix uint64 `json:"nextAttemptUnix"`
+	LastError       string `json:"lastError"`
+	CreatedUnix     uint64 `json:"createdUnix"`
+	SentUnix        uint64 `json:"sentUnix"`
+	Created         string `json:"created"`
+	NextAttempt     string `json:"nextAttempt"`
+}
+
+func scanOutboxEmail(rows *sql.Rows) (*OutboxEmail, error) {
+	var outboxEmail OutboxEmail
+	err := rows.Scan(
+		&outboxEmail.ID,
+		&outboxEmail.Sender,
+		&outboxEmail.Recipient,
+		&outboxEmail.Subject,
+		&outboxEmail.Message,
+		&outboxEmail.Status,
+		&outboxEmail.Attempts,
+		&outboxEmail.NextAttemptUnix,
+		&outboxEmail.LastError,
+		&outboxEmail.CreatedUnix,
+		&outboxEmail.SentUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	outboxEmail.Created = unixToTimeStr(outboxEmail.CreatedUnix)
+	outboxEmail.NextAttempt = unixToTimeStr(outboxEmail.NextAttemptUnix)
+
+	return &outboxEmail, nil
+}
+
+func scanOutboxEmails(rows *sql.Rows) ([]*OutboxEmail, error) {
+	var outboxEmails []*OutboxEmail
+	for rows.Next() {
+		outboxEmail, err := scanOutboxEmail(rows)
+		if err != nil {
+			return outboxEmails, err
+		}
+		outboxEmails = append(outboxEmails, outboxEmail)
+	}
+
+	return outboxEmails, nil
+}
+
+// Puts a new email into the outbox
+func (db *DB) CreateOutboxEmail(outboxEmail OutboxEmail) error {
+	_, err := db.Exec(
+		"INSERT INTO outbox(sender, recipient, subject, message, status, attempts, next_attempt_unix, last_error, created_unix, sent_unix) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		outboxEmail.Sender,
+		outboxEmail.Recipient,
+		outboxEmail.Subject,
+		outboxEmail.Message,
+		outboxEmail.Status,
+		outboxEmail.Attempts,
+		outboxEmail.NextAttemptUnix,
+		outboxEmail.LastError,
+		outboxEmail.CreatedUnix,
+		outboxEmail.SentUnix,
+	)
+
+	return err
+}
+
+// Retrieves an outbox email with given ID
+func (db *DB) GetOutboxEmail(id uint64) (*OutboxEmail, error) {
+	rows, err := db.Query("SELECT * FROM outbox WHERE id=?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rows.Next()
+	outboxEmail, err := scanOutboxEmail(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return outboxEmail, nil
+}
+
+// Retrieves up to limit pending emails whose next attempt time has come, oldest first
+func (db *DB) GetDueOutboxEmails(nowUnix uint64, limit uint64) ([]*OutboxEmail, error) {
+	rows, err := db.Query(
+		"SELECT * FROM outbox WHERE status=? AND next_attempt_unix<=? ORDER BY next_attempt_unix, id LIMIT ?",
+		OutboxPending,
+		nowUnix,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxEmails(rows)
+}
+
+// Retrieves all outbox emails with given status, newest first
+func (db *DB) GetOutboxEmailsByStatus(status string) ([]*OutboxEmail, error) {
+	rows, err := db.Query("SELECT * FROM outbox WHERE status=? ORDER BY created_unix DESC", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxEmails(rows)
+}
+
+// Counts how many emails were sent to the recipient since given time
+func (db *DB) CountOutboxEmailsSentTo(recipient string, sinceUnix uint64) (uint64, error) {
+	var count uint64
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM outbox WHERE recipient=? AND status=? AND sent_unix>=?",
+		recipient,
+		OutboxSent,
+		sinceUnix,
+	).Scan(&count)
+
+	return count, err
+}
+
+// Marks outbox email as successfully sent
+func (db *DB) OutboxEmailSetSent(id uint64, sentUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE outbox SET status=?, sent_unix=?, attempts=attempts+1, last_error='' WHERE id=?",
+		OutboxSent,
+		sentUnix,
+		id,
+	)
+
+	return err
+}
+
+// Records a failed sending attempt and sets new status and next attempt time
+func (db *DB) OutboxEmailSetFailed(id uint64, status string, nextAttemptUnix uint64, lastError string) error {
+	_, err := db.Exec(
+		"UPDATE outbox SET status=?, next_attempt_unix=?, last_error=?, attempts=attempts+1 WHERE id=?",
+		status,
+		nextAttemptUnix,
+		lastError,
+		id,
+	)
+
+	return err
+}
+
+// Postpones sending without counting it as a failed attempt
+func (db *DB) OutboxEmailPostpone(id uint64, nextAttemptUnix uint64) error {
+	_, err := db.Exec("UPDATE outbox SET next_attempt_unix=? WHERE id=?", nextAttemptUnix, id)
+	return err
+}
+
+// Puts an email back into the queue to be sent as soon as possible
+func (db *DB) OutboxEmailRequeue(id uint64, nowUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE outbox SET status=?, next_attempt_unix=?, attempts=0 WHERE id=?",
+		OutboxPending,
+		nowUnix,
+		id,
+	)
+
+	return err
+}
+
+// Deletes outbox email with given ID
+func (db *DB) DeleteOutboxEmail(id uint64) error {
+	_, err := db.Exec("DELETE FROM outbox WHERE id=?", id)
+	return err
+}
+
+// Deletes sent emails older than given time
+func (db *DB) DeleteSentOutboxEmails(olderThanUnix uint64) error {
+	_, err := db.Exec("DELETE FROM outbox WHERE status=? AND sent_unix<?", OutboxSent, olderThanUnix)
+	return err
+}
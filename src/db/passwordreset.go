@@ -0,0 +1,87 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+// Creates a password reset for the user, invalidating their previous ones
+func (db *DB) CreatePasswordReset(email string, tokenHash string, issuedUnix uint64, lifeSeconds uint64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM password_resets WHERE email=?", email)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO password_resets(email, token_hash, issued_unix, life_seconds) VALUES(?, ?, ?, ?)",
+		email,
+		tokenHash,
+		issuedUnix,
+		lifeSeconds,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+Sets a new password for the user the unexpired reset with given token hash was issued to
+and deletes all of their resets, so that each link works only once.
+Returns the email of the user or sql.ErrNoRows if there is no such reset
+*/
+func (db *DB) ResetUserPassword(tokenHash string, password string, nowUnix uint64) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRow(
+		"SELECT email FROM password_resets WHERE token_hash=? AND issued_unix + life_seconds > ?",
+		tokenHash,
+		nowUnix,
+	).Scan(&email)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("UPDATE users SET password=? WHERE email=?", password, email)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("DELETE FROM password_resets WHERE email=?", email)
+	if err != nil {
+		return "", err
+	}
+
+	return email, tx.Commit()
+}
+
+// Deletes all password resets of the user
+func (db *DB) DeleteUserPasswordResets(email string) error {
+	_, err := db.Exec("DELETE FROM password_resets WHERE email=?", email)
+	return err
+}
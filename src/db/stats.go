@@ -0,0 +1,245 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// How many TODOs were created and completed during a single day or week
+type PeriodCount struct {
+	// Date of the day or of the Monday of the week in YYYY-MM-DD format
+	Period    string `json:"period"`
+	Created   uint64 `json:"created"`
+	Completed uint64 `json:"completed"`
+}
+
+// Overall numbers of user's TODOs
+type TodoTotals struct {
+	Created   uint64 `json:"created"`
+	Completed uint64 `json:"completed"`
+	// TODOs that have a due date set
+	WithDue uint64 `json:"withDue"`
+	// TODOs that were completed after their due date or are not completed and already past it
+	Overdue uint64 `json:"overdue"`
+}
+
+// How fast TODOs of a single group get completed
+type GroupCompletionStats struct {
+	GroupID        uint64  `json:"groupId"`
+	Name           string  `json:"name"`
+	Completed      uint64  `json:"completed"`
+	AverageSeconds float64 `json:"averageSeconds"`
+	Average        string  `json:"average"`
+}
+
+// Formats seconds as days, hours and minutes
+func secondsToDurationStr(seconds uint64) string {
+	days := seconds / (60 * 60 * 24)
+	hours := seconds % (60 * 60 * 24) / (60 * 60)
+	minutes := seconds % (60 * 60) / 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// Returns YYYY-MM-DD date of the moment in given location. If weekly is true, the date of the Monday of that week is returned instead
+func periodOf(unixSec uint64, location *time.Location, weekly bool) string {
+	moment := time.Unix(int64(unixSec), 0).In(location)
+	if weekly {
+		moment = moment.AddDate(0, 0, -(int(moment.Weekday())+6)%7)
+	}
+	return moment.Format(time.DateOnly)
+}
+
+// Retrieves the single unix time column of rows the query selects
+func (db *DB) queryMoments(query string, args ...interface{}) ([]uint64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moments []uint64
+	for rows.Next() {
+		var moment uint64
+		err = rows.Scan(&moment)
+		if err != nil {
+			return nil, err
+		}
+		moments = append(moments, moment)
+	}
+
+	return moments, nil
+}
+
+/*
+Counts TODOs created and completed since given time, grouped by day or by week in given location.
+Periods without any activity are omitted
+*/
+func (db *DB) GetUserTodoActivity(email string, sinceUnix uint64, location *time.Location, weekly bool) ([]*PeriodCount, error) {
+	counts := make(map[string]*PeriodCount)
+	countOf := func(period string) *PeriodCount {
+		count, ok := counts[period]
+		if !ok {
+			count = &PeriodCount{Period: period}
+			counts[period] = count
+		}
+		return count
+	}
+
+	created, err := db.queryMoments(
+		"SELECT time_created_unix FROM todos WHERE owner_email=? AND deleted_at_unix=0 AND time_created_unix>=?",
+		email,
+		sinceUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, moment := range created {
+		countOf(periodOf(moment, location, weekly)).Created++
+	}
+
+	completed, err := db.queryMoments(
+		"SELECT completion_time_unix FROM todos WHERE owner_email=? AND deleted_at_unix=0 AND is_done AND completion_time_unix>=? AND completion_time_unix>0",
+		email,
+		sinceUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, moment := range completed {
+		countOf(periodOf(moment, location, weekly)).Completed++
+	}
+
+	var activity []*PeriodCount
+	for _, count := range counts {
+		activity = append(activity, count)
+	}
+	// YYYY-MM-DD dates sort chronologically
+	sort.Slice(activity, func(i, j int) bool {
+		return activity[i].Period < activity[j].Period
+	})
+
+	return activity, nil
+}
+
+/*
+Retrieves overall numbers of user's TODOs. Overdue TODOs are counted relative to nowUnix,
+due dates without time end in given location
+*/
+func (db *DB) GetUserTodoTotals(email string, nowUnix uint64, location *time.Location) (*TodoTotals, error) {
+	var totals TodoTotals
+	err := db.QueryRow(
+		`SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN is_done THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN due_unix>0 THEN 1 ELSE 0 END), 0)
+		FROM todos WHERE owner_email=? AND deleted_at_unix=0`,
+		email,
+	).Scan(&totals.Created, &totals.Completed, &totals.WithDue)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		"SELECT due_unix, due_has_time, is_done, completion_time_unix FROM todos WHERE owner_email=? AND deleted_at_unix=0 AND due_unix>0",
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todo Todo
+		err = rows.Scan(&todo.DueUnix, &todo.DueHasTime, &todo.IsDone, &todo.CompletionTimeUnix)
+		if err != nil {
+			return nil, err
+		}
+
+		lastInTime := todo.LastInTimeMoment(location)
+		if (todo.IsDone && todo.CompletionTimeUnix > lastInTime) || (!todo.IsDone && lastInTime < nowUnix) {
+			totals.Overdue++
+		}
+	}
+
+	return &totals, nil
+}
+
+// Retrieves the number of completed TODOs and the average time it took to complete them for each of user's groups
+func (db *DB) GetUserGroupCompletionStats(email string) ([]*GroupCompletionStats, error) {
+	rows, err := db.Query(
+		`SELECT todo_groups.id, todo_groups.name, COUNT(*), AVG(todos.completion_time_unix - todos.time_created_unix)
+		FROM todos INNER JOIN todo_groups ON todo_groups.id=todos.group_id
+		WHERE todos.owner_email=? AND todos.deleted_at_unix=0 AND todo_groups.deleted_at_unix=0
+		AND todos.is_done AND todos.completion_time_unix>=todos.time_created_unix
+		GROUP BY todo_groups.id ORDER BY todo_groups.id`,
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groupStats []*GroupCompletionStats
+	for rows.Next() {
+		var stats GroupCompletionStats
+		err = rows.Scan(&stats.GroupID, &stats.Name, &stats.Completed, &stats.AverageSeconds)
+		if err != nil {
+			return groupStats, err
+		}
+		stats.Average = secondsToDurationStr(uint64(stats.AverageSeconds))
+		groupStats = append(groupStats, &stats)
+	}
+
+	return groupStats, nil
+}
+
+// Retrieves all distinct days in YYYY-MM-DD format in given location on which user completed at least one TODO, oldest first
+func (db *DB) GetUserCompletionDays(email string, location *time.Location) ([]string, error) {
+	completed, err := db.queryMoments(
+		"SELECT completion_time_unix FROM todos WHERE owner_email=? AND deleted_at_unix=0 AND is_done AND completion_time_unix>0",
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var days []string
+	for _, moment := range completed {
+		day := periodOf(moment, location, false)
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+
+	return days, nil
+}
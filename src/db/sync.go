@@ -0,0 +1,258 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"fmt"
+)
+
+// A permanently deleted TODO or group
+type Tombstone struct {
+	ID       uint64 `json:"id"`
+	Revision uint64 `json:"revision"`
+}
+
+// Tables whose rows get revisions. Permanently deleted rows leave tombstones
+var revisionedTables = []struct {
+	Table      string
+	Tombstones string
+	IDColumn   string
+}{
+	{"todos", "todo_tombstones", "todo_id"},
+	{"todo_groups", "group_tombstones", "group_id"},
+}
+
+/*
+Makes the database give a new revision and update time to every created or changed
+TODO and group, and keep tombstones of deleted ones. Triggers are recreated on every
+start, so that they always match this code
+*/
+func setUpRevisions(db *DB) error {
+	for _, revisioned := range revisionedTables {
+		for _, trigger := range []string{"revision_insert", "revision_update", "tombstone"} {
+			_, err := db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%s", revisioned.Table, trigger))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := db.Exec(fmt.Sprintf(`CREATE TRIGGER %[1]s_revision_insert AFTER INSERT ON %[1]s
+		BEGIN
+			UPDATE sync_state SET revision=revision+1 WHERE id=1;
+			UPDATE %[1]s SET
+				revision=(SELECT revision FROM sync_state WHERE id=1),
+				updated_unix=CASE WHEN NEW.updated_unix=0 THEN CAST(strftime('%%s', 'now') AS INTEGER) ELSE NEW.updated_unix END
+			WHERE id=NEW.id;
+		END`, revisioned.Table))
+		if err != nil {
+			return err
+		}
+
+		// Changes of the revision itself do not count. Update time is set unless it was changed explicitly
+		_, err = db.Exec(fmt.Sprintf(`CREATE TRIGGER %[1]s_revision_update AFTER UPDATE ON %[1]s
+		WHEN NEW.revision=OLD.revision
+		BEGIN
+			UPDATE sync_state SET revision=revision+1 WHERE id=1;
+			UPDATE %[1]s SET
+				revision=(SELECT revision FROM sync_state WHERE id=1),
+				updated_unix=CASE WHEN NEW.updated_unix=OLD.updated_unix THEN CAST(strftime('%%s', 'now') AS INTEGER) ELSE NEW.updated_unix END
+			WHERE id=NEW.id;
+		END`, revisioned.Table))
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(fmt.Sprintf(`CREATE TRIGGER %[1]s_tombstone AFTER DELETE ON %[1]s
+		BEGIN
+			UPDATE sync_state SET revision=revision+1 WHERE id=1;
+			INSERT OR REPLACE INTO %[2]s(%[3]s, owner_email, revision)
+				VALUES(OLD.id, OLD.owner_email, (SELECT revision FROM sync_state WHERE id=1));
+		END`, revisioned.Table, revisioned.Tombstones, revisioned.IDColumn))
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_revision ON %[1]s(owner_email, revision)", revisioned.Table))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Gives revisions to rows created before revisions were introduced, in the order rows were created
+func backfillRevisions(table string) func(db *DB) error {
+	return func(db *DB) error {
+		_, err := db.Exec(fmt.Sprintf("UPDATE %s SET revision=(SELECT revision FROM sync_state WHERE id=1)+id", table))
+		if err != nil {
+			return err
+		}
+
+		// Revisions of other tables go after these
+		_, err = db.Exec(fmt.Sprintf(
+			"UPDATE sync_state SET revision=MAX(revision, (SELECT COALESCE(MAX(revision), 0) FROM %s)) WHERE id=1",
+			table,
+		))
+		return err
+	}
+}
+
+// Sets update time of rows created before update times were introduced to the time they were created
+func backfillUpdateTimes(table string) func(db *DB) error {
+	return func(db *DB) error {
+		_, err := db.Exec(fmt.Sprintf(
+			"UPDATE %s SET updated_unix=CASE WHEN time_created_unix>0 THEN time_created_unix ELSE CAST(strftime('%%s', 'now') AS INTEGER) END",
+			table,
+		))
+		return err
+	}
+}
+
+// Returns the latest given revision
+func (db *DB) GetSyncRevision() (uint64, error) {
+	var revision uint64
+	err := db.QueryRow("SELECT revision FROM sync_state WHERE id=1").Scan(&revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+/*
+Retrieves at most limit of user's TODOs changed after the since revision and not after
+the until one, including trashed and archived ones. Earlier changes come first
+*/
+func (db *DB) GetUserTodosChangedSince(email string, since uint64, until uint64, limit uint64) ([]*Todo, error) {
+	var todos []*Todo
+
+	rows, err := db.Query(
+		"SELECT * FROM todos WHERE owner_email=? AND revision>? AND revision<=? ORDER BY revision LIMIT ?",
+		email, since, until, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
+
+// Retrieves at most limit of user's groups changed after the since revision and not after the until one, including trashed ones
+func (db *DB) GetUserTodoGroupsChangedSince(email string, since uint64, until uint64, limit uint64) ([]*TodoGroup, error) {
+	var groups []*TodoGroup
+
+	rows, err := db.Query(
+		"SELECT * FROM todo_groups WHERE owner_email=? AND revision>? AND revision<=? ORDER BY revision LIMIT ?",
+		email, since, until, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		group, err := scanTodoGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (db *DB) getUserTombstonesSince(table string, idColumn string, email string, since uint64, until uint64, limit uint64) ([]Tombstone, error) {
+	var tombstones []Tombstone
+
+	rows, err := db.Query(
+		fmt.Sprintf("SELECT %s, revision FROM %s WHERE owner_email=? AND revision>? AND revision<=? ORDER BY revision LIMIT ?", idColumn, table),
+		email, since, until, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tombstone Tombstone
+		err = rows.Scan(&tombstone.ID, &tombstone.Revision)
+		if err != nil {
+			return nil, err
+		}
+
+		tombstones = append(tombstones, tombstone)
+	}
+
+	return tombstones, nil
+}
+
+// Retrieves at most limit of user's TODOs permanently deleted after the since revision and not after the until one
+func (db *DB) GetUserTodoTombstonesSince(email string, since uint64, until uint64, limit uint64) ([]Tombstone, error) {
+	return db.getUserTombstonesSince("todo_tombstones", "todo_id", email, since, until, limit)
+}
+
+// Retrieves at most limit of user's groups permanently deleted after the since revision and not after the until one
+func (db *DB) GetUserGroupTombstonesSince(email string, since uint64, until uint64, limit uint64) ([]Tombstone, error) {
+	return db.getUserTombstonesSince("group_tombstones", "group_id", email, since, until, limit)
+}
+
+// Retrieves the saved result of user's already applied mutation. Returns sql.ErrNoRows if it was not applied yet
+func (db *DB) GetSyncMutationResult(email string, mutationID string) (string, error) {
+	var result string
+	err := db.QueryRow(
+		"SELECT result FROM sync_mutations WHERE owner_email=? AND mutation_id=?",
+		email, mutationID,
+	).Scan(&result)
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// Remembers the result of user's applied mutation
+func (db *DB) SaveSyncMutationResult(email string, mutationID string, result string, createdUnix uint64) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO sync_mutations(owner_email, mutation_id, result, created_unix) VALUES(?, ?, ?, ?)",
+		email, mutationID, result, createdUnix,
+	)
+	return err
+}
+
+// Forgets results of mutations applied before given time. Returns how many were deleted
+func (db *DB) DeleteSyncMutationsOlderThan(olderThanUnix uint64) (int64, error) {
+	result, err := db.Exec("DELETE FROM sync_mutations WHERE created_unix<?", olderThanUnix)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
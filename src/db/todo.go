@@ -21,10 +21,28 @@ package db
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+const (
+	PriorityNone   uint64 = 0
+	PriorityLow    uint64 = 1
+	PriorityMedium uint64 = 2
+	PriorityHigh   uint64 = 3
+)
+
+// Units TODOs can be repeated in
+const (
+	RecurNone  string = ""
+	RecurDay   string = "day"
+	RecurWeek  string = "week"
+	RecurMonth string = "month"
+	RecurYear  string = "year"
+)
+
 // Todo structure
 type Todo struct {
 	ID                 uint64 `json:"id"`
@@ -37,17 +55,164 @@ type Todo struct {
 	CompletionTimeUnix uint64 `json:"completionTimeUnix"`
 	Image              []byte `json:"image"`
 	File               []byte `json:"file"`
-	TimeCreated        string
-	CompletionTime     string
-	Due                string
+	// 0 if not in the trash
+	DeletedAtUnix uint64 `json:"deletedAtUnix"`
+	// 0 if not archived
+	ArchivedAtUnix uint64 `json:"archivedAtUnix"`
+	// Board column of the group. 0 if not placed into any
+	ColumnID uint64 `json:"columnId"`
+	/*
+		Whether the due date has a time of the day. Due dates without it
+		are stored as UTC midnight of the date and are due from the start of that date in any zone
+	*/
+	DueHasTime bool `json:"dueHasTime"`
+	// The TODO is hidden from default views until this time. 0 if it is shown right away
+	StartUnix uint64 `json:"startUnix"`
+	Priority  uint64 `json:"priority"`
+	// The TODO is repeated every RecurInterval RecurUnits after it is done. Empty unit for TODOs done once
+	RecurUnit     string `json:"recurUnit"`
+	RecurInterval uint64 `json:"recurInterval"`
+	// Set by the database whenever the TODO changes. Larger for later changes of any TODO
+	Revision uint64 `json:"revision"`
+	// When the TODO was changed the last time
+	UpdatedUnix uint64 `json:"updatedUnix"`
+	// Whether Image is set. Stays true when Image is dropped to not send it around
+	HasImage       bool `json:"hasImage"`
+	TimeCreated    string
+	CompletionTime string
+	Due            string
+	DeletedAt      string
+	ArchivedAt     string
+	Start          string
+}
+
+// Returns true if the TODO is repeated after it is done
+func (todo *Todo) IsRecurring() bool {
+	return todo.RecurUnit != RecurNone && todo.RecurInterval > 0
+}
+
+// Returns the due date of the next occurrence of a recurring TODO. Dates with time are moved in given location
+func (todo *Todo) NextDueUnix(location *time.Location) uint64 {
+	due := time.Unix(int64(todo.DueUnix), 0).UTC()
+	if todo.DueHasTime {
+		due = due.In(location)
+	}
+
+	interval := int(todo.RecurInterval)
+	switch todo.RecurUnit {
+	case RecurDay:
+		due = due.AddDate(0, 0, interval)
+	case RecurWeek:
+		due = due.AddDate(0, 0, 7*interval)
+	case RecurMonth:
+		due = due.AddDate(0, interval, 0)
+	case RecurYear:
+		due = due.AddDate(interval, 0, 0)
+	}
+
+	return uint64(due.Unix())
+}
+
+// Returns true if the TODO should not be shown yet
+func (todo *Todo) IsDeferred(nowUnix uint64) bool {
+	return todo.StartUnix > nowUnix
+}
+
+// Returns the date of the moment in given location as UTC midnight, the way due dates without time are kept
+func dateInLocation(unixSec uint64, location *time.Location) uint64 {
+	year, month, day := time.Unix(int64(unixSec), 0).In(location).Date()
+	return uint64(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix())
+}
+
+// Returns the first date which starts at or after the moment in given location as UTC midnight
+func firstDateFrom(unixSec uint64, location *time.Location) uint64 {
+	date := dateInLocation(unixSec, location)
+	year, month, day := time.Unix(int64(date), 0).UTC().Date()
+	if time.Date(year, month, day, 0, 0, 0, 0, location).Unix() < int64(unixSec) {
+		date += 60 * 60 * 24
+	}
+
+	return date
+}
+
+// Returns the moment TODO becomes due. TODOs without time become due when their day starts in given location
+func (todo *Todo) DueMoment(location *time.Location) uint64 {
+	if todo.DueHasTime {
+		return todo.DueUnix
+	}
+
+	year, month, day := time.Unix(int64(todo.DueUnix), 0).UTC().Date()
+	return uint64(time.Date(year, month, day, 0, 0, 0, 0, location).Unix())
+}
+
+/*
+SQL condition of TODO becoming due in [from, to). Dates without time are compared with dates
+instead of moments, so that every date gets the offset its own day has. Takes arguments made by dueBetweenArgs
+*/
+const dueBetweenSQL string = "((due_has_time AND due_unix>=? AND due_unix<?) OR (NOT due_has_time AND due_unix>=? AND due_unix<?))"
+
+// Returns arguments of dueBetweenSQL for [fromUnix, toUnix) in given location
+func dueBetweenArgs(fromUnix uint64, toUnix uint64, location *time.Location) []interface{} {
+	return []interface{}{fromUnix, toUnix, firstDateFrom(fromUnix, location), firstDateFrom(toUnix, location)}
+}
+
+// Puts TODOs in order of becoming due in given location
+func sortByDueMoment(todos []*Todo, location *time.Location) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		return todos[i].DueMoment(location) < todos[j].DueMoment(location)
+	})
+}
+
+// Returns the last moment TODO is not overdue yet. TODOs without time are in time for the whole due day in given location
+func (todo *Todo) LastInTimeMoment(location *time.Location) uint64 {
+	if todo.DueHasTime {
+		return todo.DueUnix
+	}
+
+	year, month, day := time.Unix(int64(todo.DueUnix), 0).UTC().Date()
+	return uint64(time.Date(year, month, day+1, 0, 0, 0, 0, location).Unix()) - 1
 }
 
 func unixToTimeStr(unixTimeSec uint64) string {
+	return unixToLocalTimeStr(unixTimeSec, time.Local, time.DateOnly)
+}
+
+// Formats unix time in given location with given layout
+func unixToLocalTimeStr(unixTimeSec uint64, location *time.Location, layout string) string {
 	timeUnix := time.Unix(int64(unixTimeSec), 0)
 	if timeUnix.Year() == 1970 {
 		return "None"
 	} else {
-		return timeUnix.Format(time.DateOnly)
+		return timeUnix.In(location).Format(layout)
+	}
+}
+
+// Returns the moment TODO becomes due in given location
+func (todo *Todo) DueIn(location *time.Location) time.Time {
+	due := time.Unix(int64(todo.DueUnix), 0)
+	if todo.DueHasTime {
+		return due.In(location)
+	}
+
+	year, month, day := due.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+// Formats all dates of the TODO in given location with given date layout. Due time is added if it is set
+func (todo *Todo) Localize(location *time.Location, dateLayout string) {
+	todo.TimeCreated = unixToLocalTimeStr(todo.TimeCreatedUnix, location, dateLayout)
+	todo.CompletionTime = unixToLocalTimeStr(todo.CompletionTimeUnix, location, dateLayout)
+	todo.DeletedAt = unixToLocalTimeStr(todo.DeletedAtUnix, location, dateLayout)
+	todo.ArchivedAt = unixToLocalTimeStr(todo.ArchivedAtUnix, location, dateLayout)
+	todo.Start = unixToLocalTimeStr(todo.StartUnix, location, dateLayout+" 15:04")
+
+	todo.Due = "None"
+	if todo.DueUnix != 0 {
+		layout := dateLayout
+		if todo.DueHasTime {
+			layout += " 15:04"
+		}
+		todo.Due = todo.DueIn(location).Format(layout)
 	}
 }
 
@@ -64,15 +229,25 @@ func scanTodo(rows *sql.Rows) (*Todo, error) {
 		&newTodo.CompletionTimeUnix,
 		&newTodo.Image,
 		&newTodo.File,
+		&newTodo.DeletedAtUnix,
+		&newTodo.ArchivedAtUnix,
+		&newTodo.ColumnID,
+		&newTodo.DueHasTime,
+		&newTodo.StartUnix,
+		&newTodo.Priority,
+		&newTodo.RecurUnit,
+		&newTodo.RecurInterval,
+		&newTodo.Revision,
+		&newTodo.UpdatedUnix,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	newTodo.HasImage = len(newTodo.Image) > 0
+
 	// Convert to Basic time
-	newTodo.TimeCreated = unixToTimeStr(newTodo.TimeCreatedUnix)
-	newTodo.Due = unixToTimeStr(newTodo.DueUnix)
-	newTodo.CompletionTime = unixToTimeStr(newTodo.CompletionTimeUnix)
+	newTodo.Localize(time.Local, time.DateOnly)
 
 	return &newTodo, nil
 }
@@ -118,10 +293,10 @@ func (db *DB) GetTodos() ([]*Todo, error) {
 	return todos, nil
 }
 
-// Creates a new TODO in the database
-func (db *DB) CreateTodo(todo Todo) error {
-	_, err := db.Exec(
-		"INSERT INTO todos(group_id, text, time_created_unix, due_unix, owner_email, is_done, completion_time_unix, image, file) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+// Creates a new TODO in the database and returns its ID
+func (db *DB) CreateTodo(todo Todo) (uint64, error) {
+	result, err := db.Exec(
+		"INSERT INTO todos(group_id, text, time_created_unix, due_unix, owner_email, is_done, completion_time_unix, image, file, column_id, due_has_time, start_unix, priority, recur_unit, recur_interval) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		todo.GroupID,
 		todo.Text,
 		todo.TimeCreatedUnix,
@@ -131,9 +306,19 @@ func (db *DB) CreateTodo(todo Todo) error {
 		todo.CompletionTimeUnix,
 		todo.Image,
 		todo.File,
+		todo.ColumnID,
+		todo.DueHasTime,
+		todo.StartUnix,
+		todo.Priority,
+		todo.RecurUnit,
+		todo.RecurInterval,
 	)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	id, err := result.LastInsertId()
+	return uint64(id), err
 }
 
 // Deletes information about a TODO of certain ID from the database
@@ -142,10 +327,62 @@ func (db *DB) DeleteTodo(id uint64) error {
 		"DELETE FROM todos WHERE id=?",
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	return db.deleteOrphanTodoData()
+}
+
+// Moves TODO to the trash
+func (db *DB) SoftDeleteTodo(id uint64, deletedAtUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE todos SET deleted_at_unix=? WHERE id=? AND deleted_at_unix=0",
+		deletedAtUnix,
+		id,
+	)
 
 	return err
 }
 
+/*
+Takes TODO out of the trash. If its group was deleted as well - restores the group too,
+together with TODOs that were deleted along with it
+*/
+func (db *DB) RestoreTodo(id uint64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE todos SET deleted_at_unix=0 WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+
+	var groupID, groupDeletedAtUnix uint64
+	err = tx.QueryRow(
+		"SELECT todo_groups.id, todo_groups.deleted_at_unix FROM todos JOIN todo_groups ON todo_groups.id=todos.group_id WHERE todos.id=?",
+		id,
+	).Scan(&groupID, &groupDeletedAtUnix)
+	if err == sql.ErrNoRows {
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	if groupDeletedAtUnix != 0 {
+		err = restoreTodoGroup(tx, groupID, groupDeletedAtUnix)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // Updates TODO's due date, text, done state, completion time and group id with image
 func (db *DB) UpdateTodo(todoID uint64, updatedTodo Todo) error {
 	_, err := db.Exec(
@@ -163,7 +400,10 @@ func (db *DB) UpdateTodo(todoID uint64, updatedTodo Todo) error {
 	return err
 }
 
-// Updates all changed fields which are not nil-valued in a ToDo and retains all unchanged ones
+/*
+Updates all changed fields which are not nil-valued in a ToDo and retains all unchanged ones.
+Priority and recurrence are always written, so they can be cleared
+*/
 func (db *DB) UpdateTodoSoft(todoID uint64, updatedTodo Todo) error {
 	originalTodo, err := db.GetTodo(todoID)
 	if err != nil {
@@ -176,9 +416,22 @@ func (db *DB) UpdateTodoSoft(todoID uint64, updatedTodo Todo) error {
 		updates = append(updates, "group_id=?")
 		args = append(args, updatedTodo.GroupID)
 	}
-	if (updatedTodo.DueUnix != originalTodo.DueUnix) && updatedTodo.DueUnix != 0 {
-		updates = append(updates, "due_unix=?")
-		args = append(args, updatedTodo.DueUnix)
+	if (updatedTodo.DueUnix != originalTodo.DueUnix || updatedTodo.DueHasTime != originalTodo.DueHasTime) && updatedTodo.DueUnix != 0 {
+		// Due time only makes sense together with the due date
+		updates = append(updates, "due_unix=?", "due_has_time=?")
+		args = append(args, updatedTodo.DueUnix, updatedTodo.DueHasTime)
+	}
+	if updatedTodo.Priority != originalTodo.Priority {
+		updates = append(updates, "priority=?")
+		args = append(args, updatedTodo.Priority)
+	}
+	if updatedTodo.RecurUnit == RecurNone {
+		// TODOs done once have no interval
+		updatedTodo.RecurInterval = 0
+	}
+	if updatedTodo.RecurUnit != originalTodo.RecurUnit || updatedTodo.RecurInterval != originalTodo.RecurInterval {
+		updates = append(updates, "recur_unit=?", "recur_interval=?")
+		args = append(args, updatedTodo.RecurUnit, updatedTodo.RecurInterval)
 	}
 	if (updatedTodo.Text != originalTodo.Text) && updatedTodo.Text != "" {
 		updates = append(updates, "text=?")
@@ -209,8 +462,15 @@ func (db *DB) UpdateTodoSoft(todoID uint64, updatedTodo Todo) error {
 	args = append(args, todoID)
 
 	_, err = db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if !bytes.Equal(updatedTodo.Image, originalTodo.Image) && updatedTodo.Image != nil {
+		return db.deleteTodoImageDerivatives(todoID)
+	}
+
+	return nil
 }
 
 // Searches and retrieves TODO groups created by the user
@@ -218,7 +478,7 @@ func (db *DB) GetAllUserTodoGroups(email string) ([]*TodoGroup, error) {
 	var todoGroups []*TodoGroup
 
 	rows, err := db.Query(
-		"SELECT * FROM todo_groups WHERE owner_email=?",
+		"SELECT * FROM todo_groups WHERE owner_email=? AND deleted_at_unix=0",
 		email,
 	)
 	if err != nil {
@@ -237,14 +497,25 @@ func (db *DB) GetAllUserTodoGroups(email string) ([]*TodoGroup, error) {
 	return todoGroups, nil
 }
 
-// Searches and retrieves TODOs created by the user
+// Searches and retrieves TODOs created by the user. Archived ones are not included
 func (db *DB) GetAllUserTodos(email string) ([]*Todo, error) {
+	return db.getUserTodos(email, false)
+}
+
+// Searches and retrieves TODOs created by the user including archived ones
+func (db *DB) GetAllUserTodosWithArchived(email string) ([]*Todo, error) {
+	return db.getUserTodos(email, true)
+}
+
+func (db *DB) getUserTodos(email string, withArchived bool) ([]*Todo, error) {
 	var todos []*Todo
 
-	rows, err := db.Query(
-		"SELECT * FROM todos WHERE owner_email=?",
-		email,
-	)
+	query := "SELECT * FROM todos WHERE owner_email=? AND deleted_at_unix=0"
+	if !withArchived {
+		query += " AND archived_at_unix=0"
+	}
+
+	rows, err := db.Query(query, email)
 	if err != nil {
 		return nil, err
 	}
@@ -268,8 +539,11 @@ func (db *DB) DeleteAllUserTodos(email string) error {
 		"DELETE FROM todos WHERE owner_email=?",
 		email,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return db.deleteOrphanTodoData()
 }
 
 // Deletes all information regarding TODO groups of specified user
@@ -278,7 +552,26 @@ func (db *DB) DeleteAllUserTodoGroups(email string) error {
 		"DELETE FROM todo_groups WHERE owner_email=?",
 		email,
 	)
+	if err != nil {
+		return err
+	}
+
+	return db.deleteOrphanBoardColumns()
+}
 
+// Deletes comments, thumbnails and sketches of TODOs that no longer exist
+func (db *DB) deleteOrphanTodoData() error {
+	_, err := db.Exec("DELETE FROM todo_comments WHERE todo_id NOT IN (SELECT id FROM todos)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM todo_thumbnails WHERE todo_id NOT IN (SELECT id FROM todos)")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM todo_sketches WHERE todo_id NOT IN (SELECT id FROM todos)")
 	return err
 }
 
@@ -295,13 +588,16 @@ func (db *DB) DoesUserOwnTodo(todoId uint64, email string) bool {
 	return true
 }
 
-func (db *DB) GetUserTodosDue(userEmail string, tMinusSec uint64) ([]*Todo, error) {
+// Retrieves user's not yet done TODOs which become due in less than tMinusSec. Dates without time start in given location
+func (db *DB) GetUserTodosDue(userEmail string, tMinusSec uint64, location *time.Location) ([]*Todo, error) {
 	now := time.Now().Unix()
 
+	args := []interface{}{userEmail}
+	args = append(args, dueBetweenArgs(1, tMinusSec+uint64(now)+1, location)...)
+	args = append(args, now)
 	rows, err := db.Query(
-		"SELECT * FROM todos WHERE (owner_email=? AND due_unix<=? AND NOT is_done AND due_unix>0)",
-		userEmail,
-		tMinusSec+uint64(now),
+		fmt.Sprintf("SELECT * FROM todos WHERE (owner_email=? AND %s AND NOT is_done AND due_unix>0 AND deleted_at_unix=0 AND start_unix<=?)", dueBetweenSQL),
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -324,3 +620,209 @@ func (db *DB) UpdateTodoFile(todoID uint64, newFile []byte) error {
 	_, err := db.Exec("UPDATE todos SET file=? WHERE id=?", newFile, todoID)
 	return err
 }
+
+// Sets the time TODO is hidden until. 0 shows it right away
+func (db *DB) TodoSetStart(todoID uint64, startUnix uint64) error {
+	_, err := db.Exec("UPDATE todos SET start_unix=? WHERE id=?", startUnix, todoID)
+	return err
+}
+
+// Retrieves user's not yet done TODOs which were hidden and became visible in (fromUnix, toUnix]
+func (db *DB) GetUserTodosStartedBetween(userEmail string, fromUnix uint64, toUnix uint64) ([]*Todo, error) {
+	rows, err := db.Query(
+		"SELECT * FROM todos WHERE (owner_email=? AND start_unix>? AND start_unix<=? AND NOT is_done AND deleted_at_unix=0 AND archived_at_unix=0) ORDER BY start_unix",
+		userEmail,
+		fromUnix,
+		toUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return todos, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
+
+/*
+Retrieves user's not yet done TODOs which become due in [fromUnix, toUnix) in order of becoming due.
+Dates without time start in given location
+*/
+func (db *DB) GetUserTodosDueBetween(userEmail string, fromUnix uint64, toUnix uint64, location *time.Location) ([]*Todo, error) {
+	rows, err := db.Query(
+		fmt.Sprintf(
+			"SELECT * FROM todos WHERE (owner_email=? AND %s AND NOT is_done AND due_unix>0 AND deleted_at_unix=0)",
+			dueBetweenSQL,
+		),
+		append([]interface{}{userEmail}, dueBetweenArgs(fromUnix, toUnix, location)...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	sortByDueMoment(todos, location)
+
+	return todos, nil
+}
+
+// Retrieves user's TODOs which were completed in [fromUnix, toUnix)
+func (db *DB) GetUserTodosCompletedBetween(userEmail string, fromUnix uint64, toUnix uint64) ([]*Todo, error) {
+	rows, err := db.Query(
+		"SELECT * FROM todos WHERE (owner_email=? AND is_done AND completion_time_unix>=? AND completion_time_unix<? AND deleted_at_unix=0) ORDER BY completion_time_unix",
+		userEmail,
+		fromUnix,
+		toUnix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
+
+/*
+Retrieves all user's TODOs, completed or not, which become due in [fromUnix, toUnix) in order of becoming due.
+Dates without time start in given location. Archived TODOs are not included
+*/
+func (db *DB) GetUserTodosScheduledBetween(userEmail string, fromUnix uint64, toUnix uint64, location *time.Location) ([]*Todo, error) {
+	rows, err := db.Query(
+		fmt.Sprintf(
+			"SELECT * FROM todos WHERE (owner_email=? AND %s AND due_unix>0 AND deleted_at_unix=0 AND archived_at_unix=0)",
+			dueBetweenSQL,
+		),
+		append([]interface{}{userEmail}, dueBetweenArgs(fromUnix, toUnix, location)...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	sortByDueMoment(todos, location)
+
+	return todos, nil
+}
+
+// Archives a single TODO
+func (db *DB) ArchiveTodo(todoID uint64, archivedAtUnix uint64) error {
+	_, err := db.Exec(
+		"UPDATE todos SET archived_at_unix=? WHERE id=? AND archived_at_unix=0",
+		archivedAtUnix,
+		todoID,
+	)
+
+	return err
+}
+
+// Takes TODO out of the archive
+func (db *DB) UnarchiveTodo(todoID uint64) error {
+	_, err := db.Exec("UPDATE todos SET archived_at_unix=0 WHERE id=?", todoID)
+	return err
+}
+
+// Archives all completed TODOs of the group. Returns how many were archived
+func (db *DB) ArchiveCompletedGroupTodos(groupID uint64, archivedAtUnix uint64) (int64, error) {
+	result, err := db.Exec(
+		"UPDATE todos SET archived_at_unix=? WHERE group_id=? AND is_done AND archived_at_unix=0 AND deleted_at_unix=0",
+		archivedAtUnix,
+		groupID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Archives TODOs which were completed more than their owner's auto_archive_days ago. Returns how many were archived
+func (db *DB) AutoArchiveTodos(nowUnix uint64) (int64, error) {
+	result, err := db.Exec(
+		`UPDATE todos SET archived_at_unix=? WHERE is_done AND archived_at_unix=0 AND deleted_at_unix=0 AND completion_time_unix>0
+		AND EXISTS (
+			SELECT 1 FROM users WHERE users.email=todos.owner_email
+			AND users.auto_archive_days>0
+			AND todos.completion_time_unix<=?-users.auto_archive_days*86400
+		)`,
+		nowUnix,
+		nowUnix,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+/*
+Retrieves user's archived TODOs whose text contains given string and which were completed in [fromUnix, toUnix).
+Empty text matches everything, toUnix of 0 means no upper bound
+*/
+func (db *DB) SearchArchivedUserTodos(email string, text string, fromUnix uint64, toUnix uint64) ([]*Todo, error) {
+	query := "SELECT * FROM todos WHERE owner_email=? AND archived_at_unix>0 AND deleted_at_unix=0 AND completion_time_unix>=?"
+	args := []interface{}{email, fromUnix}
+
+	if toUnix != 0 {
+		query += " AND completion_time_unix<?"
+		args = append(args, toUnix)
+	}
+
+	if text != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+		query += ` AND text LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escaper.Replace(text)+"%")
+	}
+	query += " ORDER BY completion_time_unix DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []*Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return todos, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, nil
+}
@@ -20,21 +20,98 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
+)
+
+// How often a user wants to receive TODO digest emails
+type DigestFrequency uint8
+
+const (
+	DigestOff    DigestFrequency = 0
+	DigestDaily  DigestFrequency = 1
+	DigestWeekly DigestFrequency = 2
+)
+
+// Returns how much time a digest of this frequency covers
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return time.Hour * 24
+	case DigestWeekly:
+		return time.Hour * 24 * 7
+	default:
+		return 0
+	}
+}
+
+const (
+	RoleUser  string = "user"
+	RoleAdmin string = "admin"
 )
 
 // User structure
 type User struct {
-	Email           string `json:"email"`
-	Password        string `json:"password"`
-	TimeCreatedUnix uint64 `json:"timeCreatedUnix"`
-	TimeCreated     string `json:"timeCreated"`
-	ConfirmedEmail  bool   `json:"confirmedEmail"`
-	NotifyOnTodos   bool   `json:"notifyOnTodos"`
+	Email           string          `json:"email"`
+	Password        string          `json:"password"`
+	TimeCreatedUnix uint64          `json:"timeCreatedUnix"`
+	TimeCreated     string          `json:"timeCreated"`
+	ConfirmedEmail  bool            `json:"confirmedEmail"`
+	NotifyOnTodos   bool            `json:"notifyOnTodos"`
+	DigestFrequency DigestFrequency `json:"digestFrequency"`
+	LastDigestUnix  uint64          `json:"lastDigestUnix"`
+	Language        string          `json:"language"`
+	Role            string          `json:"role"`
+	Disabled        bool            `json:"disabled"`
+	LastLoginUnix   uint64          `json:"lastLoginUnix"`
+	LastLogin       string          `json:"lastLogin"`
+	// Completed TODOs are archived after this many days. 0 turns automatic archiving off
+	AutoArchiveDays uint64 `json:"autoArchiveDays"`
+	// IANA name of user's time zone. Empty for the zone of the server
+	Timezone string `json:"timezone"`
+}
+
+// Returns user's time zone, falling back to the zone of the server if it is not set or unknown
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return location
+}
+
+// Returns true if user has administrator rights
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Returns pointers to user's fields in the order of users table columns
+func (u *User) columns() []interface{} {
+	return []interface{}{
+		&u.Email,
+		&u.Password,
+		&u.TimeCreatedUnix,
+		&u.ConfirmedEmail,
+		&u.NotifyOnTodos,
+		&u.DigestFrequency,
+		&u.LastDigestUnix,
+		&u.Language,
+		&u.Role,
+		&u.Disabled,
+		&u.LastLoginUnix,
+		&u.AutoArchiveDays,
+		&u.Timezone,
+	}
 }
 
 func scanUserRaw(rows *sql.Rows) (*User, error) {
 	var user User
-	err := rows.Scan(&user.Email, &user.Password, &user.TimeCreatedUnix, &user.ConfirmedEmail, &user.NotifyOnTodos)
+	err := rows.Scan(user.columns()...)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +128,7 @@ func scanUser(rows *sql.Rows) (*User, error) {
 
 	// Convert to Basic time string
 	user.TimeCreated = unixToTimeStr(user.TimeCreatedUnix)
+	user.LastLogin = unixToTimeStr(user.LastLoginUnix)
 
 	return user, nil
 }
@@ -74,17 +152,37 @@ func (db *DB) GetUser(email string) (*User, error) {
 // Creates a new user in the database
 func (db *DB) CreateUser(newUser User) error {
 	_, err := db.Exec(
-		"INSERT INTO users(email, password, time_created_unix, confirmed_email, notify_on_todos) VALUES(?, ?, ?, ?, ?)",
+		"INSERT INTO users(email, password, time_created_unix, confirmed_email, notify_on_todos, digest_frequency, last_digest_unix, language, role, disabled, last_login_unix, auto_archive_days, timezone) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		newUser.Email,
 		newUser.Password,
 		newUser.TimeCreatedUnix,
 		newUser.ConfirmedEmail,
 		newUser.NotifyOnTodos,
+		newUser.DigestFrequency,
+		newUser.LastDigestUnix,
+		newUser.Language,
+		RoleUser,
+		false,
+		newUser.LastLoginUnix,
+		newUser.AutoArchiveDays,
+		newUser.Timezone,
 	)
 
 	return err
 }
 
+// Sets user's time zone
+func (db *DB) UserSetTimezone(email string, timezone string) error {
+	_, err := db.Exec("UPDATE users SET timezone=? WHERE email=?", timezone, email)
+	return err
+}
+
+// Sets after how many days completed TODOs of the user are archived
+func (db *DB) UserSetAutoArchive(email string, days uint64) error {
+	_, err := db.Exec("UPDATE users SET auto_archive_days=? WHERE email=?", days, email)
+	return err
+}
+
 // Deletes user with given email address
 func (db *DB) DeleteUser(email string) error {
 	_, err := db.Exec(
@@ -114,6 +212,47 @@ func (db *DB) UserSetNotifyOnTodos(email string, value bool) error {
 	return err
 }
 
+// Sets how often the user receives digest emails and in which language
+func (db *DB) UserSetDigest(email string, frequency DigestFrequency, language string) error {
+	_, err := db.Exec(
+		"UPDATE users SET digest_frequency=?, language=? WHERE email=?",
+		frequency,
+		language,
+		email,
+	)
+	return err
+}
+
+// Remembers when the last digest email was sent to the user
+func (db *DB) UserSetLastDigest(email string, lastDigestUnix uint64) error {
+	_, err := db.Exec("UPDATE users SET last_digest_unix=? WHERE email=?", lastDigestUnix, email)
+	return err
+}
+
+// Sets user's role
+func (db *DB) UserSetRole(email string, role string) error {
+	_, err := db.Exec("UPDATE users SET role=? WHERE email=?", role, email)
+	return err
+}
+
+// Disables or enables user's account. Disabled users can not log in
+func (db *DB) UserSetDisabled(email string, disabled bool) error {
+	_, err := db.Exec("UPDATE users SET disabled=? WHERE email=?", disabled, email)
+	return err
+}
+
+// Remembers when the user has logged in the last time
+func (db *DB) UserSetLastLogin(email string, lastLoginUnix uint64) error {
+	_, err := db.Exec("UPDATE users SET last_login_unix=? WHERE email=?", lastLoginUnix, email)
+	return err
+}
+
+// Sets a new password for the user
+func (db *DB) UserSetPassword(email string, password string) error {
+	_, err := db.Exec("UPDATE users SET password=? WHERE email=?", password, email)
+	return err
+}
+
 // Deletes a user and all his TODOs (with groups) as well
 func (db *DB) DeleteUserClean(email string) error {
 	err := db.DeleteAllUserTodoGroups(email)
@@ -126,6 +265,11 @@ func (db *DB) DeleteUserClean(email string) error {
 		return err
 	}
 
+	err = db.DeleteUserPasswordResets(email)
+	if err != nil {
+		return err
+	}
+
 	err = db.DeleteUser(email)
 	if err != nil {
 		return err
@@ -182,3 +326,77 @@ func (db *DB) GetAllUsersWithNotificationsOn() ([]*User, error) {
 
 	return users, nil
 }
+
+func (db *DB) GetAllUsersWithDigestOn() ([]*User, error) {
+	rows, err := db.Query("SELECT * FROM users WHERE digest_frequency!=?", DigestOff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUserRaw(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// User information with how much they use the service
+type UserOverview struct {
+	User
+	TodoCount    uint64 `json:"todoCount"`
+	StorageBytes uint64 `json:"storageBytes"`
+	Storage      string `json:"storage"`
+}
+
+// Formats size in bytes as a human readable string
+func bytesToStr(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Retrieves all users with the number of their TODOs and the space taken by images and files
+func (db *DB) GetUsersOverview() ([]*UserOverview, error) {
+	rows, err := db.Query(
+		`SELECT users.*, COUNT(todos.id), IFNULL(SUM(IFNULL(LENGTH(todos.image), 0) + IFNULL(LENGTH(todos.file), 0)), 0)
+		FROM users LEFT JOIN todos ON todos.owner_email=users.email
+		GROUP BY users.email ORDER BY users.time_created_unix`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overviews []*UserOverview
+	for rows.Next() {
+		var overview UserOverview
+		err = rows.Scan(append(overview.User.columns(), &overview.TodoCount, &overview.StorageBytes)...)
+		if err != nil {
+			return nil, err
+		}
+
+		overview.Password = ""
+		overview.TimeCreated = unixToTimeStr(overview.TimeCreatedUnix)
+		overview.LastLogin = unixToTimeStr(overview.LastLoginUnix)
+		overview.Storage = bytesToStr(overview.StorageBytes)
+		overviews = append(overviews, &overview)
+	}
+
+	return overviews, nil
+}
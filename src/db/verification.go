@@ -60,7 +60,7 @@ func (db *DB) GetVerification(id uint64) (*Verification, error) {
 // Returns the last email verification by email
 func (db *DB) GetVerificationByEmail(email string) (*Verification, error) {
 	rows, err := db.Query(
-		"SELECT * FROM verifications WHERE (email=?) ORDER BY life_seconds DESC",
+		"SELECT * FROM verifications WHERE (email=?) ORDER BY issued_unix DESC, id DESC",
 		email,
 	)
 	if err != nil {
@@ -1,16 +1,40 @@
 package email
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"net/smtp"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
 	"strings"
+	"time"
 )
 
+// A file sent along with the email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 type Email struct {
-	Sender  string
-	To      []string
-	Subject string
-	Body    string
+	Sender    string
+	To        []string
+	Subject   string
+	Body      string
+	PlainBody string
+	// URL or mailto: link to put into List-Unsubscribe header. Omitted when empty
+	ListUnsubscribe string
+	Attachments     []Attachment
+	// Filled in automatically when sending if left empty
+	Date      time.Time
+	MessageID string
 }
 
 func NewEmail(sender, subject, body string, to []string) Email {
@@ -22,31 +46,295 @@ func NewEmail(sender, subject, body string, to []string) Email {
 	}
 }
 
+// Creates a new email with both HTML and plaintext versions of the same body
+func NewEmailAlternative(sender, subject, htmlBody, plainBody string, to []string) Email {
+	mail := NewEmail(sender, subject, htmlBody, to)
+	mail.PlainBody = plainBody
+	return mail
+}
+
+// Adds a file to the email
+func (m *Email) Attach(filename string, contentType string, data []byte) {
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
 type Emailer struct {
-	Auth    smtp.Auth
-	Address string
-	From    string
+	Transport Transport
+	From      string
 }
 
-func NewEmailer(auth smtp.Auth, addr string, from string) *Emailer {
+func NewEmailer(transport Transport, from string) *Emailer {
 	return &Emailer{
-		Auth:    auth,
-		Address: addr,
-		From:    from,
+		Transport: transport,
+		From:      from,
+	}
+}
+
+// Formats an address so that non-ASCII display names are encoded as per RFC 2047
+func formatAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+
+	return parsed.String()
+}
+
+// Returns bare addresses to be used as SMTP envelope recipients
+func envelopeAddresses(addresses []string) []string {
+	var envelope []string
+	for _, address := range addresses {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			envelope = append(envelope, address)
+			continue
+		}
+		envelope = append(envelope, parsed.Address)
+	}
+
+	return envelope
+}
+
+// Generates a unique Message-ID in the domain of the sender
+func generateMessageID(sender string) string {
+	domain := "localhost"
+	parsed, err := mail.ParseAddress(sender)
+	if err == nil {
+		if at := strings.LastIndex(parsed.Address, "@"); at != -1 && at+1 < len(parsed.Address) {
+			domain = parsed.Address[at+1:]
+		}
+	}
+
+	random := make([]byte, 16)
+	rand.Read(random)
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+// Derives a multipart boundary from the message ID, so the same email is always built the same way
+func boundaryFor(messageID string, part string) string {
+	sum := sha1.Sum([]byte(messageID + part))
+	return "dela-" + part + "-" + hex.EncodeToString(sum[:])
+}
+
+// Writes a header line, folding encoded words so that lines stay reasonably short.
+// Line breaks are dropped from the value, so it can't start headers of its own
+func writeHeader(buffer *bytes.Buffer, key string, value string) {
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+
+	buffer.WriteString(key)
+	buffer.WriteString(": ")
+	buffer.WriteString(strings.ReplaceAll(value, "?= =?", "?=\r\n =?"))
+	buffer.WriteString("\r\n")
+}
+
+// Writes text as quoted-printable with CRLF line endings
+func writeQuotedPrintable(buffer *bytes.Buffer, text string) error {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	writer := quotedprintable.NewWriter(buffer)
+	_, err := writer.Write([]byte(text))
+	if err != nil {
+		return err
 	}
+
+	return writer.Close()
 }
 
-func buildEmail(mail Email) []byte {
-	message := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\r\n"
-	message += fmt.Sprintf("From: %s\r\n", mail.Sender)
-	message += fmt.Sprintf("To: %s\r\n", strings.Join(mail.To, ";"))
-	message += fmt.Sprintf("Subject: %s\r\n", mail.Subject)
-	message += fmt.Sprintf("\r\n%s\r\n", mail.Body)
+// Writes data as base64 split into 76 character lines
+func writeBase64(buffer *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76])
+		buffer.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buffer.WriteString(encoded)
+	buffer.WriteString("\r\n")
+}
 
-	return []byte(message)
+func textPartHeader(contentType string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return header
+}
+
+// Returns the header and the contents of the textual part of the email
+func buildBody(mail Email) (textproto.MIMEHeader, []byte, error) {
+	var body bytes.Buffer
+
+	if mail.PlainBody == "" || mail.Body == "" {
+		contentType := "text/html"
+		text := mail.Body
+		if mail.Body == "" {
+			contentType = "text/plain"
+			text = mail.PlainBody
+		}
+
+		err := writeQuotedPrintable(&body, text)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return textPartHeader(contentType), body.Bytes(), nil
+	}
+
+	// Plaintext part goes first, so clients that can show HTML prefer the last one
+	writer := multipart.NewWriter(&body)
+	err := writer.SetBoundary(boundaryFor(mail.MessageID, "alternative"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, part := range []struct {
+		ContentType string
+		Text        string
+	}{
+		{"text/plain", mail.PlainBody},
+		{"text/html", mail.Body},
+	} {
+		var partBody bytes.Buffer
+		err = writeQuotedPrintable(&partBody, part.Text)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partWriter, err := writer.CreatePart(textPartHeader(part.ContentType))
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = partWriter.Write(partBody.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": writer.Boundary()}))
+
+	return header, body.Bytes(), nil
+}
+
+// Builds an RFC 5322 message. Date and MessageID are expected to be already set
+func buildEmail(mail Email) ([]byte, error) {
+	contentHeader, content, err := buildBody(mail)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mail.Attachments) > 0 {
+		var mixed bytes.Buffer
+		writer := multipart.NewWriter(&mixed)
+		err = writer.SetBoundary(boundaryFor(mail.MessageID, "mixed"))
+		if err != nil {
+			return nil, err
+		}
+
+		partWriter, err := writer.CreatePart(contentHeader)
+		if err != nil {
+			return nil, err
+		}
+		_, err = partWriter.Write(content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attachment := range mail.Attachments {
+			contentType := attachment.ContentType
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Transfer-Encoding", "base64")
+			header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+
+			var encoded bytes.Buffer
+			writeBase64(&encoded, attachment.Data)
+
+			partWriter, err := writer.CreatePart(header)
+			if err != nil {
+				return nil, err
+			}
+			_, err = partWriter.Write(encoded.Bytes())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = writer.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		contentHeader = make(textproto.MIMEHeader)
+		contentHeader.Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": writer.Boundary()}))
+		content = mixed.Bytes()
+	}
+
+	var recipients []string
+	for _, recipient := range mail.To {
+		recipients = append(recipients, formatAddress(recipient))
+	}
+
+	var message bytes.Buffer
+	writeHeader(&message, "Date", mail.Date.Format(time.RFC1123Z))
+	writeHeader(&message, "From", formatAddress(mail.Sender))
+	writeHeader(&message, "To", strings.Join(recipients, ", "))
+	writeHeader(&message, "Subject", mime.QEncoding.Encode("UTF-8", mail.Subject))
+	writeHeader(&message, "Message-ID", mail.MessageID)
+	if mail.ListUnsubscribe != "" {
+		writeHeader(&message, "List-Unsubscribe", fmt.Sprintf("<%s>", mail.ListUnsubscribe))
+	}
+	writeHeader(&message, "MIME-Version", "1.0")
+	writeHeader(&message, "Content-Type", contentHeader.Get("Content-Type"))
+	if encoding := contentHeader.Get("Content-Transfer-Encoding"); encoding != "" {
+		writeHeader(&message, "Content-Transfer-Encoding", encoding)
+	}
+	message.WriteString("\r\n")
+	message.Write(content)
+
+	return message.Bytes(), nil
+}
+
+// Returns bare addresses of all recipients
+func (m *Email) Recipients() []string {
+	return envelopeAddresses(m.To)
+}
+
+// Builds a ready-to-send message, setting Date and MessageID if they are empty
+func (m *Email) Build() ([]byte, error) {
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		m.MessageID = generateMessageID(m.Sender)
+	}
+
+	return buildEmail(*m)
 }
 
 func (em *Emailer) SendEmail(mail Email) error {
-	err := smtp.SendMail(em.Address, em.Auth, em.From, mail.To, buildEmail(mail))
-	return err
+	message, err := mail.Build()
+	if err != nil {
+		return err
+	}
+
+	return em.SendRaw(mail.Recipients(), message)
+}
+
+// Sends an already built message to given recipients
+func (em *Emailer) SendRaw(to []string, message []byte) error {
+	return em.Transport.Send(em.From, to, message)
 }
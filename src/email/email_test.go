@@ -0,0 +1,254 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package email
+
+import (
+	"Unbewohnte/dela/conf"
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden *bool = flag.Bool("update", false, "Rewrite golden files with current output")
+
+func TestBuildEmailGolden(t *testing.T) {
+	date := time.Date(2025, time.March, 14, 9, 26, 53, 0, time.FixedZone("MSK", 3*60*60))
+
+	htmlOnly := NewEmail(
+		"dela@example.com",
+		"Dela: Email verification",
+		"<p>Your email verification code is: <b>12345</b></p>",
+		[]string{"user@example.com"},
+	)
+
+	alternative := NewEmailAlternative(
+		"Dela <dela@example.com>",
+		"Dela: Ежедневная сводка заметок, которая достаточно длинная, чтобы переноситься",
+		"<h2>Ваша сводка</h2><p>Просрочено: <b>1</b></p>",
+		"Ваша сводка\nПросрочено: 1\n",
+		[]string{"Пользователь <user@example.com>", "second@example.com"},
+	)
+	alternative.ListUnsubscribe = "https://dela.example.com/profile"
+
+	withAttachment := NewEmailAlternative(
+		"dela@example.com",
+		"Dela: Backup",
+		"<p>Backup is attached</p>",
+		"Backup is attached",
+		[]string{"admin@example.com"},
+	)
+	withAttachment.Attach("отчёт.txt", "text/plain", bytes.Repeat([]byte("dela "), 40))
+
+	cases := []struct {
+		Name  string
+		Email Email
+	}{
+		{"html_only", htmlOnly},
+		{"alternative", alternative},
+		{"attachment", withAttachment},
+	}
+
+	for _, testCase := range cases {
+		testCase.Email.Date = date
+		testCase.Email.MessageID = "<" + testCase.Name + "@example.com>"
+
+		message, err := buildEmail(testCase.Email)
+		if err != nil {
+			t.Fatalf("failed to build %s email: %s", testCase.Name, err)
+		}
+
+		goldenPath := filepath.Join("testdata", testCase.Name+".golden")
+		if *updateGolden {
+			err = os.WriteFile(goldenPath, message, 0644)
+			if err != nil {
+				t.Fatalf("failed to update golden file %s: %s", goldenPath, err)
+			}
+		}
+
+		golden, err := os.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatalf("failed to read golden file %s: %s", goldenPath, err)
+		}
+
+		if !bytes.Equal(message, golden) {
+			t.Fatalf("%s email differs from golden file:\n%s", testCase.Name, string(message))
+		}
+
+		// Every message must be parseable back
+		parsed, err := mail.ReadMessage(bytes.NewReader(message))
+		if err != nil {
+			t.Fatalf("failed to parse %s email back: %s", testCase.Name, err)
+		}
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		if err != nil {
+			t.Fatalf("failed to decode %s subject: %s", testCase.Name, err)
+		}
+		if subject != testCase.Email.Subject {
+			t.Fatalf("%s subject was decoded as \"%s\"", testCase.Name, subject)
+		}
+
+		if _, err = parsed.Header.AddressList("To"); err != nil {
+			t.Fatalf("failed to parse %s recipients: %s", testCase.Name, err)
+		}
+
+		for _, line := range strings.Split(string(message), "\r\n") {
+			if len(line) > 998 {
+				t.Fatalf("%s email has a line longer than 998 characters", testCase.Name)
+			}
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	injected := NewEmail(
+		"dela@example.com\r\nBcc: sender@evil.com",
+		"Dela: Password reset\r\nBcc: subject@evil.com",
+		"<p>Hello</p>",
+		[]string{"user@example.com\r\nBcc: recipient@evil.com"},
+	)
+	injected.ListUnsubscribe = "https://dela.example.com/profile>\r\nBcc: <unsubscribe@evil.com"
+
+	message, err := buildEmail(injected)
+	if err != nil {
+		t.Fatalf("failed to build email: %s", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to parse email back: %s", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Fatalf("expected no injected headers, got Bcc: %s", bcc)
+	}
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %s", err)
+	}
+	if strings.Contains(string(body), "evil.com") {
+		t.Fatalf("expected headers to stay out of the body, got %s", body)
+	}
+}
+
+func TestAttachmentRoundTrip(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 254, 255}
+
+	attached := NewEmail("dela@example.com", "Attachment", "<p>See attached</p>", []string{"user@example.com"})
+	attached.Attach("data.bin", "", data)
+	attached.Date = time.Now()
+	attached.MessageID = generateMessageID(attached.Sender)
+
+	message, err := buildEmail(attached)
+	if err != nil {
+		t.Fatalf("failed to build email: %s", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to parse email back: %s", err)
+	}
+
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %s", err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var found bool = false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read message part: %s", err)
+		}
+
+		if part.FileName() != "data.bin" {
+			continue
+		}
+		found = true
+
+		// multipart.Reader does not decode base64 by itself
+		encoded, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read attachment: %s", err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+		if err != nil {
+			t.Fatalf("failed to decode attachment: %s", err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("attachment data changed: %v", decoded)
+		}
+	}
+
+	if !found {
+		t.Fatalf("attachment was not found in the message")
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	directory := t.TempDir()
+
+	transport, err := NewTransport(conf.EmailerConf{
+		User:      "dela@example.com",
+		Transport: TransportFile,
+		Directory: directory,
+	})
+	if err != nil {
+		t.Fatalf("failed to create file transport: %s", err)
+	}
+
+	emailer := NewEmailer(transport, "dela@example.com")
+	err = emailer.SendEmail(NewEmail("dela@example.com", "Hello", "<p>Hello</p>", []string{"User <user@example.com>"}))
+	if err != nil {
+		t.Fatalf("failed to send email with file transport: %s", err)
+	}
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("failed to read mail directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 message file, got %d", len(entries))
+	}
+
+	contents, err := os.ReadFile(filepath.Join(directory, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("failed to read message file: %s", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("failed to parse written message: %s", err)
+	}
+	if parsed.Header.Get("X-Envelope-To") != "user@example.com" {
+		t.Fatalf("wrong envelope recipient: %s", parsed.Header.Get("X-Envelope-To"))
+	}
+}
@@ -0,0 +1,274 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package email
+
+import (
+	"Unbewohnte/dela/conf"
+	"Unbewohnte/dela/logger"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivers already built messages
+type Transport interface {
+	Send(from string, to []string, message []byte) error
+}
+
+const (
+	TransportSMTP     string = "smtp"
+	TransportSendmail string = "sendmail"
+	TransportFile     string = "file"
+	TransportLog      string = "log"
+)
+
+const (
+	// Use STARTTLS if the server offers it (default)
+	TLSOpportunistic string = "opportunistic"
+	// Refuse to send if the server does not offer STARTTLS
+	TLSStartTLS string = "starttls"
+	// Connect over TLS right away (usually port 465)
+	TLSImplicit string = "implicit"
+	// Never encrypt the connection
+	TLSNone string = "none"
+)
+
+const SMTPDialTimeout time.Duration = time.Second * 30
+
+// Sends messages to an SMTP server
+type SMTPTransport struct {
+	Host      string
+	Port      uint16
+	Auth      smtp.Auth
+	TLSMode   string
+	TLSConfig *tls.Config
+}
+
+func (t *SMTPTransport) Send(from string, to []string, message []byte) error {
+	address := net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+
+	var conn net.Conn
+	var err error
+	if t.TLSMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: SMTPDialTimeout}, "tcp", address, t.TLSConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, SMTPDialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if t.TLSMode == TLSStartTLS || t.TLSMode == TLSOpportunistic {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err = client.StartTLS(t.TLSConfig)
+			if err != nil {
+				return err
+			}
+		} else if t.TLSMode == TLSStartTLS {
+			return fmt.Errorf("%s does not support STARTTLS", address)
+		}
+	}
+
+	if t.Auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("%s does not support authentication", address)
+		}
+
+		err = client.Auth(t.Auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range to {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Pipes messages to a local sendmail-compatible program
+type SendmailTransport struct {
+	Path string
+}
+
+func (t *SendmailTransport) Send(from string, to []string, message []byte) error {
+	args := append([]string{"-i", "-f", from, "--"}, to...)
+	command := exec.Command(t.Path, args...)
+	command.Stdin = bytes.NewReader(message)
+
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s (%s)", t.Path, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// Writes every message to a separate .eml file in a directory. Meant for development and tests
+type FileTransport struct {
+	Directory string
+}
+
+func (t *FileTransport) Send(from string, to []string, message []byte) error {
+	err := os.MkdirAll(t.Directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	random := make([]byte, 4)
+	rand.Read(random)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), hex.EncodeToString(random))
+
+	var contents bytes.Buffer
+	contents.WriteString(fmt.Sprintf("X-Envelope-From: %s\r\n", from))
+	contents.WriteString(fmt.Sprintf("X-Envelope-To: %s\r\n", strings.Join(to, ", ")))
+	contents.Write(message)
+
+	return os.WriteFile(filepath.Join(t.Directory, name), contents.Bytes(), 0644)
+}
+
+// Prints messages to the log instead of sending them. Meant for development
+type LogTransport struct{}
+
+func (t *LogTransport) Send(from string, to []string, message []byte) error {
+	logger.Info("[Email] Message from %s to %s:\n%s", from, strings.Join(to, ", "), string(message))
+	return nil
+}
+
+// Returns a TLS configuration which trusts the system certificates and the one from caCertFilePath, if given
+func tlsConfig(host string, caCertFilePath string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caCertFilePath == "" {
+		return config, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	caCert, err := os.ReadFile(caCertFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", caCertFilePath)
+	}
+	config.RootCAs = pool
+
+	return config, nil
+}
+
+// Creates a transport as described by the configuration
+func NewTransport(emailerConf conf.EmailerConf) (Transport, error) {
+	switch strings.ToLower(emailerConf.Transport) {
+	case "", TransportSMTP:
+		tlsMode := strings.ToLower(emailerConf.TLSMode)
+		switch tlsMode {
+		case "":
+			tlsMode = TLSOpportunistic
+		case TLSOpportunistic, TLSStartTLS, TLSImplicit, TLSNone:
+		default:
+			return nil, fmt.Errorf("unknown TLS mode \"%s\"", emailerConf.TLSMode)
+		}
+
+		config, err := tlsConfig(emailerConf.Host, emailerConf.CACertFilePath, emailerConf.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+
+		transport := &SMTPTransport{
+			Host:      emailerConf.Host,
+			Port:      emailerConf.HostPort,
+			TLSMode:   tlsMode,
+			TLSConfig: config,
+		}
+		if !emailerConf.NoAuth {
+			transport.Auth = smtp.PlainAuth("", emailerConf.User, emailerConf.Password, emailerConf.Host)
+		}
+
+		return transport, nil
+
+	case TransportSendmail:
+		path := emailerConf.SendmailPath
+		if path == "" {
+			path = "/usr/sbin/sendmail"
+		}
+		return &SendmailTransport{Path: path}, nil
+
+	case TransportFile:
+		if emailerConf.Directory == "" {
+			return nil, fmt.Errorf("file transport requires a directory")
+		}
+		return &FileTransport{Directory: emailerConf.Directory}, nil
+
+	case TransportLog:
+		return &LogTransport{}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown email transport \"%s\"", emailerConf.Transport)
+	}
+}
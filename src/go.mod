@@ -2,7 +2,10 @@ module Unbewohnte/dela
 
 go 1.20
 
-require modernc.org/sqlite v1.22.0
+require (
+	golang.org/x/image v0.18.0
+	modernc.org/sqlite v1.22.0
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
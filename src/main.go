@@ -31,7 +31,8 @@ import (
 const Version string = "0.3.1"
 
 var (
-	printVersion *bool = flag.Bool("version", false, "Print version information and exit")
+	printVersion *bool   = flag.Bool("version", false, "Print version information and exit")
+	confPath     *string = flag.String("conf", "", "Path to the configuration file. conf.json alongside the executable by default")
 )
 
 const ConfName string = "conf.json"
@@ -42,6 +43,26 @@ var (
 )
 
 func init() {
+	flag.Usage = printUsage
+	flag.Parse()
+
+	// Work out the working directory
+	exePath, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to retrieve executable's path: %s\n", err)
+		os.Exit(1)
+	}
+	WDir = filepath.Dir(exePath)
+	if *confPath == "" {
+		*confPath = filepath.Join(WDir, ConfName)
+	}
+
+	if flag.NArg() > 0 {
+		// Commands print only what they are asked for
+		logger.SetOutput(os.Stderr)
+		return
+	}
+
 	// Output Banner
 	fmt.Println(
 		`██████╗ ███████╗██╗      █████╗ 
@@ -52,8 +73,6 @@ func init() {
 ╚═════╝ ╚══════╝╚══════╝╚═╝  ╚═╝  v` + Version,
 	)
 
-	// Parse flags
-	flag.Parse()
 	if *printVersion {
 		fmt.Printf("dela v%s - a web TODO list\n(c) 2023-2025 Kasyanov Nikolay Alexeyevich (Unbewohnte)\n", Version)
 		os.Exit(0)
@@ -62,19 +81,12 @@ func init() {
 	// Initialize logging
 	logger.SetOutput(os.Stdout)
 
-	// Work out the working directory
-	exePath, err := os.Executable()
-	if err != nil {
-		logger.Error("[Init] Failed to retrieve executable's path: %s", err)
-		os.Exit(1)
-	}
-	WDir = filepath.Dir(exePath)
 	logger.Info("[Init] Working in \"%s\"", WDir)
 
 	// Open configuration, create if does not exist
-	Conf, err = conf.FromFile(filepath.Join(WDir, ConfName))
+	Conf, err = conf.FromFile(*confPath)
 	if err != nil {
-		_, err = conf.Create(filepath.Join(WDir, ConfName), conf.Default())
+		_, err = conf.Create(*confPath, conf.Default())
 		if err != nil {
 			logger.Error("[Init] Failed to create a new configuration file: %s", err)
 			os.Exit(1)
@@ -83,6 +95,9 @@ func init() {
 		os.Exit(0)
 	}
 	logger.Info("[Init] Opened existing configuration file")
+	for _, problem := range Conf.Validate() {
+		logger.Warning("[Init] Configuration: %s", problem)
+	}
 	if Conf.BaseContentDir == "." {
 		Conf.BaseContentDir = WDir
 	}
@@ -91,6 +106,10 @@ func init() {
 }
 
 func main() {
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
 	server, err := server.New(Conf)
 	if err != nil {
 		logger.Error("[Main] Failed to initialize a new server with conf (%+v): %s", Conf, err)
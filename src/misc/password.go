@@ -0,0 +1,30 @@
+package misc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+)
+
+const passwordAlphabet string = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Generates a cryptographically random password of required length
+func GenerateRandomPassword(length uint) (string, error) {
+	password := make([]byte, length)
+	for i := range password {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(passwordAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordAlphabet[index.Int64()]
+	}
+
+	return string(password), nil
+}
+
+// Returns the password the way pages send it to the server and the way it is stored: SHA-256 in hex
+func HashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,214 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"Unbewohnte/dela/misc"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_admin_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{
+		db:         dbase,
+		emailer:    email.NewEmailer(&testTransport{}, "dela@example.com"),
+		outboxWake: make(chan struct{}, 1),
+	}
+	s.config.Server.PublicURL = "https://dela.example.com/"
+
+	admin := "admin@mail.ru"
+	user := "user1@mail.ru"
+	password := misc.HashPassword("ruohguoeruoger")
+	for _, userEmail := range []string{admin, user} {
+		err = dbase.CreateUser(db.User{Email: userEmail, Password: password})
+		if err != nil {
+			t.Fatalf("failed to create user: %s", err)
+		}
+		err = dbase.UserSetEmailConfirmed(userEmail)
+		if err != nil {
+			t.Fatalf("failed to confirm email: %s", err)
+		}
+	}
+	err = dbase.UserSetRole(admin, db.RoleAdmin)
+	if err != nil {
+		t.Fatalf("failed to grant admin rights: %s", err)
+	}
+
+	post := func(endpoint http.HandlerFunc, asEmail string, body interface{}) int {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to marshal body: %s", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/user", bytes.NewReader(bodyBytes))
+		if asEmail != "" {
+			req.SetBasicAuth(asEmail, password)
+		}
+		recorder := httptest.NewRecorder()
+		endpoint(recorder, req)
+		return recorder.Code
+	}
+	target := map[string]string{"email": user}
+
+	// Only admins are let in
+	for _, endpoint := range []http.HandlerFunc{
+		s.EndpointAdminUserVerify,
+		s.EndpointAdminUserDisable,
+		s.EndpointAdminUserDelete,
+		s.EndpointAdminUserResetPassword,
+		s.EndpointAdminUserResendVerification,
+		s.EndpointAdminUserRole,
+	} {
+		if status := post(endpoint, user, target); status != http.StatusForbidden {
+			t.Fatalf("expected non-admin to be forbidden, got status %d", status)
+		}
+		if status := post(endpoint, "", target); status != http.StatusForbidden {
+			t.Fatalf("expected unauthorized request to be forbidden, got status %d", status)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/get", nil)
+	req.SetBasicAuth(admin, password)
+	recorder := httptest.NewRecorder()
+	s.EndpointAdminUsersGet(recorder, req)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), user) {
+		t.Fatalf("expected users to be listed, got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if status := post(s.EndpointAdminUserVerify, admin, map[string]string{"email": "nobody@mail.ru"}); status != http.StatusNotFound {
+		t.Fatalf("expected unknown user to be not found, got status %d", status)
+	}
+
+	// Admins can not lock themselves out
+	for _, endpoint := range []http.HandlerFunc{s.EndpointAdminUserDisable, s.EndpointAdminUserDelete, s.EndpointAdminUserRole} {
+		if status := post(endpoint, admin, map[string]string{"email": admin}); status != http.StatusBadRequest {
+			t.Fatalf("expected a change of admin's own account to be rejected, got status %d", status)
+		}
+	}
+
+	if status := post(s.EndpointAdminUserDisable, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to disable user: status %d", status)
+	}
+	if updated, _ := dbase.GetUser(user); !updated.Disabled {
+		t.Fatalf("expected user to be disabled")
+	}
+	if status := post(s.EndpointAdminUserDisable, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to enable user: status %d", status)
+	}
+	if updated, _ := dbase.GetUser(user); updated.Disabled {
+		t.Fatalf("expected user to be enabled again")
+	}
+
+	if status := post(s.EndpointAdminUserRole, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to change role: status %d", status)
+	}
+	if updated, _ := dbase.GetUser(user); !updated.IsAdmin() {
+		t.Fatalf("expected user to become an admin")
+	}
+	if status := post(s.EndpointAdminUserRole, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to change role back: status %d", status)
+	}
+
+	if status := post(s.EndpointAdminUserResendVerification, admin, target); status != http.StatusBadRequest {
+		t.Fatalf("expected verified user to get no verification email, got status %d", status)
+	}
+
+	// The user gets a one-time link instead of a password
+	if status := post(s.EndpointAdminUserResetPassword, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to reset password: status %d", status)
+	}
+	if updated, _ := dbase.GetUser(user); updated.Password != password {
+		t.Fatalf("expected the password to stay until the link is used")
+	}
+	emails, err := dbase.GetOutboxEmailsByStatus(db.OutboxPending)
+	if err != nil || len(emails) != 1 || emails[0].Recipient != user {
+		t.Fatalf("expected a reset email to %s, got %+v: %v", user, emails, err)
+	}
+	message, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(emails[0].Message)))
+	if err != nil {
+		t.Fatalf("failed to decode email: %s", err)
+	}
+	link := regexp.MustCompile(`https://dela\.example\.com/resetpassword\?token=([A-Za-z0-9]+)`).FindSubmatch(message)
+	if link == nil {
+		t.Fatalf("expected a reset link in the email, got %s", message)
+	}
+	token := string(link[1])
+
+	resetPassword := func(token string, newPassword string) int {
+		bodyBytes, _ := json.Marshal(map[string]string{"token": token, "password": newPassword})
+		req := httptest.NewRequest(http.MethodPost, "/api/user/resetpassword", bytes.NewReader(bodyBytes))
+		recorder := httptest.NewRecorder()
+		s.EndpointUserResetPassword(recorder, req)
+		return recorder.Code
+	}
+	newPassword := misc.HashPassword("new password")
+	if status := resetPassword(token, "abc"); status != http.StatusBadRequest {
+		t.Fatalf("expected a short password to be rejected, got status %d", status)
+	}
+	if status := resetPassword("wrong", newPassword); status != http.StatusForbidden {
+		t.Fatalf("expected a wrong token to be rejected, got status %d", status)
+	}
+	if status := resetPassword(token, newPassword); status != http.StatusOK {
+		t.Fatalf("failed to set a new password: status %d", status)
+	}
+	if updated, _ := dbase.GetUser(user); updated.Password != newPassword {
+		t.Fatalf("expected the new password to be set")
+	}
+	if status := resetPassword(token, misc.HashPassword("another password")); status != http.StatusForbidden {
+		t.Fatalf("expected the link to work only once, got status %d", status)
+	}
+
+	// Links expire
+	err = dbase.CreatePasswordReset(user, misc.HashPassword("expired"), 1000, PasswordResetLifeSeconds)
+	if err != nil {
+		t.Fatalf("failed to create a password reset: %s", err)
+	}
+	if status := resetPassword("expired", password); status != http.StatusForbidden {
+		t.Fatalf("expected an expired link to be rejected, got status %d", status)
+	}
+
+	if status := post(s.EndpointAdminUserVerify, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to verify user: status %d", status)
+	}
+
+	if status := post(s.EndpointAdminUserDelete, admin, target); status != http.StatusOK {
+		t.Fatalf("failed to delete user: status %d", status)
+	}
+	if _, err := dbase.GetUser(user); err == nil {
+		t.Fatalf("expected user to be deleted")
+	}
+}
@@ -0,0 +1,590 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/logger"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Path all routes of the versioned API live under
+const APIv1Prefix string = "/api/v1"
+
+// Machine-readable codes of API errors
+const (
+	APIErrorInvalidRequest   string = "invalid_request"
+	APIErrorUnauthorized     string = "unauthorized"
+	APIErrorForbidden        string = "forbidden"
+	APIErrorNotFound         string = "not_found"
+	APIErrorMethodNotAllowed string = "method_not_allowed"
+	APIErrorConflict         string = "conflict"
+	APIErrorTooLarge         string = "payload_too_large"
+	APIErrorInternal         string = "internal_error"
+)
+
+// Error as sent by the versioned API
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Body of every failed response of the versioned API
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// Kinds of resources {id} in route paths refers to
+const (
+	apiResourceTodo  string = "todo"
+	apiResourceGroup string = "group"
+)
+
+/*
+A route of the versioned API. Most of them are served by the handlers of the older routes:
+the request is rewritten to look like the one they expect and their responses are
+brought to the conventions of the versioned API
+*/
+type apiRoute struct {
+	Method string
+	// Path under APIv1Prefix. {id} stands for the numeric ID of the resource
+	Path    string
+	Name    string
+	Summary string
+	// Whether the route can be used without authentication
+	Public bool
+	// What {id} refers to. Todos and groups of other users are reported as not found
+	Resource string
+	// Older route the request is rewritten to, with the ID appended to it. Empty to keep the path as is
+	Legacy  string
+	Handler func(*Server, http.ResponseWriter, *http.Request)
+	// Current state of the resource the sent JSON is put onto for PATCH
+	Current func(*Server, *http.Request, uint64) (interface{}, error)
+	// Sent on success instead of 200
+	Status int
+	Query  []string
+	// Values of the types of request and response bodies, nil if there are none
+	Request  interface{}
+	Response interface{}
+}
+
+var apiV1Routes = []apiRoute{
+	{
+		Method: http.MethodPost, Path: "/users", Name: "createUser", Summary: "Register a new user",
+		Public: true, Legacy: "/api/user/create", Handler: (*Server).EndpointUserCreate, Status: http.StatusCreated,
+		Request: db.User{}, Response: struct {
+			ConfirmEmail bool `json:"confirm_email"`
+		}{},
+	},
+	{
+		Method: http.MethodPost, Path: "/users/verify", Name: "verifyUser", Summary: "Confirm email of a new user with the sent code",
+		Public: true, Legacy: "/api/user/verify", Handler: (*Server).EndpointUserVerify, Status: http.StatusNoContent,
+		Request: struct {
+			Email string `json:"email"`
+			Code  string `json:"code"`
+		}{},
+	},
+	{
+		Method: http.MethodPost, Path: "/login", Name: "login", Summary: "Check credentials and set the auth cookie",
+		Public: true, Legacy: "/api/user/login", Handler: (*Server).EndpointUserLogin, Status: http.StatusNoContent,
+		Request: db.User{},
+	},
+	{
+		Method: http.MethodGet, Path: "/user", Name: "getUser", Summary: "Get the current user",
+		Legacy: "/api/user/get", Handler: (*Server).EndpointUserGet, Response: db.User{},
+	},
+	{
+		Method: http.MethodPatch, Path: "/user", Name: "updateUser", Summary: "Change password or notification settings of the current user",
+		Legacy: "/api/user/update", Handler: (*Server).EndpointUserUpdate, Current: currentAPIUser, Status: http.StatusNoContent,
+		Request: db.User{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/user", Name: "deleteUser", Summary: "Delete the current user with all of their data",
+		Legacy: "/api/user/delete", Handler: (*Server).EndpointUserDelete, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodGet, Path: "/todos", Name: "listTodos", Summary: "List TODOs of the user",
+		Legacy: "/api/todo/get", Handler: (*Server).EndpointUserTodosGet, Query: []string{"archived", "deferred"},
+		Response: []db.Todo{},
+	},
+	{
+		Method: http.MethodPost, Path: "/todos", Name: "createTodo", Summary: "Create a new TODO",
+		Legacy: "/api/todo/create", Handler: (*Server).EndpointTodoCreate, Status: http.StatusCreated,
+		Request: db.Todo{}, Response: db.Todo{},
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/quickadd", Name: "quickAddTodo", Summary: "Create a new TODO from a line of text",
+		Legacy: "/api/todo/quickadd", Handler: (*Server).EndpointTodoQuickAdd, Status: http.StatusCreated,
+		Request: struct {
+			Input   string `json:"input"`
+			GroupID uint64 `json:"groupId"`
+		}{}, Response: db.Todo{},
+	},
+	{
+		Method: http.MethodGet, Path: "/todos/scheduled", Name: "listScheduledTodos", Summary: "List TODOs due between two dates",
+		Legacy: "/api/todo/range", Handler: (*Server).EndpointTodoRangeGet, Query: []string{"from", "to"},
+		Response: []CalendarTodo{},
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/sync", Name: "syncTodos", Summary: "Apply changes made offline",
+		Legacy: "/api/todo/sync", Handler: (*Server).EndpointTodoSync,
+		Request: struct {
+			Mutations []TodoMutation `json:"mutations"`
+		}{}, Response: struct {
+			Results []TodoMutationResult `json:"results"`
+		}{},
+	},
+	{
+		Method: http.MethodGet, Path: "/todos/{id}", Name: "getTodo", Summary: "Get a TODO",
+		Resource: apiResourceTodo, Handler: (*Server).apiV1TodoGet, Response: db.Todo{},
+	},
+	{
+		Method: http.MethodPatch, Path: "/todos/{id}", Name: "updateTodo", Summary: "Change the sent fields of a TODO",
+		Resource: apiResourceTodo, Legacy: "/api/todo/update/", Handler: (*Server).EndpointTodoUpdate, Current: currentAPITodo,
+		Status: http.StatusNoContent, Request: db.Todo{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/todos/{id}", Name: "deleteTodo", Summary: "Move a TODO to the trash",
+		Resource: apiResourceTodo, Legacy: "/api/todo/delete/", Handler: (*Server).EndpointTodoDelete, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/done", Name: "markTodoDone", Summary: "Mark a TODO as done",
+		Resource: apiResourceTodo, Legacy: "/api/todo/markdone/", Handler: (*Server).EndpointTodoMarkDone, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/restore", Name: "restoreTodo", Summary: "Bring a TODO back from the trash",
+		Resource: apiResourceTodo, Legacy: "/api/todo/restore/", Handler: (*Server).EndpointTodoRestore, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/archive", Name: "archiveTodo", Summary: "Archive a completed TODO",
+		Resource: apiResourceTodo, Legacy: "/api/todo/archive/", Handler: (*Server).EndpointTodoArchive, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/unarchive", Name: "unarchiveTodo", Summary: "Bring a TODO back from the archive",
+		Resource: apiResourceTodo, Legacy: "/api/todo/unarchive/", Handler: (*Server).EndpointTodoUnarchive, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/snooze", Name: "snoozeTodo", Summary: "Hide a TODO until later",
+		Resource: apiResourceTodo, Legacy: "/api/todo/snooze/", Handler: (*Server).EndpointTodoSnooze,
+		Request: struct {
+			Until     string `json:"until"`
+			StartUnix uint64 `json:"startUnix"`
+		}{}, Response: struct {
+			StartUnix uint64 `json:"startUnix"`
+			Start     string `json:"start"`
+		}{},
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/move", Name: "moveTodo", Summary: "Put a TODO into a board column",
+		Resource: apiResourceTodo, Legacy: "/api/todo/move/", Handler: (*Server).EndpointTodoMove, Status: http.StatusNoContent,
+		Request: struct {
+			ColumnID uint64 `json:"columnId"`
+		}{},
+	},
+	{
+		Method: http.MethodGet, Path: "/todos/{id}/comments", Name: "listTodoComments", Summary: "List comments of a TODO",
+		Resource: apiResourceTodo, Legacy: "/api/todo/comments/", Handler: (*Server).EndpointTodoCommentsGet,
+		Response: []CommentView{},
+	},
+	{
+		Method: http.MethodPost, Path: "/todos/{id}/comments", Name: "createTodoComment", Summary: "Comment on a TODO",
+		Resource: apiResourceTodo, Legacy: "/api/todo/comment/", Handler: (*Server).EndpointTodoCommentCreate, Status: http.StatusCreated,
+		Request: struct {
+			Body string `json:"body"`
+		}{}, Response: CommentView{},
+	},
+	{
+		Method: http.MethodGet, Path: "/todos/{id}/timeline", Name: "getTodoTimeline", Summary: "Get comments and changes of a TODO in order",
+		Resource: apiResourceTodo, Legacy: "/api/todo/timeline/", Handler: (*Server).EndpointTodoTimelineGet,
+		Response: []TimelineEntry{},
+	},
+	{
+		Method: http.MethodPatch, Path: "/comments/{id}", Name: "updateComment", Summary: "Edit own comment",
+		Legacy: "/api/comment/update/", Handler: (*Server).EndpointTodoCommentUpdate,
+		Request: struct {
+			Body string `json:"body"`
+		}{}, Response: CommentView{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/comments/{id}", Name: "deleteComment", Summary: "Delete own comment",
+		Legacy: "/api/comment/delete/", Handler: (*Server).EndpointTodoCommentDelete, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodGet, Path: "/groups", Name: "listGroups", Summary: "List groups of the user",
+		Legacy: "/api/group/get", Handler: (*Server).EndpointTodoGroupGet, Response: []db.TodoGroup{},
+	},
+	{
+		Method: http.MethodPost, Path: "/groups", Name: "createGroup", Summary: "Create a new group",
+		Legacy: "/api/group/create", Handler: (*Server).EndpointTodoGroupCreate, Status: http.StatusCreated,
+		Request: db.TodoGroup{}, Response: db.TodoGroup{},
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}", Name: "getGroup", Summary: "Get a group",
+		Resource: apiResourceGroup, Handler: (*Server).apiV1GroupGet, Response: db.TodoGroup{},
+	},
+	{
+		Method: http.MethodPatch, Path: "/groups/{id}", Name: "updateGroup", Summary: "Rename a group",
+		Resource: apiResourceGroup, Legacy: "/api/group/update/", Handler: (*Server).EndpointTodoGroupUpdate, Current: currentAPIGroup,
+		Status: http.StatusNoContent, Request: db.TodoGroup{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/groups/{id}", Name: "deleteGroup", Summary: "Move a group with its TODOs to the trash",
+		Resource: apiResourceGroup, Legacy: "/api/group/delete/", Handler: (*Server).EndpointTodoGroupDelete, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/groups/{id}/restore", Name: "restoreGroup", Summary: "Bring a group back from the trash",
+		Resource: apiResourceGroup, Legacy: "/api/group/restore/", Handler: (*Server).EndpointTodoGroupRestore, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodPost, Path: "/groups/{id}/archive", Name: "archiveGroup", Summary: "Archive completed TODOs of a group",
+		Resource: apiResourceGroup, Legacy: "/api/group/archive/", Handler: (*Server).EndpointTodoGroupArchive, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodGet, Path: "/groups/{id}/board", Name: "getGroupBoard", Summary: "Get TODOs of a group placed into board columns",
+		Resource: apiResourceGroup, Legacy: "/api/board/get/", Handler: (*Server).EndpointBoardGet, Response: BoardPageData{},
+	},
+	{
+		Method: http.MethodGet, Path: "/sync", Name: "getChanges", Summary: "Get changes of TODOs and groups since a revision",
+		Legacy: "/api/sync", Handler: (*Server).EndpointSync, Query: []string{"since", "limit"}, Response: SyncChanges{},
+	},
+	{
+		Method: http.MethodGet, Path: "/archive", Name: "searchArchive", Summary: "Search archived TODOs",
+		Legacy: "/api/archive/search", Handler: (*Server).EndpointArchiveSearch, Query: []string{"q", "from", "to"},
+		Response: ArchivePageData{},
+	},
+	{
+		Method: http.MethodGet, Path: "/trash", Name: "getTrash", Summary: "List deleted TODOs and groups",
+		Legacy: "/api/trash/get", Handler: (*Server).EndpointTrashGet, Response: TrashPageData{},
+	},
+	{
+		Method: http.MethodDelete, Path: "/trash", Name: "emptyTrash", Summary: "Delete everything in the trash for good",
+		Legacy: "/api/trash/empty", Handler: (*Server).EndpointTrashEmpty, Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodGet, Path: "/stats", Name: "getStats", Summary: "Get productivity statistics",
+		Legacy: "/api/stats", Handler: (*Server).EndpointStatsGet, Query: []string{"days", "weeks"}, Response: Stats{},
+	},
+}
+
+// Returns the machine-readable code of an error with given status
+func apiErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return APIErrorInvalidRequest
+	case http.StatusUnauthorized:
+		return APIErrorUnauthorized
+	case http.StatusForbidden:
+		return APIErrorForbidden
+	case http.StatusNotFound:
+		return APIErrorNotFound
+	case http.StatusMethodNotAllowed:
+		return APIErrorMethodNotAllowed
+	case http.StatusConflict:
+		return APIErrorConflict
+	case http.StatusRequestEntityTooLarge:
+		return APIErrorTooLarge
+	default:
+		if status < http.StatusInternalServerError {
+			return APIErrorInvalidRequest
+		}
+		return APIErrorInternal
+	}
+}
+
+// Sends a JSON error with the code matching the status
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	errorBytes, err := json.Marshal(&APIErrorResponse{
+		Error: APIError{
+			Code:    apiErrorCode(status),
+			Message: message,
+		},
+	})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(errorBytes)
+}
+
+// Turns plain-text errors of the older handlers into API errors and sets the status of success
+type apiResponseWriter struct {
+	http.ResponseWriter
+	successStatus int
+	errorStatus   int
+	errorMessage  bytes.Buffer
+	wroteHeader   bool
+}
+
+func (w *apiResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status >= http.StatusBadRequest {
+		// Sent once the whole message is known
+		w.errorStatus = status
+		return
+	}
+	if status == http.StatusOK && w.successStatus != 0 {
+		status = w.successStatus
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *apiResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.errorStatus != 0 {
+		return w.errorMessage.Write(data)
+	}
+	if w.successStatus == http.StatusNoContent {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Sends whatever was held back
+func (w *apiResponseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.errorStatus != 0 {
+		writeAPIError(w.ResponseWriter, w.errorStatus, strings.TrimSpace(w.errorMessage.String()))
+	}
+}
+
+// Returns the ID in place of {id} and true if the path matches the pattern
+func matchAPIPath(pattern string, urlPath string) (uint64, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if len(patternParts) != len(pathParts) {
+		return 0, false
+	}
+
+	var id uint64
+	for i, part := range patternParts {
+		if part != "{id}" {
+			if part != pathParts[i] {
+				return 0, false
+			}
+			continue
+		}
+
+		parsed, err := strconv.ParseUint(pathParts[i], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		id = parsed
+	}
+
+	return id, true
+}
+
+// Serves all routes of the versioned API
+func (s *Server) EndpointAPIv1(w http.ResponseWriter, req *http.Request) {
+	routePath := strings.TrimPrefix(req.URL.Path, APIv1Prefix)
+	if routePath == "/openapi.json" {
+		s.apiV1OpenAPIGet(w, req)
+		return
+	}
+
+	var allowed []string
+	for _, route := range apiV1Routes {
+		id, ok := matchAPIPath(route.Path, routePath)
+		if !ok {
+			continue
+		}
+		if route.Method != req.Method {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+
+		s.serveAPIRoute(w, req, route, id)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeAPIError(w, http.StatusNotFound, "No such route")
+}
+
+func (s *Server) serveAPIRoute(w http.ResponseWriter, req *http.Request, route apiRoute, id uint64) {
+	defer req.Body.Close()
+
+	if !route.Public {
+		if !IsUserAuthorizedReq(req, s.db) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dela"`)
+			writeAPIError(w, http.StatusUnauthorized, "Invalid user auth data")
+			return
+		}
+
+		// Do not tell whether resources of other users exist
+		switch route.Resource {
+		case apiResourceTodo:
+			if !s.db.DoesUserOwnTodo(id, GetEmailFromReq(req)) {
+				writeAPIError(w, http.StatusNotFound, "No such TODO")
+				return
+			}
+		case apiResourceGroup:
+			if !s.db.DoesUserOwnGroup(id, GetEmailFromReq(req)) {
+				writeAPIError(w, http.StatusNotFound, "No such group")
+				return
+			}
+		}
+	}
+
+	routed := req.Clone(req.Context())
+	if route.Legacy != "" {
+		routed.URL.Path = route.Legacy
+		if strings.Contains(route.Path, "{id}") {
+			routed.URL.Path += strconv.FormatUint(id, 10)
+		}
+		routed.URL.RawPath = ""
+		// Older routes only take GET and POST
+		if routed.Method != http.MethodGet {
+			routed.Method = http.MethodPost
+		}
+	}
+
+	if route.Current != nil {
+		body, err := patchedBody(s, req, route, id)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		routed.Body = io.NopCloser(bytes.NewReader(body))
+		routed.ContentLength = int64(len(body))
+	}
+
+	apiWriter := &apiResponseWriter{
+		ResponseWriter: w,
+		successStatus:  route.Status,
+	}
+	route.Handler(s, apiWriter, routed)
+	apiWriter.finish()
+}
+
+// Puts the sent JSON onto the current state of the resource, so that only the sent fields change
+func patchedBody(s *Server, req *http.Request, route apiRoute, id uint64) ([]byte, error) {
+	current, err := route.Current(s, req, id)
+	if err != nil {
+		logger.Error("[Server][APIv1] Failed to get current state for %s %s: %s", route.Method, req.URL.Path, err)
+		return nil, fmt.Errorf("can't access this resource")
+	}
+
+	sent, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body")
+	}
+
+	err = json.Unmarshal(sent, current)
+	if err != nil {
+		return nil, fmt.Errorf("bad JSON: %s", err)
+	}
+
+	return json.Marshal(current)
+}
+
+func currentAPIUser(s *Server, req *http.Request, _ uint64) (interface{}, error) {
+	return s.db.GetUser(GetEmailFromReq(req))
+}
+
+func currentAPITodo(s *Server, _ *http.Request, id uint64) (interface{}, error) {
+	todo, err := s.db.GetTodo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attachments are only changed when sent
+	todo.Image = nil
+	todo.File = nil
+	return todo, nil
+}
+
+func currentAPIGroup(s *Server, _ *http.Request, id uint64) (interface{}, error) {
+	return s.db.GetTodoGroup(id)
+}
+
+func (s *Server) apiV1TodoGet(w http.ResponseWriter, req *http.Request) {
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+	// Served separately
+	todo.Image = nil
+	todo.File = nil
+
+	locale := s.localeFromReq(req)
+	todo.Localize(locale.Location, locale.DateLayout)
+	todoBytes, err := json.Marshal(todo)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODO JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(todoBytes)
+}
+
+func (s *Server) apiV1GroupGet(w http.ResponseWriter, req *http.Request) {
+	groupID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	group, err := s.db.GetTodoGroup(groupID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve TODO group", http.StatusInternalServerError)
+		return
+	}
+
+	groupBytes, err := json.Marshal(group)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODO group JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(groupBytes)
+}
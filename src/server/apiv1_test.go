@@ -0,0 +1,123 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIv1Errors(t *testing.T) {
+	// Plain-text errors of older handlers become JSON ones
+	recorder := httptest.NewRecorder()
+	writer := &apiResponseWriter{ResponseWriter: recorder}
+	http.Error(writer, "Priority must be from 0 to 3", http.StatusBadRequest)
+	writer.finish()
+
+	var response APIErrorResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("error body is not JSON: %s", err)
+	}
+	if recorder.Code != http.StatusBadRequest || response.Error.Code != APIErrorInvalidRequest {
+		t.Fatalf("expected 400 %s, got %d %s", APIErrorInvalidRequest, recorder.Code, response.Error.Code)
+	}
+	if response.Error.Message != "Priority must be from 0 to 3" {
+		t.Fatalf("message was not kept: %q", response.Error.Message)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("error was sent as %s", contentType)
+	}
+
+	// Successful responses get the status of the route
+	recorder = httptest.NewRecorder()
+	writer = &apiResponseWriter{ResponseWriter: recorder, successStatus: http.StatusCreated}
+	writer.Write([]byte("{}"))
+	writer.finish()
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != "{}" {
+		t.Fatalf("expected 201 with body, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	writer = &apiResponseWriter{ResponseWriter: recorder, successStatus: http.StatusNoContent}
+	writer.finish()
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", recorder.Code)
+	}
+
+	for status, code := range map[int]string{
+		http.StatusUnauthorized:        APIErrorUnauthorized,
+		http.StatusNotFound:            APIErrorNotFound,
+		http.StatusConflict:            APIErrorConflict,
+		http.StatusInternalServerError: APIErrorInternal,
+	} {
+		if apiErrorCode(status) != code {
+			t.Fatalf("status %d has code %s instead of %s", status, apiErrorCode(status), code)
+		}
+	}
+}
+
+func TestAPIv1Routes(t *testing.T) {
+	id, ok := matchAPIPath("/todos/{id}/done", "/todos/42/done/")
+	if !ok || id != 42 {
+		t.Fatalf("expected to match ID 42, got %d %v", id, ok)
+	}
+	if _, ok := matchAPIPath("/todos/{id}", "/todos/quickadd"); ok {
+		t.Fatal("non-numeric ID matched")
+	}
+	if _, ok := matchAPIPath("/todos/{id}", "/todos/1/done"); ok {
+		t.Fatal("longer path matched")
+	}
+
+	// Every route is documented and every referenced schema exists
+	documentBytes, err := json.Marshal(OpenAPIDocument())
+	if err != nil {
+		t.Fatalf("failed to marshal OpenAPI document: %s", err)
+	}
+	var document struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		t.Fatalf("failed to unmarshal OpenAPI document: %s", err)
+	}
+
+	for _, route := range apiV1Routes {
+		if _, ok := document.Paths[route.Path][strings.ToLower(route.Method)]; !ok {
+			t.Fatalf("%s %s is not documented", route.Method, route.Path)
+		}
+	}
+	for _, name := range []string{"Todo", "TodoGroup", "APIErrorResponse"} {
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Fatalf("schema %s is missing", name)
+		}
+	}
+	for _, part := range strings.Split(string(documentBytes), `"$ref":"`+openAPISchemasPath)[1:] {
+		name := part[:strings.Index(part, `"`)]
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Fatalf("referenced schema %s is missing", name)
+		}
+	}
+}
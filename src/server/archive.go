@@ -0,0 +1,90 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/logger"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Maximum number of days user can set for automatic archiving
+const MaxAutoArchiveDays uint64 = 3650
+
+// Search parameters of the archive page
+type ArchiveFilter struct {
+	Text string `json:"text"`
+	// Dates in YYYY-MM-DD format as sent by the form
+	From     string `json:"from"`
+	To       string `json:"to"`
+	fromUnix uint64
+	toUnix   uint64
+}
+
+// Reads q, from and to query parameters. Dates are expected in YYYY-MM-DD format in given location, "to" is inclusive
+func archiveFilterFromReq(req *http.Request, location *time.Location) (ArchiveFilter, error) {
+	query := req.URL.Query()
+	filter := ArchiveFilter{
+		Text: strings.TrimSpace(query.Get("q")),
+		From: query.Get("from"),
+		To:   query.Get("to"),
+	}
+
+	if filter.From != "" {
+		from, err := time.ParseInLocation(time.DateOnly, filter.From, location)
+		if err != nil {
+			return filter, errors.New("dates must be in YYYY-MM-DD format")
+		}
+		if from.Unix() < 0 {
+			return filter, errors.New("dates must not be before 1970")
+		}
+		filter.fromUnix = uint64(from.Unix())
+	}
+
+	if filter.To != "" {
+		to, err := time.ParseInLocation(time.DateOnly, filter.To, location)
+		if err != nil {
+			return filter, errors.New("dates must be in YYYY-MM-DD format")
+		}
+		if to.AddDate(0, 0, 1).Unix() < 0 {
+			return filter, errors.New("dates must not be before 1970")
+		}
+		filter.toUnix = uint64(to.AddDate(0, 0, 1).Unix())
+	}
+
+	return filter, nil
+}
+
+// Periodically archives TODOs completed longer ago than their owners have set
+func (s *Server) StartAutoArchiveRoutine(delay time.Duration) {
+	logger.Info("[Server][Archive Routine] Archive Routine Started!")
+
+	for {
+		archived, err := s.db.AutoArchiveTodos(uint64(time.Now().Unix()))
+		if err != nil {
+			logger.Error("[Server][Archive Routine] Failed to archive completed TODOs: %s", err)
+		} else if archived > 0 {
+			logger.Info("[Server][Archive Routine] Archived %d completed TODOs", archived)
+		}
+
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestArchiveFilterFromReq(t *testing.T) {
+	zone := time.FixedZone("UTC+9", 9*60*60)
+
+	for _, testCase := range []struct {
+		Query string
+		From  time.Time
+		To    time.Time
+		Valid bool
+	}{
+		{"from=2025-03-05&to=2025-03-06", time.Date(2025, 3, 5, 0, 0, 0, 0, zone), time.Date(2025, 3, 7, 0, 0, 0, 0, zone), true},
+		{"q=dishes", time.Unix(0, 0), time.Unix(0, 0), true},
+		// The first day in the zone starts before 1970 in UTC
+		{"from=1970-01-02", time.Date(1970, 1, 2, 0, 0, 0, 0, zone), time.Unix(0, 0), true},
+		{"from=1970-01-01", time.Time{}, time.Time{}, false},
+		{"from=1969-12-31", time.Time{}, time.Time{}, false},
+		{"to=1900-01-01", time.Time{}, time.Time{}, false},
+		{"from=05.03.2025", time.Time{}, time.Time{}, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/archive/search?"+testCase.Query, nil)
+		filter, err := archiveFilterFromReq(req, zone)
+		if (err == nil) != testCase.Valid {
+			t.Errorf("%s: expected valid to be %v, got error %v", testCase.Query, testCase.Valid, err)
+			continue
+		}
+		if testCase.Valid && (filter.fromUnix != uint64(testCase.From.Unix()) || filter.toUnix != uint64(testCase.To.Unix())) {
+			t.Errorf("%s: expected [%d, %d), got [%d, %d)", testCase.Query, testCase.From.Unix(), testCase.To.Unix(), filter.fromUnix, filter.toUnix)
+		}
+	}
+}
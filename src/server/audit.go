@@ -0,0 +1,143 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/logger"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	AuditTargetUser    string = "user"
+	AuditTargetTodo    string = "todo"
+	AuditTargetGroup   string = "group"
+	AuditTargetOutbox  string = "outbox"
+	AuditTargetColumn  string = "column"
+	AuditTargetComment string = "comment"
+	AuditTargetBackup  string = "backup"
+)
+
+const (
+	// How many latest events are shown on the profile page
+	ProfileAuditEventsCount uint64 = 50
+	// How many events are shown on a single page of the admin audit log
+	AuditPageSize uint64 = 100
+)
+
+// Fields that are never put into audit snapshots: binary data and secrets
+var auditExcludedFields = []string{"image", "file", "password", "message"}
+
+// Returns address of the client that made the request
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// Marshals value to JSON without binary data and secrets. Returns an empty string for nil
+func auditSnapshot(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(valueBytes, &fields)
+	if err != nil {
+		// Not an object
+		return string(valueBytes)
+	}
+
+	for _, excluded := range auditExcludedFields {
+		delete(fields, excluded)
+	}
+
+	snapshotBytes, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+
+	return string(snapshotBytes)
+}
+
+/*
+Records a change made by the user of the request to the data of owner.
+before and after are snapshots of the target, either of them can be nil.
+Changes of user's data are also pushed to their open sessions.
+Failing to record an event is logged, but does not stop the request
+*/
+func (s *Server) audit(req *http.Request, owner string, action string, targetType string, targetID interface{}, before interface{}, after interface{}) {
+	actor := GetEmailFromReq(req)
+	if actor == "" {
+		// Not logged in yet, ie: registration
+		actor = owner
+	}
+
+	afterSnapshot := auditSnapshot(after)
+	s.publishChange(req, owner, action, targetType, targetID, afterSnapshot)
+
+	err := s.db.CreateAuditEvent(db.AuditEvent{
+		ActorEmail: actor,
+		OwnerEmail: owner,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Before:     auditSnapshot(before),
+		After:      afterSnapshot,
+		ClientIP:   clientIP(req),
+		TimeUnix:   uint64(time.Now().Unix()),
+	})
+	if err != nil {
+		logger.Error("[Server][Audit] Failed to record \"%s\" by %s on %s %v: %s", action, actor, targetType, targetID, err)
+	}
+}
+
+// Periodically deletes audit events older than configured retention period
+func (s *Server) StartAuditRetentionRoutine(delay time.Duration) {
+	if s.config.AuditRetentionDays == 0 {
+		logger.Info("[Server][Audit Routine] Audit events are kept forever")
+		return
+	}
+
+	logger.Info("[Server][Audit Routine] Audit Routine Started!")
+
+	retention := time.Hour * 24 * time.Duration(s.config.AuditRetentionDays)
+	for {
+		deleted, err := s.db.DeleteAuditEventsOlderThan(uint64(time.Now().Add(-retention).Unix()), AuditTargetTodo)
+		if err != nil {
+			logger.Error("[Server][Audit Routine] Failed to delete old audit events: %s", err)
+		} else if deleted > 0 {
+			logger.Info("[Server][Audit Routine] Deleted %d audit events older than %d days", deleted, s.config.AuditRetentionDays)
+		}
+
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/conf"
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/logger"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Names of backup files start with it, followed by the time they were made
+	BackupFilePrefix string = "dela-"
+	BackupTimeLayout string = "20060102-150405.000"
+	BackupFileExt    string = ".db"
+)
+
+// A backup file in the backup directory
+type Backup struct {
+	Name      string `json:"name"`
+	SizeBytes uint64 `json:"sizeBytes"`
+	TimeUnix  uint64 `json:"timeUnix"`
+}
+
+// Returns the directory backups are written to
+func BackupDir(config conf.Conf) string {
+	if filepath.IsAbs(config.Backup.Directory) {
+		return config.Backup.Directory
+	}
+	return filepath.Join(config.BaseContentDir, config.Backup.Directory)
+}
+
+/*
+Returns the name of a backup made at given time. The time is in UTC, so that names sort in the
+order backups were made even when clocks are turned back
+*/
+func BackupFileName(config conf.Conf, madeAt time.Time) string {
+	name := BackupFilePrefix + madeAt.UTC().Format(BackupTimeLayout) + BackupFileExt
+	if config.Backup.Compress {
+		name += db.CompressedBackupExt
+	}
+	return name
+}
+
+func isBackupFileName(name string) bool {
+	return strings.HasPrefix(name, BackupFilePrefix) &&
+		(strings.HasSuffix(name, BackupFileExt) || strings.HasSuffix(name, BackupFileExt+db.CompressedBackupExt))
+}
+
+// Returns backups in the backup directory, oldest first
+func (s *Server) Backups() ([]Backup, error) {
+	entries, err := os.ReadDir(BackupDir(s.config))
+	if os.IsNotExist(err) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isBackupFileName(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name:      entry.Name(),
+			SizeBytes: uint64(info.Size()),
+			TimeUnix:  uint64(info.ModTime().Unix()),
+		})
+	}
+
+	// Names begin with the time, so they sort in the order backups were made
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name < backups[j].Name
+	})
+
+	return backups, nil
+}
+
+// Deletes the oldest backups beyond the configured number to keep
+func (s *Server) rotateBackups() error {
+	if s.config.Backup.Keep == 0 {
+		return nil
+	}
+
+	backups, err := s.Backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > int(s.config.Backup.Keep) {
+		err = os.Remove(filepath.Join(BackupDir(s.config), backups[0].Name))
+		if err != nil {
+			return err
+		}
+		logger.Info("[Server][Backup] Deleted old backup %s", backups[0].Name)
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Writes a consistent copy of the database into the backup directory and deletes the oldest ones
+func (s *Server) Backup() (Backup, error) {
+	s.backupMutex.Lock()
+	defer s.backupMutex.Unlock()
+
+	backupDir := BackupDir(s.config)
+	err := os.MkdirAll(backupDir, os.ModePerm)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	madeAt := time.Now()
+	backupPath := filepath.Join(backupDir, BackupFileName(s.config, madeAt))
+	for {
+		// Taken by a backup made in the same millisecond. Names must stay in the order backups were made
+		if _, err := os.Stat(backupPath); err != nil {
+			break
+		}
+		madeAt = madeAt.Add(time.Millisecond)
+		backupPath = filepath.Join(backupDir, BackupFileName(s.config, madeAt))
+	}
+	if s.config.Backup.Compress {
+		err = s.db.BackupCompressedTo(backupPath)
+	} else {
+		err = s.db.BackupTo(backupPath)
+	}
+	if err != nil {
+		return Backup{}, err
+	}
+
+	backup := Backup{
+		Name:     filepath.Base(backupPath),
+		TimeUnix: uint64(madeAt.Unix()),
+	}
+	if info, err := os.Stat(backupPath); err == nil {
+		backup.SizeBytes = uint64(info.Size())
+	}
+
+	err = s.rotateBackups()
+	if err != nil {
+		logger.Error("[Server][Backup] Failed to delete old backups: %s", err)
+	}
+
+	return backup, nil
+}
+
+// Periodically backs up the database. Backups made before a restart count, so restarts do not make extra ones
+func (s *Server) StartBackupRoutine(delay time.Duration) {
+	if delay == 0 {
+		logger.Info("[Server][Backup Routine] Scheduled backups are disabled")
+		return
+	}
+	if s.config.Backup.Directory == "" {
+		logger.Warning("[Server][Backup Routine] Backup directory is not configured, scheduled backups are disabled")
+		return
+	}
+
+	logger.Info("[Server][Backup Routine] Backup Routine Started!")
+
+	for {
+		next := time.Now()
+		backups, err := s.Backups()
+		if err != nil {
+			logger.Error("[Server][Backup Routine] Failed to list backups: %s", err)
+		} else if len(backups) > 0 {
+			next = time.Unix(int64(backups[len(backups)-1].TimeUnix), 0).Add(delay)
+		}
+
+		if !time.Now().Before(next) {
+			backup, err := s.Backup()
+			if err != nil {
+				logger.Error("[Server][Backup Routine] Failed to back up the database: %s", err)
+			} else {
+				logger.Info("[Server][Backup Routine] Backed up the database into %s", backup.Name)
+			}
+			next = time.Now().Add(delay)
+		}
+
+		time.Sleep(time.Until(next))
+	}
+}
+
+func (s *Server) EndpointAdminBackupsGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	backups, err := s.Backups()
+	if err != nil {
+		logger.Error("[Server][EndpointAdminBackupsGet] Failed to list backups: %s", err)
+		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		return
+	}
+
+	backupsBytes, err := json.Marshal(&backups)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminBackupsGet] Failed to marshal backups: %s", err)
+		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(backupsBytes)
+}
+
+func (s *Server) EndpointAdminBackupCreate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	if s.config.Backup.Directory == "" {
+		http.Error(w, "Backup directory is not configured", http.StatusConflict)
+		return
+	}
+
+	backup, err := s.Backup()
+	if err != nil {
+		logger.Error("[Server][EndpointAdminBackupCreate] Failed to back up the database: %s", err)
+		http.Error(w, "Failed to back up the database", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, GetEmailFromReq(req), "admin.backup", AuditTargetBackup, backup.Name, nil, backup)
+	logger.Info("[Server][EndpointAdminBackupCreate] %s backed up the database into %s", GetEmailFromReq(req), backup.Name)
+
+	backupBytes, err := json.Marshal(&backup)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminBackupCreate] Failed to marshal backup: %s", err)
+		http.Error(w, "Failed to back up the database", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(backupBytes)
+}
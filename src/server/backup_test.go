@@ -0,0 +1,147 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/conf"
+	"Unbewohnte/dela/db"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackups(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_backups_test.db")
+	backupDir := filepath.Join(os.TempDir(), "dela_backups_test")
+	os.RemoveAll(backupDir)
+	defer os.Remove(dbPath)
+	defer os.RemoveAll(backupDir)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+
+	config := conf.Default()
+	config.BaseContentDir = os.TempDir()
+	config.Backup.Directory = filepath.Base(backupDir)
+	config.Backup.Keep = 2
+	config.Backup.Compress = true
+	s := &Server{db: dbase, config: config}
+
+	if BackupDir(config) != backupDir {
+		t.Fatalf("expected backups to go into %s, got %s", backupDir, BackupDir(config))
+	}
+
+	backups, err := s.Backups()
+	if err != nil || len(backups) != 0 {
+		t.Fatalf("expected no backups before the directory exists, got %v: %v", backups, err)
+	}
+
+	// Made earlier
+	err = os.MkdirAll(backupDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("failed to create backup directory: %s", err)
+	}
+	old := []string{
+		BackupFileName(config, time.Now().Add(-time.Hour*48)),
+		BackupFileName(config, time.Now().Add(-time.Hour*24)),
+		"notes.txt",
+	}
+	for _, name := range old {
+		err = os.WriteFile(filepath.Join(backupDir, name), []byte{}, 0600)
+		if err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+	}
+
+	backup, err := s.Backup()
+	if err != nil {
+		t.Fatalf("failed to back up: %s", err)
+	}
+	if !strings.HasSuffix(backup.Name, BackupFileExt+db.CompressedBackupExt) || backup.SizeBytes == 0 {
+		t.Fatalf("expected a compressed backup, got %+v", backup)
+	}
+
+	// Only the latest ones are kept and unrelated files are left alone
+	backups, err = s.Backups()
+	if err != nil {
+		t.Fatalf("failed to list backups: %s", err)
+	}
+	if len(backups) != 2 || backups[0].Name != old[1] || backups[1].Name != backup.Name {
+		t.Fatalf("expected %s and %s to be kept, got %+v", old[1], backup.Name, backups)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, old[0])); err == nil {
+		t.Fatalf("oldest backup %s was not deleted", old[0])
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "notes.txt")); err != nil {
+		t.Fatalf("unrelated file was deleted: %s", err)
+	}
+
+	// Backups made right one after another do not collide
+	config.Backup.Keep = 0
+	s.config = config
+	names := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		backup, err := s.Backup()
+		if err != nil {
+			t.Fatalf("failed to back up right after another backup: %s", err)
+		}
+		names[backup.Name] = true
+	}
+	backups, err = s.Backups()
+	if err != nil || len(names) != 3 || len(backups) != 5 || backups[1].Name != backup.Name {
+		t.Fatalf("expected 3 more backups after %s, got %+v: %v", backup.Name, backups, err)
+	}
+
+	// Names keep the order after clocks are turned back
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %s", err)
+	}
+	beforeFallBack := time.Date(2025, 11, 2, 5, 50, 0, 0, time.UTC).In(newYork)
+	afterFallBack := time.Date(2025, 11, 2, 6, 10, 0, 0, time.UTC).In(newYork)
+	if BackupFileName(config, beforeFallBack) >= BackupFileName(config, afterFallBack) {
+		t.Fatalf("expected %s to sort before %s", BackupFileName(config, beforeFallBack), BackupFileName(config, afterFallBack))
+	}
+
+	// Nothing is backed up on schedule without a directory
+	config.Backup.Directory = ""
+	s.config = config
+	stopped := make(chan bool)
+	go func() {
+		s.StartBackupRoutine(time.Hour)
+		stopped <- true
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("backup routine must not run without a backup directory")
+	}
+
+	restoredPath := filepath.Join(os.TempDir(), "dela_backups_test_restored.db")
+	defer os.Remove(restoredPath)
+	err = db.Restore(filepath.Join(backupDir, backup.Name), restoredPath)
+	if err != nil {
+		t.Fatalf("failed to restore backup: %s", err)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/i18n"
+)
+
+// Longest allowed name of a board column
+const MaxBoardColumnNameLength uint = 50
+
+// A board column together with TODOs placed into it
+type BoardColumnTodos struct {
+	*db.BoardColumn
+	Todos []*db.Todo `json:"todos"`
+}
+
+/*
+Places TODOs into their columns. TODOs without a column or whose completion
+state does not match their column go to the first column with the matching done flag
+*/
+func placeOnBoard(columns []*db.BoardColumn, todos []*db.Todo) []*BoardColumnTodos {
+	var board []*BoardColumnTodos
+	byID := make(map[uint64]*BoardColumnTodos)
+	var firstDone, firstNotDone *BoardColumnTodos
+	for _, column := range columns {
+		boardColumn := &BoardColumnTodos{BoardColumn: column}
+		board = append(board, boardColumn)
+		byID[column.ID] = boardColumn
+
+		if column.IsDone && firstDone == nil {
+			firstDone = boardColumn
+		} else if !column.IsDone && firstNotDone == nil {
+			firstNotDone = boardColumn
+		}
+	}
+
+	for _, todo := range todos {
+		boardColumn, ok := byID[todo.ColumnID]
+		if !ok || boardColumn.IsDone != todo.IsDone {
+			boardColumn = firstNotDone
+			if todo.IsDone {
+				boardColumn = firstDone
+			}
+		}
+
+		if boardColumn == nil {
+			// There is no suitable column at all
+			continue
+		}
+		boardColumn.Todos = append(boardColumn.Todos, todo)
+	}
+
+	return board
+}
+
+// Creates Backlog, In progress, Review and Done columns for the group
+func (s *Server) createDefaultBoardColumns(groupID uint64, language i18n.Language) error {
+	pageData, err := s.GetPageData([]string{"board"}, language)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []db.BoardColumn{
+		{Name: pageData.Translation["board default backlog"]},
+		{Name: pageData.Translation["board default in progress"]},
+		{Name: pageData.Translation["board default review"]},
+		{Name: pageData.Translation["board default done"], IsDone: true},
+	} {
+		column.GroupID = groupID
+		_, err = s.db.CreateBoardColumn(column)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
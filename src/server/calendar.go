@@ -0,0 +1,157 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	CalendarViewMonth string = "month"
+	CalendarViewWeek  string = "week"
+	// The widest range of dates TODOs can be retrieved for at once
+	MaxTodoRangeDays int = 366
+)
+
+// A TODO placed on the calendar
+type CalendarTodo struct {
+	*db.Todo
+	Overdue bool `json:"overdue"`
+	// Time of the day the TODO is due at. Empty if it has none
+	Time string `json:"time"`
+}
+
+// Wraps TODO to be placed on the calendar. Times are taken in the location of now
+func newCalendarTodo(todo *db.Todo, now time.Time) *CalendarTodo {
+	calendarTodo := &CalendarTodo{
+		Todo:    todo,
+		Overdue: isOverdue(todo, now),
+	}
+	if todo.DueHasTime {
+		calendarTodo.Time = todo.DueIn(now.Location()).Format("15:04")
+	}
+
+	return calendarTodo
+}
+
+// A single cell of the calendar
+type CalendarDay struct {
+	Date string `json:"date"`
+	Day  int    `json:"day"`
+	// False for days of neighbouring months shown to fill the weeks
+	InPeriod bool            `json:"inPeriod"`
+	Today    bool            `json:"today"`
+	Todos    []*CalendarTodo `json:"todos"`
+}
+
+// Reads from and to query parameters in YYYY-MM-DD format and returns [from, to + 1 day) range in given location
+func todoRangeFromReq(req *http.Request, location *time.Location) (time.Time, time.Time, error) {
+	query := req.URL.Query()
+
+	from, err := time.ParseInLocation(time.DateOnly, query.Get("from"), location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to, err := time.ParseInLocation(time.DateOnly, query.Get("to"), location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to = to.AddDate(0, 0, 1)
+
+	if !to.After(from) || to.After(from.AddDate(0, 0, MaxTodoRangeDays)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must be from 1 to %d days long", MaxTodoRangeDays)
+	}
+
+	return from, to, nil
+}
+
+// Reads view and date query parameters of the calendar page, falling back to the current month. Dates are in the location of now
+func calendarFromReq(req *http.Request, now time.Time) (string, time.Time) {
+	query := req.URL.Query()
+
+	view := query.Get("view")
+	if view != CalendarViewWeek {
+		view = CalendarViewMonth
+	}
+
+	date, err := time.ParseInLocation(time.DateOnly, query.Get("date"), now.Location())
+	if err != nil {
+		date = startOfDay(now)
+	}
+
+	return view, date
+}
+
+// Returns the first day shown, the first day after the shown period and dates of the previous and next periods
+func calendarBounds(view string, date time.Time) (time.Time, time.Time, time.Time, time.Time) {
+	if view == CalendarViewWeek {
+		weekStart := startOfWeek(date)
+		return weekStart, weekStart.AddDate(0, 0, 7), weekStart.AddDate(0, 0, -7), weekStart.AddDate(0, 0, 7)
+	}
+
+	monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	nextMonth := monthStart.AddDate(0, 1, 0)
+	// Fill the first and the last weeks with days of neighbouring months
+	return startOfWeek(monthStart), startOfWeek(nextMonth.AddDate(0, 0, 6)), monthStart.AddDate(0, -1, 0), nextMonth
+}
+
+// Returns true if TODO is not done in time. TODOs without due time are overdue only after their due date has passed
+func isOverdue(todo *db.Todo, now time.Time) bool {
+	if todo.IsDone || todo.DueUnix == 0 {
+		return false
+	}
+
+	if todo.DueHasTime {
+		return int64(todo.DueUnix) < now.Unix()
+	}
+
+	return todo.DueIn(now.Location()).Before(startOfDay(now))
+}
+
+// Places TODOs on the days from start to end, splitting them into weeks. Days are taken in the location of now
+func calendarWeeks(todos []*db.Todo, start time.Time, end time.Time, month time.Month, view string, now time.Time) [][]*CalendarDay {
+	byDate := make(map[string][]*CalendarTodo)
+	for _, todo := range todos {
+		date := todo.DueIn(now.Location()).Format(time.DateOnly)
+		byDate[date] = append(byDate[date], newCalendarTodo(todo, now))
+	}
+
+	today := now.Format(time.DateOnly)
+	var weeks [][]*CalendarDay
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 7) {
+		var week []*CalendarDay
+		for weekday := 0; weekday < 7; weekday++ {
+			date := day.AddDate(0, 0, weekday)
+			week = append(week, &CalendarDay{
+				Date:     date.Format(time.DateOnly),
+				Day:      date.Day(),
+				InPeriod: view == CalendarViewWeek || date.Month() == month,
+				Today:    date.Format(time.DateOnly) == today,
+				Todos:    byDate[date.Format(time.DateOnly)],
+			})
+		}
+		weeks = append(weeks, week)
+	}
+
+	return weeks
+}
@@ -0,0 +1,164 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTodoRangeFromReq(t *testing.T) {
+	zone := time.FixedZone("UTC+9", 9*60*60)
+
+	for _, testCase := range []struct {
+		Query string
+		From  time.Time
+		To    time.Time
+		Valid bool
+	}{
+		{"from=2025-03-05&to=2025-03-05", time.Date(2025, 3, 5, 0, 0, 0, 0, zone), time.Date(2025, 3, 6, 0, 0, 0, 0, zone), true},
+		{"from=2025-02-24&to=2025-03-02", time.Date(2025, 2, 24, 0, 0, 0, 0, zone), time.Date(2025, 3, 3, 0, 0, 0, 0, zone), true},
+		{"from=2025-01-01&to=2026-01-01", time.Date(2025, 1, 1, 0, 0, 0, 0, zone), time.Date(2026, 1, 2, 0, 0, 0, 0, zone), true},
+		{"from=2025-01-01&to=2026-01-02", time.Time{}, time.Time{}, false},
+		{"from=2025-03-05&to=2025-03-04", time.Time{}, time.Time{}, false},
+		{"from=2025-03-05", time.Time{}, time.Time{}, false},
+		{"from=05.03.2025&to=2025-03-06", time.Time{}, time.Time{}, false},
+		{"", time.Time{}, time.Time{}, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/todo/range?"+testCase.Query, nil)
+		from, to, err := todoRangeFromReq(req, zone)
+		if (err == nil) != testCase.Valid {
+			t.Errorf("%s: expected valid to be %v, got error %v", testCase.Query, testCase.Valid, err)
+			continue
+		}
+		if testCase.Valid && (!from.Equal(testCase.From) || !to.Equal(testCase.To)) {
+			t.Errorf("%s: expected [%s, %s), got [%s, %s)", testCase.Query, testCase.From, testCase.To, from, to)
+		}
+	}
+}
+
+func TestTodoRangeGet(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_range_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase}
+
+	email := "user1@mail.ru"
+	password := "ruohguoeruoger"
+	err = dbase.CreateUser(db.User{Email: email, Password: password, Timezone: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+	err = dbase.UserSetEmailConfirmed(email)
+	if err != nil {
+		t.Fatalf("failed to confirm email: %s", err)
+	}
+	zone, _ := time.LoadLocation("Asia/Tokyo")
+
+	date := func(day int) uint64 {
+		return uint64(time.Date(2025, 3, day, 0, 0, 0, 0, time.UTC).Unix())
+	}
+	at := func(day int, hour int, minute int) uint64 {
+		return uint64(time.Date(2025, 3, day, hour, minute, 0, 0, zone).Unix())
+	}
+	// Days are taken in user's zone, both ends of the range included
+	ids := make(map[string]uint64)
+	for name, todo := range map[string]db.Todo{
+		"day before":         {DueUnix: date(4)},
+		"first day":          {DueUnix: date(5)},
+		"last day":           {DueUnix: date(7)},
+		"day after":          {DueUnix: date(8)},
+		"first minute":       {DueUnix: at(5, 0, 30), DueHasTime: true},
+		"minute before":      {DueUnix: at(4, 23, 59), DueHasTime: true},
+		"last minute":        {DueUnix: at(7, 23, 59), DueHasTime: true},
+		"minute after":       {DueUnix: at(8, 0, 0), DueHasTime: true},
+		"archived first day": {DueUnix: date(5), IsDone: true},
+		"no due date":        {},
+	} {
+		todo.Text = name
+		todo.GroupID = 1
+		todo.OwnerEmail = email
+		ids[name], err = dbase.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+	err = dbase.ArchiveTodo(ids["archived first day"], 1)
+	if err != nil {
+		t.Fatalf("failed to archive TODO: %s", err)
+	}
+
+	get := func(query string) (int, []*CalendarTodo) {
+		req := httptest.NewRequest(http.MethodGet, "/api/todo/range?"+query, nil)
+		req.SetBasicAuth(email, password)
+		recorder := httptest.NewRecorder()
+		s.EndpointTodoRangeGet(recorder, req)
+
+		var todos []*CalendarTodo
+		if recorder.Code == http.StatusOK {
+			err := json.Unmarshal(recorder.Body.Bytes(), &todos)
+			if err != nil {
+				t.Fatalf("failed to unmarshal TODOs: %s", err)
+			}
+		}
+		return recorder.Code, todos
+	}
+
+	status, todos := get("from=2025-03-05&to=2025-03-07")
+	if status != http.StatusOK {
+		t.Fatalf("expected range to be returned, got status %d", status)
+	}
+	expected := []string{"first day", "first minute", "last day", "last minute"}
+	if len(todos) != len(expected) {
+		t.Fatalf("expected %v, got %d TODOs", expected, len(todos))
+	}
+	for i, name := range expected {
+		if todos[i].ID != ids[name] {
+			t.Fatalf("expected %q at %d, got %q", name, i, todos[i].Text)
+		}
+	}
+	if todos[1].Time != "00:30" || todos[0].Time != "" {
+		t.Fatalf("expected times in user's zone, got %q and %q", todos[0].Time, todos[1].Time)
+	}
+
+	for _, query := range []string{"from=2025-03-07&to=2025-03-05", "from=2025-01-01&to=2026-06-01", "to=2025-03-05"} {
+		status, _ = get(query)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got status %d", query, status)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todo/range?from=2025-03-05&to=2025-03-07", nil)
+	recorder := httptest.NewRecorder()
+	s.EndpointTodoRangeGet(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected unauthorized request to be forbidden, got status %d", recorder.Code)
+	}
+}
@@ -0,0 +1,273 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Longest allowed comment body
+const MaxTodoCommentLength uint = 5000
+
+const (
+	TimelineComment string = "comment"
+	TimelineChange  string = "change"
+)
+
+// State changes shown in the activity timeline of a TODO
+const (
+	ChangeCreated string = "created"
+	ChangeMoved   string = "moved"
+	ChangeDone    string = "done"
+	ChangeUndone  string = "undone"
+	ChangeDue     string = "due"
+)
+
+// A comment as shown to a particular user
+type CommentView struct {
+	*db.TodoComment
+	// Rendered Markdown body
+	HTML string `json:"html"`
+	// Whether the user is the author and can edit or delete the comment
+	Editable bool `json:"editable"`
+}
+
+// A single entry of TODO's activity timeline: either a comment or a state change
+type TimelineEntry struct {
+	Kind       string       `json:"kind"`
+	TimeUnix   uint64       `json:"timeUnix"`
+	Time       string       `json:"time"`
+	ActorEmail string       `json:"actorEmail"`
+	Comment    *CommentView `json:"comment,omitempty"`
+	Change     string       `json:"change,omitempty"`
+	// Previous and new values of the changed property, if any
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+var (
+	markdownCode   = regexp.MustCompile("`([^`]+)`")
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|mailto:)[^\s)]+)\)`)
+	markdownBold   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	markdownItalic = regexp.MustCompile(`\*(.+?)\*|\b_(.+?)_\b`)
+)
+
+// Renders inline Markdown of already escaped text. Code spans are left as they are
+func renderMarkdownInline(escaped string) string {
+	var rendered strings.Builder
+	last := 0
+	for _, code := range markdownCode.FindAllStringSubmatchIndex(escaped, -1) {
+		rendered.WriteString(renderMarkdownEmphasis(escaped[last:code[0]]))
+		rendered.WriteString("<code>" + escaped[code[2]:code[3]] + "</code>")
+		last = code[1]
+	}
+	rendered.WriteString(renderMarkdownEmphasis(escaped[last:]))
+
+	return rendered.String()
+}
+
+func renderMarkdownEmphasis(escaped string) string {
+	escaped = markdownLink.ReplaceAllString(escaped, `<a href="$2" target="_blank" rel="noopener noreferrer">$1</a>`)
+	escaped = markdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+	return markdownItalic.ReplaceAllString(escaped, "<em>$1$2</em>")
+}
+
+/*
+Renders basic Markdown into HTML: paragraphs, line breaks, "- " lists,
+**bold**, *italic*, `code` and links. Everything else is escaped, so
+the result is safe to put into the page as is
+*/
+func renderMarkdown(source string) string {
+	var (
+		rendered  strings.Builder
+		paragraph []string
+		list      []string
+	)
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			rendered.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>")
+			paragraph = nil
+		}
+		if len(list) > 0 {
+			rendered.WriteString("<ul><li>" + strings.Join(list, "</li><li>") + "</li></ul>")
+			list = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			if len(paragraph) > 0 {
+				flush()
+			}
+			list = append(list, renderMarkdownInline(html.EscapeString(trimmed[2:])))
+		default:
+			if len(list) > 0 {
+				flush()
+			}
+			paragraph = append(paragraph, renderMarkdownInline(html.EscapeString(line)))
+		}
+	}
+	flush()
+
+	return rendered.String()
+}
+
+// Prepares the comment to be shown to the user
+func newCommentView(comment *db.TodoComment, viewerEmail string, locale Locale) *CommentView {
+	comment.Localize(locale.Location, locale.DateLayout)
+	return &CommentView{
+		TodoComment: comment,
+		HTML:        renderMarkdown(comment.Body),
+		Editable:    comment.AuthorEmail == viewerEmail,
+	}
+}
+
+// Reads TODO snapshot of an audit event. Returns nil if there is none
+func auditTodoSnapshot(snapshot string) *db.Todo {
+	if snapshot == "" {
+		return nil
+	}
+
+	var todo db.Todo
+	err := json.Unmarshal([]byte(snapshot), &todo)
+	if err != nil {
+		return nil
+	}
+
+	return &todo
+}
+
+// Returns how the due date of the TODO is shown to the user
+func dueString(todo *db.Todo, locale Locale) string {
+	shown := *todo
+	shown.Localize(locale.Location, locale.DateLayout)
+	return shown.Due
+}
+
+// Returns state changes of the TODO recorded in the audit event
+func (s *Server) auditEventChanges(event *db.AuditEvent, locale Locale, groupNames map[uint64]string) []*TimelineEntry {
+	groupName := func(groupID uint64) string {
+		name, ok := groupNames[groupID]
+		if !ok {
+			name = fmt.Sprint(groupID)
+			group, err := s.db.GetTodoGroup(groupID)
+			if err == nil {
+				name = group.Name
+			}
+			groupNames[groupID] = name
+		}
+
+		return name
+	}
+
+	newEntry := func(change string, from string, to string) *TimelineEntry {
+		return &TimelineEntry{
+			Kind:       TimelineChange,
+			TimeUnix:   event.TimeUnix,
+			ActorEmail: event.ActorEmail,
+			Change:     change,
+			From:       from,
+			To:         to,
+		}
+	}
+
+	before := auditTodoSnapshot(event.Before)
+	after := auditTodoSnapshot(event.After)
+	if after == nil {
+		return nil
+	}
+
+	var changes []*TimelineEntry
+	switch event.Action {
+	case "todo.create", "todo.recur":
+		changes = append(changes, newEntry(ChangeCreated, "", groupName(after.GroupID)))
+	case "todo.update", "todo.markdone", "todo.move":
+		if before == nil {
+			return nil
+		}
+
+		if before.GroupID != after.GroupID {
+			changes = append(changes, newEntry(ChangeMoved, groupName(before.GroupID), groupName(after.GroupID)))
+		}
+
+		if !before.IsDone && after.IsDone {
+			changes = append(changes, newEntry(ChangeDone, "", ""))
+		} else if before.IsDone && !after.IsDone {
+			changes = append(changes, newEntry(ChangeUndone, "", ""))
+		}
+
+		if before.DueUnix != after.DueUnix || before.DueHasTime != after.DueHasTime {
+			changes = append(changes, newEntry(ChangeDue, dueString(before, locale), dueString(after, locale)))
+		}
+	}
+
+	return changes
+}
+
+// Builds TODO's activity timeline out of its comments and recorded changes, oldest first
+func (s *Server) todoTimeline(todoID uint64, viewerEmail string, locale Locale) ([]*TimelineEntry, error) {
+	events, err := s.db.GetTargetAuditEvents(AuditTargetTodo, fmt.Sprint(todoID))
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := s.db.GetTodoComments(todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeline []*TimelineEntry
+	groupNames := make(map[uint64]string)
+	for _, event := range events {
+		timeline = append(timeline, s.auditEventChanges(event, locale, groupNames)...)
+	}
+
+	for _, comment := range comments {
+		timeline = append(timeline, &TimelineEntry{
+			Kind:       TimelineComment,
+			TimeUnix:   comment.CreatedUnix,
+			ActorEmail: comment.AuthorEmail,
+			Comment:    newCommentView(comment, viewerEmail, locale),
+		})
+	}
+
+	// Changes go before comments made in the same second
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].TimeUnix < timeline[j].TimeUnix
+	})
+
+	for _, entry := range timeline {
+		entry.Time = time.Unix(int64(entry.TimeUnix), 0).In(locale.Location).Format(locale.DateLayout + " 15:04")
+	}
+
+	return timeline, nil
+}
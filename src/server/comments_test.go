@@ -0,0 +1,43 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, testCase := range []struct {
+		Source string
+		HTML   string
+	}{
+		{"plain", "<p>plain</p>"},
+		{"**bold** and *italic* and _it_", "<p><strong>bold</strong> and <em>italic</em> and <em>it</em></p>"},
+		{"line\nbreak\n\nparagraph", "<p>line<br>break</p><p>paragraph</p>"},
+		{"- one\n- two", "<ul><li>one</li><li>two</li></ul>"},
+		{"`a *b*`", "<p><code>a *b*</code></p>"},
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"[site](https://example.com)", `<p><a href="https://example.com" target="_blank" rel="noopener noreferrer">site</a></p>`},
+		{"[bad](javascript:alert(1))", "<p>[bad](javascript:alert(1))</p>"},
+		{`[q](https://a.b/"onclick=x)`, `<p><a href="https://a.b/&#34;onclick=x" target="_blank" rel="noopener noreferrer">q</a></p>`},
+	} {
+		rendered := renderMarkdown(testCase.Source)
+		if rendered != testCase.HTML {
+			t.Errorf("%q: expected %q, got %q", testCase.Source, testCase.HTML, rendered)
+		}
+	}
+}
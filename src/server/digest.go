@@ -0,0 +1,269 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"Unbewohnte/dela/i18n"
+	"Unbewohnte/dela/logger"
+	"bytes"
+	htmlTemplate "html/template"
+	"path/filepath"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+// TODOs of a single category mentioned in a digest
+type DigestCategory struct {
+	Name        string
+	Overdue     []*db.Todo
+	DueToday    []*db.Todo
+	DueThisWeek []*db.Todo
+	Completed   []*db.Todo
+}
+
+func (c *DigestCategory) isEmpty() bool {
+	return len(c.Overdue) == 0 && len(c.DueToday) == 0 && len(c.DueThisWeek) == 0 && len(c.Completed) == 0
+}
+
+// Everything a digest email contains
+type DigestData struct {
+	Email            string
+	Weekly           bool
+	Since            string
+	Categories       []*DigestCategory
+	OverdueCount     int
+	DueTodayCount    int
+	DueThisWeekCount int
+	CompletedCount   int
+}
+
+// Returns true if there is nothing to tell the user about
+func (d *DigestData) IsEmpty() bool {
+	return len(d.Categories) == 0
+}
+
+// Returns the beginning of the day t is in
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// Collects user's overdue, due today, due this week and recently completed TODOs grouped by category. Days are taken in user's zone
+func (s *Server) BuildDigest(user *db.User, now time.Time) (*DigestData, error) {
+	locale := newLocale(user, userLanguage(user))
+	now = now.In(locale.Location)
+
+	today := startOfDay(now)
+	tomorrow := today.AddDate(0, 0, 1)
+	weekEnd := today.AddDate(0, 0, 7)
+
+	since := now.Add(-user.DigestFrequency.Period())
+	if user.LastDigestUnix != 0 && int64(user.LastDigestUnix) > since.Unix() {
+		since = time.Unix(int64(user.LastDigestUnix), 0).In(locale.Location)
+	}
+
+	overdue, err := s.db.GetUserTodosDueBetween(user.Email, 1, uint64(today.Unix()), locale.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	dueToday, err := s.db.GetUserTodosDueBetween(user.Email, uint64(today.Unix()), uint64(tomorrow.Unix()), locale.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	dueThisWeek, err := s.db.GetUserTodosDueBetween(user.Email, uint64(tomorrow.Unix()), uint64(weekEnd.Unix()), locale.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	completed, err := s.db.GetUserTodosCompletedBetween(user.Email, uint64(since.Unix()), uint64(now.Unix())+1)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, todos := range [][]*db.Todo{overdue, dueToday, dueThisWeek, completed} {
+		locale.Localize(todos)
+	}
+
+	groups, err := s.db.GetAllUserTodoGroups(user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep categories in the same order as they appear on the main page
+	categories := make(map[uint64]*DigestCategory)
+	for _, group := range groups {
+		categories[group.ID] = &DigestCategory{Name: group.Name}
+	}
+	categoryOf := func(todo *db.Todo) *DigestCategory {
+		category, ok := categories[todo.GroupID]
+		if !ok {
+			category = &DigestCategory{}
+			categories[todo.GroupID] = category
+		}
+		return category
+	}
+
+	for _, todo := range overdue {
+		category := categoryOf(todo)
+		category.Overdue = append(category.Overdue, todo)
+	}
+	for _, todo := range dueToday {
+		category := categoryOf(todo)
+		category.DueToday = append(category.DueToday, todo)
+	}
+	for _, todo := range dueThisWeek {
+		category := categoryOf(todo)
+		category.DueThisWeek = append(category.DueThisWeek, todo)
+	}
+	for _, todo := range completed {
+		category := categoryOf(todo)
+		category.Completed = append(category.Completed, todo)
+	}
+
+	digest := &DigestData{
+		Email:            user.Email,
+		Weekly:           user.DigestFrequency == db.DigestWeekly,
+		Since:            since.Format(locale.DateLayout),
+		OverdueCount:     len(overdue),
+		DueTodayCount:    len(dueToday),
+		DueThisWeekCount: len(dueThisWeek),
+		CompletedCount:   len(completed),
+	}
+	for _, group := range groups {
+		if !categories[group.ID].isEmpty() {
+			digest.Categories = append(digest.Categories, categories[group.ID])
+		}
+		delete(categories, group.ID)
+	}
+	// TODOs whose group could not be found
+	for _, category := range categories {
+		if !category.isEmpty() {
+			digest.Categories = append(digest.Categories, category)
+		}
+	}
+
+	return digest, nil
+}
+
+// Renders HTML and plaintext versions of the digest in given language
+func (s *Server) RenderDigest(digest *DigestData, language i18n.Language) (string, string, string, error) {
+	pageData, err := s.GetPageData([]string{"digest"}, language)
+	if err != nil {
+		return "", "", "", err
+	}
+	pageData.Data = digest
+
+	pagesDirPath := filepath.Join(s.config.BaseContentDir, PagesDirName)
+
+	htmlDigest, err := htmlTemplate.ParseFiles(filepath.Join(pagesDirPath, "digest.html"))
+	if err != nil {
+		return "", "", "", err
+	}
+	var htmlBody bytes.Buffer
+	err = htmlDigest.ExecuteTemplate(&htmlBody, "digest.html", pageData)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	plainDigest, err := textTemplate.ParseFiles(filepath.Join(pagesDirPath, "digest.txt"))
+	if err != nil {
+		return "", "", "", err
+	}
+	var plainBody bytes.Buffer
+	err = plainDigest.ExecuteTemplate(&plainBody, "digest.txt", pageData)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	subject := pageData.Translation["digest subject daily"]
+	if digest.Weekly {
+		subject = pageData.Translation["digest subject weekly"]
+	}
+
+	return subject, htmlBody.String(), plainBody.String(), nil
+}
+
+// Builds and sends a digest to the user. Does not send anything if there is nothing to report
+func (s *Server) SendDigest(user *db.User, now time.Time) error {
+	digest, err := s.BuildDigest(user, now)
+	if err != nil {
+		return err
+	}
+
+	if digest.IsEmpty() {
+		return nil
+	}
+
+	subject, htmlBody, plainBody, err := s.RenderDigest(digest, userLanguage(user))
+	if err != nil {
+		return err
+	}
+
+	digestEmail := email.NewEmailAlternative(
+		s.config.Verification.Emailer.User,
+		subject,
+		htmlBody,
+		plainBody,
+		[]string{user.Email},
+	)
+	if s.config.Server.PublicURL != "" {
+		// Digests are turned off on the profile page
+		digestEmail.ListUnsubscribe = strings.TrimSuffix(s.config.Server.PublicURL, "/") + "/profile"
+	}
+
+	logger.Info("[Server][Digest Routine] Queueing a digest to %s with %d categories...", user.Email, len(digest.Categories))
+	return s.QueueEmail(digestEmail)
+}
+
+// Periodically sends digests to users whose digest period has passed
+func (s *Server) StartDigestRoutine(delay time.Duration) {
+	logger.Info("[Server][Digest Routine] Digest Routine Started!")
+
+	for {
+		users, err := s.db.GetAllUsersWithDigestOn()
+		if err != nil {
+			logger.Error("[Server][Digest Routine] Failed to retrieve users with digests on: %s", err)
+		}
+
+		now := time.Now()
+		for _, user := range users {
+			if now.Sub(time.Unix(int64(user.LastDigestUnix), 0)) < user.DigestFrequency.Period() {
+				continue
+			}
+
+			err = s.SendDigest(user, now)
+			if err != nil {
+				logger.Error("[Server][Digest Routine] Failed to send a digest to %s: %s", user.Email, err)
+				continue
+			}
+
+			err = s.db.UserSetLastDigest(user.Email, uint64(now.Unix()))
+			if err != nil {
+				logger.Error("[Server][Digest Routine] Failed to save last digest time for %s: %s", user.Email, err)
+			}
+		}
+
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildDigest(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_digest_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase}
+
+	user := &db.User{Email: "user1@mail.ru", Timezone: "Asia/Tokyo", DigestFrequency: db.DigestDaily}
+	zone, _ := time.LoadLocation(user.Timezone)
+	// Wednesday morning in Tokyo, still Tuesday in UTC
+	now := time.Date(2025, 3, 5, 8, 0, 0, 0, zone)
+
+	workID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "Work", OwnerEmail: user.Email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	homeID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "Home", OwnerEmail: user.Email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	// Dates without time are kept as UTC midnight
+	date := func(day int) uint64 {
+		return uint64(time.Date(2025, 3, day, 0, 0, 0, 0, time.UTC).Unix())
+	}
+	at := func(day int, hour int, minute int) uint64 {
+		return uint64(time.Date(2025, 3, day, hour, minute, 0, 0, zone).Unix())
+	}
+	ids := make(map[string]uint64)
+	for name, todo := range map[string]db.Todo{
+		"yesterday":       {GroupID: workID, DueUnix: date(4)},
+		"today":           {GroupID: workID, DueUnix: date(5)},
+		"tonight":         {GroupID: homeID, DueUnix: at(5, 23, 30), DueHasTime: true},
+		"after midnight":  {GroupID: homeID, DueUnix: at(6, 0, 30), DueHasTime: true},
+		"in six days":     {GroupID: workID, DueUnix: date(11)},
+		"in a week":       {GroupID: workID, DueUnix: date(12)},
+		"done recently":   {GroupID: homeID, IsDone: true, CompletionTimeUnix: uint64(now.Add(-time.Hour * 2).Unix())},
+		"done long ago":   {GroupID: homeID, IsDone: true, CompletionTimeUnix: uint64(now.Add(-time.Hour * 30).Unix())},
+		"done but due":    {GroupID: workID, DueUnix: date(4), IsDone: true, CompletionTimeUnix: uint64(now.Add(-time.Hour * 30).Unix())},
+		"trashed overdue": {GroupID: workID, DueUnix: date(4)},
+	} {
+		todo.Text = name
+		todo.OwnerEmail = user.Email
+		ids[name], err = dbase.CreateTodo(todo)
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+	}
+
+	err = dbase.SoftDeleteTodo(ids["trashed overdue"], uint64(now.Unix()))
+	if err != nil {
+		t.Fatalf("failed to trash TODO: %s", err)
+	}
+
+	todoIDs := func(todos []*db.Todo) []uint64 {
+		var result []uint64
+		for _, todo := range todos {
+			result = append(result, todo.ID)
+		}
+		return result
+	}
+	expectTodos := func(bucket string, todos []*db.Todo, names ...string) {
+		t.Helper()
+		got := todoIDs(todos)
+		if len(got) != len(names) {
+			t.Fatalf("expected %v in %s, got TODOs %v", names, bucket, got)
+		}
+		for i, name := range names {
+			if got[i] != ids[name] {
+				t.Fatalf("expected %v in %s, got TODOs %v", names, bucket, got)
+			}
+		}
+	}
+
+	digest, err := s.BuildDigest(user, now)
+	if err != nil {
+		t.Fatalf("failed to build digest: %s", err)
+	}
+	if digest.OverdueCount != 1 || digest.DueTodayCount != 2 || digest.DueThisWeekCount != 2 || digest.CompletedCount != 1 {
+		t.Fatalf("unexpected digest counts: %+v", digest)
+	}
+
+	// Categories go in the order of the main page, empty ones are left out
+	if len(digest.Categories) != 2 || digest.Categories[0].Name != "Work" || digest.Categories[1].Name != "Home" {
+		t.Fatalf("expected Work and Home categories, got %+v", digest.Categories)
+	}
+	work, home := digest.Categories[0], digest.Categories[1]
+	expectTodos("overdue", work.Overdue, "yesterday")
+	expectTodos("work due today", work.DueToday, "today")
+	expectTodos("home due today", home.DueToday, "tonight")
+	expectTodos("work due this week", work.DueThisWeek, "in six days")
+	expectTodos("home due this week", home.DueThisWeek, "after midnight")
+	expectTodos("completed", home.Completed, "done recently")
+
+	// Nothing completed before the last digest is told about again
+	user.LastDigestUnix = uint64(now.Add(-time.Hour).Unix())
+	digest, err = s.BuildDigest(user, now)
+	if err != nil {
+		t.Fatalf("failed to build digest: %s", err)
+	}
+	if digest.CompletedCount != 0 {
+		t.Fatalf("expected TODOs completed before the last digest to be left out, got %+v", digest)
+	}
+
+	// Weekly digests look further back
+	user.LastDigestUnix = 0
+	user.DigestFrequency = db.DigestWeekly
+	digest, err = s.BuildDigest(user, now)
+	if err != nil {
+		t.Fatalf("failed to build digest: %s", err)
+	}
+	if digest.CompletedCount != 3 || !digest.Weekly {
+		t.Fatalf("expected all completed TODOs in a weekly digest, got %+v", digest)
+	}
+}
@@ -20,8 +20,9 @@ package server
 
 import (
 	"Unbewohnte/dela/db"
-	"Unbewohnte/dela/email"
 	"Unbewohnte/dela/logger"
+	"Unbewohnte/dela/misc"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -52,19 +53,24 @@ func (s *Server) EndpointUserCreate(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(contents, &user)
 	if err != nil {
 		logger.Error("[Server][EndpointUserCreate] Failed to unmarshal user data: %s", err)
-		http.Error(w, "User JSON unmarshal error", http.StatusInternalServerError)
+		http.Error(w, "User JSON unmarshal error", http.StatusBadRequest)
 		return
 	}
 
 	// Sanitize
 	valid, reason := IsUserValid(user)
 	if !valid {
-		http.Error(w, reason, http.StatusInternalServerError)
+		http.Error(w, reason, http.StatusBadRequest)
 		return
 	}
 	user.TimeCreatedUnix = uint64(time.Now().Unix())
 	user.Email = strings.ToLower(user.Email)
 
+	if _, err := s.db.GetUser(user.Email); err == nil {
+		http.Error(w, "User with this email already exists", http.StatusConflict)
+		return
+	}
+
 	// Insert into DB
 	err = s.db.CreateUser(user)
 	if err != nil {
@@ -74,19 +80,24 @@ func (s *Server) EndpointUserCreate(w http.ResponseWriter, req *http.Request) {
 	}
 
 	logger.Info("[Server][EndpointUserCreate] Created a new user with email \"%s\"", user.Email)
+	if createdUser, err := s.db.GetUser(user.Email); err == nil {
+		s.audit(req, user.Email, "user.create", AuditTargetUser, user.Email, nil, createdUser)
+	}
 
 	// Create a non-removable default category
-	err = s.db.CreateTodoGroup(db.NewTodoGroup(
+	defaultGroup := db.NewTodoGroup(
 		"Notes",
 		uint64(time.Now().Unix()),
 		user.Email,
 		false,
-	))
+	)
+	defaultGroup.ID, err = s.db.CreateTodoGroup(defaultGroup)
 	if err != nil {
 		http.Error(w, "Failed to create default group", http.StatusInternalServerError)
 		logger.Error("[Server][EndpointUserCreate] Failed to create a default group for %s: %s", user.Email, err)
 		return
 	}
+	s.audit(req, user.Email, "group.create", AuditTargetGroup, defaultGroup.ID, nil, defaultGroup)
 
 	// Check if email verification is required
 	if !s.config.Verification.VerifyEmails {
@@ -117,28 +128,13 @@ func (s *Server) EndpointUserCreate(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Send email verification message
-	verification, err := GenerateVerificationCode(s.db, user.Email, 5, uint64(time.Hour.Seconds()))
-	if err != nil {
-		logger.Error("[Server][EndpointUserCreate] Failed to generate verification code for %s: %s", user.Email, err)
-		http.Error(w, "Failed to generate confirmation code", http.StatusInternalServerError)
-		return
-	}
-
-	// Send verification email
-	err = s.emailer.SendEmail(
-		email.NewEmail(
-			s.config.Verification.Emailer.User,
-			"Dela: Email verification",
-			fmt.Sprintf("<p>Your email verification code is: <b>%s</b></p><p>Please, verify your email in %.1f hours. Your account will be deleted after some time without verified status.</p><p>This email was specified during Dela account creation. Ignore this message if it wasn't you.</p>", verification.Code, float32(verification.LifeSeconds)/3600),
-			[]string{user.Email},
-		),
-	)
+	verification, err := s.SendVerificationEmail(user.Email)
 	if err != nil {
 		logger.Error("[Server][EndpointUserCreate] Failed to send verification email to %s: %s", user.Email, err)
 		http.Error(w, "Failed to send email verification message", http.StatusInternalServerError)
 		return
 	}
-	logger.Info("[Server][EndpointUserCreate] Successfully sent confirmation email to %s", user.Email)
+	logger.Info("[Server][EndpointUserCreate] Queued confirmation email to %s", user.Email)
 
 	// Autodelete user account after some more time if email was not verified in time
 	time.AfterFunc((time.Second*time.Duration(verification.LifeSeconds))*5, func() {
@@ -176,7 +172,7 @@ func (s *Server) EndpointUserVerify(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(contents, &answer)
 	if err != nil {
 		logger.Error("[Server][EndpointUserVerify] Failed to unmarshal verification answer: %s", err)
-		http.Error(w, "Verification answer JSON unmarshal error", http.StatusInternalServerError)
+		http.Error(w, "Verification answer JSON unmarshal error", http.StatusBadRequest)
 		return
 	}
 
@@ -184,7 +180,7 @@ func (s *Server) EndpointUserVerify(w http.ResponseWriter, req *http.Request) {
 	user, err := s.db.GetUser(answer.Email)
 	if err != nil {
 		// Most likely already deleted this user's account
-		http.Error(w, "Account no longer exists, try registering again", http.StatusInternalServerError)
+		http.Error(w, "Account no longer exists, try registering again", http.StatusNotFound)
 		return
 	}
 
@@ -219,6 +215,10 @@ func (s *Server) EndpointUserVerify(w http.ResponseWriter, req *http.Request) {
 	}
 
 	logger.Info("[Server][EndpointUserVerify] %s was successfully verified!", user.Email)
+	s.audit(req, user.Email, "user.verify", AuditTargetUser, user.Email,
+		map[string]bool{"confirmedEmail": false},
+		map[string]bool{"confirmedEmail": true},
+	)
 
 	// Send cookie
 	http.SetCookie(w, &http.Cookie{
@@ -232,6 +232,55 @@ func (s *Server) EndpointUserVerify(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *Server) EndpointUserResetPassword(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defer req.Body.Close()
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][EndpointUserResetPassword] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	type resetRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var reset resetRequest
+	err = json.Unmarshal(contents, &reset)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	valid, reason := IsPasswordValid(reset.Password)
+	if !valid {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	userEmail, err := s.db.ResetUserPassword(misc.HashPassword(reset.Token), reset.Password, uint64(time.Now().Unix()))
+	if err == sql.ErrNoRows {
+		http.Error(w, "This link is invalid, already used or expired", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logger.Error("[Server][EndpointUserResetPassword] Failed to reset password: %s", err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, userEmail, "user.resetpassword", AuditTargetUser, userEmail, nil, nil)
+	logger.Info("[Server][EndpointUserResetPassword] %s set a new password with a reset link", userEmail)
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *Server) EndpointUserNotify(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -256,17 +305,27 @@ func (s *Server) EndpointUserNotify(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(contents, &notifyResult)
 	if err != nil {
 		logger.Error("[Server][EndpointUserVerify] Failed to unmarshal notification value change: %s", err)
-		http.Error(w, "Bad JSON", http.StatusInternalServerError)
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
 		return
 	}
 
 	userEmail := GetEmailFromReq(req)
+	userBefore, err := s.db.GetUser(userEmail)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
 	err = s.db.UserSetNotifyOnTodos(userEmail, notifyResult.Notify)
 	if err != nil {
 		logger.Error("[Server][EndpointUserNotify] Failed to UserSetNotifyOnTodos for %s: %s", userEmail, err)
 		http.Error(w, "Failed to change user settings", http.StatusInternalServerError)
 		return
 	}
+	s.audit(req, userEmail, "user.notify", AuditTargetUser, userEmail,
+		map[string]bool{"notifyOnTodos": userBefore.NotifyOnTodos},
+		map[string]bool{"notifyOnTodos": notifyResult.Notify},
+	)
 
 	if notifyResult.Notify {
 		logger.Info("[Server][EndpointUserNotify] Notifying %s for due TODOs", userEmail)
@@ -277,6 +336,69 @@ func (s *Server) EndpointUserNotify(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *Server) EndpointUserDigest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defer req.Body.Close()
+
+	// Authentication check
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Authentication error", http.StatusForbidden)
+		return
+	}
+
+	type digestRequest struct {
+		Frequency db.DigestFrequency `json:"digestFrequency"`
+	}
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][EndpointUserDigest] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	var digestResult digestRequest
+	err = json.Unmarshal(contents, &digestResult)
+	if err != nil {
+		logger.Error("[Server][EndpointUserDigest] Failed to unmarshal digest frequency change: %s", err)
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	if digestResult.Frequency != db.DigestOff &&
+		digestResult.Frequency != db.DigestDaily &&
+		digestResult.Frequency != db.DigestWeekly {
+		http.Error(w, "Unknown digest frequency", http.StatusBadRequest)
+		return
+	}
+
+	// Digests are sent in the language the user currently has chosen
+	userEmail := GetEmailFromReq(req)
+	userBefore, err := s.db.GetUser(userEmail)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.UserSetDigest(userEmail, digestResult.Frequency, string(LanguageFromReq(req)))
+	if err != nil {
+		logger.Error("[Server][EndpointUserDigest] Failed to UserSetDigest for %s: %s", userEmail, err)
+		http.Error(w, "Failed to change user settings", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, userEmail, "user.digest", AuditTargetUser, userEmail,
+		map[string]interface{}{"digestFrequency": userBefore.DigestFrequency, "language": userBefore.Language},
+		map[string]interface{}{"digestFrequency": digestResult.Frequency, "language": string(LanguageFromReq(req))},
+	)
+
+	logger.Info("[Server][EndpointUserDigest] Set digest frequency of %s to %d", userEmail, digestResult.Frequency)
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *Server) EndpointUserLogin(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -297,7 +419,7 @@ func (s *Server) EndpointUserLogin(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(contents, &user)
 	if err != nil {
 		logger.Error("[Server][EndpointUserLogin] Failed to unmarshal user data: %s", err)
-		http.Error(w, "User JSON unmarshal error", http.StatusInternalServerError)
+		http.Error(w, "User JSON unmarshal error", http.StatusBadRequest)
 		return
 	}
 
@@ -307,6 +429,11 @@ func (s *Server) EndpointUserLogin(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	err = s.db.UserSetLastLogin(user.Email, uint64(time.Now().Unix()))
+	if err != nil {
+		logger.Error("[Server][EndpointUserLogin] Failed to save last login time of %s: %s", user.Email, err)
+	}
+
 	// Send cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "auth",
@@ -345,7 +472,7 @@ func (s *Server) EndpointUserUpdate(w http.ResponseWriter, req *http.Request) {
 	err = json.Unmarshal(contents, &user)
 	if err != nil {
 		logger.Error("[Server][EndpointUserUpdate] Failed to unmarshal user data: %s", err)
-		http.Error(w, "User JSON unmarshal error", http.StatusInternalServerError)
+		http.Error(w, "User JSON unmarshal error", http.StatusBadRequest)
 		return
 	}
 
@@ -358,6 +485,18 @@ func (s *Server) EndpointUserUpdate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	valid, reason := IsUserValid(user)
+	if !valid {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	userBefore, err := s.db.GetUser(email)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
 	// Update
 	err = s.db.UserUpdate(user)
 	if err != nil {
@@ -366,6 +505,11 @@ func (s *Server) EndpointUserUpdate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	userAfter, err := s.db.GetUser(email)
+	if err == nil {
+		s.audit(req, email, "user.update", AuditTargetUser, email, userBefore, userAfter)
+	}
+
 	logger.Info("[Server][EndpointUserUpdate] Updated a user with email \"%s\"", user.Email)
 	w.WriteHeader(http.StatusOK)
 }
@@ -386,12 +530,19 @@ func (s *Server) EndpointUserDelete(w http.ResponseWriter, req *http.Request) {
 
 	// Delete
 	email := GetEmailFromReq(req)
-	err := s.db.DeleteUserClean(email)
+	userBefore, err := s.db.GetUser(email)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.DeleteUserClean(email)
 	if err != nil {
 		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
 		logger.Error("[Server][EndpointUserDelete] Failed to delete \"%s\": %s", email, err)
 		return
 	}
+	s.audit(req, email, "user.delete", AuditTargetUser, email, userBefore, nil)
 
 	logger.Info("[Server][EndpointUserDelete] Deleted a user with email \"%s\"", email)
 	w.WriteHeader(http.StatusOK)
@@ -515,6 +666,10 @@ func (s *Server) EndpointTodoFile(w http.ResponseWriter, req *http.Request) {
 			http.Error(w, "Failed to save Attachment File", http.StatusInternalServerError)
 			return
 		}
+		s.audit(req, todo.OwnerEmail, "todo.file", AuditTargetTodo, todoID,
+			map[string]int{"fileSize": len(todo.File)},
+			map[string]interface{}{"fileSize": len(fileData), "fileName": fileHeader.Filename},
+		)
 
 		logger.Info("[Server][EndpointTodoFile] Successfully saved \"%s\" (%vMB) for %s (todoID: %d)",
 			fileHeader.Filename,
@@ -525,10 +680,10 @@ func (s *Server) EndpointTodoFile(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (s *Server) EndpointTodoUpdate(w http.ResponseWriter, req *http.Request) {
+func (s *Server) EndpointTodoImage(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
-	if req.Method != http.MethodPost {
+	if req.Method != http.MethodPost && req.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -540,8 +695,7 @@ func (s *Server) EndpointTodoUpdate(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Obtain TODO ID
-	todoIDStr := path.Base(req.URL.Path)
-	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
 		return
@@ -553,47 +707,108 @@ func (s *Server) EndpointTodoUpdate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Read body
-	body, err := io.ReadAll(req.Body)
+	imageData, err := s.db.GetTodoImage(todoID)
 	if err != nil {
-		logger.Warning("[Server] Failed to read request body to possibly update a TODO: %s", err)
-		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		logger.Error("[Server][EndpointTodoImage] Failed to get image of TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to retrieve image", http.StatusInternalServerError)
 		return
 	}
 
-	// Unmarshal JSON
-	var updatedTodo db.Todo
-	err = json.Unmarshal(body, &updatedTodo)
-	if err != nil {
-		logger.Warning("[Server] Received invalid TODO JSON in order to update: %s", err)
-		http.Error(w, "Invalid TODO JSON", http.StatusBadRequest)
-		return
-	}
+	switch req.Method {
+	case http.MethodGet:
+		imageData, err = imageBytes(imageData)
+		if err != nil || len(imageData) == 0 {
+			http.Error(w, "This TODO has no image", http.StatusNotFound)
+			return
+		}
 
-	// Validate
-	if uint(len([]rune(updatedTodo.Text))) > MaxTodoTextLength {
-		http.Error(
-			w,
-			fmt.Sprintf("Text is too big! Text must be less than %d characters long!", MaxTodoTextLength),
-			http.StatusBadRequest,
+		etag := imageETag(imageData)
+		contentType := imageContentType(imageData)
+		if req.URL.Query().Get("thumbnail") == "true" {
+			thumbnail, err := s.db.GetTodoThumbnail(todoID, TodoThumbnailSize, etag)
+			if err != nil {
+				thumbnail = &db.TodoThumbnail{TodoID: todoID, Size: TodoThumbnailSize, ETag: etag}
+				thumbnail.Data, thumbnail.ContentType, err = makeThumbnail(imageData, TodoThumbnailSize)
+				if err != nil {
+					logger.Error("[Server][EndpointTodoImage] Failed to make thumbnail of TODO %d: %s", todoID, err)
+					http.Error(w, "Failed to make thumbnail", http.StatusInternalServerError)
+					return
+				}
+
+				err = s.db.SaveTodoThumbnail(*thumbnail)
+				if err != nil {
+					// Will be made again next time
+					logger.Warning("[Server][EndpointTodoImage] Failed to cache thumbnail of TODO %d: %s", todoID, err)
+				}
+			}
+
+			imageData = thumbnail.Data
+			contentType = thumbnail.ContentType
+			etag = fmt.Sprintf("\"%s-%d\"", strings.Trim(etag, "\""), TodoThumbnailSize)
+		}
+
+		w.Header().Set("ETag", etag)
+		// Images change in place, so browsers have to check whether theirs is still current
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if strings.Contains(req.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(imageData)))
+		w.Write(imageData)
+
+	case http.MethodPost:
+		err := req.ParseMultipartForm(int64(MaxTodoPhotoSizeBytes))
+		if err != nil {
+			logger.Error("[Server][EndpointTodoImage] Failed to parse multipart form: %s", err)
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		formFile, fileHeader, err := req.FormFile("image")
+		if err != nil {
+			http.Error(w, "No image was provided", http.StatusBadRequest)
+			return
+		}
+		defer formFile.Close()
+
+		if fileHeader.Size > int64(MaxTodoPhotoSizeBytes) {
+			http.Error(w, "Image is too big", http.StatusBadRequest)
+			return
+		}
+
+		newImage, err := io.ReadAll(formFile)
+		if err != nil {
+			logger.Error("[Server][EndpointTodoImage] Failed to read image from form: %s", err)
+			http.Error(w, "Failed to read image", http.StatusInternalServerError)
+			return
+		}
+
+		maxDimension, quality := s.photoSettings()
+		newImage, _, err = processTodoPhoto(newImage, maxDimension, quality)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		err = s.db.UpdateTodoImage(todoID, newImage)
+		if err != nil {
+			logger.Error("[Server][EndpointTodoImage] Failed to save image of TODO %d: %s", todoID, err)
+			http.Error(w, "Failed to save image", http.StatusInternalServerError)
+			return
+		}
+		s.audit(req, GetEmailFromReq(req), "todo.image", AuditTargetTodo, todoID,
+			map[string]int{"imageSize": len(imageData)},
+			map[string]int{"imageSize": len(newImage)},
 		)
-		return
-	}
-	updatedTodo.File = nil
-	updatedTodo.ID = todoID
 
-	// Update
-	err = s.db.UpdateTodoSoft(todoID, updatedTodo)
-	if err != nil {
-		logger.Warning("[Server] Failed to update TODO: %s", err)
-		http.Error(w, "Failed to update", http.StatusBadRequest)
-		return
+		logger.Info("[Server][EndpointTodoImage] Saved %dKB image for TODO %d", len(newImage)/1024, todoID)
 	}
-	w.WriteHeader(http.StatusOK)
-	logger.Info("[Server] Updated TODO with ID %d", todoID)
 }
 
-func (s *Server) EndpointTodoMarkDone(w http.ResponseWriter, req *http.Request) {
+func (s *Server) EndpointTodoImageDelete(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	if req.Method != http.MethodPost {
@@ -608,8 +823,7 @@ func (s *Server) EndpointTodoMarkDone(w http.ResponseWriter, req *http.Request)
 	}
 
 	// Obtain TODO ID
-	todoIDStr := path.Base(req.URL.Path)
-	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
 		return
@@ -621,44 +835,42 @@ func (s *Server) EndpointTodoMarkDone(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	todo, err := s.db.GetTodo(todoID)
+	imageData, err := s.db.GetTodoImage(todoID)
 	if err != nil {
-		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve image", http.StatusInternalServerError)
 		return
 	}
 
-	// Update
-	todo.IsDone = true
-	todo.CompletionTimeUnix = uint64(time.Now().Unix())
-	err = s.db.UpdateTodo(todoID, *todo)
+	err = s.db.UpdateTodoImage(todoID, nil)
 	if err != nil {
-		logger.Warning("[Server] Failed to update TODO: %s", err)
-		http.Error(w, "Failed to update", http.StatusBadRequest)
+		logger.Error("[Server][EndpointTodoImageDelete] Failed to remove image of TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to remove image", http.StatusInternalServerError)
 		return
 	}
+	s.audit(req, GetEmailFromReq(req), "todo.image", AuditTargetTodo, todoID,
+		map[string]int{"imageSize": len(imageData)},
+		map[string]int{"imageSize": 0},
+	)
+
 	w.WriteHeader(http.StatusOK)
-	logger.Info("[Server] Marked TODO as done %d", todoID)
 }
 
-func (s *Server) EndpointTodoDelete(w http.ResponseWriter, req *http.Request) {
+func (s *Server) EndpointTodoSketch(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
-	if req.Method != http.MethodPost {
+	if req.Method != http.MethodPost && req.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Delete an existing TODO
-
-	// Check if this user actually exists and the password is valid
+	// Check authentication information
 	if !IsUserAuthorizedReq(req, s.db) {
 		http.Error(w, "Invalid user auth data", http.StatusForbidden)
 		return
 	}
 
 	// Obtain TODO ID
-	todoIDStr := path.Base(req.URL.Path)
-	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
 		return
@@ -670,32 +882,314 @@ func (s *Server) EndpointTodoDelete(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Now delete
-	err = s.db.DeleteTodo(todoID)
-	if err != nil {
-		logger.Error("[Server] Failed to delete %s's TODO: %s", GetEmailFromReq(req), err)
-		http.Error(w, "Failed to delete TODO", http.StatusInternalServerError)
-		return
-	}
+	switch req.Method {
+	case http.MethodGet:
+		document, err := s.db.GetTodoSketch(todoID)
+		if err != nil {
+			http.Error(w, "This TODO has no sketch", http.StatusNotFound)
+			return
+		}
 
-	// Success!
-	logger.Info("[Server] Deleted TODO with ID %d", todoID)
-	w.WriteHeader(http.StatusOK)
+		if req.URL.Query().Get("format") != "png" {
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(document))
+			return
+		}
+
+		// Export rendered by the server
+		scale := 1
+		if req.URL.Query().Has("scale") {
+			scale, err = strconv.Atoi(req.URL.Query().Get("scale"))
+			if err != nil || scale < 1 || scale > MaxSketchExportScale {
+				http.Error(w, fmt.Sprintf("Scale must be from 1 to %d", MaxSketchExportScale), http.StatusBadRequest)
+				return
+			}
+		}
+
+		sketch, err := parseSketch([]byte(document))
+		if err != nil {
+			logger.Error("[Server][EndpointTodoSketch] Stored sketch of TODO %d is invalid: %s", todoID, err)
+			http.Error(w, "Failed to read sketch", http.StatusInternalServerError)
+			return
+		}
+		if sketch.RenderArea(scale) > MaxSketchRenderArea {
+			http.Error(w, "This sketch is too detailed to be exported at this scale", http.StatusBadRequest)
+			return
+		}
+
+		rendered, err := sketch.PNG(scale)
+		if err != nil {
+			logger.Error("[Server][EndpointTodoSketch] Failed to render sketch of TODO %d: %s", todoID, err)
+			http.Error(w, "Failed to render sketch", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sketch-%d.png\"", todoID))
+		w.Write(rendered)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusInternalServerError)
+			return
+		}
+
+		sketch, err := parseSketch(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid sketch: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		err = s.saveTodoSketch(todoID, sketch)
+		if err != nil {
+			logger.Error("[Server][EndpointTodoSketch] Failed to save sketch of TODO %d: %s", todoID, err)
+			http.Error(w, "Failed to save sketch", http.StatusInternalServerError)
+			return
+		}
+		s.audit(req, GetEmailFromReq(req), "todo.sketch", AuditTargetTodo, todoID, nil,
+			map[string]int{"strokes": len(sketch.Strokes)},
+		)
+
+		w.WriteHeader(http.StatusOK)
+	}
 }
 
-func (s *Server) EndpointTodoCreate(w http.ResponseWriter, req *http.Request) {
-	// Create a new TODO
+func (s *Server) EndpointTodoUpdate(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
+
 	if req.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Read body
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		logger.Warning("[Server] Failed to read request body to create a new TODO: %s", err)
-		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoIDStr := path.Base(req.URL.Path)
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	// Read body
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Warning("[Server] Failed to read request body to possibly update a TODO: %s", err)
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return
+	}
+
+	todoBefore, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	// Unmarshal JSON. Only the sent fields change, so that priority and recurrence can be cleared
+	updatedTodo := *todoBefore
+	updatedTodo.Image = nil
+	err = json.Unmarshal(body, &updatedTodo)
+	if err != nil {
+		logger.Warning("[Server] Received invalid TODO JSON in order to update: %s", err)
+		http.Error(w, "Invalid TODO JSON", http.StatusBadRequest)
+		return
+	}
+	err = applyDueInput(body, &updatedTodo, s.localeFromReq(req).Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate
+	if uint(len([]rune(updatedTodo.Text))) > MaxTodoTextLength {
+		http.Error(
+			w,
+			fmt.Sprintf("Text is too big! Text must be less than %d characters long!", MaxTodoTextLength),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if ok, reason := IsTodoValid(updatedTodo); !ok {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+	if updatedTodo.Image != nil {
+		maxDimension, quality := s.photoSettings()
+		updatedTodo.Image, _, err = processTodoImage(updatedTodo.Image, maxDimension, quality)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	updatedTodo.File = nil
+	updatedTodo.ID = todoID
+
+	if todoBefore.DeletedAtUnix != 0 {
+		http.Error(w, "This TODO is in the trash", http.StatusBadRequest)
+		return
+	}
+
+	if updatedTodo.GroupID != 0 && updatedTodo.GroupID != todoBefore.GroupID &&
+		!s.db.DoesUserOwnGroup(updatedTodo.GroupID, GetEmailFromReq(req)) {
+		http.Error(w, "You do not own this group", http.StatusForbidden)
+		return
+	}
+	if updatedTodo.GroupID != 0 && updatedTodo.GroupID != todoBefore.GroupID && s.db.IsTodoGroupInTrash(updatedTodo.GroupID) {
+		http.Error(w, "This group is in the trash", http.StatusBadRequest)
+		return
+	}
+
+	// Update
+	err = s.db.UpdateTodoSoft(todoID, updatedTodo)
+	if err != nil {
+		logger.Warning("[Server] Failed to update TODO: %s", err)
+		http.Error(w, "Failed to update", http.StatusBadRequest)
+		return
+	}
+
+	todoAfter, err := s.db.GetTodo(todoID)
+	if err == nil {
+		s.audit(req, todoBefore.OwnerEmail, "todo.update", AuditTargetTodo, todoID, todoBefore, todoAfter)
+		if todoAfter.IsDone && !todoBefore.IsDone {
+			s.scheduleNextOccurrence(req, todoAfter)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	logger.Info("[Server] Updated TODO with ID %d", todoID)
+}
+
+func (s *Server) EndpointTodoMarkDone(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoIDStr := path.Base(req.URL.Path)
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	if todo.DeletedAtUnix != 0 {
+		http.Error(w, "This TODO is in the trash", http.StatusBadRequest)
+		return
+	}
+
+	// Update
+	todoBefore := *todo
+	todo.IsDone = true
+	todo.CompletionTimeUnix = uint64(time.Now().Unix())
+	err = s.db.UpdateTodo(todoID, *todo)
+	if err != nil {
+		logger.Warning("[Server] Failed to update TODO: %s", err)
+		http.Error(w, "Failed to update", http.StatusBadRequest)
+		return
+	}
+	s.audit(req, todo.OwnerEmail, "todo.markdone", AuditTargetTodo, todoID, todoBefore, todo)
+	if !todoBefore.IsDone {
+		s.scheduleNextOccurrence(req, todo)
+	}
+	w.WriteHeader(http.StatusOK)
+	logger.Info("[Server] Marked TODO as done %d", todoID)
+}
+
+func (s *Server) EndpointTodoDelete(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Delete an existing TODO
+
+	// Check if this user actually exists and the password is valid
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoIDStr := path.Base(req.URL.Path)
+	todoID, err := strconv.ParseUint(todoIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	todoBefore, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	// Now move to the trash
+	err = s.db.SoftDeleteTodo(todoID, uint64(time.Now().Unix()))
+	if err != nil {
+		logger.Error("[Server] Failed to delete %s's TODO: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to delete TODO", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, todoBefore.OwnerEmail, "todo.delete", AuditTargetTodo, todoID, todoBefore, nil)
+
+	// Success!
+	logger.Info("[Server] Moved TODO with ID %d to the trash", todoID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoCreate(w http.ResponseWriter, req *http.Request) {
+	// Create a new TODO
+	defer req.Body.Close()
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Read body
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Warning("[Server] Failed to read request body to create a new TODO: %s", err)
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
 		return
 	}
 
@@ -714,6 +1208,12 @@ func (s *Server) EndpointTodoCreate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	err = applyDueInput(body, &newTodo, s.localeFromReq(req).Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check if text is too long or not
 	if uint(len([]rune(newTodo.Text))) > MaxTodoTextLength {
 		http.Error(
@@ -724,6 +1224,35 @@ func (s *Server) EndpointTodoCreate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if ok, reason := IsTodoValid(newTodo); !ok {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	if newTodo.Image != nil {
+		maxDimension, quality := s.photoSettings()
+		newTodo.Image, _, err = processTodoImage(newTodo.Image, maxDimension, quality)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid image: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Sketches drawn along with the TODO replace the image
+	var todoSketch struct {
+		Sketch json.RawMessage `json:"sketch"`
+	}
+	json.Unmarshal(body, &todoSketch)
+	var sketch *Sketch
+	if len(todoSketch.Sketch) > 0 && string(todoSketch.Sketch) != "null" {
+		sketch, err = parseSketch(todoSketch.Sketch)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid sketch: %s", err), http.StatusBadRequest)
+			return
+		}
+		newTodo.Image = nil
+	}
+
 	// Add TODO to the database
 	if newTodo.GroupID == 0 {
 		http.Error(w, "No group ID was provided", http.StatusBadRequest)
@@ -735,17 +1264,46 @@ func (s *Server) EndpointTodoCreate(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if s.db.IsTodoGroupInTrash(newTodo.GroupID) {
+		http.Error(w, "This group is in the trash", http.StatusBadRequest)
+		return
+	}
+
 	newTodo.OwnerEmail = GetEmailFromReq(req)
 	newTodo.TimeCreatedUnix = uint64(time.Now().Unix())
-	err = s.db.CreateTodo(newTodo)
+	newTodo.ID, err = s.db.CreateTodo(newTodo)
 	if err != nil {
 		http.Error(w, "Failed to create TODO", http.StatusInternalServerError)
 		logger.Error("[Server] Failed to put a new todo (%+v) into the db: %s", newTodo, err)
 		return
 	}
+	s.audit(req, newTodo.OwnerEmail, "todo.create", AuditTargetTodo, newTodo.ID, nil, newTodo)
+
+	if sketch != nil {
+		err = s.saveTodoSketch(newTodo.ID, sketch)
+		if err != nil {
+			logger.Error("[Server] Failed to save sketch of a new TODO %d: %s", newTodo.ID, err)
+		}
+	}
+
+	// Send the TODO back as it was saved
+	createdTodo, err := s.db.GetTodo(newTodo.ID)
+	if err != nil {
+		http.Error(w, "Can't access the new TODO", http.StatusInternalServerError)
+		return
+	}
+	createdTodo.File = nil
+	locale := s.localeFromReq(req)
+	createdTodo.Localize(locale.Location, locale.DateLayout)
+	createdTodoBytes, err := json.Marshal(createdTodo)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODO JSON", http.StatusInternalServerError)
+		return
+	}
 
 	// Success!
-	w.WriteHeader(http.StatusOK)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(createdTodoBytes)
 	logger.Info("[Server] Created a new TODO for %s", newTodo.OwnerEmail)
 }
 
@@ -766,12 +1324,22 @@ func (s *Server) EndpointUserTodosGet(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	// Get all user TODOs
-	todos, err := s.db.GetAllUserTodos(GetEmailFromReq(req))
+	// Get all user TODOs. Archived and not yet started ones only if asked to
+	var todos []*db.Todo
+	var err error
+	if req.URL.Query().Get("archived") == "true" {
+		todos, err = s.db.GetAllUserTodosWithArchived(GetEmailFromReq(req))
+	} else {
+		todos, err = s.db.GetAllUserTodos(GetEmailFromReq(req))
+	}
 	if err != nil {
 		http.Error(w, "Failed to get TODOs", http.StatusInternalServerError)
 		return
 	}
+	if req.URL.Query().Get("deferred") != "true" {
+		todos, _ = splitDeferred(todos, time.Now())
+	}
+	s.localeFromReq(req).Localize(todos)
 
 	// Marshal to JSON
 	todosBytes, err := json.Marshal(&todos)
@@ -825,16 +1393,27 @@ func (s *Server) EndpointTodoGroupDelete(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	// Delete all ToDos associated with this group and then delete the group itself
-	err = s.db.DeleteTodoGroupClean(groupId)
+	groupTodos, err := s.db.GetGroupTodos(groupId)
+	if err != nil {
+		logger.Error("[Server][EndpointGroupDelete] Failed to fetch TODOs of group with Id %d: %s", groupId, err)
+		http.Error(w, "Failed to retrieve TODO group", http.StatusInternalServerError)
+		return
+	}
+
+	// Move the group with all of its ToDos to the trash
+	err = s.db.SoftDeleteTodoGroup(groupId, uint64(time.Now().Unix()))
 	if err != nil {
 		logger.Error("[Server][EndpointGroupDelete] Failed to delete %s's TODO group: %s", GetEmailFromReq(req), err)
 		http.Error(w, "Failed to delete TODO group", http.StatusInternalServerError)
 		return
 	}
+	for _, todo := range groupTodos {
+		s.audit(req, todo.OwnerEmail, "todo.delete", AuditTargetTodo, todo.ID, todo, nil)
+	}
+	s.audit(req, groupDB.OwnerEmail, "group.delete", AuditTargetGroup, groupId, groupDB, nil)
 
 	// Success!
-	logger.Info("[Server][EndpointGroupDelete] Cleanly deleted group ID: %d for %s", groupId, GetEmailFromReq(req))
+	logger.Info("[Server][EndpointGroupDelete] Moved group ID: %d of %s to the trash", groupId, GetEmailFromReq(req))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -874,14 +1453,28 @@ func (s *Server) EndpointTodoGroupCreate(w http.ResponseWriter, req *http.Reques
 	newGroup.OwnerEmail = GetEmailFromReq(req)
 	newGroup.TimeCreatedUnix = uint64(time.Now().Unix())
 	newGroup.Removable = true
-	err = s.db.CreateTodoGroup(newGroup)
+	newGroup.ID, err = s.db.CreateTodoGroup(newGroup)
 	if err != nil {
 		http.Error(w, "Failed to create TODO group", http.StatusInternalServerError)
 		return
 	}
+	s.audit(req, newGroup.OwnerEmail, "group.create", AuditTargetGroup, newGroup.ID, nil, newGroup)
+
+	// Send the group back as it was saved
+	createdGroup, err := s.db.GetTodoGroup(newGroup.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve TODO group", http.StatusInternalServerError)
+		return
+	}
+	createdGroupBytes, err := json.Marshal(createdGroup)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODO group JSON", http.StatusInternalServerError)
+		return
+	}
 
 	// Success!
-	w.WriteHeader(http.StatusOK)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(createdGroupBytes)
 	logger.Info("[Server] Created a new TODO group for %s", newGroup.OwnerEmail)
 }
 
@@ -915,6 +1508,13 @@ func (s *Server) EndpointTodoGroupGet(w http.ResponseWriter, req *http.Request)
 }
 
 func (s *Server) EndpointTodoGroupUpdate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	// Check authentication information
 	if !IsUserAuthorizedReq(req, s.db) {
 		http.Error(w, "Invalid user auth data", http.StatusForbidden)
@@ -938,13 +1538,1972 @@ func (s *Server) EndpointTodoGroupUpdate(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	// TODO
-	err = s.db.UpdateTodoGroup(group.ID, group)
-	if err != nil {
-		logger.Warning("[Server] Failed to update TODO group: %s", err)
-		http.Error(w, "Failed to update", http.StatusBadRequest)
-		return
+	// The ID in the path takes precedence over the one in JSON
+	if groupID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64); err == nil {
+		group.ID = groupID
 	}
 
+	if !s.db.DoesUserOwnGroup(group.ID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	groupBefore, err := s.db.GetTodoGroup(group.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve TODO group", http.StatusBadRequest)
+		return
+	}
+
+	// TODO
+	err = s.db.UpdateTodoGroup(group.ID, group)
+	if err != nil {
+		logger.Warning("[Server] Failed to update TODO group: %s", err)
+		http.Error(w, "Failed to update", http.StatusBadRequest)
+		return
+	}
+
+	groupAfter, err := s.db.GetTodoGroup(group.ID)
+	if err == nil {
+		s.audit(req, groupBefore.OwnerEmail, "group.update", AuditTargetGroup, group.ID, groupBefore, groupAfter)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminOutboxGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = db.OutboxDead
+	}
+
+	outboxEmails, err := s.db.GetOutboxEmailsByStatus(status)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminOutboxGet] Failed to get outbox emails with status %s: %s", status, err)
+		http.Error(w, "Failed to get outbox emails", http.StatusInternalServerError)
+		return
+	}
+
+	outboxBytes, err := json.Marshal(&outboxEmails)
+	if err != nil {
+		http.Error(w, "Failed to marshal outbox emails JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(outboxBytes)
+}
+
+func (s *Server) EndpointAdminOutboxRetry(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	emailID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	outboxEmail, err := s.db.GetOutboxEmail(emailID)
+	if err != nil {
+		http.Error(w, "No such email", http.StatusNotFound)
+		return
+	}
+
+	err = s.db.OutboxEmailRequeue(emailID, uint64(time.Now().Unix()))
+	if err != nil {
+		logger.Error("[Server][EndpointAdminOutboxRetry] Failed to requeue email %d: %s", emailID, err)
+		http.Error(w, "Failed to requeue email", http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+
+	s.audit(req, outboxEmail.Recipient, "admin.outbox.retry", AuditTargetOutbox, emailID,
+		map[string]string{"status": outboxEmail.Status},
+		map[string]string{"status": db.OutboxPending},
+	)
+	logger.Info("[Server][EndpointAdminOutboxRetry] %s requeued email %d", GetEmailFromReq(req), emailID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminOutboxDelete(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	emailID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	outboxEmail, err := s.db.GetOutboxEmail(emailID)
+	if err != nil {
+		http.Error(w, "No such email", http.StatusNotFound)
+		return
+	}
+
+	err = s.db.DeleteOutboxEmail(emailID)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminOutboxDelete] Failed to delete email %d: %s", emailID, err)
+		http.Error(w, "Failed to delete email", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, outboxEmail.Recipient, "admin.outbox.delete", AuditTargetOutbox, emailID, outboxEmail, nil)
+
+	logger.Info("[Server][EndpointAdminOutboxDelete] %s deleted email %d from the outbox", GetEmailFromReq(req), emailID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Reads {"email": ...} from request body and returns the user it points to
+func (s *Server) adminTargetUser(w http.ResponseWriter, req *http.Request, endpoint string) (*db.User, bool) {
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][%s] Failed to read request body: %s", endpoint, err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	type targetRequest struct {
+		Email string `json:"email"`
+	}
+
+	var target targetRequest
+	err = json.Unmarshal(contents, &target)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := s.db.GetUser(strings.ToLower(target.Email))
+	if err != nil {
+		http.Error(w, "No such user", http.StatusNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (s *Server) EndpointAdminUsersGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	users, err := s.db.GetUsersOverview()
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUsersGet] Failed to get users overview: %s", err)
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+
+	usersBytes, err := json.Marshal(&users)
+	if err != nil {
+		http.Error(w, "Failed to marshal users JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(usersBytes)
+}
+
+func (s *Server) EndpointAdminUserVerify(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserVerify")
+	if !ok {
+		return
+	}
+
+	err := s.db.UserSetEmailConfirmed(user.Email)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserVerify] Failed to verify %s: %s", user.Email, err)
+		http.Error(w, "Failed to verify user", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, user.Email, "admin.user.verify", AuditTargetUser, user.Email,
+		map[string]bool{"confirmedEmail": user.ConfirmedEmail},
+		map[string]bool{"confirmedEmail": true},
+	)
+	logger.Info("[Server][EndpointAdminUserVerify] %s manually verified %s", GetEmailFromReq(req), user.Email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminUserDisable(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserDisable")
+	if !ok {
+		return
+	}
+
+	if user.Email == GetEmailFromReq(req) {
+		http.Error(w, "You can't disable yourself", http.StatusBadRequest)
+		return
+	}
+
+	// Toggle
+	err := s.db.UserSetDisabled(user.Email, !user.Disabled)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserDisable] Failed to change disabled state of %s: %s", user.Email, err)
+		http.Error(w, "Failed to change user", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, user.Email, "admin.user.disable", AuditTargetUser, user.Email,
+		map[string]bool{"disabled": user.Disabled},
+		map[string]bool{"disabled": !user.Disabled},
+	)
+	if user.Disabled {
+		logger.Info("[Server][EndpointAdminUserDisable] %s enabled %s", GetEmailFromReq(req), user.Email)
+	} else {
+		logger.Info("[Server][EndpointAdminUserDisable] %s disabled %s", GetEmailFromReq(req), user.Email)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminUserDelete(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserDelete")
+	if !ok {
+		return
+	}
+
+	if user.Email == GetEmailFromReq(req) {
+		http.Error(w, "You can't delete yourself from here", http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.DeleteUserClean(user.Email)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserDelete] Failed to delete %s: %s", user.Email, err)
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, user.Email, "admin.user.delete", AuditTargetUser, user.Email, user, nil)
+	logger.Info("[Server][EndpointAdminUserDelete] %s deleted %s", GetEmailFromReq(req), user.Email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminUserResetPassword(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserResetPassword")
+	if !ok {
+		return
+	}
+
+	token, err := misc.GenerateRandomPassword(PasswordResetTokenLength)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserResetPassword] Failed to generate a reset token: %s", err)
+		http.Error(w, "Failed to generate a reset link", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the hash is kept, so the database alone does not let anyone in
+	err = s.db.CreatePasswordReset(user.Email, misc.HashPassword(token), uint64(time.Now().Unix()), PasswordResetLifeSeconds)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserResetPassword] Failed to save a password reset for %s: %s", user.Email, err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, user.Email, "admin.user.resetpassword", AuditTargetUser, user.Email, nil, nil)
+
+	err = s.SendPasswordResetEmail(user.Email, s.baseURL(req)+"/resetpassword?token="+token)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserResetPassword] Failed to send a reset link to %s: %s", user.Email, err)
+		http.Error(w, "Failed to send a reset link", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("[Server][EndpointAdminUserResetPassword] %s reset password of %s", GetEmailFromReq(req), user.Email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminUserResendVerification(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserResendVerification")
+	if !ok {
+		return
+	}
+
+	if user.ConfirmedEmail {
+		http.Error(w, "User is already verified", http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.SendVerificationEmail(user.Email)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserResendVerification] Failed to send verification email to %s: %s", user.Email, err)
+		http.Error(w, "Failed to send email verification message", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, user.Email, "admin.user.resendverification", AuditTargetUser, user.Email, nil, nil)
+	logger.Info("[Server][EndpointAdminUserResendVerification] %s resent verification email to %s", GetEmailFromReq(req), user.Email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointAdminUserRole(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.adminTargetUser(w, req, "EndpointAdminUserRole")
+	if !ok {
+		return
+	}
+
+	if user.Email == GetEmailFromReq(req) {
+		http.Error(w, "You can't change your own role", http.StatusBadRequest)
+		return
+	}
+
+	// Toggle
+	newRole := db.RoleAdmin
+	if user.IsAdmin() {
+		newRole = db.RoleUser
+	}
+
+	err := s.db.UserSetRole(user.Email, newRole)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminUserRole] Failed to set role of %s: %s", user.Email, err)
+		http.Error(w, "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(req, user.Email, "admin.user.role", AuditTargetUser, user.Email,
+		map[string]string{"role": user.Role},
+		map[string]string{"role": newRole},
+	)
+	logger.Info("[Server][EndpointAdminUserRole] %s set role of %s to %s", GetEmailFromReq(req), user.Email, newRole)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointUserAuditGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Authentication check
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Authentication error", http.StatusForbidden)
+		return
+	}
+
+	events, err := s.db.GetUserAuditEvents(GetEmailFromReq(req), ProfileAuditEventsCount)
+	if err != nil {
+		logger.Error("[Server][EndpointUserAuditGet] Failed to get audit events of %s: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to get audit events", http.StatusInternalServerError)
+		return
+	}
+
+	eventsBytes, err := json.Marshal(&events)
+	if err != nil {
+		http.Error(w, "Failed to marshal audit events JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(eventsBytes)
+}
+
+func (s *Server) EndpointAdminAuditGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAdminReq(req, s.db) {
+		http.Error(w, "Admin rights required", http.StatusForbidden)
+		return
+	}
+
+	var limit uint64 = AuditPageSize
+	var offset uint64 = 0
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.ParseUint(limitStr, 10, 64)
+		if err != nil || parsedLimit == 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsedLimit
+	}
+	if offsetStr := req.URL.Query().Get("offset"); offsetStr != "" {
+		parsedOffset, err := strconv.ParseUint(offsetStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = parsedOffset
+	}
+
+	events, err := s.db.GetAuditEvents(limit, offset)
+	if err != nil {
+		logger.Error("[Server][EndpointAdminAuditGet] Failed to get audit events: %s", err)
+		http.Error(w, "Failed to get audit events", http.StatusInternalServerError)
+		return
+	}
+
+	eventsBytes, err := json.Marshal(&events)
+	if err != nil {
+		http.Error(w, "Failed to marshal audit events JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(eventsBytes)
+}
+
+func (s *Server) EndpointTrashGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	trash, err := GetTrashPageData(s.db, GetEmailFromReq(req), s.config.TrashRetentionDays, s.localeFromReq(req))
+	if err != nil {
+		logger.Error("[Server][EndpointTrashGet] Failed to get trash of %s: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to get trash", http.StatusInternalServerError)
+		return
+	}
+
+	trashBytes, err := json.Marshal(&trash)
+	if err != nil {
+		http.Error(w, "Failed to marshal trash JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(trashBytes)
+}
+
+func (s *Server) EndpointTodoRestore(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	if todo.DeletedAtUnix == 0 {
+		http.Error(w, "This TODO is not in the trash", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RestoreTodo(todoID)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoRestore] Failed to restore TODO %d of %s: %s", todoID, GetEmailFromReq(req), err)
+		http.Error(w, "Failed to restore TODO", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, todo.OwnerEmail, "todo.restore", AuditTargetTodo, todoID,
+		map[string]uint64{"deletedAtUnix": todo.DeletedAtUnix},
+		map[string]uint64{"deletedAtUnix": 0},
+	)
+
+	logger.Info("[Server][EndpointTodoRestore] Restored TODO with ID %d from the trash", todoID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoGroupRestore(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID
+	groupId, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad Category ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(groupId, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	group, err := s.db.GetTodoGroup(groupId)
+	if err != nil {
+		http.Error(w, "Failed to retrieve TODO group", http.StatusInternalServerError)
+		return
+	}
+
+	if group.DeletedAtUnix == 0 {
+		http.Error(w, "This group is not in the trash", http.StatusBadRequest)
+		return
+	}
+
+	// Restores TODOs deleted along with the group as well
+	err = s.db.RestoreTodoGroup(groupId)
+	if err != nil {
+		logger.Error("[Server][EndpointGroupRestore] Failed to restore group %d of %s: %s", groupId, GetEmailFromReq(req), err)
+		http.Error(w, "Failed to restore TODO group", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, group.OwnerEmail, "group.restore", AuditTargetGroup, groupId,
+		map[string]uint64{"deletedAtUnix": group.DeletedAtUnix},
+		map[string]uint64{"deletedAtUnix": 0},
+	)
+
+	logger.Info("[Server][EndpointGroupRestore] Restored group ID: %d of %s from the trash", groupId, GetEmailFromReq(req))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTrashEmpty(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	email := GetEmailFromReq(req)
+	err := s.db.EmptyUserTrash(email)
+	if err != nil {
+		logger.Error("[Server][EndpointTrashEmpty] Failed to empty trash of %s: %s", email, err)
+		http.Error(w, "Failed to empty trash", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, email, "trash.empty", AuditTargetUser, email, nil, nil)
+
+	logger.Info("[Server][EndpointTrashEmpty] Emptied trash of %s", email)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoArchive(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	if !todo.IsDone {
+		http.Error(w, "Only completed TODOs can be archived", http.StatusBadRequest)
+		return
+	}
+
+	archivedAt := uint64(time.Now().Unix())
+	err = s.db.ArchiveTodo(todoID, archivedAt)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoArchive] Failed to archive TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to archive TODO", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, todo.OwnerEmail, "todo.archive", AuditTargetTodo, todoID,
+		map[string]uint64{"archivedAtUnix": todo.ArchivedAtUnix},
+		map[string]uint64{"archivedAtUnix": archivedAt},
+	)
+
+	logger.Info("[Server][EndpointTodoArchive] Archived TODO with ID %d", todoID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoUnarchive(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.UnarchiveTodo(todoID)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoUnarchive] Failed to unarchive TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to unarchive TODO", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, todo.OwnerEmail, "todo.unarchive", AuditTargetTodo, todoID,
+		map[string]uint64{"archivedAtUnix": todo.ArchivedAtUnix},
+		map[string]uint64{"archivedAtUnix": 0},
+	)
+
+	logger.Info("[Server][EndpointTodoUnarchive] Unarchived TODO with ID %d", todoID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoGroupArchive(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID
+	groupId, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad Category ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(groupId, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	archived, err := s.db.ArchiveCompletedGroupTodos(groupId, uint64(time.Now().Unix()))
+	if err != nil {
+		logger.Error("[Server][EndpointGroupArchive] Failed to archive completed TODOs of group %d: %s", groupId, err)
+		http.Error(w, "Failed to archive TODOs", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, GetEmailFromReq(req), "group.archive", AuditTargetGroup, groupId,
+		nil,
+		map[string]int64{"archivedTodos": archived},
+	)
+
+	logger.Info("[Server][EndpointGroupArchive] Archived %d completed TODOs of group ID: %d", archived, groupId)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointUserAutoArchive(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Authentication check
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Authentication error", http.StatusForbidden)
+		return
+	}
+
+	type autoArchiveRequest struct {
+		Days uint64 `json:"days"`
+	}
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][EndpointUserAutoArchive] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	var autoArchive autoArchiveRequest
+	err = json.Unmarshal(contents, &autoArchive)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	if autoArchive.Days > MaxAutoArchiveDays {
+		http.Error(w, fmt.Sprintf("Can't wait for more than %d days", MaxAutoArchiveDays), http.StatusBadRequest)
+		return
+	}
+
+	userEmail := GetEmailFromReq(req)
+	userBefore, err := s.db.GetUser(userEmail)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.UserSetAutoArchive(userEmail, autoArchive.Days)
+	if err != nil {
+		logger.Error("[Server][EndpointUserAutoArchive] Failed to set auto archive days for %s: %s", userEmail, err)
+		http.Error(w, "Failed to change user settings", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, userEmail, "user.autoarchive", AuditTargetUser, userEmail,
+		map[string]uint64{"autoArchiveDays": userBefore.AutoArchiveDays},
+		map[string]uint64{"autoArchiveDays": autoArchive.Days},
+	)
+
+	logger.Info("[Server][EndpointUserAutoArchive] Set auto archive days of %s to %d", userEmail, autoArchive.Days)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointUserTimezone(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Authentication check
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Authentication error", http.StatusForbidden)
+		return
+	}
+
+	type timezoneRequest struct {
+		Timezone string `json:"timezone"`
+	}
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][EndpointUserTimezone] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	var timezone timezoneRequest
+	err = json.Unmarshal(contents, &timezone)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Empty zone means the zone of the server. "Local" is not accepted as it depends on the server
+	timezone.Timezone = strings.TrimSpace(timezone.Timezone)
+	if timezone.Timezone != "" {
+		_, err = time.LoadLocation(timezone.Timezone)
+		if err != nil || timezone.Timezone == "Local" {
+			http.Error(w, "Unknown time zone", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userEmail := GetEmailFromReq(req)
+	userBefore, err := s.db.GetUser(userEmail)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.UserSetTimezone(userEmail, timezone.Timezone)
+	if err != nil {
+		logger.Error("[Server][EndpointUserTimezone] Failed to set time zone for %s: %s", userEmail, err)
+		http.Error(w, "Failed to change user settings", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, userEmail, "user.timezone", AuditTargetUser, userEmail,
+		map[string]string{"timezone": userBefore.Timezone},
+		map[string]string{"timezone": timezone.Timezone},
+	)
+
+	logger.Info("[Server][EndpointUserTimezone] Set time zone of %s to \"%s\"", userEmail, timezone.Timezone)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointArchiveSearch(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	locale := s.localeFromReq(req)
+	filter, err := archiveFilterFromReq(req, locale.Location)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid dates: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	archive, err := GetArchivePageData(s.db, GetEmailFromReq(req), filter, locale)
+	if err != nil {
+		logger.Error("[Server][EndpointArchiveSearch] Failed to search archive of %s: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to search archive", http.StatusInternalServerError)
+		return
+	}
+
+	archiveBytes, err := json.Marshal(&archive)
+	if err != nil {
+		http.Error(w, "Failed to marshal archive JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(archiveBytes)
+}
+
+func (s *Server) EndpointStatsGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	days, weeks, err := statsRangeFromReq(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := s.BuildStats(GetEmailFromReq(req), time.Now().In(s.localeFromReq(req).Location), days, weeks)
+	if err != nil {
+		logger.Error("[Server][EndpointStatsGet] Failed to build statistics for %s: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to build statistics", http.StatusInternalServerError)
+		return
+	}
+
+	statsBytes, err := json.Marshal(&stats)
+	if err != nil {
+		http.Error(w, "Failed to marshal statistics JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(statsBytes)
+}
+
+func (s *Server) EndpointTodoRangeGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	locale := s.localeFromReq(req)
+	from, to, err := todoRangeFromReq(req, locale.Location)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid range: from and to must be dates in YYYY-MM-DD format: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	todos, err := s.db.GetUserTodosScheduledBetween(GetEmailFromReq(req), uint64(from.Unix()), uint64(to.Unix()), locale.Location)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoRangeGet] Failed to retrieve TODOs of %s: %s", GetEmailFromReq(req), err)
+		http.Error(w, "Failed to retrieve TODOs", http.StatusInternalServerError)
+		return
+	}
+
+	locale.Localize(todos)
+	now := time.Now().In(locale.Location)
+	calendarTodos := []*CalendarTodo{}
+	for _, todo := range todos {
+		todo.Image = nil
+		todo.File = nil
+		calendarTodos = append(calendarTodos, newCalendarTodo(todo, now))
+	}
+
+	todosBytes, err := json.Marshal(&calendarTodos)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODOs JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(todosBytes)
+}
+
+// Returns the board column with ID from the request path if it belongs to the user
+func (s *Server) ownedBoardColumn(w http.ResponseWriter, req *http.Request) (*db.BoardColumn, bool) {
+	columnID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid column ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	column, err := s.db.GetBoardColumn(columnID)
+	if err != nil {
+		http.Error(w, "No such column", http.StatusNotFound)
+		return nil, false
+	}
+
+	if !s.db.DoesUserOwnGroup(column.GroupID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this column", http.StatusForbidden)
+		return nil, false
+	}
+
+	return column, true
+}
+
+// Reads board column JSON from request body and validates its name
+func readBoardColumn(w http.ResponseWriter, req *http.Request) (*db.BoardColumn, bool) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	var column db.BoardColumn
+	err = json.Unmarshal(body, &column)
+	if err != nil {
+		http.Error(w, "Invalid column JSON", http.StatusBadRequest)
+		return nil, false
+	}
+
+	column.Name = strings.TrimSpace(column.Name)
+	if column.Name == "" || uint(len([]rune(column.Name))) > MaxBoardColumnNameLength {
+		http.Error(
+			w,
+			fmt.Sprintf("Column name must be from 1 to %d characters long", MaxBoardColumnNameLength),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+
+	return &column, true
+}
+
+func (s *Server) EndpointTodoGroupBoardView(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	groupID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(groupID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return
+	}
+
+	type boardViewRequest struct {
+		BoardView bool `json:"boardView"`
+	}
+
+	var boardView boardViewRequest
+	err = json.Unmarshal(body, &boardView)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	groupBefore, err := s.db.GetTodoGroup(groupID)
+	if err != nil || groupBefore.DeletedAtUnix != 0 {
+		http.Error(w, "Can't access this group", http.StatusBadRequest)
+		return
+	}
+
+	if boardView.BoardView {
+		// Give the board something to start with
+		columns, err := s.db.GetGroupBoardColumns(groupID)
+		if err != nil {
+			logger.Error("[Server][EndpointTodoGroupBoardView] Failed to get columns of group %d: %s", groupID, err)
+			http.Error(w, "Failed to get board columns", http.StatusInternalServerError)
+			return
+		}
+
+		if len(columns) == 0 {
+			err = s.createDefaultBoardColumns(groupID, LanguageFromReq(req))
+			if err != nil {
+				logger.Error("[Server][EndpointTodoGroupBoardView] Failed to create default columns for group %d: %s", groupID, err)
+				http.Error(w, "Failed to create board columns", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	err = s.db.TodoGroupSetBoardView(groupID, boardView.BoardView)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoGroupBoardView] Failed to set board view of group %d: %s", groupID, err)
+		http.Error(w, "Failed to set board view", http.StatusInternalServerError)
+		return
+	}
+
+	groupAfter, err := s.db.GetTodoGroup(groupID)
+	if err == nil {
+		s.audit(req, groupBefore.OwnerEmail, "group.board", AuditTargetGroup, groupID, groupBefore, groupAfter)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointBoardGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	groupID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(groupID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	board, err := GetBoardPageData(s.db, groupID, s.localeFromReq(req))
+	if err != nil {
+		logger.Error("[Server][EndpointBoardGet] Failed to get board of group %d: %s", groupID, err)
+		http.Error(w, "Failed to get board", http.StatusInternalServerError)
+		return
+	}
+
+	boardBytes, err := json.Marshal(&board)
+	if err != nil {
+		http.Error(w, "Failed to marshal board JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(boardBytes)
+}
+
+func (s *Server) EndpointBoardColumnCreate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	groupID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(groupID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this group", http.StatusForbidden)
+		return
+	}
+
+	column, ok := readBoardColumn(w, req)
+	if !ok {
+		return
+	}
+	column.GroupID = groupID
+
+	column.ID, err = s.db.CreateBoardColumn(*column)
+	if err != nil {
+		logger.Error("[Server][EndpointBoardColumnCreate] Failed to create a column for group %d: %s", groupID, err)
+		http.Error(w, "Failed to create column", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, GetEmailFromReq(req), "board.column.create", AuditTargetColumn, column.ID, nil, column)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointBoardColumnUpdate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	columnBefore, ok := s.ownedBoardColumn(w, req)
+	if !ok {
+		return
+	}
+
+	updatedColumn, ok := readBoardColumn(w, req)
+	if !ok {
+		return
+	}
+
+	err := s.db.UpdateBoardColumn(columnBefore.ID, *updatedColumn)
+	if err != nil {
+		logger.Error("[Server][EndpointBoardColumnUpdate] Failed to update column %d: %s", columnBefore.ID, err)
+		http.Error(w, "Failed to update column", http.StatusInternalServerError)
+		return
+	}
+
+	columnAfter, err := s.db.GetBoardColumn(columnBefore.ID)
+	if err == nil {
+		s.audit(req, GetEmailFromReq(req), "board.column.update", AuditTargetColumn, columnBefore.ID, columnBefore, columnAfter)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointBoardColumnDelete(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	column, ok := s.ownedBoardColumn(w, req)
+	if !ok {
+		return
+	}
+
+	err := s.db.DeleteBoardColumn(column.ID)
+	if err != nil {
+		logger.Error("[Server][EndpointBoardColumnDelete] Failed to delete column %d: %s", column.ID, err)
+		http.Error(w, "Failed to delete column", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, GetEmailFromReq(req), "board.column.delete", AuditTargetColumn, column.ID, column, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoMove(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return
+	}
+
+	type moveRequest struct {
+		ColumnID uint64 `json:"columnId"`
+	}
+
+	var move moveRequest
+	err = json.Unmarshal(body, &move)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	todoBefore, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	if todoBefore.DeletedAtUnix != 0 {
+		http.Error(w, "This TODO is in the trash", http.StatusBadRequest)
+		return
+	}
+
+	column, err := s.db.GetBoardColumn(move.ColumnID)
+	if err != nil || column.GroupID != todoBefore.GroupID {
+		http.Error(w, "No such column in the group of this TODO", http.StatusBadRequest)
+		return
+	}
+
+	// Columns flagged as done complete TODOs, the rest bring them back
+	completionTimeUnix := todoBefore.CompletionTimeUnix
+	if column.IsDone && !todoBefore.IsDone {
+		completionTimeUnix = uint64(time.Now().Unix())
+	} else if !column.IsDone {
+		completionTimeUnix = 0
+	}
+
+	err = s.db.TodoSetColumn(todoID, column.ID, column.IsDone, completionTimeUnix)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoMove] Failed to move TODO %d to column %d: %s", todoID, column.ID, err)
+		http.Error(w, "Failed to move TODO", http.StatusInternalServerError)
+		return
+	}
+
+	todoAfter, err := s.db.GetTodo(todoID)
+	if err == nil {
+		s.audit(req, todoBefore.OwnerEmail, "todo.move", AuditTargetTodo, todoID, todoBefore, todoAfter)
+		if todoAfter.IsDone && !todoBefore.IsDone {
+			s.scheduleNextOccurrence(req, todoAfter)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) EndpointTodoSnooze(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	// Obtain TODO ID
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user owns this TODO
+	if !s.db.DoesUserOwnTodo(todoID, GetEmailFromReq(req)) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	type snoozeRequest struct {
+		Until string `json:"until"`
+		// Only used with custom snooze
+		StartUnix uint64 `json:"startUnix"`
+	}
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoSnooze] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+
+	var snooze snoozeRequest
+	err = json.Unmarshal(contents, &snooze)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := s.db.GetTodo(todoID)
+	if err != nil {
+		http.Error(w, "Can't access this TODO", http.StatusInternalServerError)
+		return
+	}
+
+	if todo.IsDone && snooze.Until != SnoozeNone {
+		http.Error(w, "Completed TODOs can't be snoozed", http.StatusBadRequest)
+		return
+	}
+
+	locale := s.localeFromReq(req)
+	until, err := snoozeUntil(snooze.Until, time.Now().In(locale.Location), snooze.StartUnix)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Can't snooze: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	startUnix := uint64(until.Unix())
+	err = s.db.TodoSetStart(todoID, startUnix)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoSnooze] Failed to snooze TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to snooze TODO", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, todo.OwnerEmail, "todo.snooze", AuditTargetTodo, todoID,
+		map[string]uint64{"startUnix": todo.StartUnix},
+		map[string]uint64{"startUnix": startUnix},
+	)
+
+	todo.StartUnix = startUnix
+	todo.Localize(locale.Location, locale.DateLayout)
+	snoozedBytes, err := json.Marshal(map[string]interface{}{
+		"startUnix": todo.StartUnix,
+		"start":     todo.Start,
+	})
+	if err != nil {
+		http.Error(w, "Failed to marshal snooze JSON", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("[Server][EndpointTodoSnooze] Snoozed TODO with ID %d until %d", todoID, startUnix)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(snoozedBytes)
+}
+
+// Reads and parses quick add input of the request. Group given after # is looked up among user's groups
+func (s *Server) quickAddFromReq(req *http.Request) (*QuickAdd, int, error) {
+	type quickAddRequest struct {
+		Input string `json:"input"`
+		// The group to put TODO into if none is given in the input
+		GroupID uint64 `json:"groupId"`
+	}
+
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to read request body")
+	}
+
+	var quickAddReq quickAddRequest
+	err = json.Unmarshal(contents, &quickAddReq)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("bad JSON")
+	}
+
+	locale := s.localeFromReq(req)
+	quickAdd := ParseQuickAdd(quickAddReq.Input, time.Now().In(locale.Location))
+	quickAdd.GroupID = quickAddReq.GroupID
+	if quickAdd.GroupName != "" {
+		groups, err := s.db.GetAllUserTodoGroups(GetEmailFromReq(req))
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to retrieve groups")
+		}
+
+		quickAdd.GroupID = 0
+		for _, group := range groups {
+			if strings.EqualFold(group.Name, quickAdd.GroupName) {
+				quickAdd.GroupID = group.ID
+				break
+			}
+		}
+	}
+
+	if quickAdd.DueUnix != 0 {
+		todo := quickAdd.Todo()
+		todo.Localize(locale.Location, locale.DateLayout)
+		quickAdd.Due = todo.Due
+	}
+
+	return quickAdd, http.StatusOK, nil
+}
+
+func (s *Server) EndpointTodoQuickAddPreview(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	quickAdd, status, err := s.quickAddFromReq(req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	quickAddBytes, err := json.Marshal(&quickAdd)
+	if err != nil {
+		http.Error(w, "Failed to marshal quick add JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(quickAddBytes)
+}
+
+func (s *Server) EndpointTodoQuickAdd(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	quickAdd, status, err := s.quickAddFromReq(req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if quickAdd.Text == "" {
+		http.Error(w, "TODO text is empty", http.StatusBadRequest)
+		return
+	}
+
+	if uint(len([]rune(quickAdd.Text))) > MaxTodoTextLength {
+		http.Error(
+			w,
+			fmt.Sprintf("Text is too big! Text must be less than %d characters long!", MaxTodoTextLength),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if quickAdd.GroupID == 0 {
+		http.Error(w, fmt.Sprintf("No group named \"%s\"", quickAdd.GroupName), http.StatusBadRequest)
+		return
+	}
+
+	if !s.db.DoesUserOwnGroup(quickAdd.GroupID, GetEmailFromReq(req)) {
+		http.Error(w, "You do not own this group", http.StatusForbidden)
+		return
+	}
+
+	if s.db.IsTodoGroupInTrash(quickAdd.GroupID) {
+		http.Error(w, "This group is in the trash", http.StatusBadRequest)
+		return
+	}
+
+	newTodo := quickAdd.Todo()
+	newTodo.OwnerEmail = GetEmailFromReq(req)
+	newTodo.TimeCreatedUnix = uint64(time.Now().Unix())
+	newTodo.ID, err = s.db.CreateTodo(newTodo)
+	if err != nil {
+		http.Error(w, "Failed to create TODO", http.StatusInternalServerError)
+		logger.Error("[Server][EndpointTodoQuickAdd] Failed to put a new todo (%+v) into the db: %s", newTodo, err)
+		return
+	}
+	s.audit(req, newTodo.OwnerEmail, "todo.create", AuditTargetTodo, newTodo.ID, nil, newTodo)
+
+	locale := s.localeFromReq(req)
+	newTodo.Localize(locale.Location, locale.DateLayout)
+	newTodoBytes, err := json.Marshal(&newTodo)
+	if err != nil {
+		http.Error(w, "Failed to marshal TODO JSON", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("[Server][EndpointTodoQuickAdd] Created a new TODO for %s", newTodo.OwnerEmail)
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(newTodoBytes)
+}
+
+// Retrieves the comment of request's path and checks that the user wrote it
+func (s *Server) authoredTodoComment(w http.ResponseWriter, req *http.Request) (*db.TodoComment, bool) {
+	commentID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	comment, err := s.db.GetTodoComment(commentID)
+	if err != nil {
+		http.Error(w, "No such comment", http.StatusNotFound)
+		return nil, false
+	}
+
+	email := GetEmailFromReq(req)
+	if comment.AuthorEmail != email || !s.db.DoesUserOwnTodo(comment.TodoID, email) {
+		http.Error(w, "You are not the author of this comment", http.StatusForbidden)
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// Reads comment body from request JSON and validates it
+func readTodoCommentBody(w http.ResponseWriter, req *http.Request) (string, bool) {
+	contents, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return "", false
+	}
+
+	type commentRequest struct {
+		Body string `json:"body"`
+	}
+
+	var comment commentRequest
+	err = json.Unmarshal(contents, &comment)
+	if err != nil {
+		http.Error(w, "Bad JSON", http.StatusBadRequest)
+		return "", false
+	}
+
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" || uint(len([]rune(comment.Body))) > MaxTodoCommentLength {
+		http.Error(
+			w,
+			fmt.Sprintf("Comment must be from 1 to %d characters long", MaxTodoCommentLength),
+			http.StatusBadRequest,
+		)
+		return "", false
+	}
+
+	return comment.Body, true
+}
+
+func (s *Server) EndpointTodoCommentsGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	email := GetEmailFromReq(req)
+	if !s.db.DoesUserOwnTodo(todoID, email) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	comments, err := s.db.GetTodoComments(todoID)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoCommentsGet] Failed to get comments of TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+		return
+	}
+
+	locale := s.localeFromReq(req)
+	views := make([]*CommentView, 0, len(comments))
+	for _, comment := range comments {
+		views = append(views, newCommentView(comment, email, locale))
+	}
+
+	commentsBytes, err := json.Marshal(&views)
+	if err != nil {
+		http.Error(w, "Failed to marshal comments JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(commentsBytes)
+}
+
+func (s *Server) EndpointTodoCommentCreate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	email := GetEmailFromReq(req)
+	if !s.db.DoesUserOwnTodo(todoID, email) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	body, ok := readTodoCommentBody(w, req)
+	if !ok {
+		return
+	}
+
+	comment := db.TodoComment{
+		TodoID:      todoID,
+		AuthorEmail: email,
+		Body:        body,
+		CreatedUnix: uint64(time.Now().Unix()),
+	}
+	comment.ID, err = s.db.CreateTodoComment(comment)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoCommentCreate] Failed to comment on TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, email, "comment.create", AuditTargetComment, comment.ID, nil, comment)
+
+	commentBytes, err := json.Marshal(newCommentView(&comment, email, s.localeFromReq(req)))
+	if err != nil {
+		http.Error(w, "Failed to marshal comment JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(commentBytes)
+}
+
+func (s *Server) EndpointTodoCommentUpdate(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	commentBefore, ok := s.authoredTodoComment(w, req)
+	if !ok {
+		return
+	}
+
+	body, ok := readTodoCommentBody(w, req)
+	if !ok {
+		return
+	}
+
+	err := s.db.UpdateTodoComment(commentBefore.ID, body, uint64(time.Now().Unix()))
+	if err != nil {
+		logger.Error("[Server][EndpointTodoCommentUpdate] Failed to update comment %d: %s", commentBefore.ID, err)
+		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
+
+	commentAfter, err := s.db.GetTodoComment(commentBefore.ID)
+	if err != nil {
+		http.Error(w, "Failed to get updated comment", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, commentAfter.AuthorEmail, "comment.update", AuditTargetComment, commentAfter.ID, commentBefore, commentAfter)
+
+	commentBytes, err := json.Marshal(newCommentView(commentAfter, commentAfter.AuthorEmail, s.localeFromReq(req)))
+	if err != nil {
+		http.Error(w, "Failed to marshal comment JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(commentBytes)
+}
+
+func (s *Server) EndpointTodoCommentDelete(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	comment, ok := s.authoredTodoComment(w, req)
+	if !ok {
+		return
+	}
+
+	err := s.db.DeleteTodoComment(comment.ID)
+	if err != nil {
+		logger.Error("[Server][EndpointTodoCommentDelete] Failed to delete comment %d: %s", comment.ID, err)
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+	s.audit(req, comment.AuthorEmail, "comment.delete", AuditTargetComment, comment.ID, comment, nil)
+
 	w.WriteHeader(http.StatusOK)
 }
+
+func (s *Server) EndpointTodoTimelineGet(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check authentication information
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	todoID, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TODO ID", http.StatusBadRequest)
+		return
+	}
+
+	email := GetEmailFromReq(req)
+	if !s.db.DoesUserOwnTodo(todoID, email) {
+		http.Error(w, "You don't own this TODO", http.StatusForbidden)
+		return
+	}
+
+	timeline, err := s.todoTimeline(todoID, email, s.localeFromReq(req))
+	if err != nil {
+		logger.Error("[Server][EndpointTodoTimelineGet] Failed to build timeline of TODO %d: %s", todoID, err)
+		http.Error(w, "Failed to get timeline", http.StatusInternalServerError)
+		return
+	}
+	if timeline == nil {
+		timeline = []*TimelineEntry{}
+	}
+
+	timelineBytes, err := json.Marshal(&timeline)
+	if err != nil {
+		http.Error(w, "Failed to marshal timeline JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(timelineBytes)
+}
@@ -0,0 +1,149 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTodoUpdateClearsPriorityAndRecurrence(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_update_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase}
+
+	email := "user1@mail.ru"
+	password := "ruohguoeruoger"
+	err = dbase.CreateUser(db.User{Email: email, Password: password})
+	if err != nil {
+		t.Fatalf("failed to create user: %s", err)
+	}
+	err = dbase.UserSetEmailConfirmed(email)
+	if err != nil {
+		t.Fatalf("failed to confirm email: %s", err)
+	}
+	groupID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+
+	weekly := db.Todo{
+		GroupID: 1, Text: "weekly", OwnerEmail: email, DueUnix: uint64(time.Now().Unix()),
+		Priority: db.PriorityHigh, RecurUnit: db.RecurWeek, RecurInterval: 1,
+	}
+	update := func(todoID uint64, body string) {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/todo/update/%d", todoID), strings.NewReader(body))
+		req.SetBasicAuth(email, password)
+		recorder := httptest.NewRecorder()
+		s.EndpointTodoUpdate(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %s to be applied, got %d: %s", body, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	todoID, err := dbase.CreateTodo(weekly)
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	// Fields that are not sent stay as they were
+	update(todoID, fmt.Sprintf(`{"groupId":%d}`, groupID))
+	todo, _ := dbase.GetTodo(todoID)
+	if todo.GroupID != groupID || todo.Priority != db.PriorityHigh || !todo.IsRecurring() {
+		t.Fatalf("expected only the group to change, got %+v", todo)
+	}
+
+	update(todoID, `{"priority":0,"recurUnit":"","recurInterval":0}`)
+	todo, _ = dbase.GetTodo(todoID)
+	if todo.Priority != db.PriorityNone || todo.IsRecurring() || todo.Text != "weekly" {
+		t.Fatalf("expected priority and recurrence to be cleared, got %+v", todo)
+	}
+
+	// Done once, no next occurrence
+	update(todoID, `{"isDone":true}`)
+	todos, _ := dbase.GetAllUserTodosWithArchived(email)
+	if len(todos) != 1 {
+		t.Fatalf("expected no next occurrence of a TODO that is not recurring, got %d TODOs", len(todos))
+	}
+
+	// The same through sync
+	todoID, err = dbase.CreateTodo(weekly)
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+	result := s.applyTodoMutationOnce(httptest.NewRequest(http.MethodPost, "/api/todo/sync", nil), email, TodoMutation{
+		ID: "clear", Type: SyncMutationUpdate, TodoID: todoID, Todo: []byte(`{"priority":0,"recurUnit":""}`),
+	})
+	if result.Status != SyncStatusApplied {
+		t.Fatalf("expected the update to be applied, got %+v", result)
+	}
+	todo, _ = dbase.GetTodo(todoID)
+	if todo.Priority != db.PriorityNone || todo.IsRecurring() {
+		t.Fatalf("expected priority and recurrence to be cleared through sync, got %+v", todo)
+	}
+}
+
+func TestApplyDueInput(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %s", err)
+	}
+
+	for _, testCase := range []struct {
+		Body       string
+		DueUnix    uint64
+		DueHasTime bool
+		Valid      bool
+	}{
+		{`{"dueDate":"2025-03-10","dueTime":"09:30"}`, uint64(time.Date(2025, 3, 10, 9, 30, 0, 0, newYork).Unix()), true, true},
+		// After clocks are turned forward
+		{`{"dueDate":"2025-03-09","dueTime":"23:00"}`, uint64(time.Date(2025, 3, 10, 3, 0, 0, 0, time.UTC).Unix()), true, true},
+		{`{"dueDate":"2025-03-08","dueTime":"23:00"}`, uint64(time.Date(2025, 3, 9, 4, 0, 0, 0, time.UTC).Unix()), true, true},
+		{`{"dueDate":"2025-03-10","dueTime":""}`, uint64(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC).Unix()), false, true},
+		{`{"dueDate":""}`, 0, false, true},
+		// Not sent, stays as it was
+		{`{"text":"no due"}`, 42, true, true},
+		{`{"dueDate":"10.03.2025"}`, 0, false, false},
+		{`{"dueDate":"2025-03-10","dueTime":"9am"}`, 0, false, false},
+		{`{"dueDate":"1969-12-31"}`, 0, false, false},
+	} {
+		todo := db.Todo{DueUnix: 42, DueHasTime: true}
+		err := applyDueInput([]byte(testCase.Body), &todo, newYork)
+		if (err == nil) != testCase.Valid {
+			t.Errorf("%s: expected valid to be %v, got error %v", testCase.Body, testCase.Valid, err)
+			continue
+		}
+		if testCase.Valid && (todo.DueUnix != testCase.DueUnix || todo.DueHasTime != testCase.DueHasTime) {
+			t.Errorf("%s: expected due %d (time %v), got %d (time %v)", testCase.Body, testCase.DueUnix, testCase.DueHasTime, todo.DueUnix, todo.DueHasTime)
+		}
+	}
+}
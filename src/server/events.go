@@ -0,0 +1,315 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How many latest events are kept to be replayed to reconnecting clients
+	MaxBufferedEvents int = 1000
+	// How many undelivered events a single subscriber can have before being dropped
+	SubscriberEventQueue int = 64
+	// How often a comment is sent to keep idle event streams open
+	EventsHeartbeatInterval time.Duration = time.Second * 25
+	// How long clients should wait before reconnecting, in milliseconds
+	EventsRetryMilliseconds uint64 = 3000
+)
+
+// Changes of these targets are pushed to the clients
+var publishedAuditTargets = []string{
+	AuditTargetTodo,
+	AuditTargetGroup,
+	AuditTargetColumn,
+	AuditTargetComment,
+}
+
+// A change of user's data pushed to all of their sessions
+type ChangeEvent struct {
+	ID         string          `json:"id"`
+	OwnerEmail string          `json:"-"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetID   string          `json:"targetId"`
+	Data       json.RawMessage `json:"data"`
+	ClientID   string          `json:"clientId"`
+	seq        uint64
+}
+
+// Delivers change events to subscribed sessions and keeps latest ones for replay
+type EventHub struct {
+	mutex       sync.Mutex
+	epoch       string
+	lastSeq     uint64
+	recent      []*ChangeEvent
+	subscribers map[string]map[chan *ChangeEvent]struct{}
+}
+
+// Creates a new event hub. Event IDs of different hubs never match
+func NewEventHub() *EventHub {
+	return &EventHub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		recent:      []*ChangeEvent{},
+		subscribers: make(map[string]map[chan *ChangeEvent]struct{}),
+	}
+}
+
+// Returns ID of the latest published event
+func (hub *EventHub) LastID() string {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return fmt.Sprintf("%s-%d", hub.epoch, hub.lastSeq)
+}
+
+// Assigns an ID to the event and delivers it to all sessions of its owner.
+// Subscribers that can not keep up are dropped and have to reconnect
+func (hub *EventHub) Publish(event ChangeEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.lastSeq++
+	event.seq = hub.lastSeq
+	event.ID = fmt.Sprintf("%s-%d", hub.epoch, event.seq)
+
+	hub.recent = append(hub.recent, &event)
+	if len(hub.recent) > MaxBufferedEvents {
+		hub.recent = hub.recent[len(hub.recent)-MaxBufferedEvents:]
+	}
+
+	for subscriber := range hub.subscribers[event.OwnerEmail] {
+		select {
+		case subscriber <- &event:
+		default:
+			delete(hub.subscribers[event.OwnerEmail], subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+/*
+Subscribes a session of the user to the events. If lastEventID is not empty, events
+published after it are returned as missed. If they can not be replayed (the server was
+restarted or too many events happened since) reset is true and the client should reload
+all of its data
+*/
+func (hub *EventHub) Subscribe(email string, lastEventID string) (chan *ChangeEvent, []*ChangeEvent, bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	subscriber := make(chan *ChangeEvent, SubscriberEventQueue)
+	if hub.subscribers[email] == nil {
+		hub.subscribers[email] = make(map[chan *ChangeEvent]struct{})
+	}
+	hub.subscribers[email][subscriber] = struct{}{}
+
+	if lastEventID == "" {
+		return subscriber, nil, false
+	}
+
+	epoch, seqStr, found := strings.Cut(lastEventID, "-")
+	if !found || epoch != hub.epoch {
+		return subscriber, nil, true
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > hub.lastSeq {
+		return subscriber, nil, true
+	}
+
+	if len(hub.recent) > 0 && hub.recent[0].seq > seq+1 {
+		// Some events are not buffered anymore
+		return subscriber, nil, true
+	}
+
+	var missed []*ChangeEvent
+	for _, event := range hub.recent {
+		if event.seq > seq && event.OwnerEmail == email {
+			missed = append(missed, event)
+		}
+	}
+
+	return subscriber, missed, false
+}
+
+// Removes the session from subscribers
+func (hub *EventHub) Unsubscribe(email string, subscriber chan *ChangeEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	_, ok := hub.subscribers[email][subscriber]
+	if !ok {
+		// Already dropped
+		return
+	}
+
+	delete(hub.subscribers[email], subscriber)
+	if len(hub.subscribers[email]) == 0 {
+		delete(hub.subscribers, email)
+	}
+	close(subscriber)
+}
+
+// Pushes a recorded change to the sessions of its owner if the target is of interest to clients
+func (s *Server) publishChange(req *http.Request, owner string, action string, targetType string, targetID interface{}, after string) {
+	if s.events == nil {
+		return
+	}
+
+	published := false
+	for _, target := range publishedAuditTargets {
+		if target == targetType {
+			published = true
+			break
+		}
+	}
+	if !published {
+		return
+	}
+
+	data := json.RawMessage("null")
+	if after != "" {
+		data = json.RawMessage(after)
+	}
+
+	s.events.Publish(ChangeEvent{
+		OwnerEmail: owner,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Data:       data,
+		ClientID:   req.Header.Get("X-Client-ID"),
+	})
+}
+
+// Writes a single server-sent event
+func writeServerSentEvent(w http.ResponseWriter, id string, name string, data []byte) error {
+	var err error
+	if id != "" {
+		_, err = fmt.Fprintf(w, "id: %s\n", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// Streams changes of user's data as server-sent events until the client disconnects
+func (s *Server) EndpointEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error("[Server][EndpointEvents] Streaming is not supported by the response writer")
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("lastEventId")
+	}
+
+	email := GetEmailFromReq(req)
+	subscriber, missed, reset := s.events.Subscribe(email, lastEventID)
+	defer s.events.Unsubscribe(email, subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", EventsRetryMilliseconds)
+	if err != nil {
+		return
+	}
+
+	if reset {
+		err = writeServerSentEvent(w, s.events.LastID(), "reset", []byte("{}"))
+		if err != nil {
+			return
+		}
+	}
+
+	for _, event := range missed {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+
+		err = writeServerSentEvent(w, event.ID, "change", eventBytes)
+		if err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(EventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case event, ok := <-subscriber:
+			if !ok {
+				// Dropped for being too slow, the client will reconnect and catch up
+				return
+			}
+
+			eventBytes, err := json.Marshal(event)
+			if err != nil {
+				logger.Error("[Server][EndpointEvents] Failed to marshal event %s: %s", event.ID, err)
+				continue
+			}
+
+			err = writeServerSentEvent(w, event.ID, "change", eventBytes)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
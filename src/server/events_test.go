@@ -0,0 +1,85 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := NewEventHub()
+
+	subscriber, missed, reset := hub.Subscribe("a@b.c", "")
+	if len(missed) != 0 || reset {
+		t.Fatalf("fresh subscription has missed %d events, reset %v", len(missed), reset)
+	}
+	other, _, _ := hub.Subscribe("d@e.f", "")
+
+	hub.Publish(ChangeEvent{OwnerEmail: "a@b.c", Action: "todo.create", TargetID: "1"})
+	firstID := hub.LastID()
+	hub.Publish(ChangeEvent{OwnerEmail: "d@e.f", Action: "todo.create", TargetID: "2"})
+	hub.Publish(ChangeEvent{OwnerEmail: "a@b.c", Action: "todo.delete", TargetID: "1"})
+
+	for _, action := range []string{"todo.create", "todo.delete"} {
+		event := <-subscriber
+		if event.Action != action {
+			t.Fatalf("expected %s, got %s", action, event.Action)
+		}
+	}
+	if event := <-other; event.TargetID != "2" {
+		t.Fatalf("other user received event of todo %s", event.TargetID)
+	}
+	if len(other) != 0 {
+		t.Fatalf("other user received %d foreign events", len(other))
+	}
+	hub.Unsubscribe("a@b.c", subscriber)
+	hub.Unsubscribe("d@e.f", other)
+
+	// Reconnect after the first event
+	subscriber, missed, reset = hub.Subscribe("a@b.c", firstID)
+	if reset || len(missed) != 1 || missed[0].Action != "todo.delete" {
+		t.Fatalf("expected to replay a single deletion, got %d events, reset %v", len(missed), reset)
+	}
+	hub.Unsubscribe("a@b.c", subscriber)
+
+	// IDs of another server run can not be replayed
+	subscriber, _, reset = hub.Subscribe("a@b.c", "zzz-1")
+	if !reset {
+		t.Fatal("foreign event ID did not cause a reset")
+	}
+	hub.Unsubscribe("a@b.c", subscriber)
+
+	// Neither can events that fell out of the buffer
+	for i := 0; i < MaxBufferedEvents; i++ {
+		hub.Publish(ChangeEvent{OwnerEmail: "a@b.c", Action: "todo.update", TargetID: fmt.Sprint(i)})
+	}
+	subscriber, _, reset = hub.Subscribe("a@b.c", firstID)
+	if !reset {
+		t.Fatal("event ID outside of the buffer did not cause a reset")
+	}
+
+	// Slow subscribers are dropped
+	for i := 0; i <= SubscriberEventQueue; i++ {
+		hub.Publish(ChangeEvent{OwnerEmail: "a@b.c", Action: "todo.update"})
+	}
+	for range subscriber {
+	}
+	hub.Unsubscribe("a@b.c", subscriber)
+}
@@ -0,0 +1,186 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// EXIF orientation tag and its value for images that are stored the way they are shown
+const (
+	exifOrientationTag uint16 = 0x0112
+	orientationNormal  int    = 1
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Returns TIFF structure of the EXIF segment of JPEG data. nil if there is none
+func jpegExif(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return nil
+		}
+
+		marker := data[offset+1]
+		if marker == 0xDA {
+			// Start of scan, metadata is over
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return nil
+		}
+
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+
+		offset += 2 + length
+	}
+
+	return nil
+}
+
+// Returns TIFF structure of the EXIF chunk of WebP data. nil if there is none
+func webpExif(data []byte) []byte {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+
+	for offset := 12; offset+8 <= len(data); {
+		fourCC := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size < 0 || offset+8+size > len(data) {
+			return nil
+		}
+
+		if fourCC == "EXIF" {
+			// Some encoders keep JPEG's header
+			return bytes.TrimPrefix(data[offset+8:offset+8+size], exifHeader)
+		}
+
+		// Chunks are padded to even size
+		offset += 8 + size + size%2
+	}
+
+	return nil
+}
+
+// Reads orientation from EXIF TIFF structure. Images without one are shown as they are stored
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return orientationNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+
+	if order.Uint16(tiff[2:]) != 42 {
+		return orientationNormal
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return orientationNormal
+	}
+
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return orientationNormal
+		}
+		return orientation
+	}
+
+	return orientationNormal
+}
+
+/*
+Turns and mirrors the image according to EXIF orientation so that it
+looks the way it was taken once the metadata is gone
+*/
+func orient(img image.Image, orientation int) image.Image {
+	if orientation == orientationNormal {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	source := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(source, source.Bounds(), img, bounds.Min, draw.Src)
+
+	// Orientations from 5 to 8 swap sides
+	newWidth, newHeight := width, height
+	if orientation >= 5 {
+		newWidth, newHeight = height, width
+	}
+
+	oriented := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			}
+
+			copy(oriented.Pix[y*oriented.Stride+x*4:y*oriented.Stride+x*4+4], source.Pix[sourceY*source.Stride+sourceX*4:])
+		}
+	}
+
+	return oriented
+}
@@ -0,0 +1,286 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxTodoImageSizeBytes uint = 3145728 // 3MB
+	// Longest allowed side of a TODO image in pixels
+	MaxTodoImageDimension int = 4096
+	// Uploaded photos are processed before being stored, so they are allowed to be bigger
+	MaxTodoPhotoSizeBytes uint = 15728640 // 15MB
+	MaxTodoPhotoPixels    int  = 16000000
+	// Longest side of thumbnails shown in TODO lists. Twice the displayed size for high density screens
+	TodoThumbnailSize uint64 = 128
+	// Quality of JPEG thumbnails
+	thumbnailJPEGQuality int = 85
+	// Used when configuration does not say otherwise
+	DefaultImageMaxDimension uint = 1600
+	DefaultImageQuality      uint = 85
+)
+
+// Returns raw image data. Data URLs, which TODO images used to be stored as, are decoded
+func imageBytes(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("data:")) {
+		return data, nil
+	}
+
+	metadata, encoded, found := bytes.Cut(data, []byte(","))
+	if !found || !bytes.HasSuffix(metadata, []byte(";base64")) {
+		return nil, errors.New("data URL is not base64 encoded")
+	}
+
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(decoded, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded[:n], nil
+}
+
+/*
+Checks that data is a PNG or JPEG image of acceptable size and processes it the way uploaded
+photos are, so that its metadata is not stored. Returns processed image data with its content type
+*/
+func processTodoImage(data []byte, maxDimension uint, quality uint) ([]byte, string, error) {
+	data, err := imageBytes(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if uint(len(data)) > MaxTodoImageSizeBytes {
+		return nil, "", fmt.Errorf("image must be less than %dMB", MaxTodoImageSizeBytes/1024/1024)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("not a PNG or JPEG image")
+	}
+
+	if format != "png" && format != "jpeg" {
+		return nil, "", errors.New("only PNG and JPEG images are supported")
+	}
+
+	if config.Width == 0 || config.Height == 0 || config.Width > MaxTodoImageDimension || config.Height > MaxTodoImageDimension {
+		return nil, "", fmt.Errorf("image sides must be from 1 to %d pixels", MaxTodoImageDimension)
+	}
+
+	return processTodoPhoto(data, maxDimension, quality)
+}
+
+/*
+Decodes a PNG, JPEG, GIF or WebP photo, turns it the way it was taken, shrinks it
+so that its longest side is at most maxDimension and encodes it again. Photos become JPEGs,
+images that may be transparent become PNGs. Metadata, including location, is not carried over.
+Only the first frame of animated images is kept
+*/
+func processTodoPhoto(data []byte, maxDimension uint, quality uint) ([]byte, string, error) {
+	if uint(len(data)) > MaxTodoPhotoSizeBytes {
+		return nil, "", fmt.Errorf("photo must be less than %dMB", MaxTodoPhotoSizeBytes/1024/1024)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("not a JPEG, PNG, WebP or GIF image")
+	}
+
+	if config.Width == 0 || config.Height == 0 || config.Width*config.Height > MaxTodoPhotoPixels {
+		return nil, "", fmt.Errorf("photo must have at most %d megapixels", MaxTodoPhotoPixels/1000000)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("broken image: %s", err)
+	}
+
+	var orientation int = orientationNormal
+	switch format {
+	case "jpeg":
+		orientation = exifOrientation(jpegExif(data))
+	case "webp":
+		orientation = exifOrientation(webpExif(data))
+	}
+	// Turning does not change the longest side, so the smaller image is turned
+	img = orient(downscale(img, int(maxDimension)), orientation)
+
+	var processed bytes.Buffer
+	switch format {
+	case "jpeg", "webp":
+		err = jpeg.Encode(&processed, img, &jpeg.Options{Quality: int(quality)})
+		return processed.Bytes(), "image/jpeg", err
+	default:
+		err = png.Encode(&processed, img)
+		return processed.Bytes(), "image/png", err
+	}
+}
+
+// Returns configured photo dimension limit and JPEG quality, falling back to defaults
+func (s *Server) photoSettings() (uint, uint) {
+	maxDimension := s.config.ImageMaxDimension
+	if maxDimension == 0 {
+		maxDimension = DefaultImageMaxDimension
+	}
+
+	quality := s.config.ImageQuality
+	if quality == 0 || quality > 100 {
+		quality = DefaultImageQuality
+	}
+
+	return maxDimension, quality
+}
+
+// Returns a strong ETag of the image data
+func imageETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// Shrinks the image so that its longest side is size pixels by averaging pixels that fall into each new one
+func downscale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	newWidth, newHeight := size, height*size/width
+	if height > width {
+		newWidth, newHeight = width*size/height, size
+	}
+	if newWidth == 0 {
+		newWidth = 1
+	}
+	if newHeight == 0 {
+		newHeight = 1
+	}
+
+	source := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(source, source.Bounds(), img, bounds.Min, draw.Src)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		// Every new pixel covers at least one source pixel as the image only shrinks
+		fromY, toY := y*height/newHeight, (y+1)*height/newHeight
+		for x := 0; x < newWidth; x++ {
+			fromX, toX := x*width/newWidth, (x+1)*width/newWidth
+
+			var sum [4]uint64
+			for sourceY := fromY; sourceY < toY; sourceY++ {
+				row := source.Pix[sourceY*source.Stride:]
+				for sourceX := fromX; sourceX < toX; sourceX++ {
+					for channel := 0; channel < 4; channel++ {
+						sum[channel] += uint64(row[sourceX*4+channel])
+					}
+				}
+			}
+
+			count := uint64((toY - fromY) * (toX - fromX))
+			pixel := scaled.Pix[y*scaled.Stride+x*4:]
+			for channel := 0; channel < 4; channel++ {
+				pixel[channel] = uint8(sum[channel] / count)
+			}
+		}
+	}
+
+	return scaled
+}
+
+// Makes a thumbnail of the image. Photos stay JPEGs, everything else becomes a PNG
+func makeThumbnail(data []byte, size uint64) ([]byte, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var thumbnail bytes.Buffer
+	scaled := downscale(img, int(size))
+	if format == "jpeg" {
+		err = jpeg.Encode(&thumbnail, scaled, &jpeg.Options{Quality: thumbnailJPEGQuality})
+		return thumbnail.Bytes(), "image/jpeg", err
+	}
+
+	err = png.Encode(&thumbnail, scaled)
+	return thumbnail.Bytes(), "image/png", err
+}
+
+// Converts images stored as data URLs by older versions to raw image data
+func (s *Server) convertDataURLImages() {
+	todoIDs, err := s.db.GetTodosWithDataURLImages()
+	if err != nil {
+		logger.Error("[Server] Failed to find TODO images stored as data URLs: %s", err)
+		return
+	}
+
+	converted := 0
+	for _, todoID := range todoIDs {
+		data, err := s.db.GetTodoImage(todoID)
+		if err != nil {
+			logger.Error("[Server] Failed to get image of TODO %d: %s", todoID, err)
+			continue
+		}
+
+		maxDimension, quality := s.photoSettings()
+		data, _, err = processTodoImage(data, maxDimension, quality)
+		if err != nil {
+			// Left as is, served as it was before
+			logger.Warning("[Server] Image of TODO %d can't be converted: %s", todoID, err)
+			continue
+		}
+
+		err = s.db.UpdateTodoImage(todoID, data)
+		if err != nil {
+			logger.Error("[Server] Failed to save converted image of TODO %d: %s", todoID, err)
+			continue
+		}
+		converted++
+	}
+
+	if converted > 0 {
+		logger.Info("[Server] Converted %d TODO images from data URLs", converted)
+	}
+}
+
+// Returns the content type of stored image data
+func imageContentType(data []byte) string {
+	contentType := strings.Split(http.DetectContentType(data), ";")[0]
+	if !strings.HasPrefix(contentType, "image/") {
+		return "application/octet-stream"
+	}
+
+	return contentType
+}
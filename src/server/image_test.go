@@ -0,0 +1,202 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodedImage(t *testing.T, width int, height int, format string) []byte {
+	var encoded bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&encoded, img, nil)
+	} else {
+		err = png.Encode(&encoded, img)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode test image: %s", err)
+	}
+
+	return encoded.Bytes()
+}
+
+func TestTodoImages(t *testing.T) {
+	sketch := encodedImage(t, 256, 256, "png")
+	dataURL := []byte("data:image/png;base64," + base64.StdEncoding.EncodeToString(sketch))
+
+	data, contentType, err := processTodoImage(dataURL, DefaultImageMaxDimension, DefaultImageQuality)
+	if err != nil {
+		t.Fatalf("sketch sent as data URL must be accepted: %s", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "png" || contentType != "image/png" || config.Width != 256 || config.Height != 256 {
+		t.Fatalf("expected 256x256 PNG, got %s %dx%d (%v)", contentType, config.Width, config.Height, err)
+	}
+
+	for _, invalid := range [][]byte{
+		[]byte("not an image"),
+		[]byte("data:image/png;base64,!!!"),
+		encodedImage(t, MaxTodoImageDimension+1, 1, "png"),
+		sketch[:len(sketch)/2],
+	} {
+		_, _, err = processTodoImage(invalid, DefaultImageMaxDimension, DefaultImageQuality)
+		if err == nil {
+			t.Errorf("expected %.20q to be rejected", invalid)
+		}
+	}
+
+	for _, testCase := range []struct {
+		Width       int
+		Height      int
+		Format      string
+		ContentType string
+		NewWidth    int
+		NewHeight   int
+	}{
+		{256, 256, "png", "image/png", 128, 128},
+		{1000, 500, "jpeg", "image/jpeg", 128, 64},
+		{30, 300, "png", "image/png", 12, 128},
+		{64, 32, "png", "image/png", 64, 32},
+	} {
+		thumbnail, contentType, err := makeThumbnail(encodedImage(t, testCase.Width, testCase.Height, testCase.Format), TodoThumbnailSize)
+		if err != nil {
+			t.Fatalf("failed to make thumbnail of %dx%d image: %s", testCase.Width, testCase.Height, err)
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+		if err != nil {
+			t.Fatalf("thumbnail can't be decoded: %s", err)
+		}
+		if contentType != testCase.ContentType || config.Width != testCase.NewWidth || config.Height != testCase.NewHeight {
+			t.Errorf("expected %dx%d %s thumbnail of %dx%d image, got %dx%d %s",
+				testCase.NewWidth, testCase.NewHeight, testCase.ContentType,
+				testCase.Width, testCase.Height,
+				config.Width, config.Height, contentType,
+			)
+		}
+	}
+}
+
+// Returns EXIF TIFF structure with a single orientation entry
+func orientationExif(orientation uint16) []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0}
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	return append(append(tiff, entry...), 0, 0, 0, 0)
+}
+
+func TestTodoPhotos(t *testing.T) {
+	// Landscape photo taken with the camera turned, red in the top left corner
+	img := image.NewRGBA(image.Rect(0, 0, 2000, 1000))
+	for y := 0; y < 500; y++ {
+		for x := 0; x < 1000; x++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	var photo bytes.Buffer
+	err := jpeg.Encode(&photo, img, nil)
+	if err != nil {
+		t.Fatalf("failed to encode test photo: %s", err)
+	}
+
+	exif := append([]byte("Exif\x00\x00"), orientationExif(6)...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	withExif := append(append(append([]byte{}, photo.Bytes()[:2]...), append(segment, exif...)...), photo.Bytes()[2:]...)
+
+	if orientation := exifOrientation(jpegExif(withExif)); orientation != 6 {
+		t.Fatalf("expected orientation 6, got %d", orientation)
+	}
+
+	processed, contentType, err := processTodoPhoto(withExif, 1600, 85)
+	if err != nil {
+		t.Fatalf("failed to process photo: %s", err)
+	}
+	if contentType != "image/jpeg" || jpegExif(processed) != nil {
+		t.Fatalf("expected JPEG without metadata, got %s", contentType)
+	}
+
+	result, err := jpeg.Decode(bytes.NewReader(processed))
+	if err != nil {
+		t.Fatalf("processed photo can't be decoded: %s", err)
+	}
+	if result.Bounds().Dx() != 800 || result.Bounds().Dy() != 1600 {
+		t.Fatalf("expected photo turned and shrunk to 800x1600, got %v", result.Bounds())
+	}
+	// Turned clockwise, so the red corner is now in the top right
+	if r, g, _, _ := result.At(700, 100).RGBA(); r < 0xE000 || g > 0x2000 {
+		t.Fatalf("photo was not turned clockwise")
+	}
+
+	// Images sent in TODO's JSON lose their metadata as well
+	processed, contentType, err = processTodoImage(
+		[]byte("data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString(withExif)), 1600, 85,
+	)
+	if err != nil || contentType != "image/jpeg" || jpegExif(processed) != nil {
+		t.Fatalf("expected image sent in JSON to become JPEG without metadata, got %s: %v", contentType, err)
+	}
+
+	var animation bytes.Buffer
+	err = gif.Encode(&animation, image.NewPaletted(image.Rect(0, 0, 10, 20), color.Palette{color.Transparent, color.Black}), nil)
+	if err != nil {
+		t.Fatalf("failed to encode test GIF: %s", err)
+	}
+	processed, contentType, err = processTodoPhoto(animation.Bytes(), 1600, 85)
+	if err != nil || contentType != "image/png" {
+		t.Fatalf("expected GIF to become PNG, got %s: %v", contentType, err)
+	}
+
+	_, _, err = processTodoPhoto([]byte("not a photo"), 1600, 85)
+	if err == nil {
+		t.Fatalf("expected garbage to be rejected")
+	}
+
+	// WebP keeps EXIF in its own chunk after the image
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8 \x03\x00\x00\x00abc\x00EXIF")
+	webp = binary.LittleEndian.AppendUint32(webp, uint32(len(orientationExif(3))))
+	webp = append(webp, orientationExif(3)...)
+	if orientation := exifOrientation(webpExif(webp)); orientation != 3 {
+		t.Fatalf("expected WebP orientation 3, got %d", orientation)
+	}
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		oriented := orient(image.NewRGBA(image.Rect(0, 0, 4, 2)), orientation)
+		width, height := 4, 2
+		if orientation >= 5 {
+			width, height = 2, 4
+		}
+		if oriented.Bounds().Dx() != width || oriented.Bounds().Dy() != height {
+			t.Errorf("orientation %d: expected %dx%d, got %v", orientation, width, height, oriented.Bounds())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/i18n"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	// Time zones are embedded so that they work on systems without zoneinfo installed
+	_ "time/tzdata"
+)
+
+// How dates and times are shown to a user
+type Locale struct {
+	Location   *time.Location
+	DateLayout string
+}
+
+// Returns date layout common for the language
+func dateLayoutOf(language i18n.Language) string {
+	switch language {
+	case i18n.RU:
+		return "02.01.2006"
+	default:
+		return time.DateOnly
+	}
+}
+
+// Returns language the user has chosen, English by default
+func userLanguage(user *db.User) i18n.Language {
+	if strings.ToUpper(user.Language) == string(i18n.RU) {
+		return i18n.RU
+	}
+
+	return i18n.ENG
+}
+
+// Returns locale of the user in given language
+func newLocale(user *db.User, language i18n.Language) Locale {
+	return Locale{
+		Location:   user.Location(),
+		DateLayout: dateLayoutOf(language),
+	}
+}
+
+// Returns locale of the user in given language. Zone of the server is used if user cannot be retrieved
+func (s *Server) userLocale(email string, language i18n.Language) Locale {
+	user, err := s.db.GetUser(email)
+	if err != nil {
+		return Locale{
+			Location:   time.Local,
+			DateLayout: dateLayoutOf(language),
+		}
+	}
+
+	return newLocale(user, language)
+}
+
+// Returns locale of the user who made the request
+func (s *Server) localeFromReq(req *http.Request) Locale {
+	return s.userLocale(GetEmailFromReq(req), LanguageFromReq(req))
+}
+
+// Formats dates of TODOs according to the locale
+func (l Locale) Localize(todos []*db.Todo) {
+	for _, todo := range todos {
+		todo.Localize(l.Location, l.DateLayout)
+	}
+}
+
+// Due date and time of the day as typed in by the user
+type dueInput struct {
+	// YYYY-MM-DD
+	DueDate *string `json:"dueDate"`
+	// HH:MM, empty for dates without time
+	DueTime string `json:"dueTime"`
+}
+
+/*
+Sets due date of the TODO from the date and time typed in by the user if they were sent in the body.
+Times are taken in given location, dates without time are kept as UTC midnight
+*/
+func applyDueInput(body []byte, todo *db.Todo, location *time.Location) error {
+	var input dueInput
+	err := json.Unmarshal(body, &input)
+	if err != nil || input.DueDate == nil {
+		return nil
+	}
+
+	if *input.DueDate == "" {
+		todo.DueUnix, todo.DueHasTime = 0, false
+		return nil
+	}
+
+	if input.DueTime == "" {
+		due, err := time.ParseInLocation(time.DateOnly, *input.DueDate, time.UTC)
+		if err != nil || due.Unix() < 0 {
+			return errors.New("due date must be in YYYY-MM-DD format")
+		}
+		todo.DueUnix, todo.DueHasTime = uint64(due.Unix()), false
+		return nil
+	}
+
+	due, err := time.ParseInLocation(time.DateOnly+" 15:04", *input.DueDate+" "+input.DueTime, location)
+	if err != nil || due.Unix() < 0 {
+		return errors.New("due date must be in YYYY-MM-DD format and time in HH:MM format")
+	}
+	todo.DueUnix, todo.DueHasTime = uint64(due.Unix()), true
+	return nil
+}
@@ -23,45 +23,89 @@ import (
 	"Unbewohnte/dela/email"
 	"Unbewohnte/dela/logger"
 	"fmt"
+	"html"
 	"time"
 )
 
+// Generates a new verification code for the user and queues an email with it
+func (s *Server) SendVerificationEmail(userEmail string) (*db.Verification, error) {
+	verification, err := GenerateVerificationCode(s.db, userEmail, 5, uint64(time.Hour.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.QueueEmail(
+		email.NewEmail(
+			s.config.Verification.Emailer.User,
+			"Dela: Email verification",
+			fmt.Sprintf("<p>Your email verification code is: <b>%s</b></p><p>Please, verify your email in %.1f hours. Your account will be deleted after some time without verified status.</p><p>This email was specified during Dela account creation. Ignore this message if it wasn't you.</p>", verification.Code, float32(verification.LifeSeconds)/3600),
+			[]string{userEmail},
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return verification, nil
+}
+
+// Sends the user a link to set a new password with
+func (s *Server) SendPasswordResetEmail(userEmail string, resetLink string) error {
+	return s.QueueEmail(
+		email.NewEmail(
+			s.config.Verification.Emailer.User,
+			"Dela: Password reset",
+			fmt.Sprintf(
+				"<p>An administrator allowed you to set a new password.</p><p><a href=\"%s\">Set a new password</a></p><p>The link works once and expires in %.0f hours. Your current password keeps working until then.</p>",
+				html.EscapeString(resetLink), float32(PasswordResetLifeSeconds)/3600,
+			),
+			[]string{userEmail},
+		),
+	)
+}
+
 type Notification struct {
 	UserEmail string
 	ToDo      db.Todo
 }
 
-func (s *Server) SendTODOSNotification(userEmail string, todos []*db.Todo) error {
-	var err error
+// Notifies the user on TODOs nearing their due date and on snoozed TODOs that have just shown up
+func (s *Server) SendTODOSNotification(userEmail string, todos []*db.Todo, started []*db.Todo) error {
+	var body string
 	switch len(todos) {
 	case 0:
-		err = nil
 
 	case 1:
-		err = s.emailer.SendEmail(
-			email.NewEmail(
-				s.config.Verification.Emailer.User,
-				"Dela: TODO Notification",
-				fmt.Sprintf("<p>Notifying you on your \"%s\" TODO.</p><p>Due date is %s</p>", todos[0].Text, todos[0].Due),
-				[]string{userEmail},
-			),
-		)
+		body = fmt.Sprintf("<p>Notifying you on your \"%s\" TODO.</p><p>Due date is %s</p>", html.EscapeString(todos[0].Text), html.EscapeString(todos[0].Due))
 
 	default:
-		err = s.emailer.SendEmail(
-			email.NewEmail(
-				s.config.Verification.Emailer.User,
-				"Dela: TODO Notification",
-				fmt.Sprintf("<p>Notifying you on your \"%s\" TODO.</p><p>Due date is %s</p><p>There are also %d other TODOs nearing Due date.</p>", todos[0].Text, todos[0].Due, len(todos)-1),
-				[]string{userEmail},
-			),
-		)
+		body = fmt.Sprintf("<p>Notifying you on your \"%s\" TODO.</p><p>Due date is %s</p><p>There are also %d other TODOs nearing Due date.</p>", html.EscapeString(todos[0].Text), html.EscapeString(todos[0].Due), len(todos)-1)
 	}
 
-	return err
+	if len(started) > 0 {
+		body += "<p>These TODOs are no longer snoozed:</p><ul>"
+		for _, todo := range started {
+			body += fmt.Sprintf("<li>%s</li>", html.EscapeString(todo.Text))
+		}
+		body += "</ul>"
+	}
+
+	if body == "" {
+		return nil
+	}
+
+	return s.QueueEmail(
+		email.NewEmail(
+			s.config.Verification.Emailer.User,
+			"Dela: TODO Notification",
+			body,
+			[]string{userEmail},
+		),
+	)
 }
 
-func (s *Server) NotifyUserOnTodos(userEmail string) error {
+// Notifies the user on TODOs due in a day and on TODOs which became visible in (startedSince, now]
+func (s *Server) NotifyUserOnTodos(userEmail string, startedSince time.Time, now time.Time) error {
 	user, err := s.db.GetUser(userEmail)
 	if err != nil {
 		return err
@@ -71,17 +115,25 @@ func (s *Server) NotifyUserOnTodos(userEmail string) error {
 		return nil
 	}
 
-	todosDue, err := s.db.GetUserTodosDue(userEmail, uint64(time.Duration(time.Hour*24).Seconds()))
+	locale := newLocale(user, userLanguage(user))
+	todosDue, err := s.db.GetUserTodosDue(userEmail, uint64(time.Duration(time.Hour*24).Seconds()), locale.Location)
 	if err != nil {
 		return err
 	}
+	locale.Localize(todosDue)
 
-	if len(todosDue) == 0 {
+	todosStarted, err := s.db.GetUserTodosStartedBetween(userEmail, uint64(startedSince.Unix()), uint64(now.Unix()))
+	if err != nil {
+		return err
+	}
+	locale.Localize(todosStarted)
+
+	if len(todosDue) == 0 && len(todosStarted) == 0 {
 		return nil
 	}
 
-	logger.Info("[Server][Notifications Routine] Notifying %s with %d TODOs...", userEmail, len(todosDue))
-	err = s.SendTODOSNotification(userEmail, todosDue)
+	logger.Info("[Server][Notifications Routine] Notifying %s with %d due and %d started TODOs...", userEmail, len(todosDue), len(todosStarted))
+	err = s.SendTODOSNotification(userEmail, todosDue, todosStarted)
 	if err != nil {
 		return err
 	}
@@ -93,7 +145,10 @@ func (s *Server) StartNotificationsRoutine(delay time.Duration) {
 	logger.Info("[Server][Notifications Routine] Notifications Routine Started!")
 
 	var failed bool = false
+	// TODOs that started before the routine did are not announced
+	lastRound := time.Now()
 	for {
+		now := time.Now()
 		logger.Info("[Server][Notifications Routine] Retrieving list of users to be notified...")
 		users, err := s.db.GetAllUsersWithNotificationsOn()
 		if err != nil {
@@ -103,7 +158,7 @@ func (s *Server) StartNotificationsRoutine(delay time.Duration) {
 
 		if !failed {
 			for _, user := range users {
-				err = s.NotifyUserOnTodos(user.Email)
+				err = s.NotifyUserOnTodos(user.Email, lastRound, now)
 				if err != nil {
 					logger.Error("[Server][Notifications routine] Failed to notify %s: %s", user.Email, err)
 					continue
@@ -111,6 +166,9 @@ func (s *Server) StartNotificationsRoutine(delay time.Duration) {
 			}
 		}
 
+		if !failed {
+			lastRound = now
+		}
 		failed = false
 		time.Sleep(delay)
 	}
@@ -0,0 +1,73 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"bytes"
+	"io"
+	"mime/quotedprintable"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTODOSNotificationEscapesText(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_notifications_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{
+		db:         dbase,
+		emailer:    email.NewEmailer(&testTransport{}, "dela@example.com"),
+		outboxWake: make(chan struct{}, 1),
+	}
+
+	due := &db.Todo{Text: `<a href="https://evil.com">Pay</a> bills`, Due: "2025-03-05"}
+	started := &db.Todo{Text: "<script>alert(1)</script>"}
+	for _, todos := range [][]*db.Todo{{due}, {due, due}} {
+		err = s.SendTODOSNotification("user1@mail.ru", todos, []*db.Todo{started})
+		if err != nil {
+			t.Fatalf("failed to send notification: %s", err)
+		}
+	}
+
+	emails, err := dbase.GetOutboxEmailsByStatus(db.OutboxPending)
+	if err != nil || len(emails) != 2 {
+		t.Fatalf("expected 2 notifications, got %d: %v", len(emails), err)
+	}
+	for _, notification := range emails {
+		message, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(notification.Message)))
+		if err != nil {
+			t.Fatalf("failed to decode email: %s", err)
+		}
+		if strings.Contains(string(message), "<a href") || strings.Contains(string(message), "<script>") {
+			t.Fatalf("expected TODO text to be escaped, got %s", message)
+		}
+		if !strings.Contains(string(message), "&lt;a href=&#34;https://evil.com&#34;&gt;Pay&lt;/a&gt; bills") {
+			t.Fatalf("expected escaped TODO text in the email, got %s", message)
+		}
+	}
+}
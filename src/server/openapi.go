@@ -0,0 +1,255 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the OpenAPI specification the document follows
+const OpenAPIVersion string = "3.0.3"
+
+// Path the schemas of named types are referenced by
+const openAPISchemasPath string = "#/components/schemas/"
+
+var (
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+/*
+Describes JSON form of the type as an OpenAPI schema. Named structures are put into
+schemas once and referenced by their name
+*/
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == rawJSONType:
+		return map[string]interface{}{}
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Sent in base64
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return openAPIObjectSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Reserve the name first, the type might refer to itself
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = openAPIObjectSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": openAPISchemasPath + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// Describes fields of the structure the way encoding/json marshals them
+func openAPIObjectSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	addOpenAPIProperties(t, properties, schemas)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func addOpenAPIProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			// Fields of embedded structures are marshalled as if they were declared here
+			addOpenAPIProperties(fieldType, properties, schemas)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = openAPISchema(field.Type, schemas)
+	}
+}
+
+// JSON body of a request or response of given type
+func openAPIContent(value interface{}, schemas map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": openAPISchema(reflect.TypeOf(value), schemas),
+		},
+	}
+}
+
+// Generates the OpenAPI document describing the versioned API
+func OpenAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	errorResponse := map[string]interface{}{
+		"description": "Error with a machine-readable code",
+		"content":     openAPIContent(APIErrorResponse{}, schemas),
+	}
+
+	for _, route := range apiV1Routes {
+		operation := map[string]interface{}{
+			"operationId": route.Name,
+			"summary":     route.Summary,
+		}
+		if route.Public {
+			operation["security"] = []interface{}{}
+		}
+
+		parameters := []interface{}{}
+		if strings.Contains(route.Path, "{id}") {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     "id",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0},
+			})
+		}
+		for _, name := range route.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name":   name,
+				"in":     "query",
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  openAPIContent(route.Request, schemas),
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{
+			"description": http.StatusText(status),
+		}
+		if route.Response != nil && status != http.StatusNoContent {
+			success["content"] = openAPIContent(route.Response, schemas)
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		pathItem, ok := paths[route.Path].(map[string]interface{})
+		if !ok {
+			pathItem = map[string]interface{}{}
+			paths[route.Path] = pathItem
+		}
+		pathItem[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "dela",
+			"description": "Web TODO list. Errors are sent as JSON with a machine-readable code",
+			"version":     "1",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": APIv1Prefix},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"basicAuth": []string{}},
+			map[string]interface{}{"cookieAuth": []string{}},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"basicAuth": map[string]interface{}{
+					"type":   "http",
+					"scheme": "basic",
+				},
+				"cookieAuth": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "auth",
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) apiV1OpenAPIGet(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	documentBytes, err := json.Marshal(OpenAPIDocument())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to marshal OpenAPI document")
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(documentBytes)
+}
@@ -0,0 +1,156 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"Unbewohnte/dela/logger"
+	"time"
+)
+
+const (
+	// How many times to try sending an email before giving up on it
+	OutboxMaxAttempts uint64 = 8
+	// Delay after the first failed attempt. Doubles with every next one
+	OutboxRetryBaseDelay time.Duration = time.Minute
+	OutboxRetryMaxDelay  time.Duration = time.Hour * 6
+	// How many emails a single recipient can get in an hour
+	OutboxRecipientHourlyLimit uint64 = 10
+	// How many emails are taken from the outbox at once
+	OutboxBatchSize uint64 = 50
+	// How long sent emails are kept
+	OutboxSentRetention time.Duration = time.Hour * 24 * 7
+)
+
+// Returns how long to wait before the next attempt after given number of failed ones
+func outboxRetryDelay(attempts uint64) time.Duration {
+	delay := OutboxRetryBaseDelay
+	for i := uint64(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= OutboxRetryMaxDelay {
+			return OutboxRetryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// Puts email into the outbox to be sent by the outbox routine
+func (s *Server) QueueEmail(mail email.Email) error {
+	message, err := mail.Build()
+	if err != nil {
+		return err
+	}
+
+	now := uint64(time.Now().Unix())
+	for _, recipient := range mail.Recipients() {
+		err = s.db.CreateOutboxEmail(db.OutboxEmail{
+			Sender:          s.emailer.From,
+			Recipient:       recipient,
+			Subject:         mail.Subject,
+			Message:         message,
+			Status:          db.OutboxPending,
+			NextAttemptUnix: now,
+			CreatedUnix:     now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Do not wait for the next round
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Tries to send a single email from the outbox, updating its status accordingly
+func (s *Server) sendOutboxEmail(outboxEmail *db.OutboxEmail, now time.Time) {
+	sentRecently, err := s.db.CountOutboxEmailsSentTo(outboxEmail.Recipient, uint64(now.Add(-time.Hour).Unix()))
+	if err != nil {
+		logger.Error("[Server][Outbox Routine] Failed to count emails sent to %s: %s", outboxEmail.Recipient, err)
+		return
+	}
+
+	if sentRecently >= OutboxRecipientHourlyLimit {
+		// Too many emails for this recipient, try later
+		err = s.db.OutboxEmailPostpone(outboxEmail.ID, uint64(now.Add(time.Minute*10).Unix()))
+		if err != nil {
+			logger.Error("[Server][Outbox Routine] Failed to postpone email %d: %s", outboxEmail.ID, err)
+		}
+		return
+	}
+
+	err = s.emailer.SendRaw([]string{outboxEmail.Recipient}, outboxEmail.Message)
+	if err == nil {
+		err = s.db.OutboxEmailSetSent(outboxEmail.ID, uint64(now.Unix()))
+		if err != nil {
+			logger.Error("[Server][Outbox Routine] Failed to mark email %d as sent: %s", outboxEmail.ID, err)
+		}
+		return
+	}
+
+	attempts := outboxEmail.Attempts + 1
+	if attempts >= OutboxMaxAttempts {
+		logger.Error("[Server][Outbox Routine] Giving up on email %d to %s after %d attempts: %s", outboxEmail.ID, outboxEmail.Recipient, attempts, err)
+		err = s.db.OutboxEmailSetFailed(outboxEmail.ID, db.OutboxDead, 0, err.Error())
+	} else {
+		logger.Warning("[Server][Outbox Routine] Failed to send email %d to %s (attempt %d): %s", outboxEmail.ID, outboxEmail.Recipient, attempts, err)
+		err = s.db.OutboxEmailSetFailed(
+			outboxEmail.ID,
+			db.OutboxPending,
+			uint64(now.Add(outboxRetryDelay(attempts)).Unix()),
+			err.Error(),
+		)
+	}
+	if err != nil {
+		logger.Error("[Server][Outbox Routine] Failed to save failed attempt of email %d: %s", outboxEmail.ID, err)
+	}
+}
+
+// Periodically sends emails waiting in the outbox
+func (s *Server) StartOutboxRoutine(delay time.Duration) {
+	logger.Info("[Server][Outbox Routine] Outbox Routine Started!")
+
+	for {
+		now := time.Now()
+		outboxEmails, err := s.db.GetDueOutboxEmails(uint64(now.Unix()), OutboxBatchSize)
+		if err != nil {
+			logger.Error("[Server][Outbox Routine] Failed to retrieve emails to send: %s", err)
+		}
+
+		for _, outboxEmail := range outboxEmails {
+			s.sendOutboxEmail(outboxEmail, now)
+		}
+
+		err = s.db.DeleteSentOutboxEmails(uint64(now.Add(-OutboxSentRetention).Unix()))
+		if err != nil {
+			logger.Error("[Server][Outbox Routine] Failed to clean up sent emails: %s", err)
+		}
+
+		select {
+		case <-s.outboxWake:
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,302 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/email"
+	"Unbewohnte/dela/misc"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	for _, testCase := range []struct {
+		Attempts uint64
+		Delay    time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, time.Minute * 2},
+		{3, time.Minute * 4},
+		{9, time.Minute * 256},
+		{10, OutboxRetryMaxDelay},
+		{1000, OutboxRetryMaxDelay},
+	} {
+		delay := outboxRetryDelay(testCase.Attempts)
+		if delay != testCase.Delay {
+			t.Errorf("expected %s after %d attempts, got %s", testCase.Delay, testCase.Attempts, delay)
+		}
+	}
+}
+
+// Sends nothing and fails if told to
+type testTransport struct {
+	fail bool
+	sent int
+}
+
+func (transport *testTransport) Send(from string, to []string, message []byte) error {
+	if transport.fail {
+		return errors.New("connection refused")
+	}
+	transport.sent++
+	return nil
+}
+
+func TestOutboxSending(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_outbox_sending_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+
+	transport := &testTransport{fail: true}
+	s := &Server{db: dbase, emailer: email.NewEmailer(transport, "dela@example.com")}
+
+	now := time.Unix(1000000, 0)
+	recipient := "user1@mail.ru"
+	err = dbase.CreateOutboxEmail(db.OutboxEmail{Recipient: recipient, Status: db.OutboxPending, NextAttemptUnix: uint64(now.Unix())})
+	if err != nil {
+		t.Fatalf("failed to create outbox email: %s", err)
+	}
+
+	// Every failure pushes the next attempt further until the email is given up on
+	for attempt := uint64(1); attempt <= OutboxMaxAttempts; attempt++ {
+		due, err := dbase.GetDueOutboxEmails(uint64(now.Unix()), OutboxBatchSize)
+		if err != nil || len(due) != 1 {
+			t.Fatalf("expected the email to be due on attempt %d, got %v: %v", attempt, due, err)
+		}
+		s.sendOutboxEmail(due[0], now)
+
+		outboxEmail, err := dbase.GetOutboxEmail(due[0].ID)
+		if err != nil {
+			t.Fatalf("failed to get outbox email: %s", err)
+		}
+		if outboxEmail.Attempts != attempt || outboxEmail.LastError == "" {
+			t.Fatalf("expected failed attempt %d to be recorded, got %+v", attempt, outboxEmail)
+		}
+
+		if attempt == OutboxMaxAttempts {
+			if outboxEmail.Status != db.OutboxDead {
+				t.Fatalf("expected the email to be given up on after %d attempts, got %+v", attempt, outboxEmail)
+			}
+			break
+		}
+		nextAttempt := now.Add(outboxRetryDelay(attempt))
+		if outboxEmail.Status != db.OutboxPending || outboxEmail.NextAttemptUnix != uint64(nextAttempt.Unix()) {
+			t.Fatalf("expected attempt %d to be retried at %d, got %+v", attempt, nextAttempt.Unix(), outboxEmail)
+		}
+		now = nextAttempt
+	}
+
+	due, err := dbase.GetDueOutboxEmails(uint64(now.Add(OutboxRetryMaxDelay).Unix()), OutboxBatchSize)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("expected dead emails to never be due, got %v: %v", due, err)
+	}
+
+	// Recipients get a limited number of emails per hour, the rest wait without counting as failures
+	transport.fail = false
+	for i := uint64(0); i <= OutboxRecipientHourlyLimit; i++ {
+		err = dbase.CreateOutboxEmail(db.OutboxEmail{Recipient: recipient, Status: db.OutboxPending, NextAttemptUnix: uint64(now.Unix())})
+		if err != nil {
+			t.Fatalf("failed to create outbox email: %s", err)
+		}
+	}
+	due, err = dbase.GetDueOutboxEmails(uint64(now.Unix()), OutboxBatchSize)
+	if err != nil {
+		t.Fatalf("failed to get due emails: %s", err)
+	}
+	for _, outboxEmail := range due {
+		s.sendOutboxEmail(outboxEmail, now)
+	}
+	if transport.sent != int(OutboxRecipientHourlyLimit) {
+		t.Fatalf("expected %d emails to be sent, got %d", OutboxRecipientHourlyLimit, transport.sent)
+	}
+
+	postponed, err := dbase.GetOutboxEmail(due[len(due)-1].ID)
+	if err != nil {
+		t.Fatalf("failed to get outbox email: %s", err)
+	}
+	if postponed.Status != db.OutboxPending || postponed.Attempts != 0 || postponed.NextAttemptUnix <= uint64(now.Unix()) {
+		t.Fatalf("expected the email over the limit to be postponed, got %+v", postponed)
+	}
+}
+
+func TestUserCreateWithoutSMTP(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_outbox_register_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+
+	transport := &testTransport{fail: true}
+	s := &Server{
+		db:         dbase,
+		emailer:    email.NewEmailer(transport, "dela@example.com"),
+		outboxWake: make(chan struct{}, 1),
+	}
+	s.config.Verification.VerifyEmails = true
+
+	// Registration does not wait for the SMTP server
+	recipient := "user1@mail.ru"
+	body, _ := json.Marshal(db.User{Email: recipient, Password: misc.HashPassword("ruohguoeruoger")})
+	recorder := httptest.NewRecorder()
+	s.EndpointUserCreate(recorder, httptest.NewRequest(http.MethodPost, "/api/user/create", bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected registration to succeed while SMTP is down, got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if transport.sent != 0 {
+		t.Fatalf("expected nothing to be sent during the request, got %d emails", transport.sent)
+	}
+
+	pending, err := dbase.GetOutboxEmailsByStatus(db.OutboxPending)
+	if err != nil || len(pending) != 1 || pending[0].Recipient != recipient {
+		t.Fatalf("expected a verification email to %s to be queued, got %+v: %v", recipient, pending, err)
+	}
+
+	// Sent once the SMTP server is back
+	s.sendOutboxEmail(pending[0], time.Now())
+	transport.fail = false
+	s.sendOutboxEmail(pending[0], time.Now())
+	sent, err := dbase.GetOutboxEmail(pending[0].ID)
+	if err != nil || sent.Status != db.OutboxSent || transport.sent != 1 {
+		t.Fatalf("expected the verification email to be sent after a retry, got %+v: %v", sent, err)
+	}
+}
+
+func TestOutboxAdminEndpoints(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_outbox_admin_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase, outboxWake: make(chan struct{}, 1)}
+
+	admin := "admin@mail.ru"
+	user := "user1@mail.ru"
+	password := misc.HashPassword("ruohguoeruoger")
+	for _, userEmail := range []string{admin, user} {
+		err = dbase.CreateUser(db.User{Email: userEmail, Password: password})
+		if err != nil {
+			t.Fatalf("failed to create user: %s", err)
+		}
+		err = dbase.UserSetEmailConfirmed(userEmail)
+		if err != nil {
+			t.Fatalf("failed to confirm email: %s", err)
+		}
+	}
+	err = dbase.UserSetRole(admin, db.RoleAdmin)
+	if err != nil {
+		t.Fatalf("failed to grant admin rights: %s", err)
+	}
+
+	for _, status := range []string{db.OutboxDead, db.OutboxDead, db.OutboxPending} {
+		err = dbase.CreateOutboxEmail(db.OutboxEmail{Recipient: user, Status: status, Attempts: OutboxMaxAttempts, LastError: "connection refused"})
+		if err != nil {
+			t.Fatalf("failed to create outbox email: %s", err)
+		}
+	}
+
+	request := func(endpoint http.HandlerFunc, method string, target string, asEmail string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth(asEmail, password)
+		recorder := httptest.NewRecorder()
+		endpoint(recorder, req)
+		return recorder
+	}
+	getDead := func() []*db.OutboxEmail {
+		recorder := request(s.EndpointAdminOutboxGet, http.MethodGet, "/api/admin/outbox/get", admin)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("failed to get outbox: status %d", recorder.Code)
+		}
+		var outboxEmails []*db.OutboxEmail
+		err := json.Unmarshal(recorder.Body.Bytes(), &outboxEmails)
+		if err != nil {
+			t.Fatalf("failed to unmarshal outbox emails: %s", err)
+		}
+		return outboxEmails
+	}
+
+	// Only admins see and manage the outbox
+	for _, testCase := range []struct {
+		Endpoint http.HandlerFunc
+		Method   string
+		Target   string
+	}{
+		{s.EndpointAdminOutboxGet, http.MethodGet, "/api/admin/outbox/get"},
+		{s.EndpointAdminOutboxRetry, http.MethodPost, "/api/admin/outbox/retry/1"},
+		{s.EndpointAdminOutboxDelete, http.MethodPost, "/api/admin/outbox/delete/1"},
+	} {
+		if recorder := request(testCase.Endpoint, testCase.Method, testCase.Target, user); recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected non-admin to be forbidden from %s, got status %d", testCase.Target, recorder.Code)
+		}
+	}
+
+	// Failed emails are listed by default
+	dead := getDead()
+	if len(dead) != 2 || dead[0].LastError == "" {
+		t.Fatalf("expected 2 failed emails, got %+v", dead)
+	}
+
+	recorder := request(s.EndpointAdminOutboxRetry, http.MethodPost, fmt.Sprintf("/api/admin/outbox/retry/%d", dead[0].ID), admin)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("failed to retry email: status %d", recorder.Code)
+	}
+	retried, err := dbase.GetOutboxEmail(dead[0].ID)
+	if err != nil || retried.Status != db.OutboxPending || retried.Attempts != 0 {
+		t.Fatalf("expected the email to be pending again with no attempts, got %+v: %v", retried, err)
+	}
+
+	recorder = request(s.EndpointAdminOutboxDelete, http.MethodPost, fmt.Sprintf("/api/admin/outbox/delete/%d", dead[1].ID), admin)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("failed to delete email: status %d", recorder.Code)
+	}
+	if _, err := dbase.GetOutboxEmail(dead[1].ID); err == nil {
+		t.Fatalf("expected the email to be deleted")
+	}
+
+	if dead = getDead(); len(dead) != 0 {
+		t.Fatalf("expected no failed emails left, got %+v", dead)
+	}
+
+	if recorder := request(s.EndpointAdminOutboxRetry, http.MethodPost, "/api/admin/outbox/retry/1000", admin); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected retry of an unknown email to be not found, got status %d", recorder.Code)
+	}
+	if recorder := request(s.EndpointAdminOutboxDelete, http.MethodPost, "/api/admin/outbox/delete/1000", admin); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected deletion of an unknown email to be not found, got status %d", recorder.Code)
+	}
+}
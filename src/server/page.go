@@ -22,6 +22,7 @@ import (
 	"Unbewohnte/dela/db"
 	"Unbewohnte/dela/i18n"
 	"path/filepath"
+	"time"
 )
 
 type PageData struct {
@@ -74,9 +75,13 @@ type CategoryPageData struct {
 	Groups         []*db.TodoGroup `json:"groups"`
 	CurrentGroupId uint64          `json:"currentGroupId"`
 	Todos          []*db.Todo      `json:"todos"`
+	// TODOs hidden until their start time
+	Deferred []*db.Todo `json:"deferred"`
+	// Zone due times are typed in
+	Timezone string `json:"timezone"`
 }
 
-func GetCategoryPageData(db *db.DB, login string, groupId uint64) (*CategoryPageData, error) {
+func GetCategoryPageData(db *db.DB, login string, groupId uint64, locale Locale) (*CategoryPageData, error) {
 	groups, err := db.GetAllUserTodoGroups(login)
 	if err != nil {
 		return nil, err
@@ -87,9 +92,214 @@ func GetCategoryPageData(db *db.DB, login string, groupId uint64) (*CategoryPage
 		return nil, err
 	}
 
+	// Images are loaded by the page separately
+	for _, todo := range todos {
+		todo.Image = nil
+	}
+	locale.Localize(todos)
+	todos, deferred := splitDeferred(todos, time.Now())
+
 	return &CategoryPageData{
 		Groups:         groups,
 		CurrentGroupId: groupId,
 		Todos:          todos,
+		Deferred:       deferred,
+		Timezone:       locale.Location.String(),
+	}, nil
+}
+
+type ProfilePageData struct {
+	*db.User
+	AuditEvents []*db.AuditEvent `json:"auditEvents"`
+}
+
+func GetProfilePageData(db *db.DB, login string) (*ProfilePageData, error) {
+	user, err := db.GetUser(login)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = "" // No passwords sent
+
+	auditEvents, err := db.GetUserAuditEvents(login, ProfileAuditEventsCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProfilePageData{
+		User:        user,
+		AuditEvents: auditEvents,
+	}, nil
+}
+
+type AuditPageData struct {
+	Events   []*db.AuditEvent `json:"events"`
+	Page     uint64           `json:"page"`
+	NextPage uint64           `json:"nextPage"`
+	PrevPage uint64           `json:"prevPage"`
+}
+
+type TrashPageData struct {
+	Groups []*db.TodoGroup `json:"groups"`
+	Todos  []*db.Todo      `json:"todos"`
+	// Names of groups deleted TODOs belong to
+	GroupNames    map[uint64]string `json:"groupNames"`
+	RetentionDays uint              `json:"retentionDays"`
+}
+
+func GetTrashPageData(db *db.DB, login string, retentionDays uint, locale Locale) (*TrashPageData, error) {
+	groups, err := db.GetDeletedUserTodoGroups(login)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := db.GetDeletedUserTodos(login)
+	if err != nil {
+		return nil, err
+	}
+
+	aliveGroups, err := db.GetAllUserTodoGroups(login)
+	if err != nil {
+		return nil, err
+	}
+
+	groupNames := make(map[uint64]string)
+	for _, group := range append(aliveGroups, groups...) {
+		groupNames[group.ID] = group.Name
+	}
+
+	// Binary data is not shown in the trash
+	for _, todo := range todos {
+		todo.Image = nil
+		todo.File = nil
+	}
+	locale.Localize(todos)
+
+	return &TrashPageData{
+		Groups:        groups,
+		Todos:         todos,
+		GroupNames:    groupNames,
+		RetentionDays: retentionDays,
+	}, nil
+}
+
+type ArchivePageData struct {
+	Todos      []*db.Todo        `json:"todos"`
+	GroupNames map[uint64]string `json:"groupNames"`
+	Filter     ArchiveFilter     `json:"filter"`
+}
+
+func GetArchivePageData(db *db.DB, login string, filter ArchiveFilter, locale Locale) (*ArchivePageData, error) {
+	todos, err := db.SearchArchivedUserTodos(login, filter.Text, filter.fromUnix, filter.toUnix)
+	if err != nil {
+		return nil, err
+	}
+	locale.Localize(todos)
+
+	groups, err := db.GetAllUserTodoGroups(login)
+	if err != nil {
+		return nil, err
+	}
+
+	groupNames := make(map[uint64]string)
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	return &ArchivePageData{
+		Todos:      todos,
+		GroupNames: groupNames,
+		Filter:     filter,
+	}, nil
+}
+
+type CalendarPageData struct {
+	View string `json:"view"`
+	// The date the calendar was opened on
+	Date  string `json:"date"`
+	Year  int    `json:"year"`
+	Month int    `json:"month"`
+	// First and last days shown
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Dates to open previous and next periods with
+	Prev       string            `json:"prev"`
+	Next       string            `json:"next"`
+	Weeks      [][]*CalendarDay  `json:"weeks"`
+	GroupNames map[uint64]string `json:"groupNames"`
+}
+
+// Dates are expected to be in the location of the user
+func GetCalendarPageData(db *db.DB, login string, view string, date time.Time, now time.Time, locale Locale) (*CalendarPageData, error) {
+	start, end, prev, next := calendarBounds(view, date)
+
+	todos, err := db.GetUserTodosScheduledBetween(login, uint64(start.Unix()), uint64(end.Unix()), locale.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := db.GetAllUserTodoGroups(login)
+	if err != nil {
+		return nil, err
+	}
+
+	groupNames := make(map[uint64]string)
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+	}
+
+	// Binary data is not shown on the calendar
+	for _, todo := range todos {
+		todo.Image = nil
+		todo.File = nil
+	}
+	locale.Localize(todos)
+
+	return &CalendarPageData{
+		View:       view,
+		Date:       date.Format(time.DateOnly),
+		Year:       date.Year(),
+		Month:      int(date.Month()),
+		From:       start.Format(time.DateOnly),
+		To:         end.AddDate(0, 0, -1).Format(time.DateOnly),
+		Prev:       prev.Format(time.DateOnly),
+		Next:       next.Format(time.DateOnly),
+		Weeks:      calendarWeeks(todos, start, end, date.Month(), view, now),
+		GroupNames: groupNames,
+	}, nil
+}
+
+type BoardPageData struct {
+	Group   *db.TodoGroup       `json:"group"`
+	Columns []*BoardColumnTodos `json:"columns"`
+}
+
+func GetBoardPageData(db *db.DB, groupID uint64, locale Locale) (*BoardPageData, error) {
+	group, err := db.GetTodoGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := db.GetGroupBoardColumns(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := db.GetGroupTodos(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cards do not show attachments
+	for _, todo := range todos {
+		todo.Image = nil
+		todo.File = nil
+	}
+	locale.Localize(todos)
+	// Snoozed TODOs are not put on the board until they start
+	todos, _ = splitDeferred(todos, time.Now())
+
+	return &BoardPageData{
+		Group:   group,
+		Columns: placeOnBoard(columns, todos),
 	}, nil
 }
@@ -0,0 +1,663 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TODO typed in a single line, split into its parts
+type QuickAdd struct {
+	Text string `json:"text"`
+	// Name of the group given after #. Empty if none was given
+	GroupName     string `json:"groupName"`
+	GroupID       uint64 `json:"groupId"`
+	Priority      uint64 `json:"priority"`
+	DueUnix       uint64 `json:"dueUnix"`
+	DueHasTime    bool   `json:"dueHasTime"`
+	Due           string `json:"due"`
+	RecurUnit     string `json:"recurUnit"`
+	RecurInterval uint64 `json:"recurInterval"`
+	// Parts of the input that were understood, in order
+	Recognized []string `json:"recognized"`
+}
+
+// Returns a TODO made of the parsed parts
+func (q *QuickAdd) Todo() db.Todo {
+	return db.Todo{
+		Text:          q.Text,
+		GroupID:       q.GroupID,
+		Priority:      q.Priority,
+		DueUnix:       q.DueUnix,
+		DueHasTime:    q.DueHasTime,
+		RecurUnit:     q.RecurUnit,
+		RecurInterval: q.RecurInterval,
+	}
+}
+
+var (
+	quickAddTimeRegexp    = regexp.MustCompile(`^(\d{1,2})(?:[:.](\d{2}))?(am|pm|a\.m\.|p\.m\.)?$`)
+	quickAddISODateRegexp = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	quickAddDotDateRegexp = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{4}))?$`)
+	quickAddOrdinalRegexp = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th|-го|го|-е|-ое)?$`)
+)
+
+// Words that may come before dates and times and are dropped together with them
+var quickAddPrepositions = map[string]bool{
+	"on": true, "at": true, "by": true, "the": true, "due": true,
+	"в": true, "во": true, "к": true, "до": true, "на": true,
+}
+
+// Prepositions after which plain numbers are hours
+var quickAddTimePrepositions = map[string]bool{
+	"at": true, "by": true, "в": true, "к": true, "до": true,
+}
+
+var quickAddRelativeDays = map[string]int{
+	"today": 0, "tonight": 0, "tomorrow": 1, "tmr": 1,
+	"сегодня": 0, "завтра": 1, "послезавтра": 2,
+}
+
+var quickAddWeekdays = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday":    time.Saturday,
+	"sunday":      time.Sunday,
+	"понедельник": time.Monday, "пн": time.Monday,
+	"вторник": time.Tuesday, "вт": time.Tuesday,
+	"среда": time.Wednesday, "среду": time.Wednesday, "ср": time.Wednesday,
+	"четверг": time.Thursday, "чт": time.Thursday,
+	"пятница": time.Friday, "пятницу": time.Friday, "пт": time.Friday,
+	"суббота": time.Saturday, "субботу": time.Saturday, "сб": time.Saturday,
+	"воскресенье": time.Sunday, "вс": time.Sunday,
+}
+
+var quickAddMonths = map[string]time.Month{
+	"january": time.January, "jan": time.January, "января": time.January, "январь": time.January,
+	"february": time.February, "feb": time.February, "февраля": time.February, "февраль": time.February,
+	"march": time.March, "mar": time.March, "марта": time.March, "март": time.March,
+	"april": time.April, "apr": time.April, "апреля": time.April, "апрель": time.April,
+	"may": time.May, "мая": time.May, "май": time.May,
+	"june": time.June, "jun": time.June, "июня": time.June, "июнь": time.June,
+	"july": time.July, "jul": time.July, "июля": time.July, "июль": time.July,
+	"august": time.August, "aug": time.August, "августа": time.August, "август": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September, "сентября": time.September, "сентябрь": time.September,
+	"october": time.October, "oct": time.October, "октября": time.October, "октябрь": time.October,
+	"november": time.November, "nov": time.November, "ноября": time.November, "ноябрь": time.November,
+	"december": time.December, "dec": time.December, "декабря": time.December, "декабрь": time.December,
+}
+
+// Units of "every ..." and "in ..." expressions
+var quickAddUnits = map[string]string{
+	"day": db.RecurDay, "days": db.RecurDay,
+	"week": db.RecurWeek, "weeks": db.RecurWeek,
+	"month": db.RecurMonth, "months": db.RecurMonth,
+	"year": db.RecurYear, "years": db.RecurYear,
+	"день": db.RecurDay, "дня": db.RecurDay, "дней": db.RecurDay,
+	"неделю": db.RecurWeek, "недели": db.RecurWeek, "недель": db.RecurWeek, "неделя": db.RecurWeek,
+	"месяц": db.RecurMonth, "месяца": db.RecurMonth, "месяцев": db.RecurMonth,
+	"год": db.RecurYear, "года": db.RecurYear, "лет": db.RecurYear,
+}
+
+// Words starting recurrence, like "every week"
+var quickAddEvery = map[string]bool{
+	"every": true, "each": true,
+	"каждый": true, "каждую": true, "каждое": true, "каждые": true, "каждой": true,
+}
+
+// Single words meaning recurrence with interval of 1
+var quickAddRecurWords = map[string]string{
+	"daily": db.RecurDay, "weekly": db.RecurWeek, "monthly": db.RecurMonth, "yearly": db.RecurYear, "annually": db.RecurYear,
+	"ежедневно": db.RecurDay, "еженедельно": db.RecurWeek, "ежемесячно": db.RecurMonth, "ежегодно": db.RecurYear,
+}
+
+var quickAddPriorities = map[string]uint64{
+	"!": db.PriorityLow, "!1": db.PriorityLow, "!low": db.PriorityLow, "!l": db.PriorityLow, "!низкий": db.PriorityLow,
+	"!!": db.PriorityMedium, "!2": db.PriorityMedium, "!medium": db.PriorityMedium, "!med": db.PriorityMedium, "!m": db.PriorityMedium, "!средний": db.PriorityMedium,
+	"!!!": db.PriorityHigh, "!3": db.PriorityHigh, "!high": db.PriorityHigh, "!h": db.PriorityHigh, "!urgent": db.PriorityHigh,
+	"!высокий": db.PriorityHigh, "!важно": db.PriorityHigh, "!срочно": db.PriorityHigh,
+}
+
+// Words after the hour telling the part of the day
+var quickAddDayParts = map[string]bool{
+	"am": false, "a.m.": false, "утра": false, "ночи": false,
+	"pm": true, "p.m.": true, "дня": true, "вечера": true,
+}
+
+type quickAddParser struct {
+	words []string
+	lower []string
+	now   time.Time
+	used  []bool
+
+	result   QuickAdd
+	date     time.Time
+	hasDate  bool
+	hour     int
+	minute   int
+	hasTime  bool
+	monthDay int
+	// Words of the day of the month and its index in recognized parts
+	monthDayFrom       int
+	monthDayTo         int
+	monthDayRecognized int
+	weekday            time.Weekday
+	// Weekday of "every monday" kind of recurrence
+	hasWeekday bool
+}
+
+/*
+Parses a TODO typed in a single line in English or Russian, for example
+"Pay rent every month on the 1st #Finance !high at 9am".
+Recognizes #group, !priority, due dates and times and recurrence, the rest of the words
+become the text. now is expected to be in user's zone
+*/
+func ParseQuickAdd(input string, now time.Time) *QuickAdd {
+	parser := quickAddParser{
+		words: strings.Fields(input),
+		now:   now,
+	}
+	parser.used = make([]bool, len(parser.words))
+	for _, word := range parser.words {
+		parser.lower = append(parser.lower, strings.TrimRight(strings.ToLower(word), ",;"))
+	}
+
+	matchers := []func(int) int{
+		parser.matchGroup,
+		parser.matchPriority,
+		parser.matchRecurrence,
+		parser.matchWhen,
+	}
+	for i := 0; i < len(parser.words); {
+		consumed := 0
+		for _, matcher := range matchers {
+			consumed = matcher(i)
+			if consumed > 0 {
+				break
+			}
+		}
+
+		if consumed == 0 {
+			i++
+			continue
+		}
+
+		parser.result.Recognized = append(parser.result.Recognized, strings.Join(parser.words[i:i+consumed], " "))
+		for j := i; j < i+consumed; j++ {
+			parser.used[j] = true
+		}
+		i += consumed
+	}
+	parser.keepUnusedMonthDay()
+
+	var text []string
+	for i, word := range parser.words {
+		if !parser.used[i] {
+			text = append(text, word)
+		}
+	}
+	parser.result.Text = strings.Join(text, " ")
+	parser.resolveDue()
+
+	return &parser.result
+}
+
+// Returns lowercase word at i or an empty string if there is none
+func (p *quickAddParser) word(i int) string {
+	if i < 0 || i >= len(p.lower) {
+		return ""
+	}
+
+	return p.lower[i]
+}
+
+// #Group. Underscores stand for spaces
+func (p *quickAddParser) matchGroup(i int) int {
+	word := strings.TrimRight(p.words[i], ",;")
+	if !strings.HasPrefix(word, "#") || len(word) < 2 {
+		return 0
+	}
+
+	p.result.GroupName = strings.ReplaceAll(word[1:], "_", " ")
+	return 1
+}
+
+// !high, !2, !!! and so on
+func (p *quickAddParser) matchPriority(i int) int {
+	priority, ok := quickAddPriorities[p.word(i)]
+	if !ok {
+		return 0
+	}
+
+	p.result.Priority = priority
+	return 1
+}
+
+// Reads a number or words meaning one or two at i. Returns the number and how many words it took
+func (p *quickAddParser) count(i int) (int, int) {
+	switch p.word(i) {
+	case "a", "an", "one":
+		return 1, 1
+	case "other", "second", "two":
+		return 2, 1
+	}
+
+	number, err := strconv.Atoi(p.word(i))
+	if err != nil || number <= 0 {
+		return 0, 0
+	}
+
+	return number, 1
+}
+
+// every 2 weeks, every monday, daily, каждый месяц...
+func (p *quickAddParser) matchRecurrence(i int) int {
+	if unit, ok := quickAddRecurWords[p.word(i)]; ok {
+		p.result.RecurUnit = unit
+		p.result.RecurInterval = 1
+		return 1
+	}
+
+	if !quickAddEvery[p.word(i)] {
+		return 0
+	}
+
+	if weekday, ok := quickAddWeekdays[p.word(i+1)]; ok {
+		p.result.RecurUnit = db.RecurWeek
+		p.result.RecurInterval = 1
+		p.weekday = weekday
+		p.hasWeekday = true
+		return 2
+	}
+
+	interval, taken := p.count(i + 1)
+	if taken == 0 {
+		interval = 1
+	}
+	unit, ok := quickAddUnits[p.word(i+1+taken)]
+	if !ok || uint64(interval) > MaxTodoRecurInterval {
+		return 0
+	}
+
+	p.result.RecurUnit = unit
+	p.result.RecurInterval = uint64(interval)
+	return 2 + taken
+}
+
+// Dates and times, possibly after prepositions like "on the" or "в"
+func (p *quickAddParser) matchWhen(i int) int {
+	skipped := 0
+	for skipped < 2 && quickAddPrepositions[p.word(i+skipped)] {
+		skipped++
+	}
+
+	preposition := ""
+	if skipped > 0 {
+		preposition = p.word(i + skipped - 1)
+	}
+
+	for _, matcher := range []func(int, string) int{
+		p.matchRelativeDay,
+		p.matchIn,
+		p.matchWeekday,
+		p.matchDate,
+		p.matchMonthDay,
+		p.matchTime,
+	} {
+		consumed := matcher(i+skipped, preposition)
+		if consumed > 0 {
+			if p.monthDay != 0 && p.monthDayTo == 0 {
+				p.monthDayFrom, p.monthDayTo = i, i+skipped+consumed
+				p.monthDayRecognized = len(p.result.Recognized)
+			}
+			return skipped + consumed
+		}
+	}
+
+	return 0
+}
+
+func (p *quickAddParser) setDate(date time.Time) {
+	p.date = startOfDay(date)
+	p.hasDate = true
+}
+
+// today, tomorrow, day after tomorrow, послезавтра...
+func (p *quickAddParser) matchRelativeDay(i int, _ string) int {
+	if p.word(i) == "day" && p.word(i+1) == "after" && p.word(i+2) == "tomorrow" {
+		p.setDate(p.now.AddDate(0, 0, 2))
+		return 3
+	}
+
+	days, ok := quickAddRelativeDays[p.word(i)]
+	if !ok {
+		return 0
+	}
+
+	p.setDate(p.now.AddDate(0, 0, days))
+	return 1
+}
+
+// in 3 days, in a week, in 2 hours, через неделю...
+func (p *quickAddParser) matchIn(i int, _ string) int {
+	if p.word(i) != "in" && p.word(i) != "через" {
+		return 0
+	}
+
+	number, taken := p.count(i + 1)
+	if taken == 0 {
+		// "через неделю" has no number
+		number = 1
+	}
+
+	unitWord := p.word(i + 1 + taken)
+	switch unitWord {
+	case "hour", "hours", "час", "часа", "часов":
+		due := p.now.Add(time.Duration(number) * time.Hour)
+		p.setDate(due)
+		p.hour, p.minute, p.hasTime = due.Hour(), due.Minute(), true
+		return 2 + taken
+	}
+
+	unit, ok := quickAddUnits[unitWord]
+	if !ok || number > 3650 {
+		return 0
+	}
+
+	switch unit {
+	case db.RecurDay:
+		p.setDate(p.now.AddDate(0, 0, number))
+	case db.RecurWeek:
+		p.setDate(p.now.AddDate(0, 0, 7*number))
+	case db.RecurMonth:
+		p.setDate(p.now.AddDate(0, number, 0))
+	case db.RecurYear:
+		p.setDate(p.now.AddDate(number, 0, 0))
+	}
+
+	return 2 + taken
+}
+
+// Returns the closest day after today that is the weekday
+func nextWeekday(now time.Time, weekday time.Weekday) time.Time {
+	days := (int(weekday) - int(now.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+
+	return now.AddDate(0, 0, days)
+}
+
+// monday, next friday, next week, в пятницу...
+func (p *quickAddParser) matchWeekday(i int, _ string) int {
+	skipped := 0
+	if p.word(i) == "next" || p.word(i) == "следующий" || p.word(i) == "следующую" || p.word(i) == "следующее" {
+		skipped = 1
+	}
+
+	if skipped == 1 && (p.word(i+1) == "week" || p.word(i+1) == "неделе") {
+		p.setDate(startOfWeek(p.now).AddDate(0, 0, 7))
+		return 2
+	}
+
+	weekday, ok := quickAddWeekdays[p.word(i+skipped)]
+	if !ok {
+		return 0
+	}
+
+	p.setDate(nextWeekday(p.now, weekday))
+	return 1 + skipped
+}
+
+// Returns the date or the same date of the next year if it has already passed. ok is false for dates that do not exist
+func (p *quickAddParser) upcomingDate(year int, month time.Month, day int) (time.Time, bool) {
+	yearGiven := year != 0
+	if !yearGiven {
+		year = p.now.Year()
+	}
+
+	date := time.Date(year, month, day, 0, 0, 0, 0, p.now.Location())
+	if date.Day() != day || date.Month() != month {
+		return time.Time{}, false
+	}
+
+	if !yearGiven && date.Before(startOfDay(p.now)) {
+		date = date.AddDate(1, 0, 0)
+	}
+
+	return date, true
+}
+
+// 2025-03-10, 10.03.2025, 10.03, march 10, 10 марта...
+func (p *quickAddParser) matchDate(i int, _ string) int {
+	if match := quickAddISODateRegexp.FindStringSubmatch(p.word(i)); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		day, _ := strconv.Atoi(match[3])
+		date, ok := p.upcomingDate(year, time.Month(month), day)
+		if !ok {
+			return 0
+		}
+		p.setDate(date)
+		return 1
+	}
+
+	if match := quickAddDotDateRegexp.FindStringSubmatch(p.word(i)); match != nil {
+		day, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		year, _ := strconv.Atoi(match[3])
+		date, ok := p.upcomingDate(year, time.Month(month), day)
+		if !ok {
+			return 0
+		}
+		p.setDate(date)
+		return 1
+	}
+
+	// Day and month name in any order, optionally followed by the year
+	var day int
+	var month time.Month
+	if match := quickAddOrdinalRegexp.FindStringSubmatch(p.word(i)); match != nil {
+		monthName, ok := quickAddMonths[p.word(i+1)]
+		if !ok {
+			return 0
+		}
+		day, _ = strconv.Atoi(match[1])
+		month = monthName
+	} else if monthName, ok := quickAddMonths[p.word(i)]; ok {
+		match := quickAddOrdinalRegexp.FindStringSubmatch(p.word(i + 1))
+		if match == nil {
+			return 0
+		}
+		day, _ = strconv.Atoi(match[1])
+		month = monthName
+	} else {
+		return 0
+	}
+
+	consumed := 2
+	year := 0
+	if len(p.word(i+2)) == 4 {
+		parsedYear, err := strconv.Atoi(p.word(i + 2))
+		if err == nil {
+			year = parsedYear
+			consumed++
+		}
+	}
+
+	date, ok := p.upcomingDate(year, month, day)
+	if !ok {
+		return 0
+	}
+	p.setDate(date)
+
+	return consumed
+}
+
+// The 1st, on the 15, 1-го числа
+func (p *quickAddParser) matchMonthDay(i int, preposition string) int {
+	match := quickAddOrdinalRegexp.FindStringSubmatch(p.word(i))
+	if match == nil {
+		return 0
+	}
+
+	// Plain numbers are days only in "on the 15" or "15 числа", "at 9" is a time
+	if match[0] == match[1] && preposition != "the" && preposition != "on" && p.word(i+1) != "числа" {
+		return 0
+	}
+
+	day, _ := strconv.Atoi(match[1])
+	if day < 1 || day > 31 {
+		return 0
+	}
+	p.monthDay = day
+
+	if p.word(i+1) == "числа" {
+		return 2
+	}
+
+	return 1
+}
+
+/*
+The day of the month is not kept with the TODO, so it means nothing next to an exact date.
+It is left in the text instead of silently disappearing
+*/
+func (p *quickAddParser) keepUnusedMonthDay() {
+	if p.monthDay == 0 || !p.hasDate {
+		return
+	}
+
+	for j := p.monthDayFrom; j < p.monthDayTo; j++ {
+		p.used[j] = false
+	}
+	p.result.Recognized = append(p.result.Recognized[:p.monthDayRecognized], p.result.Recognized[p.monthDayRecognized+1:]...)
+	p.monthDay = 0
+}
+
+// 9am, 9:30, 21:00, at 9, в 9 вечера, noon...
+func (p *quickAddParser) matchTime(i int, preposition string) int {
+	switch p.word(i) {
+	case "noon", "полдень":
+		p.hour, p.minute, p.hasTime = 12, 0, true
+		return 1
+	case "midnight", "полночь":
+		p.hour, p.minute, p.hasTime = 0, 0, true
+		return 1
+	}
+
+	match := quickAddTimeRegexp.FindStringSubmatch(p.word(i))
+	if match == nil {
+		return 0
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+
+	consumed := 1
+	dayPart := match[3]
+	if dayPart == "" {
+		if _, ok := quickAddDayParts[p.word(i+1)]; ok {
+			dayPart = p.word(i + 1)
+			consumed++
+		}
+	}
+
+	// Plain numbers are too ambiguous without "at" or a part of the day
+	if match[2] == "" && dayPart == "" && !quickAddTimePrepositions[preposition] {
+		return 0
+	}
+
+	if dayPart != "" {
+		if hour < 1 || hour > 12 {
+			return 0
+		}
+		afternoon := quickAddDayParts[dayPart]
+		if dayPart == "ночи" && hour == 12 {
+			hour = 0
+		} else if afternoon && hour < 12 {
+			hour += 12
+		} else if !afternoon && hour == 12 {
+			hour = 0
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0
+	}
+
+	p.hour, p.minute, p.hasTime = hour, minute, true
+	return consumed
+}
+
+// Decides on the due date from everything that was found
+func (p *quickAddParser) resolveDue() {
+	today := startOfDay(p.now)
+
+	date := p.date
+	switch {
+	case p.hasDate:
+
+	case p.monthDay != 0:
+		// The closest date with this day of the month
+		for months := 0; months < 12; months++ {
+			candidate := time.Date(today.Year(), today.Month()+time.Month(months), p.monthDay, 0, 0, 0, 0, today.Location())
+			if candidate.Day() == p.monthDay && !candidate.Before(today) {
+				date = candidate
+				break
+			}
+		}
+
+	case p.hasWeekday:
+		date = today.AddDate(0, 0, (int(p.weekday)-int(today.Weekday())+7)%7)
+
+	case p.hasTime || p.result.RecurUnit != db.RecurNone:
+		date = today
+		// The time has already passed today
+		if p.hasTime && !time.Date(date.Year(), date.Month(), date.Day(), p.hour, p.minute, 0, 0, date.Location()).After(p.now) {
+			date = date.AddDate(0, 0, 1)
+		}
+	}
+
+	if date.IsZero() {
+		return
+	}
+
+	if p.hasTime {
+		due := time.Date(date.Year(), date.Month(), date.Day(), p.hour, p.minute, 0, 0, date.Location())
+		p.result.DueUnix = uint64(due.Unix())
+		p.result.DueHasTime = true
+		p.result.Due = due.Format(time.DateOnly + " 15:04")
+		return
+	}
+
+	// Dates without time are kept as UTC midnight
+	p.result.DueUnix = uint64(time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC).Unix())
+	p.result.Due = date.Format(time.DateOnly)
+}
@@ -0,0 +1,80 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// Wednesday
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+
+	for _, testCase := range []struct {
+		Input         string
+		Text          string
+		GroupName     string
+		Priority      uint64
+		Due           string
+		RecurUnit     string
+		RecurInterval uint64
+	}{
+		{"Buy milk", "Buy milk", "", db.PriorityNone, "", db.RecurNone, 0},
+		{"Pay rent every month on the 1st #Finance !high tomorrow 9am", "Pay rent on the 1st", "Finance", db.PriorityHigh, "2025-03-06 09:00", db.RecurMonth, 1},
+		{"Pay rent every month on the 1st", "Pay rent", "", db.PriorityNone, "2025-04-01", db.RecurMonth, 1},
+		{"Pay rent every month on the 1st #Finance !high at 9am", "Pay rent", "Finance", db.PriorityHigh, "2025-04-01 09:00", db.RecurMonth, 1},
+		{"Оплатить квартиру каждый месяц 1-го числа #Финансы !высокий в 9 утра", "Оплатить квартиру", "Финансы", db.PriorityHigh, "2025-04-01 09:00", db.RecurMonth, 1},
+		{"Call mom on friday at 18:30", "Call mom", "", db.PriorityNone, "2025-03-07 18:30", db.RecurNone, 0},
+		{"Work on report next week !!", "Work on report", "", db.PriorityMedium, "2025-03-10", db.RecurNone, 0},
+		{"Standup every 2 weeks at 9", "Standup", "", db.PriorityNone, "2025-03-06 09:00", db.RecurWeek, 2},
+		{"Gym every monday 7pm", "Gym", "", db.PriorityNone, "2025-03-10 19:00", db.RecurWeek, 1},
+		{"Submit taxes by 2025-04-15 #Home_Office", "Submit taxes", "Home Office", db.PriorityNone, "2025-04-15", db.RecurNone, 0},
+		{"Birthday party march 1", "Birthday party", "", db.PriorityNone, "2026-03-01", db.RecurNone, 0},
+		{"Water plants in 3 days", "Water plants", "", db.PriorityNone, "2025-03-08", db.RecurNone, 0},
+		{"Оплатить квартиру каждый месяц 1-го числа #Финансы !высокий завтра в 9 утра", "Оплатить квартиру 1-го числа", "Финансы", db.PriorityHigh, "2025-03-06 09:00", db.RecurMonth, 1},
+		{"Позвонить маме в пятницу в 18:30", "Позвонить маме", "", db.PriorityNone, "2025-03-07 18:30", db.RecurNone, 0},
+		{"Полить цветы через неделю", "Полить цветы", "", db.PriorityNone, "2025-03-12", db.RecurNone, 0},
+		{"Зарядка ежедневно в 7", "Зарядка", "", db.PriorityNone, "2025-03-06 07:00", db.RecurDay, 1},
+		{"День рождения 10 марта", "День рождения", "", db.PriorityNone, "2025-03-10", db.RecurNone, 0},
+	} {
+		parsed := ParseQuickAdd(testCase.Input, now)
+		if parsed.Text != testCase.Text ||
+			parsed.GroupName != testCase.GroupName ||
+			parsed.Priority != testCase.Priority ||
+			parsed.Due != testCase.Due ||
+			parsed.RecurUnit != testCase.RecurUnit ||
+			parsed.RecurInterval != testCase.RecurInterval {
+			t.Errorf("unexpected parse of \"%s\": %+v", testCase.Input, parsed)
+		}
+	}
+
+	// An exact date makes the day of the month useless, so it is not shown as understood
+	parsed := ParseQuickAdd("Pay rent every month on the 1st tomorrow", now)
+	for _, recognized := range parsed.Recognized {
+		if strings.Contains(recognized, "1st") {
+			t.Errorf("day of the month must not be recognized next to a date, got %v", parsed.Recognized)
+		}
+	}
+	if len(parsed.Recognized) != 2 {
+		t.Errorf("expected the recurrence and the date to be recognized, got %v", parsed.Recognized)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/i18n"
+	"Unbewohnte/dela/logger"
+	"net/http"
+	"time"
+)
+
+const (
+	// Maximum number of units between occurrences of a recurring TODO
+	MaxTodoRecurInterval uint64 = 365
+	// How many missed occurrences are skipped at most when looking for the next one
+	maxSkippedOccurrences int = 10000
+)
+
+// Returns due date of the next occurrence of a recurring TODO which is not overdue yet. now is expected to be in user's zone
+func nextOccurrenceDue(todo *db.Todo, now time.Time) uint64 {
+	next := *todo
+	next.IsDone = false
+	for i := 0; i < maxSkippedOccurrences; i++ {
+		next.DueUnix = next.NextDueUnix(now.Location())
+		if !isOverdue(&next, now) {
+			break
+		}
+	}
+
+	return next.DueUnix
+}
+
+// Creates the next occurrence of a recurring TODO that has just been completed. Does nothing for other TODOs
+func (s *Server) scheduleNextOccurrence(req *http.Request, todo *db.Todo) {
+	if !todo.IsRecurring() || todo.DueUnix == 0 {
+		return
+	}
+
+	now := time.Now().In(s.userLocale(todo.OwnerEmail, i18n.ENG).Location)
+	next := *todo
+	next.ID = 0
+	next.IsDone = false
+	next.CompletionTimeUnix = 0
+	next.ColumnID = 0
+	next.StartUnix = 0
+	next.TimeCreatedUnix = uint64(now.Unix())
+	next.DueUnix = nextOccurrenceDue(todo, now)
+
+	var err error
+	next.ID, err = s.db.CreateTodo(next)
+	if err != nil {
+		logger.Error("[Server] Failed to create next occurrence of recurring TODO %d: %s", todo.ID, err)
+		return
+	}
+	s.audit(req, next.OwnerEmail, "todo.recur", AuditTargetTodo, next.ID, todo, next)
+
+	logger.Info("[Server] Created next occurrence %d of recurring TODO %d", next.ID, todo.ID)
+}
@@ -25,12 +25,15 @@ import (
 	"Unbewohnte/dela/logger"
 	"context"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -43,17 +46,23 @@ const (
 )
 
 type Server struct {
-	config    conf.Conf
-	db        *db.DB
-	http      http.Server
-	cookieJar *cookiejar.Jar
-	emailer   *email.Emailer
+	config     conf.Conf
+	db         *db.DB
+	http       http.Server
+	cookieJar  *cookiejar.Jar
+	emailer    *email.Emailer
+	outboxWake chan struct{}
+	events     *EventHub
+	syncMutex  sync.Mutex
+	// Keeps the routine and admins from backing up at the same time
+	backupMutex sync.Mutex
 }
 
 // Creates a new server instance with provided config
 func New(config conf.Conf) (*Server, error) {
 	var server Server = Server{}
 	server.config = config
+	server.events = NewEventHub()
 
 	// check if required directories are present
 	_, err := os.Stat(filepath.Join(config.BaseContentDir, PagesDirName))
@@ -93,12 +102,36 @@ func New(config conf.Conf) (*Server, error) {
 	server.db = serverDB
 	logger.Info("Opened a database successfully")
 
+	// grant admin rights to users listed in the configuration
+	for _, adminEmail := range server.config.Admins {
+		adminEmail = strings.ToLower(strings.TrimSpace(adminEmail))
+		user, err := server.db.GetUser(adminEmail)
+		if err != nil {
+			// Will become an admin after registering and restarting the server
+			logger.Warning("[Server] Admin %s is not registered yet", adminEmail)
+			continue
+		}
+
+		if !user.IsAdmin() {
+			err = server.db.UserSetRole(user.Email, db.RoleAdmin)
+			if err != nil {
+				logger.Error("[Server] Failed to grant admin rights to %s: %s", user.Email, err)
+				continue
+			}
+			logger.Info("[Server] Granted admin rights to %s", user.Email)
+		}
+	}
+
+	// images used to be stored as data URLs
+	server.convertDataURLImages()
+
 	// start constructing an http server configuration
 	server.http = http.Server{
 		Addr: fmt.Sprintf(":%d", server.config.Server.Port),
 	}
 
 	// configure paths' callbacks
+	mime.AddExtensionType(".webmanifest", "application/manifest+json")
 	mux := http.NewServeMux()
 	mux.Handle(
 		"/static/",
@@ -114,6 +147,12 @@ func New(config conf.Conf) (*Server, error) {
 		),
 	)
 
+	// the service worker controls only pages below its own path, so it is served from the root
+	mux.HandleFunc("/sw.js", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, req, filepath.Join(server.config.BaseContentDir, ScriptsDirName, "sw.js"))
+	})
+
 	// handle page requests
 	pagesDirPath := filepath.Join(server.config.BaseContentDir, PagesDirName)
 	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
@@ -180,12 +219,18 @@ func New(config conf.Conf) (*Server, error) {
 			}
 
 			// Check if it exists
-			if _, err = server.db.GetTodoGroup(groupId); err != nil {
-				// Group does not exist
+			group, err := server.db.GetTodoGroup(groupId)
+			if err != nil || group.DeletedAtUnix != 0 {
+				// Group does not exist or is in the trash
 				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
 				return
 			}
 
+			if group.BoardView {
+				http.Redirect(w, req, fmt.Sprintf("/board/%d", groupId), http.StatusTemporaryRedirect)
+				return
+			}
+
 			requestedPage, err := template.ParseFiles(
 				filepath.Join(pagesDirPath, "base.html"),
 				filepath.Join(pagesDirPath, "paint.html"),
@@ -205,7 +250,7 @@ func New(config conf.Conf) (*Server, error) {
 				return
 			}
 
-			categoriesData, err := GetCategoryPageData(server.db, GetEmailFromReq(req), groupId)
+			categoriesData, err := GetCategoryPageData(server.db, GetEmailFromReq(req), groupId, server.localeFromReq(req))
 			if err != nil {
 				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
 				logger.Error("[Server][/category/] Failed to get category (%d) page data: %s", groupId, err)
@@ -220,6 +265,61 @@ func New(config conf.Conf) (*Server, error) {
 				return
 			}
 
+		} else if path.Dir(req.URL.Path) == "/board" {
+			if req.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			// Auth first
+			if !IsUserAuthorizedReq(req, server.db) {
+				http.Redirect(w, req, "/about", http.StatusTemporaryRedirect)
+				return
+			}
+
+			// Get group ID
+			groupId, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			if !server.db.DoesUserOwnGroup(groupId, GetEmailFromReq(req)) {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			boardData, err := GetBoardPageData(server.db, groupId, server.localeFromReq(req))
+			if err != nil || boardData.Group.DeletedAtUnix != 0 {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "board"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/board/] Failed to get board (%d) page data: %s", groupId, err)
+				return
+			}
+			pageData.Data = boardData
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "board.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/board/] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "board.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/board/] Template error: %s", err)
+				return
+			}
+
 		} else if req.URL.Path == "/profile" {
 			if req.Method != "GET" {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -232,20 +332,19 @@ func New(config conf.Conf) (*Server, error) {
 				return
 			}
 
-			email := GetEmailFromReq(req)
-			user, err := server.db.GetUser(email)
+			profileData, err := GetProfilePageData(server.db, GetEmailFromReq(req))
 			if err != nil {
-				// TODO
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/profile] Failed to get profile page data: %s", err)
 				return
 			}
-			user.Password = "" // No passwords sent
 
 			pageData, err := server.GetPageData([]string{"profile", "base"}, LanguageFromReq(req))
 			if err != nil {
 				// TODO
 				return
 			}
-			pageData.Data = user
+			pageData.Data = profileData
 
 			requestedPage, err := template.ParseFiles(
 				filepath.Join(pagesDirPath, "base.html"),
@@ -264,6 +363,330 @@ func New(config conf.Conf) (*Server, error) {
 				return
 			}
 
+		} else if req.URL.Path == "/trash" {
+			if req.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			// Auth first
+			if !IsUserAuthorizedReq(req, server.db) {
+				http.Redirect(w, req, "/about", http.StatusTemporaryRedirect)
+				return
+			}
+
+			trashData, err := GetTrashPageData(server.db, GetEmailFromReq(req), server.config.TrashRetentionDays, server.localeFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/trash] Failed to get trash page data: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "trash"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/trash] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = trashData
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "trash.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/trash] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "trash.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/trash] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/archive" {
+			if req.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			// Auth first
+			if !IsUserAuthorizedReq(req, server.db) {
+				http.Redirect(w, req, "/about", http.StatusTemporaryRedirect)
+				return
+			}
+
+			locale := server.localeFromReq(req)
+			filter, err := archiveFilterFromReq(req, locale.Location)
+			if err != nil {
+				// Show everything instead
+				filter = ArchiveFilter{Text: filter.Text}
+			}
+
+			archiveData, err := GetArchivePageData(server.db, GetEmailFromReq(req), filter, locale)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/archive] Failed to get archive page data: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "archive"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/archive] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = archiveData
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "archive.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/archive] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "archive.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/archive] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/calendar" {
+			if req.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			// Auth first
+			if !IsUserAuthorizedReq(req, server.db) {
+				http.Redirect(w, req, "/about", http.StatusTemporaryRedirect)
+				return
+			}
+
+			locale := server.localeFromReq(req)
+			now := time.Now().In(locale.Location)
+			view, date := calendarFromReq(req, now)
+			calendarData, err := GetCalendarPageData(server.db, GetEmailFromReq(req), view, date, now, locale)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/calendar] Failed to get calendar page data: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "calendar"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/calendar] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = calendarData
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "calendar.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/calendar] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "calendar.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/calendar] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/stats" {
+			if req.Method != "GET" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			// Auth first
+			if !IsUserAuthorizedReq(req, server.db) {
+				http.Redirect(w, req, "/about", http.StatusTemporaryRedirect)
+				return
+			}
+
+			days, weeks, err := statsRangeFromReq(req)
+			if err != nil {
+				days, weeks = StatsDefaultDays, StatsDefaultWeeks
+			}
+
+			stats, err := server.BuildStats(GetEmailFromReq(req), time.Now().In(server.localeFromReq(req).Location), days, weeks)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/stats] Failed to build statistics: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "stats"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/stats] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = stats
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "stats.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/stats] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "stats.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/stats] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/admin" {
+			if !IsUserAdminReq(req, server.db) {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			users, err := server.db.GetUsersOverview()
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin] Failed to get users overview: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "admin"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = users
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "admin.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "admin.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/admin/audit" {
+			if !IsUserAdminReq(req, server.db) {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			var page uint64 = 0
+			if pageStr := req.URL.Query().Get("page"); pageStr != "" {
+				parsedPage, err := strconv.ParseUint(pageStr, 10, 64)
+				if err == nil {
+					page = parsedPage
+				}
+			}
+
+			events, err := server.db.GetAuditEvents(AuditPageSize, page*AuditPageSize)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/audit] Failed to get audit events: %s", err)
+				return
+			}
+
+			auditData := AuditPageData{
+				Events: events,
+				Page:   page,
+			}
+			if uint64(len(events)) == AuditPageSize {
+				auditData.NextPage = page + 1
+			}
+			if page > 0 {
+				auditData.PrevPage = page - 1
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "audit"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/audit] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = auditData
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "audit.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/audit] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "audit.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/audit] Template error: %s", err)
+				return
+			}
+
+		} else if req.URL.Path == "/admin/outbox" {
+			if !IsUserAdminReq(req, server.db) {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				return
+			}
+
+			failedEmails, err := server.db.GetOutboxEmailsByStatus(db.OutboxDead)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/outbox] Failed to get failed emails: %s", err)
+				return
+			}
+
+			pageData, err := server.GetPageData([]string{"base", "outbox"}, LanguageFromReq(req))
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/outbox] Failed to get page data: %s", err)
+				return
+			}
+			pageData.Data = failedEmails
+
+			requestedPage, err := template.ParseFiles(
+				filepath.Join(pagesDirPath, "base.html"),
+				filepath.Join(pagesDirPath, "outbox.html"),
+			)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/outbox] Failed to get a page: %s", err)
+				return
+			}
+
+			err = requestedPage.ExecuteTemplate(w, "outbox.html", &pageData)
+			if err != nil {
+				http.Redirect(w, req, "/error", http.StatusTemporaryRedirect)
+				logger.Error("[Server][/admin/outbox] Template error: %s", err)
+				return
+			}
+
 		} else {
 			// default
 			requestedPage, err := template.ParseFiles(
@@ -294,45 +717,137 @@ func New(config conf.Conf) (*Server, error) {
 			}
 		}
 	})
-	mux.HandleFunc("/api/user/get", server.EndpointUserGet)              // Non specific
-	mux.HandleFunc("/api/user/delete", server.EndpointUserDelete)        // Non specific
-	mux.HandleFunc("/api/user/update", server.EndpointUserUpdate)        // Non specific
-	mux.HandleFunc("/api/user/create", server.EndpointUserCreate)        // Non specific
-	mux.HandleFunc("/api/user/login", server.EndpointUserLogin)          // Non specific
-	mux.HandleFunc("/api/user/verify", server.EndpointUserVerify)        // Non specific
-	mux.HandleFunc("/api/user/notify", server.EndpointUserNotify)        // Non specific
-	mux.HandleFunc("/api/todo/create", server.EndpointTodoCreate)        // Non specific
-	mux.HandleFunc("/api/todo/get", server.EndpointUserTodosGet)         // Non specific
-	mux.HandleFunc("/api/todo/delete/", server.EndpointTodoDelete)       // Specific
-	mux.HandleFunc("/api/todo/update/", server.EndpointTodoUpdate)       // Specific
-	mux.HandleFunc("/api/todo/file/", server.EndpointTodoFile)           // Specific
-	mux.HandleFunc("/api/todo/markdone/", server.EndpointTodoMarkDone)   // Specific
-	mux.HandleFunc("/api/group/create", server.EndpointTodoGroupCreate)  // Non specific
-	mux.HandleFunc("/api/group/get/", server.EndpointTodoGroupGet)       // Specific
-	mux.HandleFunc("/api/group/update/", server.EndpointTodoGroupUpdate) // Specific
-	mux.HandleFunc("/api/group/delete/", server.EndpointTodoGroupDelete) // Specific
+	mux.HandleFunc("/api/user/get", server.EndpointUserGet)                                          // Non specific
+	mux.HandleFunc("/api/user/delete", server.EndpointUserDelete)                                    // Non specific
+	mux.HandleFunc("/api/user/update", server.EndpointUserUpdate)                                    // Non specific
+	mux.HandleFunc("/api/user/create", server.EndpointUserCreate)                                    // Non specific
+	mux.HandleFunc("/api/user/login", server.EndpointUserLogin)                                      // Non specific
+	mux.HandleFunc("/api/user/verify", server.EndpointUserVerify)                                    // Non specific
+	mux.HandleFunc("/api/user/resetpassword", server.EndpointUserResetPassword)                      // Non specific
+	mux.HandleFunc("/api/user/notify", server.EndpointUserNotify)                                    // Non specific
+	mux.HandleFunc("/api/user/digest", server.EndpointUserDigest)                                    // Non specific
+	mux.HandleFunc("/api/user/audit", server.EndpointUserAuditGet)                                   // Non specific
+	mux.HandleFunc("/api/user/autoarchive", server.EndpointUserAutoArchive)                          // Non specific
+	mux.HandleFunc("/api/user/timezone", server.EndpointUserTimezone)                                // Non specific
+	mux.HandleFunc("/api/todo/create", server.EndpointTodoCreate)                                    // Non specific
+	mux.HandleFunc("/api/todo/quickadd", server.EndpointTodoQuickAdd)                                // Non specific
+	mux.HandleFunc("/api/todo/quickadd/preview", server.EndpointTodoQuickAddPreview)                 // Non specific
+	mux.HandleFunc("/api/todo/sync", server.EndpointTodoSync)                                        // Non specific
+	mux.HandleFunc("/api/todo/get", server.EndpointUserTodosGet)                                     // Non specific
+	mux.HandleFunc("/api/todo/range", server.EndpointTodoRangeGet)                                   // Non specific
+	mux.HandleFunc("/api/todo/delete/", server.EndpointTodoDelete)                                   // Specific
+	mux.HandleFunc("/api/todo/update/", server.EndpointTodoUpdate)                                   // Specific
+	mux.HandleFunc("/api/todo/file/", server.EndpointTodoFile)                                       // Specific
+	mux.HandleFunc("/api/todo/image/", server.EndpointTodoImage)                                     // Specific
+	mux.HandleFunc("/api/todo/image/delete/", server.EndpointTodoImageDelete)                        // Specific
+	mux.HandleFunc("/api/todo/sketch/", server.EndpointTodoSketch)                                   // Specific
+	mux.HandleFunc("/api/todo/markdone/", server.EndpointTodoMarkDone)                               // Specific
+	mux.HandleFunc("/api/todo/restore/", server.EndpointTodoRestore)                                 // Specific
+	mux.HandleFunc("/api/todo/archive/", server.EndpointTodoArchive)                                 // Specific
+	mux.HandleFunc("/api/todo/snooze/", server.EndpointTodoSnooze)                                   // Specific
+	mux.HandleFunc("/api/todo/unarchive/", server.EndpointTodoUnarchive)                             // Specific
+	mux.HandleFunc("/api/todo/move/", server.EndpointTodoMove)                                       // Specific
+	mux.HandleFunc("/api/todo/comments/", server.EndpointTodoCommentsGet)                            // Specific
+	mux.HandleFunc("/api/todo/comment/", server.EndpointTodoCommentCreate)                           // Specific
+	mux.HandleFunc("/api/todo/timeline/", server.EndpointTodoTimelineGet)                            // Specific
+	mux.HandleFunc("/api/comment/update/", server.EndpointTodoCommentUpdate)                         // Specific
+	mux.HandleFunc("/api/comment/delete/", server.EndpointTodoCommentDelete)                         // Specific
+	mux.HandleFunc("/api/group/create", server.EndpointTodoGroupCreate)                              // Non specific
+	mux.HandleFunc("/api/group/get/", server.EndpointTodoGroupGet)                                   // Specific
+	mux.HandleFunc("/api/group/update/", server.EndpointTodoGroupUpdate)                             // Specific
+	mux.HandleFunc("/api/group/delete/", server.EndpointTodoGroupDelete)                             // Specific
+	mux.HandleFunc("/api/group/restore/", server.EndpointTodoGroupRestore)                           // Specific
+	mux.HandleFunc("/api/group/archive/", server.EndpointTodoGroupArchive)                           // Specific
+	mux.HandleFunc("/api/group/board/", server.EndpointTodoGroupBoardView)                           // Specific
+	mux.HandleFunc("/api/board/get/", server.EndpointBoardGet)                                       // Specific
+	mux.HandleFunc("/api/board/column/create/", server.EndpointBoardColumnCreate)                    // Specific
+	mux.HandleFunc("/api/board/column/update/", server.EndpointBoardColumnUpdate)                    // Specific
+	mux.HandleFunc("/api/board/column/delete/", server.EndpointBoardColumnDelete)                    // Specific
+	mux.HandleFunc("/api/archive/search", server.EndpointArchiveSearch)                              // Non specific
+	mux.HandleFunc("/api/stats", server.EndpointStatsGet)                                            // Non specific
+	mux.HandleFunc("/api/trash/get", server.EndpointTrashGet)                                        // Non specific
+	mux.HandleFunc("/api/trash/empty", server.EndpointTrashEmpty)                                    // Non specific
+	mux.HandleFunc("/api/admin/users/get", server.EndpointAdminUsersGet)                             // Non specific
+	mux.HandleFunc("/api/admin/user/verify", server.EndpointAdminUserVerify)                         // Non specific
+	mux.HandleFunc("/api/admin/user/disable", server.EndpointAdminUserDisable)                       // Non specific
+	mux.HandleFunc("/api/admin/user/delete", server.EndpointAdminUserDelete)                         // Non specific
+	mux.HandleFunc("/api/admin/user/resetpassword", server.EndpointAdminUserResetPassword)           // Non specific
+	mux.HandleFunc("/api/admin/user/resendverification", server.EndpointAdminUserResendVerification) // Non specific
+	mux.HandleFunc("/api/admin/user/role", server.EndpointAdminUserRole)                             // Non specific
+	mux.HandleFunc("/api/admin/audit/get", server.EndpointAdminAuditGet)                             // Non specific
+	mux.HandleFunc("/api/admin/outbox/get", server.EndpointAdminOutboxGet)                           // Non specific
+	mux.HandleFunc("/api/admin/outbox/retry/", server.EndpointAdminOutboxRetry)                      // Specific
+	mux.HandleFunc("/api/admin/outbox/delete/", server.EndpointAdminOutboxDelete)                    // Specific
+	mux.HandleFunc("/api/admin/backups/get", server.EndpointAdminBackupsGet)                         // Non specific
+	mux.HandleFunc("/api/admin/backup/create", server.EndpointAdminBackupCreate)                     // Non specific
+	mux.HandleFunc("/api/events", server.EndpointEvents)                                             // Non specific
+	mux.HandleFunc("/api/sync", server.EndpointSync)                                                 // Non specific
+	mux.HandleFunc("/api/v1/", server.EndpointAPIv1)                                                 // Specific
 
 	server.http.Handler = mux
 	jar, _ := cookiejar.New(nil)
 	server.cookieJar = jar
 
-	server.emailer = email.NewEmailer(
-		email.Auth(server.config),
-		fmt.Sprintf("%s:%d", server.config.Verification.Emailer.Host, server.config.Verification.Emailer.HostPort),
-		server.config.Verification.Emailer.User,
-	)
+	emailTransport, err := email.NewTransport(server.config.Verification.Emailer)
+	if err != nil {
+		logger.Error("[Server] Failed to set up email transport: %s", err)
+		return nil, err
+	}
+	server.emailer = email.NewEmailer(emailTransport, server.config.Verification.Emailer.User)
+	server.outboxWake = make(chan struct{}, 1)
 
 	logger.Info("[Server] Created an HTTP server instance")
 
 	return &server, nil
 }
 
+// Returns the address the service is reachable at, taken from the request if it is not configured
+func (s *Server) baseURL(req *http.Request) string {
+	if s.config.Server.PublicURL != "" {
+		return strings.TrimSuffix(s.config.Server.PublicURL, "/")
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
 // Launches server instance
 func (s *Server) Start() error {
+	// Launch outbox routine
+	logger.Info("[Server] Starting Outbox Routine...")
+	go s.StartOutboxRoutine(time.Second * 30)
+
 	// Launch notifier routine
 	logger.Info("[Server] Starting Notifications Routine...")
 	go s.StartNotificationsRoutine(time.Hour * 24)
 
+	// Launch digest routine
+	logger.Info("[Server] Starting Digest Routine...")
+	go s.StartDigestRoutine(time.Hour)
+
+	// Launch audit log cleanup routine
+	logger.Info("[Server] Starting Audit Routine...")
+	go s.StartAuditRetentionRoutine(time.Hour * 24)
+
+	// Launch automatic archiving routine
+	logger.Info("[Server] Starting Archive Routine...")
+	go s.StartAutoArchiveRoutine(time.Hour)
+
+	// Launch trash purge routine
+	logger.Info("[Server] Starting Trash Routine...")
+	go s.StartTrashPurgeRoutine(time.Hour * 6)
+
+	// Launch cleanup of applied offline changes
+	logger.Info("[Server] Starting Sync Routine...")
+	go s.StartSyncRetentionRoutine(time.Hour * 24)
+
+	// Launch scheduled database backups
+	logger.Info("[Server] Starting Backup Routine...")
+	go s.StartBackupRoutine(time.Hour * time.Duration(s.config.Backup.IntervalHours))
+
 	if s.config.Server.CertFilePath != "" && s.config.Server.KeyFilePath != "" {
 		logger.Info("[Server] Using TLS")
 		logger.Info("[Server] HTTP server is going live on port %d!", s.config.Server.Port)
@@ -0,0 +1,310 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// Size of the canvas sketches are drawn on
+	DefaultSketchSize int = 256
+	MaxSketchSize     int = 1024
+	MaxSketchStrokes  int = 2000
+	// Points of all strokes together
+	MaxSketchPoints      int     = 10000
+	MaxSketchStrokeWidth float64 = 64
+	// Sketches can be exported bigger than they were drawn
+	MaxSketchExportScale int = 4
+	// Pixels a single render may visit, see Sketch.RenderArea
+	MaxSketchRenderArea float64 = 4 * 1024 * 1024
+)
+
+// A line drawn without lifting the pen
+type SketchStroke struct {
+	// #rrggbb
+	Color  string       `json:"color"`
+	Width  float64      `json:"width"`
+	Points [][2]float64 `json:"points"`
+}
+
+// A hand-drawn image stored as strokes so that it can be edited and rendered again
+type Sketch struct {
+	Width   int            `json:"width"`
+	Height  int            `json:"height"`
+	Strokes []SketchStroke `json:"strokes"`
+}
+
+// Parses #rrggbb color
+func parseHexColor(hexColor string) (color.NRGBA, error) {
+	if len(hexColor) != 7 || hexColor[0] != '#' {
+		return color.NRGBA{}, fmt.Errorf("color \"%s\" is not in #rrggbb format", hexColor)
+	}
+
+	value, err := strconv.ParseUint(hexColor[1:], 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("color \"%s\" is not in #rrggbb format", hexColor)
+	}
+
+	return color.NRGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+}
+
+// Reads sketch JSON and checks that it is reasonable to render
+func parseSketch(data []byte) (*Sketch, error) {
+	var sketch Sketch
+	err := json.Unmarshal(data, &sketch)
+	if err != nil {
+		return nil, errors.New("invalid sketch JSON")
+	}
+
+	if sketch.Width == 0 && sketch.Height == 0 {
+		sketch.Width, sketch.Height = DefaultSketchSize, DefaultSketchSize
+	}
+	if sketch.Width <= 0 || sketch.Height <= 0 || sketch.Width > MaxSketchSize || sketch.Height > MaxSketchSize {
+		return nil, fmt.Errorf("sketch sides must be from 1 to %d pixels", MaxSketchSize)
+	}
+
+	if len(sketch.Strokes) == 0 {
+		return nil, errors.New("sketch is empty")
+	}
+	if len(sketch.Strokes) > MaxSketchStrokes {
+		return nil, fmt.Errorf("sketch must have at most %d strokes", MaxSketchStrokes)
+	}
+
+	points := 0
+	for _, stroke := range sketch.Strokes {
+		_, err = parseHexColor(stroke.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		if !(stroke.Width > 0 && stroke.Width <= MaxSketchStrokeWidth) {
+			return nil, fmt.Errorf("stroke width must be from 1 to %v", MaxSketchStrokeWidth)
+		}
+
+		if len(stroke.Points) == 0 {
+			return nil, errors.New("stroke has no points")
+		}
+		for _, point := range stroke.Points {
+			// Strokes may go past the edges a bit, but points far away can not be drawn
+			x, y := point[0], point[1]
+			if !(x >= -float64(sketch.Width) && x <= 2*float64(sketch.Width) &&
+				y >= -float64(sketch.Height) && y <= 2*float64(sketch.Height)) {
+				return nil, errors.New("stroke points must be near the canvas")
+			}
+		}
+
+		points += len(stroke.Points)
+	}
+	if points > MaxSketchPoints {
+		return nil, fmt.Errorf("sketch must have at most %d points", MaxSketchPoints)
+	}
+	if sketch.RenderArea(1) > MaxSketchRenderArea {
+		return nil, errors.New("sketch has too many long and wide strokes")
+	}
+
+	return &sketch, nil
+}
+
+// Returns distance from point p to the segment from a to b
+func distanceToSegment(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	t := 0.0
+	if lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lengthSquared))
+	}
+
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+/*
+Returns how many pixels rendering the sketch scale times bigger visits at most.
+Every segment covers a capsule around it, so the work grows with the length and width of strokes
+and not with the size of the canvas
+*/
+func (sketch *Sketch) RenderArea(scale int) float64 {
+	area := 0.0
+	for _, stroke := range sketch.Strokes {
+		radius := stroke.Width * float64(scale) / 2
+		for i := range stroke.Points {
+			from, to := stroke.Points[i], stroke.Points[i]
+			if i > 0 {
+				from = stroke.Points[i-1]
+			}
+			length := math.Hypot(to[0]-from[0], to[1]-from[1]) * float64(scale)
+			area += (length + 2*radius + 3) * (2*radius + 4)
+		}
+	}
+
+	return area
+}
+
+// Returns the range of x where lo <= slope*x+intercept <= hi
+func linearRange(slope, intercept, lo, hi float64) (float64, float64) {
+	if slope == 0 {
+		if intercept < lo || intercept > hi {
+			return math.Inf(1), math.Inf(-1)
+		}
+		return math.Inf(-1), math.Inf(1)
+	}
+
+	from, to := (lo-intercept)/slope, (hi-intercept)/slope
+	if from > to {
+		from, to = to, from
+	}
+	return from, to
+}
+
+// Returns the range of x on the horizontal line y that is closer than reach to the segment from a to b
+func segmentSpan(y, ax, ay, bx, by, reach float64) (float64, float64) {
+	left, right := math.Inf(1), math.Inf(-1)
+
+	// Round caps
+	for _, end := range [2][2]float64{{ax, ay}, {bx, by}} {
+		offset := y - end[1]
+		if math.Abs(offset) <= reach {
+			half := math.Sqrt(reach*reach - offset*offset)
+			left, right = math.Min(left, end[0]-half), math.Max(right, end[0]+half)
+		}
+	}
+
+	// Body of the segment: close to the line and between its ends
+	dx, dy := bx-ax, by-ay
+	length := math.Hypot(dx, dy)
+	if length > 0 {
+		// Distance from the line is ((x-ax)*(-dy) + (y-ay)*dx) / length
+		sideFrom, sideTo := linearRange(-dy/length, (ax*dy+(y-ay)*dx)/length, -reach, reach)
+		// Position along the segment is ((x-ax)*dx + (y-ay)*dy) / length
+		alongFrom, alongTo := linearRange(dx/length, (-ax*dx+(y-ay)*dy)/length, 0, length)
+		from, to := math.Max(sideFrom, alongFrom), math.Min(sideTo, alongTo)
+		if from <= to {
+			left, right = math.Min(left, from), math.Max(right, to)
+		}
+	}
+
+	return left, right
+}
+
+/*
+Draws the sketch scale times bigger than it was drawn on a transparent background.
+Strokes have round caps and joins and antialiased edges.
+Only pixels near the strokes are visited, see RenderArea
+*/
+func (sketch *Sketch) Render(scale int) *image.NRGBA {
+	width, height := sketch.Width*scale, sketch.Height*scale
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	coverage := make([]uint8, width*height)
+	var touched []int
+
+	for _, stroke := range sketch.Strokes {
+		strokeColor, _ := parseHexColor(stroke.Color)
+		radius := stroke.Width * float64(scale) / 2
+		// Pixels further than this from the segment are not covered at all
+		reach := radius + 0.5
+
+		touched = touched[:0]
+		for i := range stroke.Points {
+			// A single point is a dot
+			from, to := stroke.Points[i], stroke.Points[i]
+			if i > 0 {
+				from = stroke.Points[i-1]
+			}
+			ax, ay := from[0]*float64(scale), from[1]*float64(scale)
+			bx, by := to[0]*float64(scale), to[1]*float64(scale)
+
+			top := int(math.Max(0, math.Floor(math.Min(ay, by)-reach-0.5)))
+			bottom := int(math.Min(float64(height-1), math.Ceil(math.Max(ay, by)+reach-0.5)))
+			for y := top; y <= bottom; y++ {
+				spanLeft, spanRight := segmentSpan(float64(y)+0.5, ax, ay, bx, by, reach)
+				if spanLeft > spanRight {
+					continue
+				}
+				left := int(math.Max(0, math.Floor(spanLeft-0.5)))
+				right := int(math.Min(float64(width-1), math.Ceil(spanRight-0.5)))
+
+				for x := left; x <= right; x++ {
+					distance := distanceToSegment(float64(x)+0.5, float64(y)+0.5, ax, ay, bx, by)
+					covered := uint8(math.Round(math.Max(0, math.Min(1, reach-distance)) * 255))
+					// Segments of the same stroke overlap at joins and must not darken them
+					if covered > coverage[y*width+x] {
+						if coverage[y*width+x] == 0 {
+							touched = append(touched, y*width+x)
+						}
+						coverage[y*width+x] = covered
+					}
+				}
+			}
+		}
+
+		for _, index := range touched {
+			alpha := float64(coverage[index]) / 255
+			coverage[index] = 0
+
+			// Source over destination with straight alpha
+			pixel := img.Pix[(index/width)*img.Stride+(index%width)*4 : (index/width)*img.Stride+(index%width)*4+4]
+			destinationAlpha := float64(pixel[3]) / 255
+			outAlpha := alpha + destinationAlpha*(1-alpha)
+			blend := func(source uint8, destination uint8) uint8 {
+				return uint8(math.Round((float64(source)*alpha + float64(destination)*destinationAlpha*(1-alpha)) / outAlpha))
+			}
+			pixel[0] = blend(strokeColor.R, pixel[0])
+			pixel[1] = blend(strokeColor.G, pixel[1])
+			pixel[2] = blend(strokeColor.B, pixel[2])
+			pixel[3] = uint8(math.Round(outAlpha * 255))
+		}
+	}
+
+	return img
+}
+
+// Renders the sketch to PNG
+func (sketch *Sketch) PNG(scale int) ([]byte, error) {
+	var rendered bytes.Buffer
+	err := png.Encode(&rendered, sketch.Render(scale))
+	if err != nil {
+		return nil, err
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// Renders the sketch into TODO's image and keeps the sketch to be edited later
+func (s *Server) saveTodoSketch(todoID uint64, sketch *Sketch) error {
+	rendered, err := sketch.PNG(1)
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(sketch)
+	if err != nil {
+		return err
+	}
+
+	return s.db.SetTodoSketch(todoID, string(document), rendered, uint64(time.Now().Unix()))
+}
@@ -0,0 +1,133 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSketches(t *testing.T) {
+	for _, invalid := range []string{
+		`not json`,
+		`{"strokes":[]}`,
+		`{"width":5000,"height":10,"strokes":[{"color":"#000000","width":5,"points":[[1,1]]}]}`,
+		`{"strokes":[{"color":"black","width":5,"points":[[1,1]]}]}`,
+		`{"strokes":[{"color":"#000000","width":0,"points":[[1,1]]}]}`,
+		`{"strokes":[{"color":"#000000","width":5,"points":[]}]}`,
+		`{"strokes":[{"color":"#000000","width":5,"points":[[1e300,10],[1e300,12]]}]}`,
+		`{"width":100,"height":100,"strokes":[{"color":"#000000","width":5,"points":[[10,-101]]}]}`,
+	} {
+		_, err := parseSketch([]byte(invalid))
+		if err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+
+	// Points as far from the canvas as allowed are drawn where they touch it
+	farSketch, err := parseSketch([]byte(`{"width":100,"height":50,"strokes":[
+		{"color":"#000000","width":5,"points":[[-100,-50],[200,100]]}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to parse sketch with far points: %s", err)
+	}
+	farSketch.Render(2)
+
+	sketch, err := parseSketch([]byte(`{"strokes":[
+		{"color":"#ff0000","width":4,"points":[[10,10],[100,10]]},
+		{"color":"#0000ff","width":10,"points":[[50,50]]},
+		{"color":"#00ff00","width":6,"points":[[-100,-100],[-50,-50]]}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to parse sketch: %s", err)
+	}
+	if sketch.Width != DefaultSketchSize || sketch.Height != DefaultSketchSize {
+		t.Fatalf("sketch without size must get the default canvas size, got %dx%d", sketch.Width, sketch.Height)
+	}
+
+	for _, scale := range []int{1, 2} {
+		img := sketch.Render(scale)
+		if img.Bounds().Dx() != DefaultSketchSize*scale {
+			t.Fatalf("expected %d pixels wide image, got %d", DefaultSketchSize*scale, img.Bounds().Dx())
+		}
+
+		for _, testCase := range []struct {
+			X, Y  int
+			Color color.NRGBA
+		}{
+			{55, 10, color.NRGBA{255, 0, 0, 255}},
+			{50, 50, color.NRGBA{0, 0, 255, 255}},
+			{55, 20, color.NRGBA{}},
+			{0, 0, color.NRGBA{}},
+		} {
+			pixel := img.NRGBAAt(testCase.X*scale, testCase.Y*scale)
+			if pixel != testCase.Color {
+				t.Errorf("scale %d: expected %v at %d,%d, got %v", scale, testCase.Color, testCase.X, testCase.Y, pixel)
+			}
+		}
+	}
+}
+
+func TestSketchRenderWork(t *testing.T) {
+	// Wide strokes going back and forth across the whole canvas
+	var strokes []string
+	for i := 0; i < 20; i++ {
+		var points []string
+		for j := 0; j < 25; j++ {
+			corner := -1024 + (j%2)*3072
+			points = append(points, fmt.Sprintf("[%d,%d]", corner, corner))
+		}
+		strokes = append(strokes, fmt.Sprintf(`{"color":"#000000","width":64,"points":[%s]}`, strings.Join(points, ",")))
+	}
+	_, err := parseSketch([]byte(fmt.Sprintf(`{"width":1024,"height":1024,"strokes":[%s]}`, strings.Join(strokes, ","))))
+	if err == nil {
+		t.Fatalf("expected a sketch with too much to draw to be rejected")
+	}
+
+	// The most expensive sketch that is still accepted
+	sketch := Sketch{Width: MaxSketchSize, Height: MaxSketchSize}
+	stroke := SketchStroke{Color: "#000000", Width: MaxSketchStrokeWidth}
+	for i := 0; ; i++ {
+		corner := float64(i%2) * float64(MaxSketchSize)
+		sketch.Strokes = []SketchStroke{{Color: stroke.Color, Width: stroke.Width, Points: append(stroke.Points, [2]float64{corner, corner})}}
+		if sketch.RenderArea(1) > MaxSketchRenderArea {
+			break
+		}
+		stroke.Points = append(stroke.Points, [2]float64{corner, corner})
+	}
+	sketch.Strokes = []SketchStroke{stroke}
+	document, _ := json.Marshal(sketch)
+	parsed, err := parseSketch(document)
+	if err != nil {
+		t.Fatalf("failed to parse sketch within the limits: %s", err)
+	}
+	if parsed.RenderArea(MaxSketchExportScale) <= MaxSketchRenderArea {
+		t.Fatalf("expected the sketch to be too expensive to export at scale %d", MaxSketchExportScale)
+	}
+
+	start := time.Now()
+	parsed.Render(1)
+	if took := time.Since(start); took > 2*time.Second {
+		t.Fatalf("rendering the worst sketch took %s", took)
+	}
+}
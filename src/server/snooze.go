@@ -0,0 +1,93 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"fmt"
+	"time"
+)
+
+const (
+	// A few hours from now
+	SnoozeLaterToday string = "later"
+	// Tomorrow morning
+	SnoozeTomorrow string = "tomorrow"
+	// Monday morning of the next week
+	SnoozeNextWeek string = "week"
+	// Time given by the user
+	SnoozeCustom string = "custom"
+	// Show the TODO right away
+	SnoozeNone string = "none"
+
+	SnoozeLaterTodayDelay time.Duration = time.Hour * 3
+	// Hour of the day snoozed TODOs show up at
+	SnoozeMorningHour int = 9
+	// The furthest TODO can be snoozed for
+	MaxSnoozeDays int = 3650
+)
+
+// Returns the time TODO snoozed with given option becomes visible. now is expected to be in user's zone
+func snoozeUntil(option string, now time.Time, customUnix uint64) (time.Time, error) {
+	morningOf := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), SnoozeMorningHour, 0, 0, 0, day.Location())
+	}
+
+	switch option {
+	case SnoozeLaterToday:
+		return now.Add(SnoozeLaterTodayDelay), nil
+
+	case SnoozeTomorrow:
+		return morningOf(now.AddDate(0, 0, 1)), nil
+
+	case SnoozeNextWeek:
+		return morningOf(startOfWeek(now).AddDate(0, 0, 7)), nil
+
+	case SnoozeCustom:
+		until := time.Unix(int64(customUnix), 0)
+		if !until.After(now) {
+			return time.Time{}, fmt.Errorf("snooze time must be in the future")
+		}
+		if until.After(now.AddDate(0, 0, MaxSnoozeDays)) {
+			return time.Time{}, fmt.Errorf("can't snooze for more than %d days", MaxSnoozeDays)
+		}
+		return until, nil
+
+	case SnoozeNone:
+		return time.Unix(0, 0), nil
+
+	default:
+		return time.Time{}, fmt.Errorf("unknown snooze option \"%s\"", option)
+	}
+}
+
+// Splits TODOs into the ones that are shown and the ones that are still hidden
+func splitDeferred(todos []*db.Todo, now time.Time) ([]*db.Todo, []*db.Todo) {
+	var visible []*db.Todo
+	var deferred []*db.Todo
+	for _, todo := range todos {
+		if todo.IsDeferred(uint64(now.Unix())) {
+			deferred = append(deferred, todo)
+		} else {
+			visible = append(visible, todo)
+		}
+	}
+
+	return visible, deferred
+}
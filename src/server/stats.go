@@ -0,0 +1,250 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// How many last days and weeks are shown on the statistics page by default
+	StatsDefaultDays  uint64 = 30
+	StatsDefaultWeeks uint64 = 12
+	StatsMaxDays      uint64 = 366
+	StatsMaxWeeks     uint64 = 104
+	// How many weeks the completion heatmap covers
+	StatsHeatmapWeeks int = 53
+)
+
+// A bar of the activity chart
+type StatsBar struct {
+	*db.PeriodCount
+	// Heights of bars relative to the biggest one in percents
+	CreatedPercent   uint64 `json:"-"`
+	CompletedPercent uint64 `json:"-"`
+}
+
+// A single cell of the completion heatmap
+type HeatmapDay struct {
+	Date      string `json:"date"`
+	Completed uint64 `json:"completed"`
+	// From 0 (nothing completed) to 4 (the most productive days)
+	Level uint8 `json:"level"`
+	// Days after today are not shown
+	Future bool `json:"future"`
+}
+
+type Stats struct {
+	Totals *db.TodoTotals `json:"totals"`
+	// Percentage of TODOs with due date that became overdue
+	OverdueRate float64 `json:"overdueRate"`
+	// Consecutive days with at least one completed TODO
+	CurrentStreak uint64                     `json:"currentStreak"`
+	LongestStreak uint64                     `json:"longestStreak"`
+	Daily         []*StatsBar                `json:"daily"`
+	Weekly        []*StatsBar                `json:"weekly"`
+	Groups        []*db.GroupCompletionStats `json:"groups"`
+	// Weeks starting on Monday, oldest first
+	Heatmap [][]*HeatmapDay `json:"heatmap"`
+}
+
+// Reads days and weeks query parameters, falling back to defaults when they are not set
+func statsRangeFromReq(req *http.Request) (uint64, uint64, error) {
+	days, weeks := StatsDefaultDays, StatsDefaultWeeks
+	query := req.URL.Query()
+
+	if query.Get("days") != "" {
+		parsed, err := strconv.ParseUint(query.Get("days"), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		days = parsed
+	}
+
+	if query.Get("weeks") != "" {
+		parsed, err := strconv.ParseUint(query.Get("weeks"), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		weeks = parsed
+	}
+
+	if days == 0 || days > StatsMaxDays || weeks == 0 || weeks > StatsMaxWeeks {
+		return 0, 0, fmt.Errorf("days must be within 1-%d and weeks within 1-%d", StatsMaxDays, StatsMaxWeeks)
+	}
+
+	return days, weeks, nil
+}
+
+// Returns the Monday of the week t is in
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	weekday := int(day.Weekday()+6) % 7
+	return day.AddDate(0, 0, -weekday)
+}
+
+// Turns sparse activity into a bar for every period from since to until, moving to the next period with next
+func activityBars(activity []*db.PeriodCount, since time.Time, until time.Time, next func(time.Time) time.Time) []*StatsBar {
+	counts := make(map[string]*db.PeriodCount)
+	for _, count := range activity {
+		counts[count.Period] = count
+	}
+
+	var bars []*StatsBar
+	var biggest uint64
+	for period := since; !period.After(until); period = next(period) {
+		date := period.Format(time.DateOnly)
+		count, ok := counts[date]
+		if !ok {
+			count = &db.PeriodCount{Period: date}
+		}
+		bars = append(bars, &StatsBar{PeriodCount: count})
+
+		if count.Created > biggest {
+			biggest = count.Created
+		}
+		if count.Completed > biggest {
+			biggest = count.Completed
+		}
+	}
+
+	if biggest > 0 {
+		for _, bar := range bars {
+			bar.CreatedPercent = bar.Created * 100 / biggest
+			bar.CompletedPercent = bar.Completed * 100 / biggest
+		}
+	}
+
+	return bars
+}
+
+// Computes current and longest streaks from sorted YYYY-MM-DD dates
+func completionStreaks(days []string, today time.Time) (uint64, uint64) {
+	var current, longest uint64
+	var previous time.Time
+	for _, day := range days {
+		date, err := time.ParseInLocation(time.DateOnly, day, today.Location())
+		if err != nil {
+			continue
+		}
+
+		if !previous.IsZero() && date.Equal(previous.AddDate(0, 0, 1)) {
+			current++
+		} else {
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+		previous = date
+	}
+
+	// The streak is still going if something was completed today or yesterday
+	if previous.IsZero() || previous.Before(today.AddDate(0, 0, -1)) {
+		current = 0
+	}
+
+	return current, longest
+}
+
+// Collects user's productivity statistics over the given number of last days and weeks
+func (s *Server) BuildStats(email string, now time.Time, days uint64, weeks uint64) (*Stats, error) {
+	today := startOfDay(now)
+	thisWeek := startOfWeek(now)
+	daysSince := today.AddDate(0, 0, -int(days)+1)
+	weeksSince := thisWeek.AddDate(0, 0, -7*(int(weeks)-1))
+	heatmapSince := thisWeek.AddDate(0, 0, -7*(StatsHeatmapWeeks-1))
+
+	totals, err := s.db.GetUserTodoTotals(email, uint64(now.Unix()), now.Location())
+	if err != nil {
+		return nil, err
+	}
+
+	// Days of the heatmap and of the daily chart are retrieved at once
+	dailySince := heatmapSince
+	if daysSince.Before(dailySince) {
+		dailySince = daysSince
+	}
+	daily, err := s.db.GetUserTodoActivity(email, uint64(dailySince.Unix()), now.Location(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	weekly, err := s.db.GetUserTodoActivity(email, uint64(weeksSince.Unix()), now.Location(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := s.db.GetUserGroupCompletionStats(email)
+	if err != nil {
+		return nil, err
+	}
+
+	completionDays, err := s.db.GetUserCompletionDays(email, now.Location())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Totals: totals,
+		Groups: groups,
+		Daily: activityBars(daily, daysSince, today, func(t time.Time) time.Time {
+			return t.AddDate(0, 0, 1)
+		}),
+		Weekly: activityBars(weekly, weeksSince, thisWeek, func(t time.Time) time.Time {
+			return t.AddDate(0, 0, 7)
+		}),
+	}
+	if totals.WithDue > 0 {
+		stats.OverdueRate = float64(totals.Overdue) * 100 / float64(totals.WithDue)
+	}
+	stats.CurrentStreak, stats.LongestStreak = completionStreaks(completionDays, today)
+
+	// Heatmap levels are relative to the most productive day
+	completed := make(map[string]uint64)
+	var mostCompleted uint64
+	for _, count := range daily {
+		completed[count.Period] = count.Completed
+		if count.Completed > mostCompleted {
+			mostCompleted = count.Completed
+		}
+	}
+	for week := 0; week < StatsHeatmapWeeks; week++ {
+		var heatmapWeek []*HeatmapDay
+		for weekday := 0; weekday < 7; weekday++ {
+			date := heatmapSince.AddDate(0, 0, week*7+weekday)
+			day := &HeatmapDay{
+				Date:      date.Format(time.DateOnly),
+				Completed: completed[date.Format(time.DateOnly)],
+				Future:    date.After(today),
+			}
+			if day.Completed > 0 {
+				day.Level = uint8(1 + (day.Completed-1)*4/mostCompleted)
+			}
+			heatmapWeek = append(heatmapWeek, day)
+		}
+		stats.Heatmap = append(stats.Heatmap, heatmapWeek)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,523 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"Unbewohnte/dela/i18n"
+	"Unbewohnte/dela/logger"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	SyncMutationCreate string = "create"
+	SyncMutationUpdate string = "update"
+	SyncMutationDelete string = "delete"
+)
+
+const (
+	// The mutation was applied now or before
+	SyncStatusApplied string = "applied"
+	// The TODO was deleted, so the mutation could not be applied
+	SyncStatusConflict string = "conflict"
+	// The mutation is invalid and will never be applied
+	SyncStatusRejected string = "rejected"
+)
+
+const (
+	// How many mutations can be sent at once
+	MaxSyncMutations int = 500
+	// Clients generate mutation IDs themselves, usually as UUIDs
+	MaxSyncMutationIDLength int = 64
+	// How long results of applied mutations are kept for resent ones
+	SyncMutationRetention time.Duration = time.Hour * 24 * 30
+)
+
+/*
+A change of a TODO made by a client, possibly while offline. Mutations are applied in
+the order they are received; fields of an update overwrite only the same fields of
+the TODO, so the last received value of a field wins. Deletion wins over any update
+*/
+type TodoMutation struct {
+	// Unique among mutations of the user. Mutations with an already applied ID are not applied again
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// TODO to update or delete
+	TodoID uint64 `json:"todoId"`
+	// Fields of the TODO to create or to change. Same fields as of a TODO update
+	Todo json.RawMessage `json:"todo"`
+}
+
+// What happened to a mutation
+type TodoMutationResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Created, updated or deleted TODO
+	TodoID uint64 `json:"todoId"`
+	Reason string `json:"reason,omitempty"`
+}
+
+const (
+	// How many changes are returned at once unless asked otherwise
+	DefaultSyncLimit uint64 = 500
+	MaxSyncLimit     uint64 = 5000
+)
+
+// Changes of user's TODOs and groups since a cursor
+type SyncChanges struct {
+	// Pass as "since" to get later changes only
+	Cursor uint64 `json:"cursor"`
+	// Not all changes fit, more can be requested right away with the new cursor
+	More bool `json:"more"`
+	/*
+		The cursor is unknown to the server, ie: the database was restored from a backup.
+		All data is sent again and the client should drop what it has
+	*/
+	Reset bool `json:"reset"`
+	// Created or changed TODOs, including trashed and archived ones
+	Todos []*db.Todo `json:"todos"`
+	// Created or changed groups, including trashed ones
+	Groups []*db.TodoGroup `json:"groups"`
+	// IDs of permanently deleted TODOs and groups
+	DeletedTodos  []uint64 `json:"deletedTodos"`
+	DeletedGroups []uint64 `json:"deletedGroups"`
+}
+
+// Returns at most limit of user's changes made after since revision, earlier ones first
+func (s *Server) changesSince(email string, since uint64, limit uint64) (*SyncChanges, error) {
+	latest, err := s.db.GetSyncRevision()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := SyncChanges{
+		Cursor:        latest,
+		Todos:         []*db.Todo{},
+		Groups:        []*db.TodoGroup{},
+		DeletedTodos:  []uint64{},
+		DeletedGroups: []uint64{},
+	}
+	if since > latest {
+		since = 0
+		changes.Reset = true
+	}
+	if since == latest {
+		return &changes, nil
+	}
+
+	todos, err := s.db.GetUserTodosChangedSince(email, since, latest, limit)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.db.GetUserTodoGroupsChangedSince(email, since, latest, limit)
+	if err != nil {
+		return nil, err
+	}
+	deletedTodos, err := s.db.GetUserTodoTombstonesSince(email, since, latest, limit)
+	if err != nil {
+		return nil, err
+	}
+	deletedGroups, err := s.db.GetUserGroupTombstonesSince(email, since, latest, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		Each kind of change is limited separately. A kind that hit the limit may have more
+		changes right after its last one, so nothing later than that can be sent yet
+	*/
+	cutoff := latest
+	truncate := func(count int, lastRevision func() uint64) {
+		if count > 0 && uint64(count) >= limit && lastRevision() < cutoff {
+			cutoff = lastRevision()
+		}
+	}
+	truncate(len(todos), func() uint64 { return todos[len(todos)-1].Revision })
+	truncate(len(groups), func() uint64 { return groups[len(groups)-1].Revision })
+	truncate(len(deletedTodos), func() uint64 { return deletedTodos[len(deletedTodos)-1].Revision })
+	truncate(len(deletedGroups), func() uint64 { return deletedGroups[len(deletedGroups)-1].Revision })
+
+	type change struct {
+		revision uint64
+		add      func()
+	}
+	var all []change
+	for _, todo := range todos {
+		todo := todo
+		all = append(all, change{todo.Revision, func() {
+			// Images and files are fetched separately
+			todo.Image = nil
+			todo.File = nil
+			changes.Todos = append(changes.Todos, todo)
+		}})
+	}
+	for _, group := range groups {
+		group := group
+		all = append(all, change{group.Revision, func() { changes.Groups = append(changes.Groups, group) }})
+	}
+	for _, tombstone := range deletedTodos {
+		id := tombstone.ID
+		all = append(all, change{tombstone.Revision, func() { changes.DeletedTodos = append(changes.DeletedTodos, id) }})
+	}
+	for _, tombstone := range deletedGroups {
+		id := tombstone.ID
+		all = append(all, change{tombstone.Revision, func() { changes.DeletedGroups = append(changes.DeletedGroups, id) }})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].revision < all[j].revision
+	})
+
+	if cutoff < latest {
+		for len(all) > 0 && all[len(all)-1].revision > cutoff {
+			all = all[:len(all)-1]
+		}
+		changes.Cursor = cutoff
+		changes.More = true
+	}
+	if uint64(len(all)) > limit {
+		all = all[:limit]
+		changes.Cursor = all[len(all)-1].revision
+		changes.More = true
+	}
+	for _, change := range all {
+		change.add()
+	}
+
+	return &changes, nil
+}
+
+// Applies a single mutation of the user. Does not check whether it was applied before
+func (s *Server) applyTodoMutation(req *http.Request, email string, mutation TodoMutation) TodoMutationResult {
+	result := TodoMutationResult{
+		ID:     mutation.ID,
+		Status: SyncStatusApplied,
+		TodoID: mutation.TodoID,
+	}
+	reject := func(reason string) TodoMutationResult {
+		result.Status = SyncStatusRejected
+		result.Reason = reason
+		return result
+	}
+
+	switch mutation.Type {
+	case SyncMutationCreate:
+		var newTodo db.Todo
+		err := json.Unmarshal(mutation.Todo, &newTodo)
+		if err != nil {
+			return reject("Invalid TODO JSON")
+		}
+		err = applyDueInput(mutation.Todo, &newTodo, s.userLocale(email, i18n.ENG).Location)
+		if err != nil {
+			return reject(err.Error())
+		}
+
+		if uint(len([]rune(newTodo.Text))) > MaxTodoTextLength {
+			return reject(fmt.Sprintf("Text must be less than %d characters long", MaxTodoTextLength))
+		}
+		if ok, reason := IsTodoValid(newTodo); !ok {
+			return reject(reason)
+		}
+		if newTodo.GroupID == 0 || !s.db.DoesUserOwnGroup(newTodo.GroupID, email) {
+			return reject("You do not own this group")
+		}
+		if s.db.IsTodoGroupInTrash(newTodo.GroupID) {
+			return reject("This group is in the trash")
+		}
+
+		newTodo = db.Todo{
+			GroupID:       newTodo.GroupID,
+			Text:          newTodo.Text,
+			DueUnix:       newTodo.DueUnix,
+			DueHasTime:    newTodo.DueHasTime,
+			Priority:      newTodo.Priority,
+			RecurUnit:     newTodo.RecurUnit,
+			RecurInterval: newTodo.RecurInterval,
+			IsDone:        newTodo.IsDone,
+			OwnerEmail:    email,
+		}
+		newTodo.TimeCreatedUnix = uint64(time.Now().Unix())
+		if newTodo.IsDone {
+			newTodo.CompletionTimeUnix = newTodo.TimeCreatedUnix
+		}
+
+		newTodo.ID, err = s.db.CreateTodo(newTodo)
+		if err != nil {
+			logger.Error("[Server][Sync] Failed to create %s's TODO: %s", email, err)
+			return reject("Failed to create TODO")
+		}
+		s.audit(req, email, "todo.create", AuditTargetTodo, newTodo.ID, nil, newTodo)
+		result.TodoID = newTodo.ID
+
+	case SyncMutationUpdate:
+		if !s.db.DoesUserOwnTodo(mutation.TodoID, email) {
+			result.Status = SyncStatusConflict
+			result.Reason = "The TODO was deleted"
+			return result
+		}
+
+		todoBefore, err := s.db.GetTodo(mutation.TodoID)
+		if err != nil {
+			logger.Error("[Server][Sync] Failed to get TODO %d: %s", mutation.TodoID, err)
+			return reject("Can't access this TODO")
+		}
+		if todoBefore.DeletedAtUnix != 0 {
+			result.Status = SyncStatusConflict
+			result.Reason = "The TODO is in the trash"
+			return result
+		}
+
+		// Only the sent fields change
+		updatedTodo := *todoBefore
+		err = json.Unmarshal(mutation.Todo, &updatedTodo)
+		if err != nil {
+			return reject("Invalid TODO JSON")
+		}
+		err = applyDueInput(mutation.Todo, &updatedTodo, s.userLocale(email, i18n.ENG).Location)
+		if err != nil {
+			return reject(err.Error())
+		}
+
+		if uint(len([]rune(updatedTodo.Text))) > MaxTodoTextLength {
+			return reject(fmt.Sprintf("Text must be less than %d characters long", MaxTodoTextLength))
+		}
+		if ok, reason := IsTodoValid(updatedTodo); !ok {
+			return reject(reason)
+		}
+		if updatedTodo.GroupID != todoBefore.GroupID && !s.db.DoesUserOwnGroup(updatedTodo.GroupID, email) {
+			return reject("You do not own this group")
+		}
+		if updatedTodo.GroupID != todoBefore.GroupID && s.db.IsTodoGroupInTrash(updatedTodo.GroupID) {
+			return reject("This group is in the trash")
+		}
+		if updatedTodo.IsDone && !todoBefore.IsDone && updatedTodo.CompletionTimeUnix == todoBefore.CompletionTimeUnix {
+			updatedTodo.CompletionTimeUnix = uint64(time.Now().Unix())
+		}
+		updatedTodo.Image = nil
+		updatedTodo.File = nil
+
+		err = s.db.UpdateTodoSoft(mutation.TodoID, updatedTodo)
+		if err != nil {
+			logger.Error("[Server][Sync] Failed to update TODO %d: %s", mutation.TodoID, err)
+			return reject("Failed to update")
+		}
+
+		todoAfter, err := s.db.GetTodo(mutation.TodoID)
+		if err == nil {
+			s.audit(req, email, "todo.update", AuditTargetTodo, mutation.TodoID, todoBefore, todoAfter)
+			if todoAfter.IsDone && !todoBefore.IsDone {
+				s.scheduleNextOccurrence(req, todoAfter)
+			}
+		}
+
+	case SyncMutationDelete:
+		if !s.db.DoesUserOwnTodo(mutation.TodoID, email) {
+			// Already deleted
+			return result
+		}
+
+		todoBefore, err := s.db.GetTodo(mutation.TodoID)
+		if err != nil {
+			logger.Error("[Server][Sync] Failed to get TODO %d: %s", mutation.TodoID, err)
+			return reject("Can't access this TODO")
+		}
+		if todoBefore.DeletedAtUnix != 0 {
+			return result
+		}
+
+		err = s.db.SoftDeleteTodo(mutation.TodoID, uint64(time.Now().Unix()))
+		if err != nil {
+			logger.Error("[Server][Sync] Failed to delete TODO %d: %s", mutation.TodoID, err)
+			return reject("Failed to delete TODO")
+		}
+		s.audit(req, email, "todo.delete", AuditTargetTodo, mutation.TodoID, todoBefore, nil)
+
+	default:
+		return reject("Unknown mutation type")
+	}
+
+	return result
+}
+
+// Applies the mutation unless it was applied before. Returns the result of the first application for resent ones
+func (s *Server) applyTodoMutationOnce(req *http.Request, email string, mutation TodoMutation) TodoMutationResult {
+	if mutation.ID == "" || len(mutation.ID) > MaxSyncMutationIDLength {
+		return TodoMutationResult{
+			ID:     mutation.ID,
+			Status: SyncStatusRejected,
+			Reason: fmt.Sprintf("Mutation ID must be from 1 to %d characters long", MaxSyncMutationIDLength),
+		}
+	}
+
+	savedResult, err := s.db.GetSyncMutationResult(email, mutation.ID)
+	if err == nil {
+		var result TodoMutationResult
+		err = json.Unmarshal([]byte(savedResult), &result)
+		if err == nil {
+			return result
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("[Server][Sync] Failed to look up mutation %s of %s: %s", mutation.ID, email, err)
+	}
+
+	result := s.applyTodoMutation(req, email, mutation)
+
+	resultBytes, err := json.Marshal(result)
+	if err == nil {
+		err = s.db.SaveSyncMutationResult(email, mutation.ID, string(resultBytes), uint64(time.Now().Unix()))
+	}
+	if err != nil {
+		logger.Error("[Server][Sync] Failed to save result of mutation %s of %s: %s", mutation.ID, email, err)
+	}
+
+	return result
+}
+
+// Returns changes of user's TODOs and groups made after the "since" cursor
+func (s *Server) EndpointSync(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	var since uint64 = 0
+	var err error
+	if sinceStr := req.URL.Query().Get("since"); sinceStr != "" {
+		since, err = strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := DefaultSyncLimit
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.ParseUint(limitStr, 10, 64)
+		if err != nil || limit == 0 || limit > MaxSyncLimit {
+			http.Error(w, fmt.Sprintf("Limit must be from 1 to %d", MaxSyncLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := s.changesSince(GetEmailFromReq(req), since, limit)
+	if err != nil {
+		logger.Error("[Server][EndpointSync] Failed to get changes of %s since %d: %s", GetEmailFromReq(req), since, err)
+		http.Error(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+
+	changesBytes, err := json.Marshal(changes)
+	if err != nil {
+		logger.Error("[Server][EndpointSync] Failed to marshal changes: %s", err)
+		http.Error(w, "Failed to get changes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(changesBytes)
+}
+
+// Applies a batch of TODO mutations made by a client in order
+func (s *Server) EndpointTodoSync(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsUserAuthorizedReq(req, s.db) {
+		http.Error(w, "Invalid user auth data", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Warning("[Server][EndpointTodoSync] Failed to read request body: %s", err)
+		http.Error(w, "Failed to read body", http.StatusInternalServerError)
+		return
+	}
+
+	var batch struct {
+		Mutations []TodoMutation `json:"mutations"`
+	}
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		http.Error(w, "Invalid mutations JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(batch.Mutations) > MaxSyncMutations {
+		http.Error(w, fmt.Sprintf("Too many mutations! At most %d can be sent at once", MaxSyncMutations), http.StatusBadRequest)
+		return
+	}
+
+	email := GetEmailFromReq(req)
+
+	// Resent batches must not race with the first ones
+	s.syncMutex.Lock()
+	results := []TodoMutationResult{}
+	for _, mutation := range batch.Mutations {
+		results = append(results, s.applyTodoMutationOnce(req, email, mutation))
+	}
+	s.syncMutex.Unlock()
+
+	resultsBytes, err := json.Marshal(struct {
+		Results []TodoMutationResult `json:"results"`
+	}{results})
+	if err != nil {
+		logger.Error("[Server][EndpointTodoSync] Failed to marshal results: %s", err)
+		http.Error(w, "Failed to apply mutations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resultsBytes)
+	logger.Info("[Server][EndpointTodoSync] Applied %d mutations of %s", len(results), email)
+}
+
+// Periodically forgets results of mutations old enough to never be resent
+func (s *Server) StartSyncRetentionRoutine(delay time.Duration) {
+	logger.Info("[Server][Sync Routine] Sync Routine Started!")
+
+	for {
+		deleted, err := s.db.DeleteSyncMutationsOlderThan(uint64(time.Now().Add(-SyncMutationRetention).Unix()))
+		if err != nil {
+			logger.Error("[Server][Sync Routine] Failed to delete old mutation results: %s", err)
+		} else if deleted > 0 {
+			logger.Info("[Server][Sync Routine] Forgot %d old mutation results", deleted)
+		}
+
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/db"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTodoSync(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_sync_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	s := &Server{db: dbase}
+
+	email := "user1@mail.ru"
+	groupID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	todoID, err := dbase.CreateTodo(db.Todo{GroupID: groupID, Text: "original", Priority: db.PriorityHigh, OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/todo/sync", nil)
+	apply := func(mutation TodoMutation) TodoMutationResult {
+		return s.applyTodoMutationOnce(req, email, mutation)
+	}
+	fields := func(value string) json.RawMessage {
+		return json.RawMessage(value)
+	}
+
+	created := apply(TodoMutation{ID: "create", Type: SyncMutationCreate, Todo: fields(`{"text":"offline","groupId":1}`)})
+	if created.Status != SyncStatusApplied || created.TodoID == 0 {
+		t.Fatalf("expected the TODO to be created, got %+v", created)
+	}
+
+	// Resending does not create another one
+	resent := apply(TodoMutation{ID: "create", Type: SyncMutationCreate, Todo: fields(`{"text":"offline","groupId":1}`)})
+	if resent != created {
+		t.Fatalf("resent mutation must give the same result, got %+v", resent)
+	}
+	todos, _ := dbase.GetAllUserTodos(email)
+	if len(todos) != 2 {
+		t.Fatalf("expected 2 TODOs, got %d", len(todos))
+	}
+
+	// Only the sent fields change
+	result := apply(TodoMutation{ID: "update", Type: SyncMutationUpdate, TodoID: todoID, Todo: fields(`{"text":"edited"}`)})
+	if result.Status != SyncStatusApplied {
+		t.Fatalf("expected the update to be applied, got %+v", result)
+	}
+	todo, _ := dbase.GetTodo(todoID)
+	if todo.Text != "edited" || todo.Priority != db.PriorityHigh {
+		t.Fatalf("expected only the text to change, got %+v", todo)
+	}
+
+	// Deletion wins over later updates
+	apply(TodoMutation{ID: "delete", Type: SyncMutationDelete, TodoID: todoID})
+	result = apply(TodoMutation{ID: "late update", Type: SyncMutationUpdate, TodoID: todoID, Todo: fields(`{"text":"late"}`)})
+	if result.Status != SyncStatusConflict {
+		t.Fatalf("expected a conflict with the deletion, got %+v", result)
+	}
+
+	for _, invalid := range []TodoMutation{
+		{ID: "", Type: SyncMutationCreate, Todo: fields(`{"text":"no id","groupId":1}`)},
+		{ID: "foreign group", Type: SyncMutationCreate, Todo: fields(`{"text":"x","groupId":100}`)},
+		{ID: "bad priority", Type: SyncMutationUpdate, TodoID: created.TodoID, Todo: fields(`{"priority":10}`)},
+		{ID: "unknown", Type: "rename", TodoID: created.TodoID},
+	} {
+		result = apply(invalid)
+		if result.Status != SyncStatusRejected {
+			t.Errorf("expected %q to be rejected, got %+v", invalid.ID, result)
+		}
+	}
+
+	changes, err := s.changesSince(email, 0, DefaultSyncLimit)
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err)
+	}
+	if len(changes.Todos) != 2 || changes.Todos[0].ID != created.TodoID || changes.Todos[1].DeletedAtUnix == 0 {
+		t.Fatalf("expected the created and the trashed TODOs latest last, got %+v", changes.Todos)
+	}
+	if len(changes.Groups) != 1 || changes.More {
+		t.Fatalf("expected the group and no more changes, got %+v", changes)
+	}
+
+	later, err := s.changesSince(email, changes.Cursor, DefaultSyncLimit)
+	if err != nil || len(later.Todos) != 0 || len(later.DeletedTodos) != 0 || later.Cursor != changes.Cursor {
+		t.Fatalf("expected no changes after the cursor, got %+v (%v)", later, err)
+	}
+
+	// Permanent deletions are reported once the limit lets them through
+	err = dbase.DeleteTodo(todoID)
+	if err != nil {
+		t.Fatalf("failed to delete TODO: %s", err)
+	}
+
+	var deleted []uint64
+	cursor := uint64(0)
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("changes never end")
+		}
+
+		page, err := s.changesSince(email, cursor, 1)
+		if err != nil {
+			t.Fatalf("failed to get changes: %s", err)
+		}
+		if len(page.Todos)+len(page.Groups)+len(page.DeletedTodos) > 1 {
+			t.Fatalf("expected at most one change, got %+v", page)
+		}
+		deleted = append(deleted, page.DeletedTodos...)
+		cursor = page.Cursor
+		if !page.More {
+			break
+		}
+	}
+	if len(deleted) != 1 || deleted[0] != todoID {
+		t.Fatalf("expected TODO %d to be deleted, got %v", todoID, deleted)
+	}
+
+	// Cursors from the future mean the database was replaced
+	reset, err := s.changesSince(email, cursor+100, DefaultSyncLimit)
+	if err != nil || !reset.Reset || len(reset.Todos) != 1 {
+		t.Fatalf("expected everything to be sent again, got %+v (%v)", reset, err)
+	}
+}
+
+func TestSyncChangesPaging(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_sync_paging_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase}
+
+	// Only TODOs change, so no other kind of change shows that the page is full
+	email := "user1@mail.ru"
+	var todoIDs []uint64
+	for i := 0; i < 3; i++ {
+		todoID, err := dbase.CreateTodo(db.Todo{GroupID: 1, Text: "todo", OwnerEmail: email})
+		if err != nil {
+			t.Fatalf("couldn't create a new TODO: %s", err)
+		}
+		todoIDs = append(todoIDs, todoID)
+	}
+
+	for _, limit := range []uint64{1, 2, 3} {
+		var received []uint64
+		cursor := uint64(0)
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("changes never end with limit %d", limit)
+			}
+
+			page, err := s.changesSince(email, cursor, limit)
+			if err != nil {
+				t.Fatalf("failed to get changes: %s", err)
+			}
+			if uint64(len(page.Todos)) > limit {
+				t.Fatalf("expected at most %d changes, got %d", limit, len(page.Todos))
+			}
+			for _, todo := range page.Todos {
+				received = append(received, todo.ID)
+			}
+			cursor = page.Cursor
+			if !page.More {
+				break
+			}
+		}
+
+		if len(received) != len(todoIDs) {
+			t.Fatalf("expected TODOs %v with limit %d, got %v", todoIDs, limit, received)
+		}
+		for i := range todoIDs {
+			if received[i] != todoIDs[i] {
+				t.Fatalf("expected TODOs %v with limit %d, got %v", todoIDs, limit, received)
+			}
+		}
+	}
+}
+
+func TestSyncTrashedGroup(t *testing.T) {
+	dbPath := filepath.Join(os.TempDir(), "dela_sync_trash_test.db")
+	defer os.Remove(dbPath)
+
+	dbase, err := db.Create(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	defer dbase.Close()
+	s := &Server{db: dbase}
+
+	email := "user1@mail.ru"
+	groupID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "group1", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	trashedID, err := dbase.CreateTodoGroup(db.TodoGroup{Name: "trashed", OwnerEmail: email, Removable: true})
+	if err != nil {
+		t.Fatalf("failed to create todo group: %s", err)
+	}
+	todoID, err := dbase.CreateTodo(db.Todo{GroupID: groupID, Text: "todo", OwnerEmail: email})
+	if err != nil {
+		t.Fatalf("couldn't create a new TODO: %s", err)
+	}
+
+	err = dbase.SoftDeleteTodoGroup(trashedID, 1)
+	if err != nil {
+		t.Fatalf("failed to trash group: %s", err)
+	}
+	if !dbase.IsTodoGroupInTrash(trashedID) || dbase.IsTodoGroupInTrash(groupID) {
+		t.Fatalf("expected only group %d to be in the trash", trashedID)
+	}
+
+	// Emptying the trash would take them with the group
+	req := httptest.NewRequest("POST", "/api/todo/sync", nil)
+	for _, mutation := range []TodoMutation{
+		{ID: "create", Type: SyncMutationCreate, Todo: json.RawMessage(fmt.Sprintf(`{"text":"x","groupId":%d}`, trashedID))},
+		{ID: "move", Type: SyncMutationUpdate, TodoID: todoID, Todo: json.RawMessage(fmt.Sprintf(`{"groupId":%d}`, trashedID))},
+	} {
+		result := s.applyTodoMutationOnce(req, email, mutation)
+		if result.Status != SyncStatusRejected {
+			t.Errorf("expected %q into a trashed group to be rejected, got %+v", mutation.ID, result)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+/*
+  	dela - web TODO list
+    Copyright (C) 2025  Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Affero General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Affero General Public License for more details.
+
+    You should have received a copy of the GNU Affero General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"Unbewohnte/dela/logger"
+	"time"
+)
+
+// Periodically deletes TODOs and groups that have been in the trash longer than configured retention period
+func (s *Server) StartTrashPurgeRoutine(delay time.Duration) {
+	if s.config.TrashRetentionDays == 0 {
+		logger.Info("[Server][Trash Routine] Deleted TODOs are kept in the trash forever")
+		return
+	}
+
+	logger.Info("[Server][Trash Routine] Trash Routine Started!")
+
+	retention := time.Hour * 24 * time.Duration(s.config.TrashRetentionDays)
+	for {
+		purged, err := s.db.PurgeDeleted(uint64(time.Now().Add(-retention).Unix()))
+		if err != nil {
+			logger.Error("[Server][Trash Routine] Failed to purge the trash: %s", err)
+		} else if purged > 0 {
+			logger.Info("[Server][Trash Routine] Permanently deleted %d TODOs and groups older than %d days", purged, s.config.TrashRetentionDays)
+		}
+
+		time.Sleep(delay)
+	}
+}
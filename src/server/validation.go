@@ -35,6 +35,10 @@ const (
 	MaxPasswordLength     uint = 100
 	MaxTodoTextLength     uint = 250
 	MaxTodoFileSizeBytes  uint = 3145728 // 3MB
+	ResetPasswordLength   uint = 12
+	// Password reset links
+	PasswordResetTokenLength uint   = 32
+	PasswordResetLifeSeconds uint64 = 60 * 60 * 24
 )
 
 // Check if user is valid. Returns false and a reason-string if not
@@ -46,16 +50,40 @@ func IsUserValid(user db.User) (bool, string) {
 		return false, fmt.Sprintf("Email is too big; Email should be up to %d characters", MaxEmailLength)
 	}
 
-	if uint(len([]rune(user.Password))) < MinimalPasswordLength {
+	return IsPasswordValid(user.Password)
+}
+
+// Check if password is of acceptable length. Returns false and a reason-string if not
+func IsPasswordValid(password string) (bool, string) {
+	if uint(len([]rune(password))) < MinimalPasswordLength {
 		return false, "Password is too small"
 	}
-	if uint(len([]rune(user.Password))) > MaxPasswordLength {
+	if uint(len([]rune(password))) > MaxPasswordLength {
 		return false, fmt.Sprintf("Password is too big; Password should be up to %d characters", MaxPasswordLength)
 	}
 
 	return true, ""
 }
 
+// Check if TODO's priority and recurrence are valid. Returns false and a reason-string if not
+func IsTodoValid(todo db.Todo) (bool, string) {
+	if todo.Priority > db.PriorityHigh {
+		return false, fmt.Sprintf("Priority must be from %d to %d", db.PriorityNone, db.PriorityHigh)
+	}
+
+	switch todo.RecurUnit {
+	case db.RecurNone:
+	case db.RecurDay, db.RecurWeek, db.RecurMonth, db.RecurYear:
+		if todo.RecurInterval == 0 || todo.RecurInterval > MaxTodoRecurInterval {
+			return false, fmt.Sprintf("Recurrence interval must be from 1 to %d", MaxTodoRecurInterval)
+		}
+	default:
+		return false, "Unknown recurrence unit"
+	}
+
+	return true, ""
+}
+
 // Checks if such user exists, passwords match and email is confirmed. Returns true if such user exists, passwords do match and email was verified
 func IsUserAuthorized(db *db.DB, user db.User) bool {
 	userDB, err := db.GetUser(user.Email)
@@ -67,6 +95,10 @@ func IsUserAuthorized(db *db.DB, user db.User) bool {
 		return false
 	}
 
+	if userDB.Disabled {
+		return false
+	}
+
 	if userDB.Password != user.Password {
 		return false
 	}
@@ -112,6 +144,20 @@ func IsUserAuthorizedReq(req *http.Request, dbase *db.DB) bool {
 	})
 }
 
+// Checks if the user from request is authorized and has administrator role
+func IsUserAdminReq(req *http.Request, dbase *db.DB) bool {
+	if !IsUserAuthorizedReq(req, dbase) {
+		return false
+	}
+
+	user, err := dbase.GetUser(GetEmailFromReq(req))
+	if err != nil {
+		return false
+	}
+
+	return user.IsAdmin()
+}
+
 // Returns email value from basic auth or from cookie if the former does not exist
 func GetEmailFromReq(req *http.Request) string {
 	email, _, ok := req.BasicAuth()